@@ -79,6 +79,8 @@ func overrideVSphereClusterSpecFieldsFuncs(runtimeserializer.CodecFactory) []int
 			c.FuzzNoCustom(in)
 			in.ClusterModules = nil
 			in.FailureDomainSelector = nil
+			in.ServerRef = ""
+			in.CABundleRef = nil
 		},
 	}
 }
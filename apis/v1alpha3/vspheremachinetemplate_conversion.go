@@ -43,12 +43,23 @@ func (src *VSphereMachineTemplate) ConvertTo(dstRaw conversion.Hub) error {
 	dst.Spec.Template.Spec.AdditionalDisksGiB = restored.Spec.Template.Spec.AdditionalDisksGiB
 	dst.Spec.Template.Spec.PowerOffMode = restored.Spec.Template.Spec.PowerOffMode
 	dst.Spec.Template.Spec.GuestSoftPowerOffTimeout = restored.Spec.Template.Spec.GuestSoftPowerOffTimeout
+	dst.Spec.Template.Spec.Adopt = restored.Spec.Template.Spec.Adopt
+	dst.Spec.Template.Spec.InstantCloneParents = restored.Spec.Template.Spec.InstantCloneParents
+	dst.Spec.Template.Spec.ContentLibraryItem = restored.Spec.Template.Spec.ContentLibraryItem
+	dst.Spec.Template.Spec.DataDisks = restored.Spec.Template.Spec.DataDisks
+	dst.Spec.Template.Spec.ResizePolicy = restored.Spec.Template.Spec.ResizePolicy
+	dst.Spec.Template.Spec.CPUAllocation = restored.Spec.Template.Spec.CPUAllocation
+	dst.Spec.Template.Spec.MemoryAllocation = restored.Spec.Template.Spec.MemoryAllocation
+	dst.Spec.Template.Spec.DriftPolicy = restored.Spec.Template.Spec.DriftPolicy
+	dst.Spec.Template.Spec.DatastoreCluster = restored.Spec.Template.Spec.DatastoreCluster
+	dst.Spec.Template.Spec.DatastoreSelectionPolicy = restored.Spec.Template.Spec.DatastoreSelectionPolicy
 	for i := range dst.Spec.Template.Spec.Network.Devices {
 		dst.Spec.Template.Spec.Network.Devices[i].AddressesFromPools = restored.Spec.Template.Spec.Network.Devices[i].AddressesFromPools
 		dst.Spec.Template.Spec.Network.Devices[i].DHCP4Overrides = restored.Spec.Template.Spec.Network.Devices[i].DHCP4Overrides
 		dst.Spec.Template.Spec.Network.Devices[i].DHCP6Overrides = restored.Spec.Template.Spec.Network.Devices[i].DHCP6Overrides
 		dst.Spec.Template.Spec.Network.Devices[i].SkipIPAllocation = restored.Spec.Template.Spec.Network.Devices[i].SkipIPAllocation
 	}
+	dst.Status = restored.Status
 
 	return nil
 }
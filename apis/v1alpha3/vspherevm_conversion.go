@@ -39,7 +39,26 @@ func (src *VSphereVM) ConvertTo(dstRaw conversion.Hub) error {
 	dst.Spec.AdditionalDisksGiB = restored.Spec.AdditionalDisksGiB
 	dst.Spec.PowerOffMode = restored.Spec.PowerOffMode
 	dst.Spec.GuestSoftPowerOffTimeout = restored.Spec.GuestSoftPowerOffTimeout
+	dst.Spec.InstantCloneParents = restored.Spec.InstantCloneParents
+	dst.Spec.ContentLibraryItem = restored.Spec.ContentLibraryItem
+	dst.Spec.DataDisks = restored.Spec.DataDisks
+	dst.Spec.ResizePolicy = restored.Spec.ResizePolicy
+	dst.Spec.CPUAllocation = restored.Spec.CPUAllocation
+	dst.Spec.MemoryAllocation = restored.Spec.MemoryAllocation
+	dst.Spec.DriftPolicy = restored.Spec.DriftPolicy
+	dst.Spec.DatastoreCluster = restored.Spec.DatastoreCluster
+	dst.Spec.DatastoreSelectionPolicy = restored.Spec.DatastoreSelectionPolicy
+	dst.Spec.SnapshotPolicy = restored.Spec.SnapshotPolicy
+	dst.Spec.RollbackToSnapshot = restored.Spec.RollbackToSnapshot
+	dst.Spec.Adopt = restored.Spec.Adopt
 	dst.Status.Host = restored.Status.Host
+	dst.Status.HostRef = restored.Status.HostRef
+	dst.Status.InstantCloneParent = restored.Status.InstantCloneParent
+	dst.Status.ContentLibraryItemVersion = restored.Status.ContentLibraryItemVersion
+	dst.Status.DataDisks = restored.Status.DataDisks
+	dst.Status.Snapshots = restored.Status.Snapshots
+	dst.Status.RolledBackSnapshot = restored.Status.RolledBackSnapshot
+	dst.Status.DatastoreSelection = restored.Status.DatastoreSelection
 	for i := range dst.Spec.Network.Devices {
 		dst.Spec.Network.Devices[i].AddressesFromPools = restored.Spec.Network.Devices[i].AddressesFromPools
 		dst.Spec.Network.Devices[i].DHCP4Overrides = restored.Spec.Network.Devices[i].DHCP4Overrides
@@ -40,6 +40,17 @@ func (src *VSphereMachine) ConvertTo(dstRaw conversion.Hub) error {
 	dst.Spec.TagIDs = restored.Spec.TagIDs
 	dst.Spec.PowerOffMode = restored.Spec.PowerOffMode
 	dst.Spec.GuestSoftPowerOffTimeout = restored.Spec.GuestSoftPowerOffTimeout
+	dst.Spec.Adopt = restored.Spec.Adopt
+	dst.Spec.InstantCloneParents = restored.Spec.InstantCloneParents
+	dst.Spec.ContentLibraryItem = restored.Spec.ContentLibraryItem
+	dst.Spec.DataDisks = restored.Spec.DataDisks
+	dst.Spec.ResizePolicy = restored.Spec.ResizePolicy
+	dst.Spec.CPUAllocation = restored.Spec.CPUAllocation
+	dst.Spec.MemoryAllocation = restored.Spec.MemoryAllocation
+	dst.Spec.DriftPolicy = restored.Spec.DriftPolicy
+	dst.Spec.DatastoreCluster = restored.Spec.DatastoreCluster
+	dst.Spec.DatastoreSelectionPolicy = restored.Spec.DatastoreSelectionPolicy
+	dst.Status.DataDisks = restored.Status.DataDisks
 	for i := range dst.Spec.Network.Devices {
 		dst.Spec.Network.Devices[i].AddressesFromPools = restored.Spec.Network.Devices[i].AddressesFromPools
 		dst.Spec.Network.Devices[i].DHCP4Overrides = restored.Spec.Network.Devices[i].DHCP4Overrides
@@ -75,6 +75,22 @@ const (
 	// are automatically re-tried by the controller.
 	CloningFailedReason = "CloningFailed"
 
+	// InstantCloneFailedReason (Severity=Warning) documents a VSphereVM whose instant clone failed; the
+	// VM is then fully cloned from its template.
+	InstantCloneFailedReason = "InstantCloneFailed"
+
+	// DeployingContentLibraryItemReason (Severity=Info) documents a VSphereMachine/VSphereVM waiting for
+	// the deployment of its Content Library item, which runs in the background, before it is cloned.
+	DeployingContentLibraryItemReason = "DeployingContentLibraryItem"
+
+	// WaitingForVCenterCapacityReason (Severity=Info) documents a VSphereMachine/VSphereVM waiting for the
+	// capacity of its vCenter server to start the clone or the destroy operation.
+	WaitingForVCenterCapacityReason = "WaitingForVCenterCapacity"
+
+	// ResourceNotAllowedReason (Severity=Error) documents a VSphereMachine/VSphereVM targeting a vSphere
+	// inventory object which is not allowed by the AllowedResources of the VSphereClusterIdentity of its cluster.
+	ResourceNotAllowedReason = "ResourceNotAllowed"
+
 	// PoweringOnReason documents (Severity=Info) a VSphereMachine/VSphereVM currently executing the power on sequence.
 	PoweringOnReason = "PoweringOn"
 
@@ -83,6 +99,14 @@ const (
 	// are automatically re-tried by the controller.
 	PoweringOnFailedReason = "PoweringOnFailed"
 
+	// AdoptingReason documents (Severity=Info) a VSphereMachine/VSphereVM currently adopting an existing VM.
+	AdoptingReason = "Adopting"
+
+	// AdoptionFailedReason (Severity=Error) documents a VSphereMachine/VSphereVM controller failing to adopt
+	// an existing VM, e.g. because it does not exist, does not match the spec or is already adopted by another
+	// VSphereVM; a user intervention might be required to fix the problem.
+	AdoptionFailedReason = "AdoptionFailed"
+
 	// NotFoundByBIOSUUIDReason (Severity=Warning) documents a VSphereVM which can't be found by BIOS UUID.
 	// Those kind of errors could be transient sometimes and failed VSphereVM are automatically
 	// reconciled by the controller.
@@ -114,7 +138,7 @@ const (
 )
 
 // Conditions and Reasons related to utilizing a VSphereIdentity to make connections to a VCenter.
-// Can currently be used by VSphereCluster and VSphereVM.
+// Can currently be used by VSphereCluster, VSphereVM and VSphereServer.
 const (
 	// VCenterAvailableCondition documents the connectivity with vcenter
 	// for a given resource.
@@ -123,6 +147,11 @@ const (
 	// VCenterUnreachableReason (Severity=Error) documents a controller detecting
 	// issues with VCenter reachability.
 	VCenterUnreachableReason = "VCenterUnreachable"
+
+	// VSphereServerMisconfiguredReason (Severity=Error) documents a controller detecting
+	// that the VSphereServer referenced by an object cannot be found, or conflicts with
+	// the connection settings of the object.
+	VSphereServerMisconfiguredReason = "VSphereServerMisconfigured"
 )
 
 const (
@@ -156,6 +185,40 @@ const (
 
 	// SecretAlreadyInUseReason is used when another VSphereClusterIdentity is using the secret.
 	SecretAlreadyInUseReason = "SecretInUse"
+
+	// SecretInvalidReason is used when the secret referenced by the VSphereClusterIdentity holds a TLS keypair
+	// which cannot be used to authenticate with the vCenter server.
+	SecretInvalidReason = "SecretInvalid"
+)
+
+const (
+	// CredentialsRotatedCondition documents the last rotation of the vCenter
+	// credentials of a VSphereClusterIdentity or a VSphereCluster detected by
+	// the controllers. It is only set once the credentials were rotated, and its
+	// last transition time is the time of the last rotation.
+	CredentialsRotatedCondition clusterv1.ConditionType = "CredentialsRotated"
+
+	// CredentialsRotationFailedReason (Severity=Warning) documents a
+	// VSphereCluster for which no vCenter session can be created with the
+	// rotated credentials.
+	CredentialsRotationFailedReason = "CredentialsRotationFailed"
+)
+
+const (
+	// PrivilegesSufficientCondition documents whether the user of the vCenter
+	// sessions of a VSphereCluster, or of the VSphereClusters using a
+	// VSphereClusterIdentity, has the privileges needed by CAPV on the
+	// inventory objects they use.
+	PrivilegesSufficientCondition clusterv1.ConditionType = "PrivilegesSufficient"
+
+	// PrivilegesMissingReason (Severity=Warning) documents a user missing
+	// privileges on some of the inventory objects. The missing privileges are
+	// listed in the message of the condition.
+	PrivilegesMissingReason = "PrivilegesMissing"
+
+	// PrivilegesCheckFailedReason (Severity=Warning) documents a failure to
+	// resolve the inventory objects or to fetch the privileges of the user.
+	PrivilegesCheckFailedReason = "PrivilegesCheckFailed"
 )
 
 const (
@@ -238,3 +301,118 @@ const (
 	// shutdown request fails.
 	GuestSoftPowerOffFailedReason = "GuestSoftPowerOffFailed"
 )
+
+const (
+	// ResizedCondition documents the in-place resize of the CPU, memory and disk
+	// of a VSphereVM with the InPlace resize policy, and the correction of the
+	// CPU and memory of a VSphereVM with the Correct drift policy.
+	ResizedCondition clusterv1.ConditionType = "Resized"
+
+	// ResizingReason (Severity=Info) documents a VSphereVM whose VM is being
+	// reconfigured with the new CPU, memory and disk.
+	ResizingReason = "Resizing"
+
+	// WaitingForPowerCycleReason (Severity=Info) documents a VSphereVM whose VM
+	// is being powered off, because the resize cannot be applied while the VM
+	// is running.
+	WaitingForPowerCycleReason = "WaitingForPowerCycle"
+
+	// ResizeFailedReason (Severity=Warning) documents a VSphereVM whose VM could
+	// not be resized.
+	ResizeFailedReason = "ResizeFailed"
+
+	// WaitingForSnapshotsRemovalReason (Severity=Info) documents a VSphereVM
+	// whose disk is not grown until the snapshots of its VM are removed, e.g.
+	// once their retention period expired, because vSphere cannot extend the
+	// disk of a VM with snapshots.
+	WaitingForSnapshotsRemovalReason = "WaitingForSnapshotsRemoval"
+)
+
+const (
+	// HostConnectedCondition documents the connection of the ESXi host running
+	// the VM of a VSphereVM to vCenter, as reported by the vCenter events.
+	HostConnectedCondition clusterv1.ConditionType = "HostConnected"
+
+	// HostDisconnectedReason (Severity=Warning) documents a VSphereVM whose VM
+	// is disconnected from vCenter together with its ESXi host.
+	HostDisconnectedReason = "HostDisconnected"
+)
+
+const (
+	// VMUninterruptedCondition documents that the VM of a VSphereVM was not
+	// restarted or reset by vSphere HA, as reported by the vCenter events.
+	VMUninterruptedCondition clusterv1.ConditionType = "VMUninterrupted"
+
+	// HARestartedReason (Severity=Warning) documents a VSphereVM whose VM was
+	// restarted by vSphere HA on another ESXi host after a host failure.
+	HARestartedReason = "HARestarted"
+
+	// HAResetReason (Severity=Warning) documents a VSphereVM whose VM was reset
+	// by the VM monitoring of vSphere HA because its guest stopped responding.
+	HAResetReason = "HAReset"
+)
+
+const (
+	// ConfigDriftedCondition documents the changes made in vSphere to the
+	// configuration of the VM of a VSphereVM, which make it differ from the
+	// VSphereVM. Unlike the other conditions, it is true when the VM drifted,
+	// and its message lists the fields which differ.
+	ConfigDriftedCondition clusterv1.ConditionType = "ConfigDrifted"
+
+	// DriftDetectedReason (Severity=Warning) documents a VSphereVM whose VM
+	// drifted with the Report drift policy.
+	DriftDetectedReason = "DriftDetected"
+
+	// DriftCorrectingReason (Severity=Info) documents a VSphereVM whose VM
+	// drifted and is being reverted to the VSphereVM with the Correct drift
+	// policy.
+	DriftCorrectingReason = "DriftCorrecting"
+
+	// RemediationRequestedReason (Severity=Warning) documents a VSphereVM whose
+	// VM drifted and whose Machine was marked for remediation with the
+	// Remediate drift policy.
+	RemediationRequestedReason = "RemediationRequested"
+)
+
+const (
+	// HostInServiceCondition documents that the ESXi host running the VM of a
+	// VSphereVM is neither entering nor in maintenance or quarantine mode.
+	HostInServiceCondition clusterv1.ConditionType = "HostInService"
+
+	// HostEnteringMaintenanceReason (Severity=Warning) documents a VSphereVM
+	// whose VM runs on an ESXi host entering maintenance mode, and whose Node
+	// is cordoned and drained.
+	HostEnteringMaintenanceReason = "HostEnteringMaintenance"
+
+	// HostInMaintenanceReason (Severity=Warning) documents a VSphereVM whose
+	// VM runs on an ESXi host in maintenance mode, and whose Node is cordoned
+	// and drained.
+	HostInMaintenanceReason = "HostInMaintenance"
+
+	// HostInQuarantineReason (Severity=Warning) documents a VSphereVM whose VM
+	// runs on an ESXi host in quarantine mode, and whose Node is cordoned and
+	// drained.
+	HostInQuarantineReason = "HostInQuarantine"
+)
+
+const (
+	// ReplicasReadyCondition documents that the VMs of a VSphereMachinePool
+	// are ready, and created from its current template.
+	ReplicasReadyCondition clusterv1.ConditionType = "ReplicasReady"
+
+	// ScalingUpReason (Severity=Info) documents a VSphereMachinePool creating
+	// VMs to reach its desired number of replicas.
+	ScalingUpReason = "ScalingUp"
+
+	// ScalingDownReason (Severity=Info) documents a VSphereMachinePool
+	// deleting VMs to reach its desired number of replicas.
+	ScalingDownReason = "ScalingDown"
+
+	// RollingUpdateInProgressReason (Severity=Info) documents a
+	// VSphereMachinePool replacing the VMs created from a previous template.
+	RollingUpdateInProgressReason = "RollingUpdateInProgress"
+
+	// WaitingForVMsReason (Severity=Info) documents a VSphereMachinePool
+	// waiting for its VMs to be ready.
+	WaitingForVMsReason = "WaitingForVMs"
+)
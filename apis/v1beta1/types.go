@@ -32,6 +32,11 @@ const (
 	// ready.
 	AnnotationControlPlaneReady = "vsphere.infrastructure.cluster.x-k8s.io/control-plane-ready"
 
+	// AnnotationHostMaintenanceCordoned indicates a Node was cordoned because
+	// the ESXi host running its VM entered maintenance or quarantine mode, so
+	// that it is uncordoned once the host is back in service.
+	AnnotationHostMaintenanceCordoned = "vsphere.infrastructure.cluster.x-k8s.io/host-maintenance-cordoned"
+
 	// ValueReady is the ready value for *Ready annotations.
 	ValueReady = "true"
 )
@@ -50,6 +55,133 @@ const (
 	// clone mode, but it also prevents expanding a VMs disk beyond the size of
 	// the source VM/template.
 	LinkedClone CloneMode = "linkedClone"
+
+	// InstantClone means resulting VMs are forked from a running parent VM
+	// using the vSphere InstantClone API. The new VM shares the memory and
+	// disk state of its parent at the time of the fork and is powered on as
+	// soon as it is created. This is the fastest clone mode, but it requires
+	// a pool of running parent VMs prepared from the template.
+	InstantClone CloneMode = "instantClone"
+)
+
+// ResizePolicy describes how changes to the resources of a VM are applied.
+// +kubebuilder:validation:Enum=None;InPlace
+type ResizePolicy string
+
+const (
+	// ResizePolicyNone means the CPU, memory and disk of a VM cannot be changed
+	// once it is created. Changing them requires replacing the machine.
+	ResizePolicyNone ResizePolicy = "None"
+
+	// ResizePolicyInPlace means the CPU, memory and disk of a VM are grown on
+	// the existing VM. CPU and memory are hot-added when the VM allows it,
+	// otherwise the VM is power cycled to apply the changes. The disk is
+	// grown once the VM has no snapshots, as vSphere cannot extend the disk
+	// of a VM with snapshots.
+	ResizePolicyInPlace ResizePolicy = "InPlace"
+)
+
+// DriftPolicy describes how the changes made in vSphere to the configuration
+// of a VM, which make it differ from its VSphereVM, are handled.
+// +kubebuilder:validation:Enum=Report;Correct;Remediate
+type DriftPolicy string
+
+const (
+	// DriftPolicyReport means the configuration drift of a VM is only reported
+	// in the ConfigDrifted condition of its VSphereVM.
+	DriftPolicyReport DriftPolicy = "Report"
+
+	// DriftPolicyCorrect means the configuration drift of a VM is reported,
+	// and the configuration of the VM is reverted to the one of its
+	// VSphereVM. The VM is power cycled when its CPU or memory cannot be
+	// changed while it is running. The network devices are not corrected.
+	DriftPolicyCorrect DriftPolicy = "Correct"
+
+	// DriftPolicyRemediate means the configuration drift of a VM is reported,
+	// and its Machine is marked for remediation by its MachineHealthCheck,
+	// which replaces it. It is not supported for the VMs of a VSphereMachinePool,
+	// which have no Machine.
+	DriftPolicyRemediate DriftPolicy = "Remediate"
+)
+
+// SharesLevel is the level of the shares of a resource allocated to a VM.
+// +kubebuilder:validation:Enum=Low;Normal;High;Custom
+type SharesLevel string
+
+const (
+	// SharesLevelLow allocates 500 CPU shares per virtual CPU and 5 memory
+	// shares per MiB of memory to the VM.
+	SharesLevelLow SharesLevel = "Low"
+
+	// SharesLevelNormal allocates 1000 CPU shares per virtual CPU and 10
+	// memory shares per MiB of memory to the VM.
+	SharesLevelNormal SharesLevel = "Normal"
+
+	// SharesLevelHigh allocates 2000 CPU shares per virtual CPU and 20 memory
+	// shares per MiB of memory to the VM.
+	SharesLevelHigh SharesLevel = "High"
+
+	// SharesLevelCustom allocates the number of shares set in Shares to the
+	// VM.
+	SharesLevelCustom SharesLevel = "Custom"
+)
+
+// ResourceShares describes the relative priority of a VM when it competes
+// with its siblings for a resource.
+type ResourceShares struct {
+	// Level is the level of the shares.
+	Level SharesLevel `json:"level"`
+
+	// Shares is the number of shares allocated to the VM. It must be set if,
+	// and only if, Level is Custom.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Shares int32 `json:"shares,omitempty"`
+}
+
+// ResourceAllocation describes the reservation, limit and shares of a
+// resource of a VM. CPU is expressed in MHz and memory in MiB.
+// The settings which are not set are not managed, and keep the values of the
+// template the VM is cloned from.
+type ResourceAllocation struct {
+	// Reservation is the amount of the resource which is guaranteed to the
+	// VM.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Reservation *int64 `json:"reservation,omitempty"`
+
+	// Limit is the maximum amount of the resource the VM can use, even if
+	// more is available. -1 means the usage of the VM is not limited.
+	// +optional
+	// +kubebuilder:validation:Minimum=-1
+	Limit *int64 `json:"limit,omitempty"`
+
+	// Shares is the relative priority of the VM when it competes with its
+	// siblings for the resource.
+	// +optional
+	Shares *ResourceShares `json:"shares,omitempty"`
+}
+
+// DatastoreSelectionPolicy describes how the datastore of a VM is selected
+// among the datastores which are compatible with its storage policy.
+// +kubebuilder:validation:Enum=Random;MostFreeSpace;LeastVMs;RoundRobin
+type DatastoreSelectionPolicy string
+
+const (
+	// DatastoreSelectionPolicyRandom selects a random compatible datastore.
+	DatastoreSelectionPolicyRandom DatastoreSelectionPolicy = "Random"
+
+	// DatastoreSelectionPolicyMostFreeSpace selects the compatible datastore
+	// with the most free space.
+	DatastoreSelectionPolicyMostFreeSpace DatastoreSelectionPolicy = "MostFreeSpace"
+
+	// DatastoreSelectionPolicyLeastVMs selects the compatible datastore which
+	// hosts the fewest VMs.
+	DatastoreSelectionPolicyLeastVMs DatastoreSelectionPolicy = "LeastVMs"
+
+	// DatastoreSelectionPolicyRoundRobin spreads the VMs of a cluster across
+	// the compatible datastores, in proportion to their free space.
+	DatastoreSelectionPolicyRoundRobin DatastoreSelectionPolicy = "RoundRobin"
 )
 
 // OS is the type of Operating System the virtual machine uses.
@@ -91,12 +223,57 @@ const (
 	VirtualMachinePowerOpModeTrySoft VirtualMachinePowerOpMode = "trySoft"
 )
 
+// AdoptedVMDeletionPolicy describes what happens to an adopted VM when the
+// resource which adopted it is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain
+type AdoptedVMDeletionPolicy string
+
+const (
+	// AdoptedVMDeletionPolicyDelete powers off and destroys the adopted VM,
+	// like the VMs cloned by CAPV.
+	AdoptedVMDeletionPolicyDelete AdoptedVMDeletionPolicy = "Delete"
+
+	// AdoptedVMDeletionPolicyRetain releases the adopted VM and leaves it
+	// running in vCenter.
+	AdoptedVMDeletionPolicyRetain AdoptedVMDeletionPolicy = "Retain"
+)
+
+// VirtualMachineAdoptionSpec references an existing VM which is adopted
+// instead of cloning a new one. The VM is referenced either by its managed
+// object reference or by its BIOS UUID.
+type VirtualMachineAdoptionSpec struct {
+	// MoRef is the managed object reference ID of the VM, e.g. vm-123.
+	// Mutually exclusive with BiosUUID.
+	// +optional
+	MoRef string `json:"moRef,omitempty"`
+
+	// BiosUUID is the BIOS UUID of the VM.
+	// Mutually exclusive with MoRef.
+	// +optional
+	BiosUUID string `json:"biosUUID,omitempty"`
+
+	// DeletionPolicy describes what happens to the VM when the resource is
+	// deleted.
+	// Defaults to Retain, which leaves the VM running in vCenter.
+	// +optional
+	// +kubebuilder:default=Retain
+	DeletionPolicy AdoptedVMDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
 // VirtualMachineCloneSpec is information used to clone a virtual machine.
 type VirtualMachineCloneSpec struct {
 	// Template is the name or inventory path of the template used to clone
 	// the virtual machine.
+	// Either Template or ContentLibraryItem must be set.
 	// +kubebuilder:validation:MinLength=1
-	Template string `json:"template"`
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// ContentLibraryItem is a reference to the Content Library item from
+	// which the virtual machine is deployed.
+	// Either Template or ContentLibraryItem must be set.
+	// +optional
+	ContentLibraryItem *ContentLibraryItemSpec `json:"contentLibraryItem,omitempty"`
 
 	// CloneMode specifies the type of clone operation.
 	// The LinkedClone mode is only support for templates that have at least
@@ -106,6 +283,9 @@ type VirtualMachineCloneSpec struct {
 	// not possible to expand disks of linked clones.
 	// Defaults to LinkedClone, but fails gracefully to FullClone if the source
 	// of the clone operation has no snapshots.
+	// The InstantClone mode forks one of the running VMs listed in
+	// InstantCloneParents. If none of them is available, or if the instant
+	// clone fails, then CloneMode falls back to FullClone.
 	// +optional
 	CloneMode CloneMode `json:"cloneMode,omitempty"`
 
@@ -115,6 +295,16 @@ type VirtualMachineCloneSpec struct {
 	// +optional
 	Snapshot string `json:"snapshot,omitempty"`
 
+	// InstantCloneParents is the pool of names or inventory paths of running
+	// parent VMs, prepared from the template, which may be forked when
+	// CloneMode is InstantClone. The parent VMs must be powered on and have
+	// as many network devices as the clone. The guestinfo metadata and
+	// userdata are injected into the VM after the fork, so the guest of the
+	// parent VM is expected to wait for them before running cloud-init.
+	// This field is ignored if InstantClone is not enabled.
+	// +optional
+	InstantCloneParents []string `json:"instantCloneParents,omitempty"`
+
 	// Server is the IP address or FQDN of the vSphere server on which
 	// the virtual machine is created/located.
 	// +optional
@@ -143,11 +333,25 @@ type VirtualMachineCloneSpec struct {
 	// +optional
 	Datastore string `json:"datastore,omitempty"`
 
+	// DatastoreCluster is the name or inventory path of the datastore cluster
+	// in which the virtual machine is created/located. The datastore of the
+	// virtual machine is recommended by Storage DRS when it is cloned from a
+	// template. It is ignored when Datastore is set.
+	// +optional
+	DatastoreCluster string `json:"datastoreCluster,omitempty"`
+
 	// StoragePolicyName of the storage policy to use with this
 	// Virtual Machine
 	// +optional
 	StoragePolicyName string `json:"storagePolicyName,omitempty"`
 
+	// DatastoreSelectionPolicy describes how the datastore of the virtual
+	// machine is selected among the datastores compatible with
+	// StoragePolicyName when Datastore is not set.
+	// Defaults to Random.
+	// +optional
+	DatastoreSelectionPolicy DatastoreSelectionPolicy `json:"datastoreSelectionPolicy,omitempty"`
+
 	// ResourcePool is the name or inventory path of the resource pool in which
 	// the virtual machine is created/located.
 	// +optional
@@ -182,6 +386,39 @@ type VirtualMachineCloneSpec struct {
 	// virtual machine is cloned.
 	// +optional
 	AdditionalDisksGiB []int32 `json:"additionalDisksGiB,omitempty"`
+	// DataDisks are new disks which are added to the virtual machine when it
+	// is created, in addition to the disks of the template.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	DataDisks []DataDisk `json:"dataDisks,omitempty"`
+	// ResizePolicy describes how changes to NumCPUs, MemoryMiB and DiskGiB are
+	// applied once the virtual machine is created.
+	// Defaults to None, which forbids such changes. It cannot be InPlace
+	// when CloneMode is InstantClone. With InPlace, DiskGiB is only grown
+	// once the virtual machine has no snapshots, e.g. once the snapshots of
+	// its SnapshotPolicy are deleted after their retention period.
+	// +optional
+	// +kubebuilder:default=None
+	ResizePolicy ResizePolicy `json:"resizePolicy,omitempty"`
+	// DriftPolicy describes how the changes made in vSphere to the number of
+	// CPUs, the memory, the network devices and the custom VMX keys of the
+	// virtual machine are handled once it is created.
+	// Defaults to Report.
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// CPUAllocation is the reservation, limit and shares of the CPU of the
+	// virtual machine, in MHz. It is applied when the virtual machine is
+	// created, and changes made to it in vSphere are reverted.
+	// +optional
+	CPUAllocation *ResourceAllocation `json:"cpuAllocation,omitempty"`
+	// MemoryAllocation is the reservation, limit and shares of the memory of
+	// the virtual machine, in MiB. It is applied when the virtual machine is
+	// created, and changes made to it in vSphere are reverted.
+	// The memory reservation is locked to the memory of the virtual machine
+	// when PCI devices are attached to it.
+	// +optional
+	MemoryAllocation *ResourceAllocation `json:"memoryAllocation,omitempty"`
 	// CustomVMXKeys is a dictionary of advanced VMX options that can be set on VM
 	// Defaults to empty map
 	// +optional
@@ -246,6 +483,164 @@ func (v APIEndpoint) String() string {
 	return fmt.Sprintf("%s:%d", v.Host, v.Port)
 }
 
+// ContentLibraryItemSpec is a reference to a Content Library item, either by
+// ID or by the name of the library and the name of the item.
+type ContentLibraryItemSpec struct {
+	// ID is the identifier of the Content Library item.
+	// Mutually exclusive with Library and Name.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Library is the name of the Content Library which contains the item.
+	// +optional
+	Library string `json:"library,omitempty"`
+
+	// Name is the name of the item in the Content Library.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// CacheTemplate enables caching the deployed item as a local VM template
+	// with a snapshot, one per item version and datastore. Later virtual
+	// machines are cloned from the cached template, which allows using
+	// LinkedClone mode.
+	// Defaults to false, which deploys the item for each virtual machine.
+	// +optional
+	CacheTemplate bool `json:"cacheTemplate,omitempty"`
+}
+
+// DiskProvisioningMode is the provisioning type of a virtual disk.
+// +kubebuilder:validation:Enum=thin;thick;eagerZeroedThick
+type DiskProvisioningMode string
+
+const (
+	// DiskProvisioningModeThin allocates the space of the disk on demand.
+	DiskProvisioningModeThin DiskProvisioningMode = "thin"
+
+	// DiskProvisioningModeThick allocates the space of the disk when it is
+	// created, and zeroes it on first write.
+	DiskProvisioningModeThick DiskProvisioningMode = "thick"
+
+	// DiskProvisioningModeEagerZeroedThick allocates and zeroes the space of
+	// the disk when it is created.
+	DiskProvisioningModeEagerZeroedThick DiskProvisioningMode = "eagerZeroedThick"
+)
+
+// DiskControllerType is the type of the controller a virtual disk is
+// attached to.
+// +kubebuilder:validation:Enum=pvscsi;lsilogic;lsilogic-sas;buslogic;nvme;sata
+type DiskControllerType string
+
+const (
+	// DiskControllerTypePVSCSI is a VMware Paravirtual SCSI controller.
+	DiskControllerTypePVSCSI DiskControllerType = "pvscsi"
+
+	// DiskControllerTypeLSILogic is a LSI Logic parallel SCSI controller.
+	DiskControllerTypeLSILogic DiskControllerType = "lsilogic"
+
+	// DiskControllerTypeLSILogicSAS is a LSI Logic SAS SCSI controller.
+	DiskControllerTypeLSILogicSAS DiskControllerType = "lsilogic-sas"
+
+	// DiskControllerTypeBusLogic is a BusLogic parallel SCSI controller.
+	DiskControllerTypeBusLogic DiskControllerType = "buslogic"
+
+	// DiskControllerTypeNVMe is a NVMe controller.
+	DiskControllerTypeNVMe DiskControllerType = "nvme"
+
+	// DiskControllerTypeSATA is a SATA (AHCI) controller.
+	DiskControllerTypeSATA DiskControllerType = "sata"
+)
+
+// DiskMode is the mode of a virtual disk, which determines how it is
+// affected by snapshots.
+// +kubebuilder:validation:Enum=persistent;independentPersistent;independentNonpersistent
+type DiskMode string
+
+const (
+	// DiskModePersistent means changes are immediately and permanently
+	// written to the disk, and the disk is included in snapshots.
+	DiskModePersistent DiskMode = "persistent"
+
+	// DiskModeIndependentPersistent means changes are immediately and
+	// permanently written to the disk, and the disk is not affected by
+	// snapshots.
+	DiskModeIndependentPersistent DiskMode = "independentPersistent"
+
+	// DiskModeIndependentNonpersistent means changes to the disk are
+	// discarded when the virtual machine is powered off or reverted to a
+	// snapshot, and the disk is not affected by snapshots.
+	DiskModeIndependentNonpersistent DiskMode = "independentNonpersistent"
+)
+
+// DataDisk defines a new disk which is added to a virtual machine when it is
+// created.
+type DataDisk struct {
+	// Name identifies the disk. It must be unique among the data disks of the
+	// virtual machine.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// SizeGiB is the size of the disk, in GiB.
+	// +kubebuilder:validation:Minimum=1
+	SizeGiB int32 `json:"sizeGiB"`
+
+	// ProvisioningMode is the provisioning type of the disk.
+	// Defaults to thin.
+	// +optional
+	ProvisioningMode DiskProvisioningMode `json:"provisioningMode,omitempty"`
+
+	// ControllerType is the type of the controller the disk is attached to.
+	// Defaults to pvscsi.
+	// +optional
+	ControllerType DiskControllerType `json:"controllerType,omitempty"`
+
+	// ControllerBusNumber is the bus number of the controller the disk is
+	// attached to. A new controller is added if there is no controller of
+	// ControllerType with this bus number.
+	// Defaults to the first controller of ControllerType which has a free
+	// unit, or a new controller if there is none.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=3
+	// +optional
+	ControllerBusNumber *int32 `json:"controllerBusNumber,omitempty"`
+
+	// DiskMode is the mode of the disk.
+	// Defaults to persistent.
+	// +optional
+	DiskMode DiskMode `json:"diskMode,omitempty"`
+
+	// Datastore is the name or inventory path of the datastore on which the
+	// disk is created.
+	// Defaults to the datastore of the virtual machine.
+	// +optional
+	Datastore string `json:"datastore,omitempty"`
+
+	// StoragePolicyName is the name of the storage policy applied to the
+	// disk.
+	// +optional
+	StoragePolicyName string `json:"storagePolicyName,omitempty"`
+}
+
+// DataDiskStatus is the observed state of a data disk.
+type DataDiskStatus struct {
+	// Name is the name of the data disk.
+	Name string `json:"name"`
+
+	// ControllerType is the type of the controller the disk is attached to.
+	ControllerType DiskControllerType `json:"controllerType"`
+
+	// ControllerBusNumber is the bus number of the controller the disk is
+	// attached to.
+	ControllerBusNumber int32 `json:"controllerBusNumber"`
+
+	// UnitNumber is the unit number of the disk on its controller.
+	UnitNumber int32 `json:"unitNumber"`
+
+	// UUID is the UUID of the virtual disk. It is set once the disk is
+	// created.
+	// +optional
+	UUID string `json:"uuid,omitempty"`
+}
+
 // PCIDeviceSpec defines virtual machine's PCI configuration.
 type PCIDeviceSpec struct {
 	// DeviceID is the device ID of a virtual machine's PCI, in integer.
@@ -39,12 +39,24 @@ func NewVCenterVersion(version string) VCenterVersion {
 // VSphereClusterSpec defines the desired state of VSphereCluster.
 type VSphereClusterSpec struct {
 	// Server is the address of the vSphere endpoint.
+	// It is set from the VSphereServer when ServerRef is set.
 	Server string `json:"server,omitempty"`
 
 	// Thumbprint is the colon-separated SHA-1 checksum of the given vCenter server's host certificate
 	// +optional
 	Thumbprint string `json:"thumbprint,omitempty"`
 
+	// CABundleRef references the PEM encoded certificate authorities inside the namespace of
+	// the VSphereCluster used to verify the certificate of the vCenter server.
+	// +optional
+	CABundleRef *CABundleReference `json:"caBundleRef,omitempty"`
+
+	// ServerRef is the name of the VSphereServer which holds the connection settings of the vCenter server.
+	// When set, the server, the thumbprint, the CA bundle, the proxy and the identity of the VSphereServer
+	// are used, and Thumbprint, CABundleRef and IdentityRef must not be set.
+	// +optional
+	ServerRef string `json:"serverRef,omitempty"`
+
 	// ControlPlaneEndpoint represents the endpoint used to communicate with the control plane.
 	// +optional
 	ControlPlaneEndpoint APIEndpoint `json:"controlPlaneEndpoint"`
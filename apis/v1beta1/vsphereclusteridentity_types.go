@@ -39,6 +39,18 @@ type VSphereClusterIdentitySpec struct {
 	// If this object is nil, no namespaces will be allowed
 	// +optional
 	AllowedNamespaces *AllowedNamespaces `json:"allowedNamespaces,omitempty"`
+
+	// CABundleRef references the PEM encoded certificate authorities inside the controller
+	// namespace used to verify the certificate of the vCenter server, when the VSphereCluster
+	// using this identity does not set its own.
+	// +optional
+	CABundleRef *CABundleReference `json:"caBundleRef,omitempty"`
+
+	// AllowedResources is used to restrict the vSphere inventory objects which the VSphereClusters
+	// using this identity may target.
+	// If this object is nil, all the objects are allowed.
+	// +optional
+	AllowedResources *AllowedResources `json:"allowedResources,omitempty"`
 }
 
 // VSphereClusterIdentityStatus contains the status of the VSphereClusterIdentity.
@@ -58,6 +70,39 @@ type AllowedNamespaces struct {
 	Selector metav1.LabelSelector `json:"selector"`
 }
 
+// AllowedResources restricts the vSphere inventory objects a VSphereClusterIdentity can be used with.
+// Each entry is the name or the inventory path of the allowed objects, and may contain the shell
+// patterns of path.Match, e.g. /dc0/vm/team-a/*. An entry starting with a slash is matched against
+// the inventory path of the objects, and an entry without against their name. An empty list does not
+// restrict the objects of its kind.
+type AllowedResources struct {
+	// Datacenters are the allowed datacenters.
+	// +optional
+	Datacenters []string `json:"datacenters,omitempty"`
+
+	// Folders are the allowed VM folders.
+	// +optional
+	Folders []string `json:"folders,omitempty"`
+
+	// ResourcePools are the allowed resource pools.
+	// +optional
+	ResourcePools []string `json:"resourcePools,omitempty"`
+
+	// Networks are the allowed networks.
+	// +optional
+	Networks []string `json:"networks,omitempty"`
+
+	// Datastores are the allowed datastores and datastore clusters.
+	// +optional
+	Datastores []string `json:"datastores,omitempty"`
+
+	// Templates are the allowed VM templates, instant clone parents and Content
+	// Library items. The Content Library items are matched by their name, or by
+	// the path /<library>/<item> for the entries starting with a slash.
+	// +optional
+	Templates []string `json:"templates,omitempty"`
+}
+
 // VSphereIdentityKind is the kind of mechanism used to handle credentials for the VCenter API.
 type VSphereIdentityKind string
 
@@ -79,6 +124,36 @@ type VSphereIdentityReference struct {
 	Name string `json:"name"`
 }
 
+// CABundleKind is the kind of the object holding a CA bundle.
+type CABundleKind string
+
+const (
+	// ConfigMapCABundleKind is used when the CA bundle is held by a ConfigMap.
+	ConfigMapCABundleKind = CABundleKind("ConfigMap")
+	// SecretCABundleKind is used when the CA bundle is held by a Secret.
+	SecretCABundleKind = CABundleKind("Secret")
+
+	// DefaultCABundleKey is the key of the CA bundle when none is set.
+	DefaultCABundleKey = "ca.crt"
+)
+
+// CABundleReference references the PEM encoded certificate authorities held by
+// a ConfigMap or a Secret. The certificate of the vCenter server is trusted if
+// it is signed by one of them, even if it does not match the thumbprint.
+type CABundleReference struct {
+	// Kind of the object holding the CA bundle. Can either be ConfigMap or Secret
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind CABundleKind `json:"kind"`
+
+	// Name of the object holding the CA bundle.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key of the CA bundle in the object. Defaults to ca.crt.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
 // GetConditions returns the conditions for the VSphereClusterIdentity.
 func (c *VSphereClusterIdentity) GetConditions() clusterv1.Conditions {
 	return c.Status.Conditions
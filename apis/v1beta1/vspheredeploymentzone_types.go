@@ -32,8 +32,18 @@ const (
 type VSphereDeploymentZoneSpec struct {
 
 	// Server is the address of the vSphere endpoint.
+	// It is set from the VSphereServer when ServerRef is set.
 	Server string `json:"server,omitempty"`
 
+	// ServerRef is the name of the VSphereServer which holds the connection settings of the vCenter server.
+	// +optional
+	ServerRef string `json:"serverRef,omitempty"`
+
+	// CABundleRef references the PEM encoded certificate authorities inside the controller
+	// namespace used to verify the certificate of the vCenter server.
+	// +optional
+	CABundleRef *CABundleReference `json:"caBundleRef,omitempty"`
+
 	// FailureDomain is the name of the VSphereFailureDomain used for this VSphereDeploymentZone
 	FailureDomain string `json:"failureDomain,omitempty"`
 
@@ -85,6 +85,11 @@ type Topology struct {
 	// virtual machine is created/located.
 	// +optional
 	Datastore string `json:"datastore,omitempty"`
+
+	// DatastoreCluster is the name or inventory path of the datastore cluster
+	// in which the virtual machine is created/located.
+	// +optional
+	DatastoreCluster string `json:"datastoreCluster,omitempty"`
 }
 
 // FailureDomainHosts has information required for placement of machines on VSphere hosts.
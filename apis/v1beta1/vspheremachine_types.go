@@ -68,6 +68,12 @@ type VSphereMachineSpec struct {
 	//
 	// +optional
 	GuestSoftPowerOffTimeout *metav1.Duration `json:"guestSoftPowerOffTimeout,omitempty"`
+
+	// Adopt references an existing VM which is adopted instead of cloning a
+	// new one from the template. The VM must match the spec. Once adopted,
+	// it is managed like the VMs cloned by CAPV.
+	// +optional
+	Adopt *VirtualMachineAdoptionSpec `json:"adopt,omitempty"`
 }
 
 // VSphereMachineStatus defines the observed state of VSphereMachine.
@@ -84,6 +90,10 @@ type VSphereMachineStatus struct {
 	// +optional
 	Network []NetworkStatus `json:"network,omitempty"`
 
+	// DataDisks is the status of each of the machine's data disks.
+	// +optional
+	DataDisks []DataDiskStatus `json:"dataDisks,omitempty"`
+
 	// FailureReason will be set in the event that there is a terminal problem
 	// reconciling the Machine and will contain a succinct value suitable
 	// for machine interpretation.
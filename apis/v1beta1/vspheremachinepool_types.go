@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
+)
+
+const (
+	// MachinePoolFinalizer allows ReconcileVSphereMachinePool to clean up the
+	// VSphereVMs of the VSphereMachinePool before removing it from the API
+	// Server.
+	MachinePoolFinalizer = "vspheremachinepool.infrastructure.cluster.x-k8s.io"
+
+	// MachinePoolNameLabel is the label set on the VSphereVMs of a
+	// VSphereMachinePool, with the name of the VSphereMachinePool.
+	MachinePoolNameLabel = "vspheremachinepool.infrastructure.cluster.x-k8s.io/name"
+
+	// MachinePoolTemplateHashLabel is the label set on the VSphereVMs of a
+	// VSphereMachinePool, with the hash of the template they were created
+	// from. The VSphereVMs created from another template are replaced.
+	MachinePoolTemplateHashLabel = "vspheremachinepool.infrastructure.cluster.x-k8s.io/template-hash"
+
+	// MachinePoolFailureDomainLabel is the label set on the VSphereVMs of a
+	// VSphereMachinePool, with the failure domain they were placed in.
+	MachinePoolFailureDomainLabel = "vspheremachinepool.infrastructure.cluster.x-k8s.io/failure-domain"
+)
+
+// VSphereMachinePoolSpec defines the desired state of VSphereMachinePool.
+type VSphereMachinePoolSpec struct {
+	// Template is the template of the VMs of the pool. The VMs created from
+	// a previous template are replaced one at a time once it changes.
+	Template VSphereMachinePoolMachineTemplate `json:"template"`
+
+	// ProviderIDList is the list of the provider IDs of the VMs of the pool,
+	// formatted as the ProviderID of a VSphereMachine.
+	// +optional
+	ProviderIDList []string `json:"providerIDList,omitempty"`
+
+	// MaxSurge is the maximum number of VMs which can be created above the
+	// desired number of replicas while the VMs are replaced.
+	//
+	// If omitted, the VMs are replaced one at a time.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxSurge *int32 `json:"maxSurge,omitempty"`
+}
+
+// VSphereMachinePoolMachineTemplate is the template of the VMs of a
+// VSphereMachinePool.
+type VSphereMachinePoolMachineTemplate struct {
+	VirtualMachineCloneSpec `json:",inline"`
+
+	// PowerOffMode describes the desired behavior when powering off a VM.
+	//
+	// If omitted, the mode defaults to hard.
+	//
+	// +optional
+	// +kubebuilder:default=hard
+	PowerOffMode VirtualMachinePowerOpMode `json:"powerOffMode,omitempty"`
+
+	// GuestSoftPowerOffTimeout sets the wait timeout for shutdown in the VM guest.
+	// The VM will be powered off forcibly after the timeout if the VM is still
+	// up and running when the PowerOffMode is set to trySoft.
+	//
+	// If omitted, the timeout defaults to 5 minutes.
+	//
+	// +optional
+	GuestSoftPowerOffTimeout *metav1.Duration `json:"guestSoftPowerOffTimeout,omitempty"`
+}
+
+// VSphereMachinePoolStatus defines the observed state of VSphereMachinePool.
+type VSphereMachinePoolStatus struct {
+	// Ready is true when the desired number of VMs of the pool are ready.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Replicas is the number of ready VMs of the pool.
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// FailureReason will be set in the event that there is a terminal problem
+	// reconciling the VSphereMachinePool and will contain a succinct value
+	// suitable for machine interpretation.
+	// +optional
+	FailureReason *errors.MachineStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set in the event that there is a terminal problem
+	// reconciling the VSphereMachinePool and will contain a more verbose string
+	// suitable for logging and human consumption.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Conditions defines current service state of the VSphereMachinePool.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vspheremachinepools,scope=Namespaced,categories=cluster-api
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels.cluster\\.x-k8s\\.io/cluster-name",description="Cluster to which this VSphereMachinePool belongs"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Number of ready VMs of the pool"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.ready",description="VSphereMachinePool ready status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation of the VSphereMachinePool"
+
+// VSphereMachinePool is the Schema for the vspheremachinepools API. It is
+// the infrastructure of a MachinePool, and owns the VSphereVMs of its
+// replicas.
+type VSphereMachinePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereMachinePoolSpec   `json:"spec,omitempty"`
+	Status VSphereMachinePoolStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the conditions for a VSphereMachinePool.
+func (r *VSphereMachinePool) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the conditions on a VSphereMachinePool.
+func (r *VSphereMachinePool) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereMachinePoolList contains a list of VSphereMachinePool.
+type VSphereMachinePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereMachinePool `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &VSphereMachinePool{}, &VSphereMachinePoolList{})
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OrphanType describes the kind of a vCenter object which no CAPV object maps
+// to.
+// +kubebuilder:validation:Enum=VirtualMachine;ClusterModule;VMGroupMember
+type OrphanType string
+
+const (
+	// OrphanTypeVirtualMachine is a VM cloned by CAPV whose VSphereVM no
+	// longer exists.
+	OrphanTypeVirtualMachine OrphanType = "VirtualMachine"
+
+	// OrphanTypeClusterModule is a cluster module which is not used by any
+	// VSphereCluster.
+	OrphanTypeClusterModule OrphanType = "ClusterModule"
+
+	// OrphanTypeVMGroupMember is the membership of a VM cloned by CAPV, whose
+	// VSphereVM no longer exists, in the VM group of a failure domain.
+	OrphanTypeVMGroupMember OrphanType = "VMGroupMember"
+)
+
+// VSphereOrphanSpec defines the vCenter object reported by a VSphereOrphan.
+type VSphereOrphanSpec struct {
+	// Server is the address of the vCenter of the object.
+	Server string `json:"server"`
+
+	// Datacenter is the datacenter of the object. It is empty for the cluster
+	// modules, which belong to the vCenter.
+	// +optional
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// Type is the kind of the object.
+	Type OrphanType `json:"type"`
+
+	// Ref is the managed object reference of the VM for the VirtualMachine
+	// and VMGroupMember types, and the UUID of the cluster module for the
+	// ClusterModule type.
+	Ref string `json:"ref"`
+
+	// Name is the inventory path of the VM, or the name of the compute
+	// cluster of the cluster module.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// ComputeCluster is the compute cluster of the VM group of the
+	// VMGroupMember type.
+	// +optional
+	ComputeCluster string `json:"computeCluster,omitempty"`
+
+	// VMGroup is the name of the VM group of the VMGroupMember type.
+	// +optional
+	VMGroup string `json:"vmGroup,omitempty"`
+}
+
+// VSphereOrphanStatus defines the observed state of VSphereOrphan.
+type VSphereOrphanStatus struct {
+	// LastSeen is the last time the object was found without any CAPV object
+	// mapping to it.
+	// +optional
+	LastSeen *metav1.Time `json:"lastSeen,omitempty"`
+
+	// DeleteAfter is the time after which the object is deleted from vCenter,
+	// if the deletion of the orphaned objects is enabled.
+	// +optional
+	DeleteAfter *metav1.Time `json:"deleteAfter,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vsphereorphans,scope=Cluster,categories=cluster-api
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type="string",JSONPath=".spec.type",description="Kind of the orphaned object"
+// +kubebuilder:printcolumn:name="Server",type="string",JSONPath=".spec.server",description="vCenter of the orphaned object"
+// +kubebuilder:printcolumn:name="Name",type="string",JSONPath=".spec.name",description="Inventory path of the orphaned object"
+// +kubebuilder:printcolumn:name="Delete After",type="string",JSONPath=".status.deleteAfter",description="Time after which the orphaned object is deleted"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since the object was found orphaned"
+
+// VSphereOrphan is the Schema for the vsphereorphans API. It reports a
+// vCenter object, in the folders or compute clusters used by CAPV, which no
+// CAPV object maps to. It is created and deleted by the orphan collector of
+// the controller manager.
+type VSphereOrphan struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereOrphanSpec   `json:"spec,omitempty"`
+	Status VSphereOrphanStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereOrphanList contains a list of VSphereOrphan.
+type VSphereOrphanList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereOrphan `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &VSphereOrphan{}, &VSphereOrphanList{})
+}
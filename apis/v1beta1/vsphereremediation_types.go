@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RemediationDefaultRetryLimit is the default number of times each step
+	// of a remediation is attempted before escalating to the next step.
+	RemediationDefaultRetryLimit = 1
+
+	// RemediationDefaultTimeout is the default time to wait for the Machine
+	// to become healthy after a step of a remediation before retrying it or
+	// escalating to the next step.
+	RemediationDefaultTimeout = 5 * time.Minute
+)
+
+// RemediationStep describes an action taken on the VM of an unhealthy Machine.
+// +kubebuilder:validation:Enum=GuestReboot;HardReset;PowerCycle;DeleteMachine
+type RemediationStep string
+
+const (
+	// RemediationStepGuestReboot reboots the guest operating system of the
+	// VM. It requires VMware Tools to be running in the guest, and the step
+	// is skipped otherwise.
+	RemediationStepGuestReboot RemediationStep = "GuestReboot"
+
+	// RemediationStepHardReset resets the VM, which is the equivalent of
+	// pressing the reset button of a physical system.
+	RemediationStepHardReset RemediationStep = "HardReset"
+
+	// RemediationStepPowerCycle powers off the VM, which is then powered on
+	// again by the VSphereVM controller.
+	RemediationStepPowerCycle RemediationStep = "PowerCycle"
+
+	// RemediationStepDeleteMachine deletes the Machine, so that it is
+	// replaced by its owner.
+	RemediationStepDeleteMachine RemediationStep = "DeleteMachine"
+)
+
+// DefaultRemediationSteps are the steps of a remediation which does not set
+// any, from the least to the most disruptive one.
+var DefaultRemediationSteps = []RemediationStep{
+	RemediationStepGuestReboot,
+	RemediationStepHardReset,
+	RemediationStepPowerCycle,
+	RemediationStepDeleteMachine,
+}
+
+// RemediationPhase describes the state of a remediation.
+type RemediationPhase string
+
+const (
+	// RemediationPhaseRunning is the phase of a remediation which is taking
+	// steps on the VM of the Machine.
+	RemediationPhaseRunning RemediationPhase = "Running"
+
+	// RemediationPhaseDeleting is the phase of a remediation which deleted
+	// the Machine.
+	RemediationPhaseDeleting RemediationPhase = "Deleting"
+
+	// RemediationPhaseFailed is the phase of a remediation which took all
+	// its steps without the Machine becoming healthy.
+	RemediationPhaseFailed RemediationPhase = "Failed"
+)
+
+// VSphereRemediationSpec defines the desired state of VSphereRemediation.
+type VSphereRemediationSpec struct {
+	// Steps are the steps taken, in order, to remediate the Machine. Each
+	// step is attempted up to RetryLimit times before escalating to the next
+	// one. The remediation ends once the Machine becomes healthy, in which
+	// case the VSphereRemediation is deleted by the MachineHealthCheck.
+	//
+	// If omitted, the steps are GuestReboot, HardReset, PowerCycle and
+	// DeleteMachine.
+	//
+	// +optional
+	Steps []RemediationStep `json:"steps,omitempty"`
+
+	// RetryLimit is the number of times each step is attempted before
+	// escalating to the next step.
+	//
+	// If omitted, each step is attempted once.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	RetryLimit int32 `json:"retryLimit,omitempty"`
+
+	// Timeout is the time to wait for the Machine to become healthy after a
+	// step before retrying it or escalating to the next step.
+	//
+	// If omitted, the timeout defaults to 5 minutes.
+	//
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// VSphereRemediationStatus defines the observed state of VSphereRemediation.
+type VSphereRemediationStatus struct {
+	// Phase is the state of the remediation.
+	// +optional
+	Phase RemediationPhase `json:"phase,omitempty"`
+
+	// Step is the last step taken to remediate the Machine.
+	// +optional
+	Step RemediationStep `json:"step,omitempty"`
+
+	// RetryCount is the number of times the last step was attempted.
+	// +optional
+	RetryCount int32 `json:"retryCount,omitempty"`
+
+	// LastRemediated is the time at which the last step was taken.
+	// +optional
+	LastRemediated *metav1.Time `json:"lastRemediated,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vsphereremediations,scope=Namespaced,categories=cluster-api
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Phase of the remediation"
+// +kubebuilder:printcolumn:name="Step",type="string",JSONPath=".status.step",description="Last step taken to remediate the Machine"
+// +kubebuilder:printcolumn:name="Retries",type="integer",JSONPath=".status.retryCount",description="Number of times the last step was attempted"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation of the remediation"
+
+// VSphereRemediation is the Schema for the vsphereremediations API. It is
+// created by a MachineHealthCheck for an unhealthy Machine, from the
+// VSphereRemediationTemplate of the MachineHealthCheck, and has the name of
+// the Machine.
+type VSphereRemediation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereRemediationSpec   `json:"spec,omitempty"`
+	Status VSphereRemediationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereRemediationList contains a list of VSphereRemediation.
+type VSphereRemediationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereRemediation `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &VSphereRemediation{}, &VSphereRemediationList{})
+}
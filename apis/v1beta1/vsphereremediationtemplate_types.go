@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VSphereRemediationTemplateSpec defines the desired state of VSphereRemediationTemplate.
+type VSphereRemediationTemplateSpec struct {
+	Template VSphereRemediationTemplateResource `json:"template"`
+}
+
+// VSphereRemediationTemplateResource describes the data needed to create a VSphereRemediation from a template.
+type VSphereRemediationTemplateResource struct {
+	// Spec is the specification of the desired behavior of the remediation.
+	Spec VSphereRemediationSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vsphereremediationtemplates,scope=Namespaced,categories=cluster-api
+
+// VSphereRemediationTemplate is the Schema for the vsphereremediationtemplates
+// API. It is referenced by the remediationTemplate of a MachineHealthCheck.
+type VSphereRemediationTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VSphereRemediationTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereRemediationTemplateList contains a list of VSphereRemediationTemplate.
+type VSphereRemediationTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereRemediationTemplate `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &VSphereRemediationTemplate{}, &VSphereRemediationTemplateList{})
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// VSphereServerSpec defines the connection settings of a vCenter server.
+type VSphereServerSpec struct {
+	// Server is the address of the vSphere endpoint.
+	// +kubebuilder:validation:MinLength=1
+	Server string `json:"server"`
+
+	// Thumbprint is the colon-separated SHA-1 checksum of the given vCenter server's host certificate.
+	// +optional
+	Thumbprint string `json:"thumbprint,omitempty"`
+
+	// CABundle is the PEM encoded bundle of the certificate authorities used
+	// to verify the certificate of the vCenter server. The certificate is
+	// trusted if it is signed by one of them, even if it does not match the
+	// Thumbprint. The certificate is not verified if neither is set.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Proxy defines the HTTP proxy used to connect to the vCenter server.
+	// +optional
+	Proxy *VSphereServerProxy `json:"proxy,omitempty"`
+
+	// IdentityRef is a reference to the VSphereClusterIdentity used to
+	// connect to the vCenter server. The credentials of the controller
+	// manager are used if not set.
+	// +optional
+	IdentityRef *VSphereIdentityReference `json:"identityRef,omitempty"`
+
+	// Session defines the tuning of the sessions with the vCenter server.
+	// +optional
+	Session *VSphereServerSession `json:"session,omitempty"`
+}
+
+// VSphereServerProxy defines the HTTP proxy used to connect to a vCenter
+// server.
+type VSphereServerProxy struct {
+	// URL is the URL of the proxy, e.g. http://proxy.example.com:3128.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// SecretName references a Secret inside the controller namespace with
+	// the username and the password used to authenticate with the proxy.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// VSphereServerSession defines the tuning of the sessions with a vCenter
+// server. The settings of the controller manager are used for the unset
+// fields.
+type VSphereServerSession struct {
+	// EnableKeepAlive enables the keep alive handler of the sessions.
+	// +optional
+	EnableKeepAlive *bool `json:"enableKeepAlive,omitempty"`
+
+	// KeepAliveDuration is the idle time after which the keep alive handler
+	// sends a request to keep the sessions alive.
+	// +optional
+	KeepAliveDuration *metav1.Duration `json:"keepAliveDuration,omitempty"`
+}
+
+// VSphereServerCapabilities summarizes the features of a vCenter server used
+// by CAPV.
+type VSphereServerCapabilities struct {
+	// ClusterModules is true when the vCenter server supports the cluster
+	// modules used for the anti-affinity of the machines.
+	// +optional
+	ClusterModules bool `json:"clusterModules,omitempty"`
+
+	// InstantClone is true when the vCenter server supports the instant
+	// clone of VMs.
+	// +optional
+	InstantClone bool `json:"instantClone,omitempty"`
+
+	// Tagging is true when the REST API used for the tags and the content
+	// libraries is available.
+	// +optional
+	Tagging bool `json:"tagging,omitempty"`
+}
+
+// VSphereServerStatus defines the observed state of VSphereServer.
+type VSphereServerStatus struct {
+	// Version is the version of the vCenter server.
+	// +optional
+	Version VCenterVersion `json:"version,omitempty"`
+
+	// Build is the build number of the vCenter server.
+	// +optional
+	Build string `json:"build,omitempty"`
+
+	// Capabilities summarizes the features of the vCenter server used by
+	// CAPV.
+	// +optional
+	Capabilities VSphereServerCapabilities `json:"capabilities,omitempty"`
+
+	// Conditions defines current service state of the VSphereServer.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// GetConditions returns the conditions for the VSphereServer.
+func (s *VSphereServer) GetConditions() clusterv1.Conditions {
+	return s.Status.Conditions
+}
+
+// SetConditions sets the conditions on the VSphereServer.
+func (s *VSphereServer) SetConditions(conditions clusterv1.Conditions) {
+	s.Status.Conditions = conditions
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vsphereservers,scope=Cluster,categories=cluster-api
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Server",type="string",JSONPath=".spec.server",description="Address of the vSphere endpoint"
+// +kubebuilder:printcolumn:name="Available",type="string",JSONPath=".status.conditions[?(@.type=='VCenterAvailable')].status",description="Connectivity with the vCenter server"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",description="Version of the vCenter server"
+// +kubebuilder:printcolumn:name="Build",type="string",JSONPath=".status.build",description="Build number of the vCenter server"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation of VSphereServer"
+
+// VSphereServer is the Schema for the vsphereservers API. It holds the
+// connection settings of a vCenter server, which VSphereClusters and
+// VSphereDeploymentZones reference by name.
+type VSphereServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereServerSpec   `json:"spec,omitempty"`
+	Status VSphereServerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VSphereServerList contains a list of VSphereServer.
+type VSphereServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereServer `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &VSphereServer{}, &VSphereServerList{})
+}
@@ -38,6 +38,10 @@ const (
 	// shutdown finishes in the guest VM before powering off the VM forcibly
 	// Only effective when the powerOffMode is set to trySoft.
 	GuestSoftPowerOffDefaultTimeout = 5 * time.Minute
+
+	// SnapshotDefaultRetentionPeriod is the default time after which the
+	// snapshots taken of a VM are deleted.
+	SnapshotDefaultRetentionPeriod = 7 * 24 * time.Hour
 )
 
 // VSphereVMSpec defines the desired state of VSphereVM.
@@ -84,6 +88,96 @@ type VSphereVMSpec struct {
 	//
 	// +optional
 	GuestSoftPowerOffTimeout *metav1.Duration `json:"guestSoftPowerOffTimeout,omitempty"`
+
+	// SnapshotPolicy describes the snapshots taken of the VM before the
+	// operations which change its virtual hardware.
+	// If omitted, no snapshots are taken.
+	// +optional
+	SnapshotPolicy *VSphereVMSnapshotPolicy `json:"snapshotPolicy,omitempty"`
+
+	// RollbackToSnapshot is the name of one of the snapshots in the status
+	// of the VSphereVM which the VM is reverted to.
+	// The VM is reverted once for each value of this field. While it is set,
+	// the operations guarded by the snapshot policy are not performed again.
+	// +optional
+	RollbackToSnapshot string `json:"rollbackToSnapshot,omitempty"`
+
+	// Adopt references an existing VM which is adopted instead of cloning a
+	// new one from the template. The VM must match the spec. Once adopted,
+	// it is managed like the VMs cloned by CAPV.
+	// +optional
+	Adopt *VirtualMachineAdoptionSpec `json:"adopt,omitempty"`
+}
+
+// SnapshotOperation is an operation before which a snapshot of a VM is taken.
+// +kubebuilder:validation:Enum=HardwareUpgrade;PCIDeviceChange
+type SnapshotOperation string
+
+const (
+	// SnapshotOperationHardwareUpgrade is the upgrade of the hardware version
+	// of a VM.
+	SnapshotOperationHardwareUpgrade SnapshotOperation = "HardwareUpgrade"
+
+	// SnapshotOperationPCIDeviceChange is the addition of PCI devices to a VM.
+	SnapshotOperationPCIDeviceChange SnapshotOperation = "PCIDeviceChange"
+)
+
+// VSphereVMSnapshotPolicy describes the snapshots taken of a VM.
+type VSphereVMSnapshotPolicy struct {
+	// Operations are the operations before which a snapshot of the VM is taken.
+	// +listType=set
+	Operations []SnapshotOperation `json:"operations"`
+
+	// Quiesce indicates whether the file system of a running VM is quiesced
+	// when the snapshot is taken. This requires VMware Tools in the guest.
+	// If omitted, the file system is quiesced.
+	// +optional
+	Quiesce *bool `json:"quiesce,omitempty"`
+
+	// RetentionPeriod is the time after which the snapshots are deleted.
+	// If omitted, the snapshots are deleted after 7 days.
+	// +optional
+	RetentionPeriod *metav1.Duration `json:"retentionPeriod,omitempty"`
+}
+
+// VSphereVMSnapshot describes a snapshot taken of a VM.
+type VSphereVMSnapshot struct {
+	// Name is the name of the snapshot.
+	Name string `json:"name"`
+
+	// Operation is the operation before which the snapshot was taken.
+	Operation SnapshotOperation `json:"operation"`
+
+	// SnapshotRef is the managed object reference of the snapshot, which is
+	// set once the snapshot is created.
+	// +optional
+	SnapshotRef string `json:"snapshotRef,omitempty"`
+
+	// CreationTime is the time at which the snapshot was requested.
+	CreationTime metav1.Time `json:"creationTime"`
+}
+
+// DatastoreSelection describes the selection of the datastore of a VM among
+// the datastores compatible with its storage policy, or among the datastores
+// of its datastore cluster.
+type DatastoreSelection struct {
+	// Policy is the datastore selection policy which was applied. It is not
+	// set when the datastore was recommended by Storage DRS.
+	// +optional
+	Policy DatastoreSelectionPolicy `json:"policy,omitempty"`
+
+	// DatastoreCluster is the name of the datastore cluster the datastore
+	// was selected from.
+	// +optional
+	DatastoreCluster string `json:"datastoreCluster,omitempty"`
+
+	// Datastore is the name of the selected datastore.
+	Datastore string `json:"datastore"`
+
+	// Candidates is the number of datastores compatible with the storage
+	// policy, or of datastores recommended by Storage DRS, among which the
+	// datastore was selected.
+	Candidates int32 `json:"candidates"`
 }
 
 // VSphereVMStatus defines the observed state of VSphereVM.
@@ -93,6 +187,11 @@ type VSphereVMStatus struct {
 	// +optional
 	Host string `json:"host,omitempty"`
 
+	// HostRef is the Managed Object Reference of the infrastructure host that
+	// the VSphereVM is residing on.
+	// +optional
+	HostRef string `json:"hostRef,omitempty"`
+
 	// Ready is true when the provider resource is ready.
 	// This field is required at runtime for other controllers that read
 	// this CRD as unstructured data.
@@ -117,6 +216,38 @@ type VSphereVMStatus struct {
 	// +optional
 	Snapshot string `json:"snapshot,omitempty"`
 
+	// InstantCloneParent is the name or inventory path of the parent VM from
+	// which the VM was forked if InstantClone is enabled.
+	// +optional
+	InstantCloneParent string `json:"instantCloneParent,omitempty"`
+
+	// ContentLibraryItemVersion is the content version of the Content Library
+	// item from which the VM was deployed, if ContentLibraryItem is set.
+	// +optional
+	ContentLibraryItemVersion string `json:"contentLibraryItemVersion,omitempty"`
+
+	// DataDisks is the status of each of the data disks of the VM.
+	// +optional
+	DataDisks []DataDiskStatus `json:"dataDisks,omitempty"`
+
+	// Snapshots are the snapshots taken of the VM according to its snapshot
+	// policy.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Snapshots []VSphereVMSnapshot `json:"snapshots,omitempty"`
+
+	// RolledBackSnapshot is the name of the snapshot the VM was last reverted
+	// to, as requested by RollbackToSnapshot.
+	// +optional
+	RolledBackSnapshot string `json:"rolledBackSnapshot,omitempty"`
+
+	// DatastoreSelection records how the datastore of the VM was selected
+	// when it was placed according to its storage policy or in its datastore
+	// cluster.
+	// +optional
+	DatastoreSelection *DatastoreSelection `json:"datastoreSelection,omitempty"`
+
 	// RetryAfter tracks the time we can retry queueing a task
 	// +optional
 	RetryAfter metav1.Time `json:"retryAfter,omitempty"`
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	pkgerrors "github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/privileges"
+)
+
+// addVSphereClusterInventory adds to the checker the failure domains of the
+// VSphereCluster, and the inventory objects used by the VSphereMachineTemplates
+// of its cluster in each of them and by its VSphereVMs.
+func addVSphereClusterInventory(ctx context.Context, c client.Client, checker *privileges.Checker, vsphereCluster *infrav1.VSphereCluster) error {
+	type failureDomain struct {
+		deploymentZone *infrav1.VSphereDeploymentZone
+		failureDomain  *infrav1.VSphereFailureDomain
+	}
+	var failureDomains []failureDomain
+	for _, name := range sets.List(sets.KeySet(vsphereCluster.Status.FailureDomains)) {
+		deploymentZone := &infrav1.VSphereDeploymentZone{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name}, deploymentZone); err != nil {
+			return pkgerrors.Wrapf(err, "failed to get VSphereDeploymentZone %s", name)
+		}
+		vsphereFailureDomain := &infrav1.VSphereFailureDomain{}
+		if err := c.Get(ctx, client.ObjectKey{Name: deploymentZone.Spec.FailureDomain}, vsphereFailureDomain); err != nil {
+			return pkgerrors.Wrapf(err, "failed to get VSphereFailureDomain %s", deploymentZone.Spec.FailureDomain)
+		}
+		checker.AddFailureDomain(ctx, vsphereFailureDomain)
+		failureDomains = append(failureDomains, failureDomain{deploymentZone: deploymentZone, failureDomain: vsphereFailureDomain})
+	}
+
+	clusterName := vsphereCluster.Labels[clusterv1.ClusterNameLabel]
+	if clusterName == "" {
+		return nil
+	}
+	templates := &infrav1.VSphereMachineTemplateList{}
+	if err := c.List(ctx, templates, client.InNamespace(vsphereCluster.Namespace), client.MatchingLabels{clusterv1.ClusterNameLabel: clusterName}); err != nil {
+		return pkgerrors.Wrap(err, "failed to list VSphereMachineTemplates")
+	}
+	for _, template := range templates.Items {
+		spec := template.Spec.Template.Spec.VirtualMachineCloneSpec
+		// The templates on another vCenter server are checked with its
+		// session by the VSphereVM controller when the VMs are cloned.
+		if spec.Server != "" && spec.Server != vsphereCluster.Spec.Server {
+			continue
+		}
+		if len(failureDomains) == 0 {
+			checker.AddVM(ctx, &infrav1.VSphereVM{Spec: infrav1.VSphereVMSpec{VirtualMachineCloneSpec: spec}})
+			continue
+		}
+		for _, fd := range failureDomains {
+			vm := &infrav1.VSphereVM{Spec: infrav1.VSphereVMSpec{VirtualMachineCloneSpec: *spec.DeepCopy()}}
+			services.OverrideWithFailureDomain(vm, fd.deploymentZone, fd.failureDomain)
+			checker.AddVM(ctx, vm)
+		}
+	}
+
+	// The VSphereVMs mostly use the objects of the templates, but they also
+	// carry the settings which are not part of them, like snapshot policies.
+	vms := &infrav1.VSphereVMList{}
+	if err := c.List(ctx, vms, client.InNamespace(vsphereCluster.Namespace), client.MatchingLabels{clusterv1.ClusterNameLabel: clusterName}); err != nil {
+		return pkgerrors.Wrap(err, "failed to list VSphereVMs")
+	}
+	for i := range vms.Items {
+		vm := &vms.Items[i]
+		if !vm.DeletionTimestamp.IsZero() || vm.Spec.Server != vsphereCluster.Spec.Server {
+			continue
+		}
+		checker.AddVM(ctx, vm)
+	}
+	return nil
+}
+
+// markPrivilegesSufficient sets the PrivilegesSufficient condition of the
+// object from the messages listing the missing privileges, and the error to
+// check them. The missing privileges take precedence over the error, which
+// only affects the objects which could not be checked.
+func markPrivilegesSufficient(ctx context.Context, obj conditions.Setter, missing []string, err error) {
+	switch {
+	case len(missing) > 0:
+		if err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to check some of the vCenter privileges")
+		}
+		conditions.MarkFalse(obj, infrav1.PrivilegesSufficientCondition, infrav1.PrivilegesMissingReason, clusterv1.ConditionSeverityWarning, strings.Join(missing, "; "))
+	case err != nil:
+		conditions.MarkFalse(obj, infrav1.PrivilegesSufficientCondition, infrav1.PrivilegesCheckFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+	default:
+		conditions.MarkTrue(obj, infrav1.PrivilegesSufficientCondition)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/internal/test/helpers/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+func TestVSphereClusterIdentityPrivileges(t *testing.T) {
+	model := simulator.VPX()
+	model.Host = 0
+
+	simr, err := vcsim.NewBuilder().WithModel(model).Build()
+	if err != nil {
+		t.Fatalf("unable to create simulator: %s", err)
+	}
+	defer simr.Destroy()
+
+	ctx := context.Background()
+	g := NewWithT(t)
+
+	identity := &infrav1.VSphereClusterIdentity{
+		ObjectMeta: metav1.ObjectMeta{Name: "identity"},
+		Spec: infrav1.VSphereClusterIdentitySpec{
+			SecretName:        "identity-secret",
+			AllowedNamespaces: &infrav1.AllowedNamespaces{},
+		},
+		Status: infrav1.VSphereClusterIdentityStatus{Ready: true},
+	}
+	vsphereCluster := &infrav1.VSphereCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vsphere-cluster",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster"},
+		},
+		Spec: infrav1.VSphereClusterSpec{
+			Server:      simr.ServerURL().Host,
+			IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: "identity"},
+		},
+	}
+	cloneSpec := infrav1.VirtualMachineCloneSpec{
+		Template:  "DC0_C0_RP0_VM0",
+		Datastore: "LocalDS_0",
+		Network:   infrav1.NetworkSpec{Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "VM Network"}}},
+	}
+	vsphereMachineTemplate := &infrav1.VSphereMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "template",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster"},
+		},
+		Spec: infrav1.VSphereMachineTemplateSpec{
+			Template: infrav1.VSphereMachineTemplateResource{
+				Spec: infrav1.VSphereMachineSpec{VirtualMachineCloneSpec: cloneSpec},
+			},
+		},
+	}
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vm",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster"},
+		},
+		Spec: infrav1.VSphereVMSpec{
+			VirtualMachineCloneSpec: cloneSpec,
+			SnapshotPolicy:          &infrav1.VSphereVMSnapshotPolicy{},
+		},
+	}
+	vsphereVM.Spec.Server = simr.ServerURL().Host
+
+	controllerManagerCtx := fake.NewControllerManagerContext(
+		identity, vsphereCluster, vsphereMachineTemplate, vsphereVM,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity-secret", Namespace: fake.ControllerManagerNamespace},
+			Data: map[string][]byte{
+				"username": []byte(simr.Username()),
+				"password": []byte(simr.Password()),
+			},
+		},
+	)
+	r := clusterIdentityReconciler{
+		ControllerManagerCtx: controllerManagerCtx,
+		Client:               controllerManagerCtx.Client,
+		Recorder:             record.NewFakeRecorder(10),
+		credentials:          &sync.Map{},
+	}
+
+	r.reconcilePrivileges(ctx, identity)
+	g.Expect(conditions.IsTrue(identity, infrav1.PrivilegesSufficientCondition)).To(BeTrue())
+
+	// The privileges of the user are the ones of the Admin role of the simulator.
+	s, err := session.GetOrCreate(ctx, session.NewParams().
+		WithServer(simr.ServerURL().Host).
+		WithUserInfo(simr.Username(), simr.Password()))
+	g.Expect(err).ToNot(HaveOccurred())
+	authorizationManager := object.NewAuthorizationManager(s.Client.Client)
+	roles, err := authorizationManager.RoleList(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	admin := roles.ByName("Admin")
+	var privileges []string
+	for _, privilege := range admin.Privilege {
+		if privilege != "VirtualMachine.State.CreateSnapshot" {
+			privileges = append(privileges, privilege)
+		}
+	}
+	g.Expect(authorizationManager.UpdateRole(ctx, admin.RoleId, admin.Name, privileges)).To(Succeed())
+
+	r.reconcilePrivileges(ctx, identity)
+	g.Expect(conditions.IsFalse(identity, infrav1.PrivilegesSufficientCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(identity, infrav1.PrivilegesSufficientCondition)).To(Equal(infrav1.PrivilegesMissingReason))
+	g.Expect(conditions.GetMessage(identity, infrav1.PrivilegesSufficientCondition)).To(Equal(
+		simr.ServerURL().Host + `: missing privileges on folder "/DC0/vm": VirtualMachine.State.CreateSnapshot`))
+
+	// The condition is removed once the identity is no longer used.
+	g.Expect(r.Client.Delete(ctx, vsphereCluster)).To(Succeed())
+	r.reconcilePrivileges(ctx, identity)
+	g.Expect(conditions.Has(identity, infrav1.PrivilegesSufficientCondition)).To(BeFalse())
+}
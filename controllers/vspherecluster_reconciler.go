@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	pkgerrors "github.com/pkg/errors"
@@ -46,6 +47,7 @@ import (
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/privileges"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
 	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
@@ -56,6 +58,10 @@ type clusterReconciler struct {
 
 	vmService               services.VimMachineService
 	clusterModuleReconciler Reconciler
+
+	// credentials are the credentials of the vCenter sessions of the clusters
+	// by UID, which are used to detect their rotation.
+	credentials sync.Map
 }
 
 // Reconcile ensures the back-end state reflects the Kubernetes resource state intent.
@@ -127,6 +133,7 @@ func (r *clusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_
 
 func (r *clusterReconciler) reconcileDelete(ctx context.Context, clusterCtx *capvcontext.ClusterContext) (reconcile.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
+	r.credentials.Delete(clusterCtx.VSphereCluster.UID)
 
 	vsphereMachines, err := r.vmService.GetMachinesInCluster(ctx, clusterCtx.Cluster.Namespace, clusterCtx.Cluster.Name)
 	if err != nil {
@@ -186,6 +193,12 @@ func (r *clusterReconciler) reconcileDelete(ctx context.Context, clusterCtx *cap
 func (r *clusterReconciler) reconcileNormal(ctx context.Context, clusterCtx *capvcontext.ClusterContext) (reconcile.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 
+	vsphereServer, err := r.reconcileVSphereServer(ctx, clusterCtx)
+	if err != nil {
+		conditions.MarkFalse(clusterCtx.VSphereCluster, infrav1.VCenterAvailableCondition, infrav1.VSphereServerMisconfiguredReason, clusterv1.ConditionSeverityError, err.Error())
+		return reconcile.Result{}, err
+	}
+
 	ok, err := r.reconcileDeploymentZones(ctx, clusterCtx)
 	if err != nil {
 		return reconcile.Result{}, err
@@ -200,7 +213,7 @@ func (r *clusterReconciler) reconcileNormal(ctx context.Context, clusterCtx *cap
 		return reconcile.Result{}, err
 	}
 
-	vcenterSession, err := r.reconcileVCenterConnectivity(ctx, clusterCtx)
+	vcenterSession, err := r.reconcileVCenterConnectivity(ctx, clusterCtx, vsphereServer)
 	if err != nil {
 		conditions.MarkFalse(clusterCtx.VSphereCluster, infrav1.VCenterAvailableCondition, infrav1.VCenterUnreachableReason, clusterv1.ConditionSeverityError, err.Error())
 		return reconcile.Result{}, pkgerrors.Wrapf(err,
@@ -214,6 +227,8 @@ func (r *clusterReconciler) reconcileNormal(ctx context.Context, clusterCtx *cap
 		log.Error(err, "could not reconcile vCenter version")
 	}
 
+	r.reconcilePrivileges(ctx, clusterCtx, vcenterSession)
+
 	affinityReconcileResult, err := r.reconcileClusterModules(ctx, clusterCtx)
 	if err != nil {
 		conditions.MarkFalse(clusterCtx.VSphereCluster, infrav1.ClusterModulesAvailableCondition, infrav1.ClusterModuleSetupFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
@@ -268,27 +283,71 @@ func (r *clusterReconciler) reconcileIdentitySecret(ctx context.Context, cluster
 	return helper.Patch(ctx, secret)
 }
 
-func (r *clusterReconciler) reconcileVCenterConnectivity(ctx context.Context, clusterCtx *capvcontext.ClusterContext) (*session.Session, error) {
-	params := session.NewParams().
-		WithServer(clusterCtx.VSphereCluster.Spec.Server).
-		WithThumbprint(clusterCtx.VSphereCluster.Spec.Thumbprint).
-		WithFeatures(session.Feature{
-			EnableKeepAlive:   r.ControllerManagerContext.EnableKeepAlive,
-			KeepAliveDuration: r.ControllerManagerContext.KeepAliveDuration,
-		})
-
-	if clusterCtx.VSphereCluster.Spec.IdentityRef != nil {
-		creds, err := identity.GetCredentials(ctx, r.Client, clusterCtx.VSphereCluster, r.ControllerManagerContext.Namespace)
-		if err != nil {
-			return nil, pkgerrors.Wrap(err, "failed to get credentials from IdentityRef")
-		}
+// reconcileVSphereServer returns the VSphereServer referenced by the
+// VSphereCluster, if any, and sets the server of the VSphereCluster from it.
+func (r *clusterReconciler) reconcileVSphereServer(ctx context.Context, clusterCtx *capvcontext.ClusterContext) (*infrav1.VSphereServer, error) {
+	vsphereCluster := clusterCtx.VSphereCluster
+	if vsphereCluster.Spec.ServerRef == "" {
+		return nil, nil
+	}
+	if vsphereCluster.Spec.Thumbprint != "" || vsphereCluster.Spec.CABundleRef != nil || vsphereCluster.Spec.IdentityRef != nil {
+		return nil, errors.New("thumbprint, caBundleRef and identityRef cannot be set together with serverRef")
+	}
 
-		params = params.WithUserInfo(creds.Username, creds.Password)
-		return session.GetOrCreate(ctx, params)
+	vsphereServer := &infrav1.VSphereServer{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: vsphereCluster.Spec.ServerRef}, vsphereServer); err != nil {
+		return nil, pkgerrors.Wrapf(err, "failed to get VSphereServer %s", vsphereCluster.Spec.ServerRef)
 	}
 
-	params = params.WithUserInfo(r.ControllerManagerContext.Username, r.ControllerManagerContext.Password)
-	return session.GetOrCreate(ctx, params)
+	switch vsphereCluster.Spec.Server {
+	case "":
+		vsphereCluster.Spec.Server = vsphereServer.Spec.Server
+	case vsphereServer.Spec.Server:
+	default:
+		return nil, fmt.Errorf("server %s does not match the server %s of VSphereServer %s",
+			vsphereCluster.Spec.Server, vsphereServer.Spec.Server, vsphereServer.Name)
+	}
+	return vsphereServer, nil
+}
+
+func (r *clusterReconciler) reconcileVCenterConnectivity(ctx context.Context, clusterCtx *capvcontext.ClusterContext, vsphereServer *infrav1.VSphereServer) (*session.Session, error) {
+	params, credentials, err := getVSphereClusterSessionParams(ctx, r.Client, r.ControllerManagerContext, clusterCtx.VSphereCluster, vsphereServer)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, ok := r.credentials.Load(clusterCtx.VSphereCluster.UID)
+	rotated := ok && previous != credentials
+	s, err := session.GetOrCreate(ctx, params)
+	if err != nil {
+		if rotated {
+			conditions.MarkFalse(clusterCtx.VSphereCluster, infrav1.CredentialsRotatedCondition, infrav1.CredentialsRotationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		}
+		return nil, err
+	}
+	r.credentials.Store(clusterCtx.VSphereCluster.UID, credentials)
+
+	if rotated {
+		// GetOrCreate only drains the sessions created with the previous
+		// password, keypair or token of the same user.
+		previous := previous.(identity.Credentials)
+		ctrl.LoggerFrom(ctx).Info("Credentials rotated", "username", credentials.Username)
+		session.Drain(ctx, session.NewParams().
+			WithUserInfo(previous.Username, previous.Password).
+			WithCertificate(previous.Certificate, previous.PrivateKey).
+			WithToken(previous.Token))
+		markCredentialsRotated(clusterCtx.VSphereCluster)
+	}
+	return s, nil
+}
+
+// getVSphereClusterSessionParams returns the parameters of the vCenter
+// sessions of the VSphereCluster, and the credentials they are created with.
+func getVSphereClusterSessionParams(ctx context.Context, c client.Client, controllerManagerCtx *capvcontext.ControllerManagerContext, vsphereCluster *infrav1.VSphereCluster, vsphereServer *infrav1.VSphereServer) (*session.Params, identity.Credentials, error) {
+	params := session.NewParams().
+		WithServer(vsphereCluster.Spec.Server).
+		WithThumbprint(vsphereCluster.Spec.Thumbprint)
+	return identity.GetSessionParams(ctx, c, controllerManagerCtx, params, vsphereCluster, vsphereServer)
 }
 
 func (r *clusterReconciler) reconcileVCenterVersion(clusterCtx *capvcontext.ClusterContext, s *session.Session) error {
@@ -300,6 +359,25 @@ func (r *clusterReconciler) reconcileVCenterVersion(clusterCtx *capvcontext.Clus
 	return nil
 }
 
+// reconcilePrivileges checks the privileges of the user of the vCenter session
+// on the inventory objects used by the cluster. The missing privileges are
+// reported by the PrivilegesSufficient condition without failing the
+// reconciliation, since they may only be needed by some of the operations.
+func (r *clusterReconciler) reconcilePrivileges(ctx context.Context, clusterCtx *capvcontext.ClusterContext, s *session.Session) {
+	checker := privileges.NewChecker(s)
+	if err := addVSphereClusterInventory(ctx, r.Client, checker, clusterCtx.VSphereCluster); err != nil {
+		markPrivilegesSufficient(ctx, clusterCtx.VSphereCluster, nil, err)
+		return
+	}
+
+	missing, err := checker.Check(ctx)
+	var messages []string
+	if len(missing) > 0 {
+		messages = append(messages, privileges.Message(missing))
+	}
+	markPrivilegesSufficient(ctx, clusterCtx.VSphereCluster, messages, err)
+}
+
 func (r *clusterReconciler) reconcileDeploymentZones(ctx context.Context, clusterCtx *capvcontext.ClusterContext) (bool, error) {
 	// If there is no failure domain selector, skip reconciliation
 	if clusterCtx.VSphereCluster.Spec.FailureDomainSelector == nil {
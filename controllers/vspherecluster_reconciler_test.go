@@ -639,6 +639,75 @@ func TestClusterReconciler_ReconcileDeploymentZones(t *testing.T) {
 	})
 }
 
+func TestClusterReconciler_ReconcileVSphereServer(t *testing.T) {
+	server := "vcenter123.foo.com"
+	vsphereServer := &infrav1.VSphereServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vcenter"},
+		Spec:       infrav1.VSphereServerSpec{Server: server},
+	}
+
+	tests := []struct {
+		name       string
+		spec       infrav1.VSphereClusterSpec
+		wantServer string
+		wantErr    string
+	}{
+		{
+			name:       "without server reference",
+			spec:       infrav1.VSphereClusterSpec{Server: "other.foo.com"},
+			wantServer: "other.foo.com",
+		},
+		{
+			name:       "sets the server from the VSphereServer",
+			spec:       infrav1.VSphereClusterSpec{ServerRef: "vcenter"},
+			wantServer: server,
+		},
+		{
+			name:       "with the server of the VSphereServer",
+			spec:       infrav1.VSphereClusterSpec{Server: server, ServerRef: "vcenter"},
+			wantServer: server,
+		},
+		{
+			name:    "with another server",
+			spec:    infrav1.VSphereClusterSpec{Server: "other.foo.com", ServerRef: "vcenter"},
+			wantErr: "does not match the server",
+		},
+		{
+			name:    "with a thumbprint",
+			spec:    infrav1.VSphereClusterSpec{Thumbprint: "AA:BB:CC", ServerRef: "vcenter"},
+			wantErr: "cannot be set together with serverRef",
+		},
+		{
+			name:    "with a missing VSphereServer",
+			spec:    infrav1.VSphereClusterSpec{ServerRef: "missing"},
+			wantErr: "failed to get VSphereServer missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			controllerManagerContext := fake.NewControllerManagerContext(vsphereServer.DeepCopy())
+			clusterCtx := fake.NewClusterContext(ctx, controllerManagerContext)
+			clusterCtx.VSphereCluster.Spec = tt.spec
+
+			r := clusterReconciler{
+				ControllerManagerContext: controllerManagerContext,
+				Client:                   controllerManagerContext.Client,
+			}
+			got, err := r.reconcileVSphereServer(ctx, clusterCtx)
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got == nil).To(Equal(tt.spec.ServerRef == ""))
+			g.Expect(clusterCtx.VSphereCluster.Spec.Server).To(Equal(tt.wantServer))
+		})
+	}
+}
+
 func deploymentZone(server, fdName string, cp, ready *bool) *infrav1.VSphereDeploymentZone {
 	return &infrav1.VSphereDeploymentZone{
 		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("zone-%s", fdName)},
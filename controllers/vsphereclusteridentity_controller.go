@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -37,12 +38,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	pkgidentity "sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/privileges"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
 )
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusteridentities,verbs=get;list;watch;create;update;patch;delete
@@ -55,10 +59,16 @@ func AddVsphereClusterIdentityControllerToManager(ctx context.Context, controlle
 		ControllerManagerCtx: controllerManagerCtx,
 		Client:               controllerManagerCtx.Client,
 		Recorder:             mgr.GetEventRecorderFor("vsphereclusteridentity-controller"),
+		credentials:          &sync.Map{},
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrav1.VSphereClusterIdentity{}).
+		// Watch the secrets of the identities to detect the rotation of their credentials.
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &infrav1.VSphereClusterIdentity{}),
+		).
 		WithOptions(options).
 		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), controllerManagerCtx.WatchFilterValue)).
 		Complete(reconciler)
@@ -68,6 +78,11 @@ type clusterIdentityReconciler struct {
 	ControllerManagerCtx *capvcontext.ControllerManagerContext
 	Client               client.Client
 	Recorder             record.EventRecorder
+
+	// credentials are the credentials of the identities by UID, which are
+	// used to detect their rotation. Like the vCenter sessions created with
+	// them, they are only kept in memory.
+	credentials *sync.Map
 }
 
 func (r clusterIdentityReconciler) Reconcile(ctx context.Context, req reconcile.Request) (_ reconcile.Result, reterr error) {
@@ -87,6 +102,10 @@ func (r clusterIdentityReconciler) Reconcile(ctx context.Context, req reconcile.
 		return reconcile.Result{}, nil
 	}
 
+	// The VSphereClusters can only use the identity, and its privileges be
+	// checked with their sessions, once it is reported as ready.
+	wasReady := identity.Status.Ready
+
 	// Create the patch helper.
 	patchHelper, err := patch.NewHelper(identity, r.Client)
 	if err != nil {
@@ -122,6 +141,13 @@ func (r clusterIdentityReconciler) Reconcile(ctx context.Context, req reconcile.
 		return reconcile.Result{}, errors.Wrapf(err, "failed to get Secret %s", klog.KRef(secretKey.Namespace, secretKey.Name))
 	}
 
+	credentials := *pkgidentity.GetCredentialsFromSecret(secret)
+	if err := credentials.Validate(); err != nil {
+		conditions.MarkFalse(identity, infrav1.CredentialsAvailableCondidtion, infrav1.SecretInvalidReason, clusterv1.ConditionSeverityError, err.Error())
+		identity.Status.Ready = false
+		return reconcile.Result{}, errors.Wrapf(err, "invalid credentials in Secret %s", klog.KObj(secret))
+	}
+
 	// If this secret is owned by a different VSphereClusterIdentity or a VSphereCluster, mark the identity as not ready and return an error.
 	if !clusterutilv1.IsOwnedByObject(secret, identity) && pkgidentity.IsOwnedByIdentityOrCluster(secret.GetOwnerReferences()) {
 		conditions.MarkFalse(identity, infrav1.CredentialsAvailableCondidtion, infrav1.SecretAlreadyInUseReason, clusterv1.ConditionSeverityError, "secret being used by another Cluster/VSphereIdentity")
@@ -150,11 +176,104 @@ func (r clusterIdentityReconciler) Reconcile(ctx context.Context, req reconcile.
 
 	conditions.MarkTrue(identity, infrav1.CredentialsAvailableCondidtion)
 	identity.Status.Ready = true
+
+	// The sessions created with the previous credentials are drained when the
+	// sessions with the rotated credentials are created.
+	if previous, ok := r.credentials.Swap(identity.UID, credentials); ok && previous != credentials {
+		log.Info("Credentials rotated", "Secret", klog.KObj(secret))
+		r.Recorder.Eventf(identity, corev1.EventTypeNormal, "CredentialsRotated", "Credentials of Secret %s rotated", secret.Name)
+		markCredentialsRotated(identity)
+	}
+
+	if wasReady {
+		r.reconcilePrivileges(ctx, identity)
+	}
 	return reconcile.Result{}, nil
 }
 
+// reconcilePrivileges checks the privileges of the user of the identity on the
+// inventory objects used by the VSphereClusters using it, on each of their
+// vCenter servers.
+func (r clusterIdentityReconciler) reconcilePrivileges(ctx context.Context, identity *infrav1.VSphereClusterIdentity) {
+	vsphereClusters := &infrav1.VSphereClusterList{}
+	if err := r.Client.List(ctx, vsphereClusters); err != nil {
+		markPrivilegesSufficient(ctx, identity, nil, errors.Wrap(err, "failed to list VSphereClusters"))
+		return
+	}
+
+	checkers := map[string]*privileges.Checker{}
+	var servers []string
+	var errs []error
+	for i := range vsphereClusters.Items {
+		vsphereCluster := &vsphereClusters.Items[i]
+		if !vsphereCluster.DeletionTimestamp.IsZero() || vsphereCluster.Spec.Server == "" {
+			continue
+		}
+		clusterIdentity, err := pkgidentity.GetIdentityForCluster(ctx, r.Client, vsphereCluster)
+		if err != nil || clusterIdentity == nil || clusterIdentity.Name != identity.Name {
+			continue
+		}
+
+		server := vsphereCluster.Spec.Server
+		checker, ok := checkers[server]
+		if !ok {
+			s, err := r.getVSphereClusterSession(ctx, vsphereCluster)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to create vCenter session for VSphereCluster %s", klog.KObj(vsphereCluster)))
+				continue
+			}
+			checker = privileges.NewChecker(s)
+			checkers[server] = checker
+			servers = append(servers, server)
+		}
+		if err := addVSphereClusterInventory(ctx, r.Client, checker, vsphereCluster); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to get inventory of VSphereCluster %s", klog.KObj(vsphereCluster)))
+		}
+	}
+
+	// The condition is only reported for the identities in use.
+	if len(servers) == 0 && len(errs) == 0 {
+		conditions.Delete(identity, infrav1.PrivilegesSufficientCondition)
+		return
+	}
+
+	var messages []string
+	for _, server := range servers {
+		missing, err := checkers[server].Check(ctx)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to check privileges on %s", server))
+		}
+		if len(missing) > 0 {
+			messages = append(messages, fmt.Sprintf("%s: %s", server, privileges.Message(missing)))
+		}
+	}
+	markPrivilegesSufficient(ctx, identity, messages, kerrors.NewAggregate(errs))
+}
+
+// getVSphereClusterSession returns a vCenter session of the VSphereCluster.
+func (r clusterIdentityReconciler) getVSphereClusterSession(ctx context.Context, vsphereCluster *infrav1.VSphereCluster) (*session.Session, error) {
+	vsphereServer, err := pkgidentity.GetVSphereServer(ctx, r.Client, vsphereCluster.Spec.ServerRef)
+	if err != nil {
+		return nil, err
+	}
+	params, _, err := getVSphereClusterSessionParams(ctx, r.Client, r.ControllerManagerCtx, vsphereCluster, vsphereServer)
+	if err != nil {
+		return nil, err
+	}
+	return session.GetOrCreate(ctx, params)
+}
+
+// markCredentialsRotated marks the CredentialsRotated condition of the object
+// as true, resetting its last transition time to the time of the rotation.
+func markCredentialsRotated(obj conditions.Setter) {
+	conditions.Delete(obj, infrav1.CredentialsRotatedCondition)
+	conditions.MarkTrue(obj, infrav1.CredentialsRotatedCondition)
+}
+
 func (r clusterIdentityReconciler) reconcileDelete(ctx context.Context, identity *infrav1.VSphereClusterIdentity) error {
 	log := ctrl.LoggerFrom(ctx)
+	r.credentials.Delete(identity.UID)
+
 	secret := &corev1.Secret{}
 	secretKey := client.ObjectKey{
 		Namespace: r.ControllerManagerCtx.Namespace,
@@ -187,5 +187,41 @@ var _ = Describe("VSphereClusterIdentity Reconciler", func() {
 				return false
 			}, timeout).Should(BeTrue())
 		})
+
+		It("should error if secret has an invalid TLS keypair", func() {
+			credentialSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "secret-",
+					Namespace:    controllerNamespace,
+				},
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       []byte("not a certificate"),
+					corev1.TLSPrivateKeyKey: []byte("not a private key"),
+				},
+			}
+			Expect(testEnv.Create(ctx, credentialSecret)).To(Succeed())
+
+			identity := &infrav1.VSphereClusterIdentity{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "identity-",
+				},
+				Spec: infrav1.VSphereClusterIdentitySpec{
+					SecretName: credentialSecret.Name,
+				},
+			}
+			Expect(testEnv.Create(ctx, identity)).To(Succeed())
+
+			Eventually(func() bool {
+				i := &infrav1.VSphereClusterIdentity{}
+				if err := testEnv.Get(ctx, client.ObjectKey{Name: identity.Name}, i); err != nil {
+					return false
+				}
+
+				if !i.Status.Ready && conditions.GetReason(i, infrav1.CredentialsAvailableCondidtion) == infrav1.SecretInvalidReason {
+					return true
+				}
+				return false
+			}, timeout).Should(BeTrue())
+		})
 	})
 })
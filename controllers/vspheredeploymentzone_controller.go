@@ -134,13 +134,20 @@ func (r vsphereDeploymentZoneReconciler) Reconcile(ctx context.Context, request
 }
 
 func (r vsphereDeploymentZoneReconciler) reconcileNormal(ctx context.Context, deploymentZoneCtx *capvcontext.VSphereDeploymentZoneContext) error {
+	vsphereServer, err := r.reconcileVSphereServer(ctx, deploymentZoneCtx)
+	if err != nil {
+		conditions.MarkFalse(deploymentZoneCtx.VSphereDeploymentZone, infrav1.VCenterAvailableCondition, infrav1.VSphereServerMisconfiguredReason, clusterv1.ConditionSeverityError, err.Error())
+		deploymentZoneCtx.VSphereDeploymentZone.Status.Ready = ptr.To(false)
+		return err
+	}
+
 	failureDomain := &infrav1.VSphereFailureDomain{}
 	failureDomainKey := client.ObjectKey{Name: deploymentZoneCtx.VSphereDeploymentZone.Spec.FailureDomain}
 	if err := r.Client.Get(ctx, failureDomainKey, failureDomain); err != nil {
 		return errors.Wrapf(err, "failed to get VSphereFailureDomain %s", klog.KRef(failureDomainKey.Namespace, failureDomainKey.Name))
 	}
 
-	authSession, err := r.getVCenterSession(ctx, deploymentZoneCtx, failureDomain.Spec.Topology.Datacenter)
+	authSession, err := r.getVCenterSession(ctx, deploymentZoneCtx, vsphereServer, failureDomain.Spec.Topology.Datacenter)
 	if err != nil {
 		conditions.MarkFalse(deploymentZoneCtx.VSphereDeploymentZone, infrav1.VCenterAvailableCondition, infrav1.VCenterUnreachableReason, clusterv1.ConditionSeverityError, err.Error())
 		deploymentZoneCtx.VSphereDeploymentZone.Status.Ready = ptr.To(false)
@@ -185,17 +192,60 @@ func (r vsphereDeploymentZoneReconciler) reconcilePlacementConstraint(ctx contex
 	return nil
 }
 
-func (r vsphereDeploymentZoneReconciler) getVCenterSession(ctx context.Context, deploymentZoneCtx *capvcontext.VSphereDeploymentZoneContext, datacenter string) (*session.Session, error) {
+// reconcileVSphereServer returns the VSphereServer referenced by the
+// VSphereDeploymentZone, if any, and sets the server of the
+// VSphereDeploymentZone from it.
+func (r vsphereDeploymentZoneReconciler) reconcileVSphereServer(ctx context.Context, deploymentZoneCtx *capvcontext.VSphereDeploymentZoneContext) (*infrav1.VSphereServer, error) {
+	deploymentZone := deploymentZoneCtx.VSphereDeploymentZone
+	if deploymentZone.Spec.ServerRef == "" {
+		return nil, nil
+	}
+
+	if deploymentZone.Spec.CABundleRef != nil {
+		return nil, errors.New("caBundleRef cannot be set together with serverRef")
+	}
+
+	vsphereServer := &infrav1.VSphereServer{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: deploymentZone.Spec.ServerRef}, vsphereServer); err != nil {
+		return nil, errors.Wrapf(err, "failed to get VSphereServer %s", deploymentZone.Spec.ServerRef)
+	}
+
+	switch deploymentZone.Spec.Server {
+	case "":
+		deploymentZone.Spec.Server = vsphereServer.Spec.Server
+	case vsphereServer.Spec.Server:
+	default:
+		return nil, errors.Errorf("server %s does not match the server %s of VSphereServer %s",
+			deploymentZone.Spec.Server, vsphereServer.Spec.Server, vsphereServer.Name)
+	}
+	return vsphereServer, nil
+}
+
+func (r vsphereDeploymentZoneReconciler) getVCenterSession(ctx context.Context, deploymentZoneCtx *capvcontext.VSphereDeploymentZoneContext, vsphereServer *infrav1.VSphereServer, datacenter string) (*session.Session, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	params := session.NewParams().
 		WithServer(deploymentZoneCtx.VSphereDeploymentZone.Spec.Server).
-		WithDatacenter(datacenter).
-		WithUserInfo(r.ControllerManagerContext.Username, r.ControllerManagerContext.Password).
-		WithFeatures(session.Feature{
-			EnableKeepAlive:   r.EnableKeepAlive,
-			KeepAliveDuration: r.KeepAliveDuration,
-		})
+		WithDatacenter(datacenter)
+
+	if vsphereServer != nil {
+		// The VSphereDeploymentZones are cluster-scoped, and are not
+		// restricted by the allowed namespaces of the identity.
+		params, _, err := identity.GetSessionParams(ctx, r.Client, r.ControllerManagerContext, params, nil, vsphereServer)
+		if err != nil {
+			return nil, err
+		}
+		return session.GetOrCreate(ctx, params)
+	}
+
+	var caBundle []byte
+	if ref := deploymentZoneCtx.VSphereDeploymentZone.Spec.CABundleRef; ref != nil {
+		var err error
+		caBundle, err = identity.GetCABundle(ctx, r.Client, ref, r.Namespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get CA bundle")
+		}
+	}
 
 	clusterList := &infrav1.VSphereClusterList{}
 	if err := r.Client.List(ctx, clusterList); err != nil {
@@ -211,20 +261,24 @@ func (r vsphereDeploymentZoneReconciler) getVCenterSession(ctx context.Context,
 		log := log.WithValues("VSphereCluster", klog.KRef(vsphereCluster.Namespace, vsphereCluster.Name))
 		ctx := ctrl.LoggerInto(ctx, log)
 
-		params = params.WithThumbprint(vsphereCluster.Spec.Thumbprint)
 		vsphereCluster := vsphereCluster
-		creds, err := identity.GetCredentials(ctx, r.Client, &vsphereCluster, r.Namespace)
+		clusterParams, _, err := identity.GetSessionParams(ctx, r.Client, r.ControllerManagerContext, params.WithThumbprint(vsphereCluster.Spec.Thumbprint), &vsphereCluster, nil)
 		if err != nil {
 			log.Error(err, "error retrieving credentials from IdentityRef")
 			continue
 		}
-		log.V(4).Info("Using credentials from VSphereCluster IdentityRef to create the authenticated session")
-		params = params.WithUserInfo(creds.Username, creds.Password)
-		return session.GetOrCreate(ctx, params)
+		// The CA bundle of the VSphereDeploymentZone has precedence over the
+		// one of the VSphereCluster.
+		if deploymentZoneCtx.VSphereDeploymentZone.Spec.CABundleRef != nil {
+			clusterParams = clusterParams.WithCABundle(caBundle)
+		}
+		return session.GetOrCreate(ctx, clusterParams)
 	}
 
-	// Fallback to using credentials provided to the manager
-	log.V(4).Info("Using credentials provided to the manager to create the authenticated session")
+	params, _, err := identity.GetSessionParams(ctx, r.Client, r.ControllerManagerContext, params.WithCABundle(caBundle), nil, nil)
+	if err != nil {
+		return nil, err
+	}
 	return session.GetOrCreate(ctx, params)
 }
 
@@ -0,0 +1,570 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbldr "sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
+	infrautilv1 "sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// machinePoolRequeueInterval is the interval between the reconciles of a
+// VSphereMachinePool whose VMs are not all ready.
+const machinePoolRequeueInterval = 15 * time.Second
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachinepools,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachinepools/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools;machinepools/status,verbs=get;list;watch
+
+// AddVSphereMachinePoolControllerToManager adds the VSphereMachinePool controller to the provided manager.
+func AddVSphereMachinePoolControllerToManager(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, mgr manager.Manager, options controller.Options) error {
+	reconciler := vsphereMachinePoolReconciler{
+		ControllerManagerContext: controllerManagerCtx,
+		Recorder:                 mgr.GetEventRecorderFor("vspheremachinepool-controller"),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Watch the controlled, infrastructure resource.
+		For(&infrav1.VSphereMachinePool{}).
+		WithOptions(options).
+		// Watch the CAPI resource that owns this infrastructure resource.
+		Watches(
+			&expv1.MachinePool{},
+			handler.EnqueueRequestsFromMapFunc(machinePoolToVSphereMachinePool),
+		).
+		// Watch the VSphereVMs of the pool.
+		Owns(&infrav1.VSphereVM{}).
+		Watches(
+			&clusterv1.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(reconciler.clusterToVSphereMachinePools),
+			ctrlbldr.WithPredicates(
+				predicates.ClusterUnpausedAndInfrastructureReady(ctrl.LoggerFrom(ctx)),
+			),
+		).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), controllerManagerCtx.WatchFilterValue)).
+		Complete(reconciler)
+}
+
+// vsphereMachinePoolReconciler reconciles the VSphereVMs of a
+// VSphereMachinePool. It creates and deletes VSphereVMs to reach the replicas
+// of the MachinePool, spreads them across its failure domains, and replaces
+// the VSphereVMs created from a previous template. The VMs of the VSphereVMs
+// are reconciled by the VSphereVM controller, like the ones of the
+// VSphereMachines.
+type vsphereMachinePoolReconciler struct {
+	*capvcontext.ControllerManagerContext
+	Recorder record.EventRecorder
+}
+
+func (r vsphereMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// Fetch the VSphereMachinePool for this request.
+	vsphereMachinePool := &infrav1.VSphereMachinePool{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vsphereMachinePool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Fetch the CAPI MachinePool.
+	machinePool, err := getOwnerMachinePool(ctx, r.Client, vsphereMachinePool.ObjectMeta)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "failed to get MachinePool for VSphereMachinePool")
+	}
+	if machinePool == nil {
+		log.Info("Waiting for MachinePool Controller to set OwnerRef on VSphereMachinePool")
+		return reconcile.Result{}, nil
+	}
+	log = log.WithValues("MachinePool", klog.KObj(machinePool))
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, r.Client, machinePool.ObjectMeta)
+	if err != nil {
+		log.Info("MachinePool is missing cluster label or cluster does not exist")
+		return reconcile.Result{}, nil
+	}
+	log = log.WithValues("Cluster", klog.KObj(cluster))
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	if annotations.IsPaused(cluster, vsphereMachinePool) {
+		log.Info("Reconciliation is paused for this object")
+		return reconcile.Result{}, nil
+	}
+
+	patchHelper, err := patch.NewHelper(vsphereMachinePool, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer func() {
+		conditions.SetSummary(vsphereMachinePool, conditions.WithConditions(infrav1.ReplicasReadyCondition))
+
+		if err := patchHelper.Patch(ctx, vsphereMachinePool, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.ReplicasReadyCondition,
+		}}); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	if !vsphereMachinePool.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, vsphereMachinePool)
+	}
+	return r.reconcileNormal(ctx, vsphereMachinePool, machinePool, cluster)
+}
+
+func (r vsphereMachinePoolReconciler) reconcileNormal(ctx context.Context, vsphereMachinePool *infrav1.VSphereMachinePool, machinePool *expv1.MachinePool, cluster *clusterv1.Cluster) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// If the VSphereMachinePool doesn't have our finalizer, add it.
+	ctrlutil.AddFinalizer(vsphereMachinePool, infrav1.MachinePoolFinalizer)
+
+	if !cluster.Status.InfrastructureReady {
+		log.Info("Cluster infrastructure is not ready yet")
+		conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, infrav1.WaitingForClusterInfrastructureReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{}, nil
+	}
+	if machinePool.Spec.Template.Spec.Bootstrap.DataSecretName == nil {
+		log.Info("Waiting for bootstrap data to be available")
+		conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, infrav1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{}, nil
+	}
+
+	vsphereVMs, err := r.getVSphereVMs(ctx, vsphereMachinePool)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var current []*infrav1.VSphereVM
+	for _, vsphereVM := range vsphereVMs {
+		if vsphereVM.DeletionTimestamp.IsZero() {
+			current = append(current, vsphereVM)
+		}
+	}
+
+	templateHash, err := getTemplateHash(vsphereMachinePool)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	replicas := ptr.Deref(machinePool.Spec.Replicas, 1)
+	maxSurge := ptr.Deref(vsphereMachinePool.Spec.MaxSurge, 1)
+
+	var upToDate, ready int32
+	var outdated int
+	for _, vsphereVM := range current {
+		if vsphereVM.Labels[infrav1.MachinePoolTemplateHashLabel] == templateHash {
+			upToDate++
+		} else {
+			outdated++
+		}
+		if vsphereVM.Status.Ready {
+			ready++
+		}
+	}
+
+	// Create the missing VSphereVMs from the current template, above the
+	// replicas by up to MaxSurge while the outdated ones are replaced. The
+	// pool is still scaled down and its status reported if a creation fails.
+	var errs []error
+	toCreate := min(replicas-upToDate, replicas+maxSurge-int32(len(current)))
+	for i := int32(0); i < toCreate; i++ {
+		vsphereVM, err := r.createVSphereVM(ctx, vsphereMachinePool, machinePool, cluster, templateHash, current)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		current = append(current, vsphereVM)
+	}
+
+	// Delete the VSphereVMs above the replicas, starting with the outdated
+	// ones, as long as the ready ones do not drop below the replicas.
+	for _, vsphereVM := range getVSphereVMsToDelete(current, templateHash, len(current)-int(replicas)) {
+		if vsphereVM.Status.Ready {
+			if ready <= replicas {
+				break
+			}
+			ready--
+		}
+		log.Info("Deleting VSphereVM", "VSphereVM", klog.KObj(vsphereVM))
+		if err := r.Client.Delete(ctx, vsphereVM); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete VSphereVM %s", klog.KObj(vsphereVM)))
+			continue
+		}
+		current = removeVSphereVM(current, vsphereVM)
+	}
+
+	r.reconcileStatus(vsphereMachinePool, current, replicas, templateHash)
+	if len(errs) > 0 {
+		return reconcile.Result{}, kerrors.NewAggregate(errs)
+	}
+	if !conditions.IsTrue(vsphereMachinePool, infrav1.ReplicasReadyCondition) {
+		return reconcile.Result{RequeueAfter: machinePoolRequeueInterval}, nil
+	}
+	return reconcile.Result{}, nil
+}
+
+func (r vsphereMachinePoolReconciler) reconcileDelete(ctx context.Context, vsphereMachinePool *infrav1.VSphereMachinePool) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
+	vsphereVMs, err := r.getVSphereVMs(ctx, vsphereMachinePool)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// The VMs of the deleted VSphereVMs are destroyed by the VSphereVM
+	// controller.
+	var errs []error
+	for _, vsphereVM := range vsphereVMs {
+		if !vsphereVM.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := r.Client.Delete(ctx, vsphereVM); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete VSphereVM %s", klog.KObj(vsphereVM)))
+		}
+	}
+	if len(errs) > 0 {
+		return reconcile.Result{}, kerrors.NewAggregate(errs)
+	}
+
+	if len(vsphereVMs) > 0 {
+		log.Info("Waiting for VSphereVMs to be deleted", "count", len(vsphereVMs))
+		return reconcile.Result{RequeueAfter: machinePoolRequeueInterval}, nil
+	}
+
+	// The VSphereVMs are deleted so remove the finalizer.
+	ctrlutil.RemoveFinalizer(vsphereMachinePool, infrav1.MachinePoolFinalizer)
+	return reconcile.Result{}, nil
+}
+
+// createVSphereVM creates a VSphereVM from the current template of the pool,
+// in its failure domain with the fewest VSphereVMs.
+func (r vsphereMachinePoolReconciler) createVSphereVM(ctx context.Context, vsphereMachinePool *infrav1.VSphereMachinePool, machinePool *expv1.MachinePool, cluster *clusterv1.Cluster, templateHash string, current []*infrav1.VSphereVM) (*infrav1.VSphereVM, error) {
+	template := vsphereMachinePool.Spec.Template
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: vsphereMachinePool.Namespace,
+			Name:      fmt.Sprintf("%s-%s", vsphereMachinePool.Name, rand.String(5)),
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel:           cluster.Name,
+				infrav1.MachinePoolNameLabel:         vsphereMachinePool.Name,
+				infrav1.MachinePoolTemplateHashLabel: templateHash,
+			},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(vsphereMachinePool, infrav1.GroupVersion.WithKind("VSphereMachinePool"))},
+			Finalizers:      []string{infrav1.VMFinalizer},
+		},
+		Spec: infrav1.VSphereVMSpec{
+			// Instruct the VSphereVM to use the CAPI bootstrap data resource.
+			BootstrapRef: &corev1.ObjectReference{
+				APIVersion: "v1",
+				Kind:       "Secret",
+				Name:       *machinePool.Spec.Template.Spec.Bootstrap.DataSecretName,
+				Namespace:  machinePool.Namespace,
+			},
+			PowerOffMode:             template.PowerOffMode,
+			GuestSoftPowerOffTimeout: template.GuestSoftPowerOffTimeout,
+		},
+	}
+	template.VirtualMachineCloneSpec.DeepCopyInto(&vsphereVM.Spec.VirtualMachineCloneSpec)
+
+	if failureDomain := getFailureDomainToPlace(machinePool.Spec.FailureDomains, current); failureDomain != "" {
+		vsphereDeploymentZone, vsphereFailureDomain, err := r.getFailureDomain(ctx, failureDomain)
+		if err != nil {
+			return nil, err
+		}
+		services.OverrideWithFailureDomain(vsphereVM, vsphereDeploymentZone, vsphereFailureDomain)
+		vsphereVM.Labels[infrav1.MachinePoolFailureDomainLabel] = failureDomain
+	}
+
+	// The vCenter is the one of the VSphereCluster, unless it is set by the
+	// template or the failure domain.
+	if vsphereVM.Spec.Server == "" || vsphereVM.Spec.Thumbprint == "" {
+		vsphereCluster, err := getVSphereCluster(ctx, r.Client, cluster)
+		if err != nil {
+			return nil, err
+		}
+		if vsphereVM.Spec.Server == "" {
+			vsphereVM.Spec.Server = vsphereCluster.Spec.Server
+		}
+		if vsphereVM.Spec.Thumbprint == "" {
+			vsphereVM.Spec.Thumbprint = vsphereCluster.Spec.Thumbprint
+		}
+	}
+
+	if err := r.Client.Create(ctx, vsphereVM); err != nil {
+		return nil, errors.Wrapf(err, "failed to create VSphereVM for VSphereMachinePool")
+	}
+	ctrl.LoggerFrom(ctx).Info("Created VSphereVM", "VSphereVM", klog.KObj(vsphereVM), "failureDomain", vsphereVM.Labels[infrav1.MachinePoolFailureDomainLabel])
+	return vsphereVM, nil
+}
+
+// reconcileStatus reports the provider IDs of the ready VSphereVMs of the pool,
+// and the progress of its scaling and rolling update.
+func (r vsphereMachinePoolReconciler) reconcileStatus(vsphereMachinePool *infrav1.VSphereMachinePool, current []*infrav1.VSphereVM, replicas int32, templateHash string) {
+	var providerIDs []string
+	var ready int32
+	var outdated int
+	for _, vsphereVM := range current {
+		if vsphereVM.Labels[infrav1.MachinePoolTemplateHashLabel] != templateHash {
+			outdated++
+		}
+		if !vsphereVM.Status.Ready {
+			continue
+		}
+		ready++
+		if providerID := infrautilv1.ConvertUUIDToProviderID(vsphereVM.Spec.BiosUUID); providerID != "" {
+			providerIDs = append(providerIDs, providerID)
+		}
+	}
+	sort.Strings(providerIDs)
+	vsphereMachinePool.Spec.ProviderIDList = providerIDs
+	vsphereMachinePool.Status.Replicas = ready
+	// The pool stays ready while it is scaled or its VSphereVMs are replaced,
+	// so that the MachinePool is not provisioned again.
+	vsphereMachinePool.Status.Ready = vsphereMachinePool.Status.Ready || ready >= replicas
+
+	switch {
+	case outdated > 0:
+		conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, infrav1.RollingUpdateInProgressReason, clusterv1.ConditionSeverityInfo,
+			"%d of %d VSphereVMs are outdated", outdated, len(current))
+	case int32(len(current)) < replicas:
+		conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, infrav1.ScalingUpReason, clusterv1.ConditionSeverityInfo,
+			"Scaling up to %d replicas (actual %d)", replicas, len(current))
+	case int32(len(current)) > replicas:
+		conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, infrav1.ScalingDownReason, clusterv1.ConditionSeverityInfo,
+			"Scaling down to %d replicas (actual %d)", replicas, len(current))
+	case ready < replicas:
+		conditions.MarkFalse(vsphereMachinePool, infrav1.ReplicasReadyCondition, infrav1.WaitingForVMsReason, clusterv1.ConditionSeverityInfo,
+			"%d of %d VSphereVMs are ready", ready, replicas)
+	default:
+		conditions.MarkTrue(vsphereMachinePool, infrav1.ReplicasReadyCondition)
+	}
+}
+
+// getVSphereVMs returns the VSphereVMs of the pool, sorted by name.
+func (r vsphereMachinePoolReconciler) getVSphereVMs(ctx context.Context, vsphereMachinePool *infrav1.VSphereMachinePool) ([]*infrav1.VSphereVM, error) {
+	vsphereVMList := &infrav1.VSphereVMList{}
+	if err := r.Client.List(ctx, vsphereVMList,
+		ctrlclient.InNamespace(vsphereMachinePool.Namespace),
+		ctrlclient.MatchingLabels{infrav1.MachinePoolNameLabel: vsphereMachinePool.Name}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list VSphereVMs of VSphereMachinePool")
+	}
+	vsphereVMs := make([]*infrav1.VSphereVM, 0, len(vsphereVMList.Items))
+	for i := range vsphereVMList.Items {
+		if metav1.IsControlledBy(&vsphereVMList.Items[i], vsphereMachinePool) {
+			vsphereVMs = append(vsphereVMs, &vsphereVMList.Items[i])
+		}
+	}
+	sort.Slice(vsphereVMs, func(i, j int) bool { return vsphereVMs[i].Name < vsphereVMs[j].Name })
+	return vsphereVMs, nil
+}
+
+// getVSphereCluster returns the VSphereCluster of the Cluster.
+func getVSphereCluster(ctx context.Context, c ctrlclient.Client, cluster *clusterv1.Cluster) (*infrav1.VSphereCluster, error) {
+	if cluster.Spec.InfrastructureRef == nil {
+		return nil, errors.Errorf("failed to get VSphereCluster: Cluster.spec.infrastructureRef of Cluster %s is nil", klog.KObj(cluster))
+	}
+	vsphereCluster := &infrav1.VSphereCluster{}
+	if err := c.Get(ctx, ctrlclient.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Spec.InfrastructureRef.Name}, vsphereCluster); err != nil {
+		return nil, errors.Wrapf(err, "failed to get VSphereCluster %s", cluster.Spec.InfrastructureRef.Name)
+	}
+	return vsphereCluster, nil
+}
+
+// getFailureDomain returns the VSphereDeploymentZone and the
+// VSphereFailureDomain of a failure domain.
+func (r vsphereMachinePoolReconciler) getFailureDomain(ctx context.Context, name string) (*infrav1.VSphereDeploymentZone, *infrav1.VSphereFailureDomain, error) {
+	vsphereDeploymentZone := &infrav1.VSphereDeploymentZone{}
+	if err := r.Client.Get(ctx, apitypes.NamespacedName{Name: name}, vsphereDeploymentZone); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get VSphereDeploymentZone %s", name)
+	}
+	vsphereFailureDomain := &infrav1.VSphereFailureDomain{}
+	if err := r.Client.Get(ctx, apitypes.NamespacedName{Name: vsphereDeploymentZone.Spec.FailureDomain}, vsphereFailureDomain); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get VSphereFailureDomain %s", vsphereDeploymentZone.Spec.FailureDomain)
+	}
+	return vsphereDeploymentZone, vsphereFailureDomain, nil
+}
+
+func (r vsphereMachinePoolReconciler) clusterToVSphereMachinePools(ctx context.Context, a ctrlclient.Object) []reconcile.Request {
+	requests := []reconcile.Request{}
+	vsphereMachinePools := &infrav1.VSphereMachinePoolList{}
+	if err := r.Client.List(ctx, vsphereMachinePools,
+		ctrlclient.InNamespace(a.GetNamespace()),
+		ctrlclient.MatchingLabels{clusterv1.ClusterNameLabel: a.GetName()}); err != nil {
+		return requests
+	}
+	for _, vsphereMachinePool := range vsphereMachinePools.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: apitypes.NamespacedName{
+			Namespace: vsphereMachinePool.Namespace,
+			Name:      vsphereMachinePool.Name,
+		}})
+	}
+	return requests
+}
+
+// machinePoolToVSphereMachinePool returns a request for the VSphereMachinePool
+// of a MachinePool.
+func machinePoolToVSphereMachinePool(_ context.Context, a ctrlclient.Object) []reconcile.Request {
+	machinePool, ok := a.(*expv1.MachinePool)
+	if !ok {
+		return nil
+	}
+	ref := machinePool.Spec.Template.Spec.InfrastructureRef
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != infrav1.GroupVersion.Group || ref.Kind != "VSphereMachinePool" || ref.Name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: apitypes.NamespacedName{
+		Namespace: machinePool.Namespace,
+		Name:      ref.Name,
+	}}}
+}
+
+// getOwnerMachinePool returns the MachinePool owning the object, or nil if it
+// has none.
+func getOwnerMachinePool(ctx context.Context, c ctrlclient.Client, obj metav1.ObjectMeta) (*expv1.MachinePool, error) {
+	for _, ref := range obj.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Kind != "MachinePool" || gv.Group != expv1.GroupVersion.Group {
+			continue
+		}
+		machinePool := &expv1.MachinePool{}
+		if err := c.Get(ctx, ctrlclient.ObjectKey{Namespace: obj.Namespace, Name: ref.Name}, machinePool); err != nil {
+			return nil, err
+		}
+		return machinePool, nil
+	}
+	return nil, nil
+}
+
+// getTemplateHash returns the hash of the template of the pool, which changes
+// when the VSphereVMs of the pool have to be replaced.
+func getTemplateHash(vsphereMachinePool *infrav1.VSphereMachinePool) (string, error) {
+	data, err := json.Marshal(vsphereMachinePool.Spec.Template)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to compute the template hash of VSphereMachinePool")
+	}
+	hasher := fnv.New32a()
+	_, _ = hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// getFailureDomainToPlace returns the failure domain with the fewest
+// VSphereVMs, or an empty string if there are no failure domains.
+func getFailureDomainToPlace(failureDomains []string, current []*infrav1.VSphereVM) string {
+	if len(failureDomains) == 0 {
+		return ""
+	}
+	counts := getFailureDomainCounts(current)
+	placed := failureDomains[0]
+	for _, failureDomain := range failureDomains[1:] {
+		if counts[failureDomain] < counts[placed] {
+			placed = failureDomain
+		}
+	}
+	return placed
+}
+
+// getVSphereVMsToDelete returns up to count VSphereVMs to delete, starting
+// with the outdated ones which are not ready, then the outdated ones, then
+// the ones which are not ready. Ties are broken by deleting from the failure
+// domain with the most VSphereVMs.
+func getVSphereVMsToDelete(current []*infrav1.VSphereVM, templateHash string, count int) []*infrav1.VSphereVM {
+	if count <= 0 {
+		return nil
+	}
+	priority := func(vsphereVM *infrav1.VSphereVM) int {
+		outdated := vsphereVM.Labels[infrav1.MachinePoolTemplateHashLabel] != templateHash
+		switch {
+		case outdated && !vsphereVM.Status.Ready:
+			return 0
+		case outdated:
+			return 1
+		case !vsphereVM.Status.Ready:
+			return 2
+		default:
+			return 3
+		}
+	}
+	counts := getFailureDomainCounts(current)
+	candidates := append([]*infrav1.VSphereVM{}, current...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if pi, pj := priority(candidates[i]), priority(candidates[j]); pi != pj {
+			return pi < pj
+		}
+		return counts[candidates[i].Labels[infrav1.MachinePoolFailureDomainLabel]] > counts[candidates[j].Labels[infrav1.MachinePoolFailureDomainLabel]]
+	})
+	return candidates[:min(count, len(candidates))]
+}
+
+// getFailureDomainCounts returns the number of VSphereVMs by failure domain.
+func getFailureDomainCounts(vsphereVMs []*infrav1.VSphereVM) map[string]int {
+	counts := map[string]int{}
+	for _, vsphereVM := range vsphereVMs {
+		counts[vsphereVM.Labels[infrav1.MachinePoolFailureDomainLabel]]++
+	}
+	return counts
+}
+
+func removeVSphereVM(vsphereVMs []*infrav1.VSphereVM, removed *infrav1.VSphereVM) []*infrav1.VSphereVM {
+	result := make([]*infrav1.VSphereVM, 0, len(vsphereVMs))
+	for _, vsphereVM := range vsphereVMs {
+		if vsphereVM != removed {
+			result = append(result, vsphereVM)
+		}
+	}
+	return result
+}
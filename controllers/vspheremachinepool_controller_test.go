@@ -0,0 +1,236 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apirecord "k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestVSphereMachinePoolReconciler(t *testing.T) {
+	server := "vcenter.local"
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "test"},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{APIVersion: infrav1.GroupVersion.String(), Kind: "VSphereCluster", Name: "foo"},
+		},
+		Status: clusterv1.ClusterStatus{InfrastructureReady: true},
+	}
+	vsphereCluster := &infrav1.VSphereCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "test"},
+		Spec:       infrav1.VSphereClusterSpec{Server: server},
+	}
+	machinePool := &expv1.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "foo"},
+		},
+		Spec: expv1.MachinePoolSpec{
+			ClusterName:    "foo",
+			Replicas:       ptr.To(int32(3)),
+			FailureDomains: []string{"zone-a", "zone-b"},
+			Template: clusterv1.MachineTemplateSpec{
+				Spec: clusterv1.MachineSpec{
+					Bootstrap: clusterv1.Bootstrap{DataSecretName: ptr.To("foo-bootstrap")},
+					InfrastructureRef: corev1.ObjectReference{
+						APIVersion: infrav1.GroupVersion.String(),
+						Kind:       "VSphereMachinePool",
+						Name:       "foo",
+					},
+				},
+			},
+		},
+	}
+	vsphereMachinePool := &infrav1.VSphereMachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			Namespace:       "test",
+			UID:             "foo-vsphere-machine-pool",
+			Labels:          map[string]string{clusterv1.ClusterNameLabel: "foo"},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: expv1.GroupVersion.String(), Kind: "MachinePool", Name: "foo"}},
+		},
+		Spec: infrav1.VSphereMachinePoolSpec{
+			Template: infrav1.VSphereMachinePoolMachineTemplate{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Template: "ubuntu"},
+			},
+		},
+	}
+	var failureDomains []ctrlclient.Object
+	for _, name := range machinePool.Spec.FailureDomains {
+		failureDomains = append(failureDomains,
+			&infrav1.VSphereDeploymentZone{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: infrav1.VSphereDeploymentZoneSpec{
+					Server:              server,
+					FailureDomain:       name,
+					PlacementConstraint: infrav1.PlacementConstraint{ResourcePool: name},
+				},
+			},
+			&infrav1.VSphereFailureDomain{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: infrav1.VSphereFailureDomainSpec{
+					Topology: infrav1.Topology{Datacenter: "DC0"},
+				},
+			},
+		)
+	}
+
+	newReconciler := func() vsphereMachinePoolReconciler {
+		objs := append([]ctrlclient.Object{cluster.DeepCopy(), vsphereCluster.DeepCopy(), machinePool.DeepCopy(), vsphereMachinePool.DeepCopy()}, failureDomains...)
+		controllerManagerCtx := fake.NewControllerManagerContext(objs...)
+		return vsphereMachinePoolReconciler{
+			ControllerManagerContext: controllerManagerCtx,
+			Recorder:                 apirecord.NewFakeRecorder(100),
+		}
+	}
+	reconcile := func(g *WithT, r vsphereMachinePoolReconciler) (ctrl.Result, *infrav1.VSphereMachinePool, []infrav1.VSphereVM) {
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: util.ObjectKey(vsphereMachinePool)})
+		g.Expect(err).NotTo(HaveOccurred())
+		pool := &infrav1.VSphereMachinePool{}
+		g.Expect(r.Client.Get(context.Background(), util.ObjectKey(vsphereMachinePool), pool)).To(Succeed())
+		vsphereVMs := &infrav1.VSphereVMList{}
+		g.Expect(r.Client.List(context.Background(), vsphereVMs, ctrlclient.InNamespace("test"))).To(Succeed())
+		return result, pool, vsphereVMs.Items
+	}
+	// The VMs of the VSphereVMs are reconciled by the VSphereVM controller.
+	markVMsReady := func(g *WithT, r vsphereMachinePoolReconciler) {
+		vsphereVMs := &infrav1.VSphereVMList{}
+		g.Expect(r.Client.List(context.Background(), vsphereVMs, ctrlclient.InNamespace("test"))).To(Succeed())
+		for i := range vsphereVMs.Items {
+			vsphereVM := &vsphereVMs.Items[i]
+			if vsphereVM.Status.Ready {
+				continue
+			}
+			vsphereVM.Spec.BiosUUID = fmt.Sprintf("4215e8b2-3b4e-4b68-8f4e-2c9d3c0a%04d", i)
+			g.Expect(r.Client.Update(context.Background(), vsphereVM)).To(Succeed())
+			vsphereVM.Status.Ready = true
+			g.Expect(r.Client.Status().Update(context.Background(), vsphereVM)).To(Succeed())
+		}
+	}
+
+	t.Run("creates the replicas across the failure domains and reports their provider IDs", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := newReconciler()
+		result, pool, vsphereVMs := reconcile(g, r)
+		g.Expect(result.RequeueAfter).To(Equal(machinePoolRequeueInterval))
+		g.Expect(pool.Finalizers).To(ContainElement(infrav1.MachinePoolFinalizer))
+		g.Expect(pool.Status.Ready).To(BeFalse())
+		g.Expect(conditions.GetReason(pool, infrav1.ReplicasReadyCondition)).To(Equal(infrav1.WaitingForVMsReason))
+		g.Expect(vsphereVMs).To(HaveLen(3))
+		zones := map[string]int{}
+		for _, vsphereVM := range vsphereVMs {
+			g.Expect(metav1.IsControlledBy(&vsphereVM, pool)).To(BeTrue())
+			g.Expect(vsphereVM.Spec.BootstrapRef.Name).To(Equal("foo-bootstrap"))
+			g.Expect(vsphereVM.Spec.Template).To(Equal("ubuntu"))
+			g.Expect(vsphereVM.Spec.ResourcePool).To(Equal(vsphereVM.Labels[infrav1.MachinePoolFailureDomainLabel]))
+			zones[vsphereVM.Spec.ResourcePool]++
+		}
+		g.Expect(zones).To(HaveLen(2))
+
+		markVMsReady(g, r)
+		result, pool, _ = reconcile(g, r)
+		g.Expect(result.IsZero()).To(BeTrue())
+		g.Expect(pool.Status.Ready).To(BeTrue())
+		g.Expect(pool.Status.Replicas).To(Equal(int32(3)))
+		g.Expect(pool.Spec.ProviderIDList).To(HaveLen(3))
+		g.Expect(conditions.IsTrue(pool, infrav1.ReplicasReadyCondition)).To(BeTrue())
+	})
+
+	t.Run("replaces the VMs created from a previous template", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := newReconciler()
+		_, _, _ = reconcile(g, r)
+		markVMsReady(g, r)
+		_, pool, _ := reconcile(g, r)
+
+		pool.Spec.Template.NumCPUs = 4
+		g.Expect(r.Client.Update(context.Background(), pool)).To(Succeed())
+		result, pool, vsphereVMs := reconcile(g, r)
+		g.Expect(result.RequeueAfter).To(Equal(machinePoolRequeueInterval))
+		g.Expect(pool.Status.Ready).To(BeTrue())
+		g.Expect(conditions.GetReason(pool, infrav1.ReplicasReadyCondition)).To(Equal(infrav1.RollingUpdateInProgressReason))
+		g.Expect(vsphereVMs).To(HaveLen(4))
+
+		// Once the new VM is ready, an outdated one is deleted.
+		markVMsReady(g, r)
+		_, _, vsphereVMs = reconcile(g, r)
+		var deleting, upToDate int
+		for _, vsphereVM := range vsphereVMs {
+			if !vsphereVM.DeletionTimestamp.IsZero() {
+				deleting++
+			}
+			if vsphereVM.Spec.NumCPUs == 4 {
+				upToDate++
+			}
+		}
+		g.Expect(deleting).To(Equal(1))
+		g.Expect(upToDate).To(Equal(1))
+	})
+}
+
+func TestGetVSphereVMsToDelete(t *testing.T) {
+	newVSphereVM := func(name, templateHash, failureDomain string, ready bool) *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					infrav1.MachinePoolTemplateHashLabel:  templateHash,
+					infrav1.MachinePoolFailureDomainLabel: failureDomain,
+				},
+			},
+			Status: infrav1.VSphereVMStatus{Ready: ready},
+		}
+	}
+	current := []*infrav1.VSphereVM{
+		newVSphereVM("ready-a", "new", "a", true),
+		newVSphereVM("ready-b", "new", "b", true),
+		newVSphereVM("ready-b2", "new", "b", true),
+		newVSphereVM("not-ready", "new", "a", false),
+		newVSphereVM("outdated", "old", "a", true),
+		newVSphereVM("outdated-not-ready", "old", "a", false),
+	}
+
+	g := NewWithT(t)
+	g.Expect(getVSphereVMsToDelete(current, "new", 0)).To(BeEmpty())
+	var names []string
+	for _, vsphereVM := range getVSphereVMsToDelete(current, "new", 5) {
+		names = append(names, vsphereVM.Name)
+	}
+	g.Expect(names).To(Equal([]string{"outdated-not-ready", "outdated", "not-ready", "ready-a", "ready-b"}))
+	g.Expect(getFailureDomainToPlace([]string{"a", "b", "c"}, current)).To(Equal("c"))
+	g.Expect(getFailureDomainToPlace(nil, current)).To(BeEmpty())
+}
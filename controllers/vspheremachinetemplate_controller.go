@@ -0,0 +1,220 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// gpuResourceNames maps the vendor IDs of the PCI devices to the resource
+// names under which the device plugins of the vendors advertise their GPUs.
+var gpuResourceNames = map[int32]corev1.ResourceName{
+	0x10DE: "nvidia.com/gpu",
+	0x1002: "amd.com/gpu",
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachinetemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vspheremachinetemplates/status,verbs=get;update;patch
+
+// AddVSphereMachineTemplateControllerToManager adds the VSphereMachineTemplate controller to the provided manager.
+func AddVSphereMachineTemplateControllerToManager(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, mgr manager.Manager, options controller.Options) error {
+	reconciler := vsphereMachineTemplateReconciler{
+		ControllerManagerContext: controllerManagerCtx,
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.VSphereMachineTemplate{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), controllerManagerCtx.WatchFilterValue)).
+		Complete(reconciler)
+}
+
+// vsphereMachineTemplateReconciler reports the capacity of the machines
+// created from a VSphereMachineTemplate, so that the cluster autoscaler can
+// scale a MachineDeployment from zero.
+type vsphereMachineTemplateReconciler struct {
+	*capvcontext.ControllerManagerContext
+}
+
+func (r vsphereMachineTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereMachineTemplate := &infrav1.VSphereMachineTemplate{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vsphereMachineTemplate); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// The VSphereCluster of the Cluster, if any, provides the credentials
+	// used to look up the vCenter template.
+	var vsphereCluster *infrav1.VSphereCluster
+	cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, r.Client, vsphereMachineTemplate.ObjectMeta)
+	if err == nil {
+		log = log.WithValues("Cluster", klog.KObj(cluster))
+		ctx = ctrl.LoggerInto(ctx, log)
+
+		if annotations.IsPaused(cluster, vsphereMachineTemplate) {
+			log.Info("Reconciliation is paused for this object")
+			return reconcile.Result{}, nil
+		}
+		if cluster.Spec.InfrastructureRef != nil {
+			vsphereCluster = &infrav1.VSphereCluster{}
+			key := ctrlclient.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Spec.InfrastructureRef.Name}
+			if err := r.Client.Get(ctx, key, vsphereCluster); err != nil {
+				log.V(4).Info("Failed to get VSphereCluster, using credentials provided to the manager", "err", err.Error())
+				vsphereCluster = nil
+			}
+		}
+	} else if annotations.HasPaused(vsphereMachineTemplate) {
+		log.Info("Reconciliation is paused for this object")
+		return reconcile.Result{}, nil
+	}
+
+	patchHelper, err := patch.NewHelper(vsphereMachineTemplate, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer func() {
+		if err := patchHelper.Patch(ctx, vsphereMachineTemplate); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	return reconcile.Result{}, r.reconcileCapacity(ctx, vsphereMachineTemplate, vsphereCluster)
+}
+
+func (r vsphereMachineTemplateReconciler) reconcileCapacity(ctx context.Context, vsphereMachineTemplate *infrav1.VSphereMachineTemplate, vsphereCluster *infrav1.VSphereCluster) error {
+	spec := vsphereMachineTemplate.Spec.Template.Spec
+
+	// The disk omitted in the spec defaults to the one of the vCenter
+	// template. The disk of the content library items is not known before
+	// they are deployed, so it is not reported.
+	var templateDiskGiB int32
+	if spec.DiskGiB == 0 && spec.Template != "" {
+		authSession, err := r.getVCenterSession(ctx, vsphereMachineTemplate, vsphereCluster)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get vCenter session")
+		}
+		templateDiskGiB, err = template.GetDiskGiB(ctx, authSession, spec.Template)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get disk size of template %q", spec.Template)
+		}
+	}
+
+	vsphereMachineTemplate.Status.Capacity = getMachineTemplateCapacity(spec, templateDiskGiB)
+	return nil
+}
+
+func (r vsphereMachineTemplateReconciler) getVCenterSession(ctx context.Context, vsphereMachineTemplate *infrav1.VSphereMachineTemplate, vsphereCluster *infrav1.VSphereCluster) (*session.Session, error) {
+	spec := vsphereMachineTemplate.Spec.Template.Spec
+
+	// The vCenter is the one of the VSphereCluster unless it is set by the
+	// template, like for the VSphereVMs.
+	server, thumbprint := spec.Server, spec.Thumbprint
+	if vsphereCluster != nil {
+		if server == "" {
+			server = vsphereCluster.Spec.Server
+		}
+		if thumbprint == "" {
+			thumbprint = vsphereCluster.Spec.Thumbprint
+		}
+	}
+
+	params := session.NewParams().
+		WithServer(server).
+		WithDatacenter(spec.Datacenter).
+		WithThumbprint(thumbprint)
+
+	// The VSphereServer of the VSphereCluster is only used if the template
+	// does not set another vCenter.
+	var vsphereServer *infrav1.VSphereServer
+	if vsphereCluster != nil && spec.Server == "" {
+		var err error
+		if vsphereServer, err = identity.GetVSphereServer(ctx, r.Client, vsphereCluster.Spec.ServerRef); err != nil {
+			return nil, err
+		}
+	}
+
+	params, _, err := identity.GetSessionParams(ctx, r.Client, r.ControllerManagerContext, params, vsphereCluster, vsphereServer)
+	if err != nil {
+		return nil, err
+	}
+	return session.GetOrCreate(ctx, params)
+}
+
+// getMachineTemplateCapacity returns the capacity of the machines created
+// from a VSphereMachineTemplate. The CPUs and the memory are the ones the
+// VMs are created with, and the disk omitted in the spec is the one of the
+// vCenter template if known.
+func getMachineTemplateCapacity(spec infrav1.VSphereMachineSpec, templateDiskGiB int32) corev1.ResourceList {
+	numCPUs, _, memoryMiB := vcenter.VMResources(&infrav1.VSphereVM{
+		Spec: infrav1.VSphereVMSpec{VirtualMachineCloneSpec: spec.VirtualMachineCloneSpec},
+	})
+	diskGiB := spec.DiskGiB
+	if diskGiB == 0 {
+		diskGiB = templateDiskGiB
+	}
+
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewQuantity(int64(numCPUs), resource.DecimalSI),
+		corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", memoryMiB)),
+	}
+	if diskGiB > 0 {
+		capacity[corev1.ResourceEphemeralStorage] = resource.MustParse(fmt.Sprintf("%dGi", diskGiB))
+	}
+
+	gpus := map[corev1.ResourceName]int64{}
+	for _, device := range spec.PciDevices {
+		if device.VendorID == nil {
+			continue
+		}
+		if name, ok := gpuResourceNames[*device.VendorID]; ok {
+			gpus[name]++
+		}
+	}
+	for name, count := range gpus {
+		capacity[name] = *resource.NewQuantity(count, resource.DecimalSI)
+	}
+
+	return capacity
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/simulator"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/internal/test/helpers/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestVSphereMachineTemplateReconciler(t *testing.T) {
+	model := simulator.VPX()
+	model.Host = 0
+
+	simr, err := vcsim.NewBuilder().WithModel(model).Build()
+	if err != nil {
+		t.Fatalf("unable to create simulator: %s", err)
+	}
+	defer simr.Destroy()
+
+	g := NewWithT(t)
+
+	// The memory of the machines defaults to the one the VMs are created
+	// with and the disk to the one of the vCenter template.
+	vsphereMachineTemplate := &infrav1.VSphereMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "test"},
+		Spec: infrav1.VSphereMachineTemplateSpec{
+			Template: infrav1.VSphereMachineTemplateResource{
+				Spec: infrav1.VSphereMachineSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						Server:     simr.ServerURL().Host,
+						Datacenter: "DC0",
+						Template:   "DC0_C0_RP0_VM0",
+						NumCPUs:    4,
+					},
+				},
+			},
+		},
+	}
+	controllerManagerCtx := fake.NewControllerManagerContext(vsphereMachineTemplate)
+	controllerManagerCtx.SetCredentials(simr.Username(), simr.Password())
+	r := vsphereMachineTemplateReconciler{ControllerManagerContext: controllerManagerCtx}
+
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: util.ObjectKey(vsphereMachineTemplate)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(vsphereMachineTemplate), vsphereMachineTemplate)).To(Succeed())
+	capacity := vsphereMachineTemplate.Status.Capacity
+	g.Expect(capacity.Cpu().Value()).To(Equal(int64(4)))
+	g.Expect(capacity.Memory().Value()).To(Equal(int64(2048 * 1024 * 1024)))
+	g.Expect(capacity).To(HaveKey(corev1.ResourceEphemeralStorage))
+}
+
+func TestGetMachineTemplateCapacity(t *testing.T) {
+	tests := []struct {
+		name            string
+		spec            infrav1.VirtualMachineCloneSpec
+		templateDiskGiB int32
+		want            corev1.ResourceList
+	}{
+		{
+			name: "reports the hardware of the spec",
+			spec: infrav1.VirtualMachineCloneSpec{NumCPUs: 2, MemoryMiB: 4096, DiskGiB: 25},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:              resource.MustParse("2"),
+				corev1.ResourceMemory:           resource.MustParse("4Gi"),
+				corev1.ResourceEphemeralStorage: resource.MustParse("25Gi"),
+			},
+		},
+		{
+			name:            "defaults to the disk of the vCenter template",
+			spec:            infrav1.VirtualMachineCloneSpec{NumCPUs: 8, MemoryMiB: 4096},
+			templateDiskGiB: 20,
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:              resource.MustParse("8"),
+				corev1.ResourceMemory:           resource.MustParse("4Gi"),
+				corev1.ResourceEphemeralStorage: resource.MustParse("20Gi"),
+			},
+		},
+		{
+			name:            "reports the CPUs and the memory the VMs are created with",
+			spec:            infrav1.VirtualMachineCloneSpec{NumCPUs: 1},
+			templateDiskGiB: 20,
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:              resource.MustParse("2"),
+				corev1.ResourceMemory:           resource.MustParse("2Gi"),
+				corev1.ResourceEphemeralStorage: resource.MustParse("20Gi"),
+			},
+		},
+		{
+			name: "reports the GPUs of the PCI devices",
+			spec: infrav1.VirtualMachineCloneSpec{
+				NumCPUs: 2,
+				PciDevices: []infrav1.PCIDeviceSpec{
+					{DeviceID: ptr.To(int32(0x1EB8)), VendorID: ptr.To(int32(0x10DE))},
+					{DeviceID: ptr.To(int32(0x1EB8)), VendorID: ptr.To(int32(0x10DE))},
+					{DeviceID: ptr.To(int32(0x1234)), VendorID: ptr.To(int32(0x8086))},
+				},
+			},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("2Gi"),
+				"nvidia.com/gpu":      resource.MustParse("2"),
+			},
+		},
+		{
+			name: "does not report the disk when it is not known",
+			spec: infrav1.VirtualMachineCloneSpec{},
+			want: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("2Gi"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got := getMachineTemplateCapacity(infrav1.VSphereMachineSpec{VirtualMachineCloneSpec: tt.spec}, tt.templateDiskGiB)
+			g.Expect(got).To(HaveLen(len(tt.want)))
+			for name, quantity := range tt.want {
+				g.Expect(got).To(HaveKey(name))
+				actual := got[name]
+				g.Expect(actual.Cmp(quantity)).To(Equal(0), "%s: got %s, want %s", name, actual.String(), quantity.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlutil "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/orphans"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereorphans,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereorphans/status,verbs=get;update;patch
+
+// OrphanCollectorOptions configures the collector of the orphaned vCenter
+// objects.
+type OrphanCollectorOptions struct {
+	// Interval is the interval between the scans of the vCenters. The
+	// collector is disabled if it is zero.
+	Interval time.Duration
+
+	// GracePeriod is the time during which an object must stay orphaned
+	// before it is deleted.
+	GracePeriod time.Duration
+
+	// Delete enables the deletion of the orphaned objects once their grace
+	// period expired. Otherwise, they are only reported.
+	Delete bool
+}
+
+// AddOrphanCollectorToManager adds the collector of the orphaned vCenter
+// objects to the provided manager.
+func AddOrphanCollectorToManager(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, mgr manager.Manager, options OrphanCollectorOptions) error {
+	if options.Interval <= 0 {
+		return nil
+	}
+	collector := &orphanCollector{
+		ControllerManagerContext: controllerManagerCtx,
+		Recorder:                 mgr.GetEventRecorderFor("vsphereorphan-collector"),
+		Options:                  options,
+	}
+	log := ctrl.LoggerFrom(ctx).WithName("vsphereorphan-collector")
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		wait.UntilWithContext(ctrl.LoggerInto(ctx, log), collector.collect, options.Interval)
+		return nil
+	}))
+}
+
+// orphanCollector periodically lists the VMs in the folders used by CAPV, the
+// cluster modules and the members of the VM groups of the failure domains,
+// and reports the ones which no CAPV object maps to with VSphereOrphans.
+// The orphaned objects are deleted once their grace period expired, if
+// enabled.
+type orphanCollector struct {
+	*capvcontext.ControllerManagerContext
+	Recorder record.EventRecorder
+	Options  OrphanCollectorOptions
+}
+
+// orphanScope is a datacenter of a vCenter used by CAPV.
+type orphanScope struct {
+	server     string
+	datacenter string
+	thumbprint string
+	folders    sets.Set[string]
+	vmGroups   sets.Set[orphans.VMGroup]
+}
+
+// foundOrphan is an orphaned object found in the datacenter of a scope.
+type foundOrphan struct {
+	orphans.Object
+	scope      *orphanScope
+	datacenter string
+}
+
+func (c *orphanCollector) collect(ctx context.Context) {
+	log := ctrl.LoggerFrom(ctx)
+	if err := c.reconcileOrphans(ctx); err != nil {
+		log.Error(err, "Failed to collect orphaned vCenter objects")
+	}
+}
+
+func (c *orphanCollector) reconcileOrphans(ctx context.Context) error {
+	scopes, owners, err := c.getOrphanScopes(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The VSphereOrphans of the datacenters which failed to be scanned are
+	// kept until the next scan.
+	var errs []error
+	found := map[string]foundOrphan{}
+	failed := sets.New[string]()
+	scannedModules := sets.New[string]()
+	for _, key := range sets.List(sets.KeySet(scopes)) {
+		scope := scopes[key]
+		objects, err := c.findOrphans(ctx, scope, owners, !scannedModules.Has(scope.server))
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to find orphaned objects of datacenter %s of vCenter %s", scope.datacenter, scope.server))
+			failed.Insert(key)
+			if !scannedModules.Has(scope.server) {
+				failed.Insert(orphanScopeKey(scope.server, ""))
+			}
+			continue
+		}
+		scannedModules.Insert(scope.server)
+		for _, object := range objects {
+			datacenter := scope.datacenter
+			if object.Type == infrav1.OrphanTypeClusterModule {
+				datacenter = ""
+			}
+			found[getVSphereOrphanName(scope.server, datacenter, object)] = foundOrphan{Object: object, scope: scope, datacenter: datacenter}
+		}
+	}
+
+	existing := &infrav1.VSphereOrphanList{}
+	if err := c.Client.List(ctx, existing); err != nil {
+		return kerrors.NewAggregate(append(errs, errors.Wrap(err, "failed to list VSphereOrphans")))
+	}
+	for i := range existing.Items {
+		vsphereOrphan := &existing.Items[i]
+		// The VSphereOrphans of the other watch filters are left to their
+		// collectors.
+		if vsphereOrphan.Labels[clusterv1.WatchLabel] != c.WatchFilterValue {
+			continue
+		}
+		if _, ok := found[vsphereOrphan.Name]; ok || failed.Has(orphanScopeKey(vsphereOrphan.Spec.Server, vsphereOrphan.Spec.Datacenter)) {
+			continue
+		}
+		// The object is no longer orphaned, or no longer exists.
+		if err := c.Client.Delete(ctx, vsphereOrphan); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete VSphereOrphan %s", vsphereOrphan.Name))
+		}
+	}
+
+	for _, name := range sets.List(sets.KeySet(found)) {
+		if err := c.reconcileOrphan(ctx, name, found[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+// findOrphans returns the orphaned VMs and VM group members of the
+// datacenter, and the orphaned cluster modules of its vCenter if requested.
+func (c *orphanCollector) findOrphans(ctx context.Context, scope *orphanScope, owners *orphans.Owners, withModules bool) ([]orphans.Object, error) {
+	s, err := c.getSession(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := sets.List(scope.folders)
+	vms, err := orphans.FindVirtualMachines(ctx, s, folders, owners)
+	if err != nil {
+		return nil, err
+	}
+	orphanedVMs := sets.New[string]()
+	for _, vm := range vms {
+		orphanedVMs.Insert(vm.Ref)
+	}
+
+	vmGroups := scope.vmGroups.UnsortedList()
+	sort.Slice(vmGroups, func(i, j int) bool {
+		return vmGroups[i].ComputeCluster+"/"+vmGroups[i].Name < vmGroups[j].ComputeCluster+"/"+vmGroups[j].Name
+	})
+	members, err := orphans.FindVMGroupMembers(ctx, s, vmGroups, owners, orphanedVMs)
+	if err != nil {
+		return nil, err
+	}
+	objects := append(vms, members...)
+
+	if withModules {
+		modules, err := orphans.FindClusterModules(ctx, s, owners, orphanedVMs)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, modules...)
+	}
+	return objects, nil
+}
+
+// reconcileOrphan creates or updates the VSphereOrphan of the object, and
+// deletes the object once its grace period expired, if enabled.
+func (c *orphanCollector) reconcileOrphan(ctx context.Context, name string, orphan foundOrphan) error {
+	log := ctrl.LoggerFrom(ctx).WithValues("VSphereOrphan", name)
+	object := orphan.Object
+
+	vsphereOrphan := &infrav1.VSphereOrphan{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	result, err := ctrlutil.CreateOrPatch(ctx, c.Client, vsphereOrphan, func() error {
+		if c.WatchFilterValue != "" {
+			if vsphereOrphan.Labels == nil {
+				vsphereOrphan.Labels = map[string]string{}
+			}
+			vsphereOrphan.Labels[clusterv1.WatchLabel] = c.WatchFilterValue
+		}
+		vsphereOrphan.Spec = infrav1.VSphereOrphanSpec{
+			Server:         orphan.scope.server,
+			Datacenter:     orphan.datacenter,
+			Type:           object.Type,
+			Ref:            object.Ref,
+			Name:           object.Name,
+			ComputeCluster: object.ComputeCluster,
+			VMGroup:        object.VMGroup,
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create or patch VSphereOrphan %s", name)
+	}
+	if result == ctrlutil.OperationResultCreated {
+		log.Info("Found orphaned vCenter object", "type", object.Type, "name", object.Name)
+		c.Recorder.Eventf(vsphereOrphan, corev1.EventTypeWarning, "OrphanDetected", "%s %s is not mapped to any CAPV object", object.Type, object.Name)
+	}
+
+	patchHelper, err := patch.NewHelper(vsphereOrphan, c.Client)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	vsphereOrphan.Status.LastSeen = &now
+	if vsphereOrphan.Status.DeleteAfter == nil {
+		vsphereOrphan.Status.DeleteAfter = &metav1.Time{Time: now.Add(c.Options.GracePeriod)}
+	}
+	if err := patchHelper.Patch(ctx, vsphereOrphan); err != nil {
+		return errors.Wrapf(err, "failed to patch VSphereOrphan %s", name)
+	}
+
+	if !c.Options.Delete || now.Before(vsphereOrphan.Status.DeleteAfter) {
+		return nil
+	}
+	s, err := c.getSession(ctx, orphan.scope)
+	if err != nil {
+		return err
+	}
+	// The orphaned VMs are destroyed within the limits of the clone and
+	// destroy tasks of their vCenter, or at the next collection.
+	if object.Type == infrav1.OrphanTypeVirtualMachine {
+		if !c.TaskLimiter.Acquire(orphan.scope.server, name, throttle.PriorityWorker) {
+			log.Info("Waiting for vCenter capacity to delete orphaned vCenter object", "type", object.Type, "name", object.Name)
+			return nil
+		}
+		defer c.TaskLimiter.Release(orphan.scope.server, name)
+	}
+	log.Info("Deleting orphaned vCenter object", "type", object.Type, "name", object.Name)
+	if err := orphans.Delete(ctx, s, object); err != nil {
+		c.Recorder.Eventf(vsphereOrphan, corev1.EventTypeWarning, "OrphanDeletionFailed", "Failed to delete %s %s: %v", object.Type, object.Name, err)
+		return err
+	}
+	c.Recorder.Eventf(vsphereOrphan, corev1.EventTypeNormal, "OrphanDeleted", "Deleted %s %s", object.Type, object.Name)
+	if err := c.Client.Delete(ctx, vsphereOrphan); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete VSphereOrphan %s", name)
+	}
+	return nil
+}
+
+// getOrphanScopes returns the datacenters used by the VSphereVMs and the
+// VSphereDeploymentZones, keyed by vCenter and datacenter, and the owners of
+// the vCenter objects.
+func (c *orphanCollector) getOrphanScopes(ctx context.Context) (map[string]*orphanScope, *orphans.Owners, error) {
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := c.Client.List(ctx, vsphereVMs); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list VSphereVMs")
+	}
+	vsphereClusters := &infrav1.VSphereClusterList{}
+	if err := c.Client.List(ctx, vsphereClusters); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list VSphereClusters")
+	}
+	vsphereDeploymentZones := &infrav1.VSphereDeploymentZoneList{}
+	if err := c.Client.List(ctx, vsphereDeploymentZones); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list VSphereDeploymentZones")
+	}
+	vsphereFailureDomains := &infrav1.VSphereFailureDomainList{}
+	if err := c.Client.List(ctx, vsphereFailureDomains); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list VSphereFailureDomains")
+	}
+	vsphereMachineTemplates := &infrav1.VSphereMachineTemplateList{}
+	if err := c.Client.List(ctx, vsphereMachineTemplates); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list VSphereMachineTemplates")
+	}
+
+	// The VMs used as templates or instant clone parents are never orphaned.
+	var templates []string
+	addTemplates := func(spec infrav1.VirtualMachineCloneSpec) {
+		if spec.Template != "" {
+			templates = append(templates, path.Base(spec.Template))
+		}
+		for _, parent := range spec.InstantCloneParents {
+			templates = append(templates, path.Base(parent))
+		}
+	}
+	thumbprints := map[string]string{}
+	var clusterModules []string
+	for _, vsphereCluster := range vsphereClusters.Items {
+		thumbprints[vsphereCluster.Spec.Server] = vsphereCluster.Spec.Thumbprint
+		for _, module := range vsphereCluster.Spec.ClusterModules {
+			clusterModules = append(clusterModules, module.ModuleUUID)
+		}
+	}
+	for _, vsphereMachineTemplate := range vsphereMachineTemplates.Items {
+		addTemplates(vsphereMachineTemplate.Spec.Template.Spec.VirtualMachineCloneSpec)
+	}
+
+	scopes := map[string]*orphanScope{}
+	getScope := func(server, datacenter string) *orphanScope {
+		key := orphanScopeKey(server, datacenter)
+		if scopes[key] == nil {
+			scopes[key] = &orphanScope{
+				server:     server,
+				datacenter: datacenter,
+				thumbprint: thumbprints[server],
+				folders:    sets.New[string](),
+				vmGroups:   sets.New[orphans.VMGroup](),
+			}
+		}
+		return scopes[key]
+	}
+	for _, vsphereVM := range vsphereVMs.Items {
+		addTemplates(vsphereVM.Spec.VirtualMachineCloneSpec)
+		if vsphereVM.Spec.Server == "" {
+			continue
+		}
+		scope := getScope(vsphereVM.Spec.Server, vsphereVM.Spec.Datacenter)
+		scope.folders.Insert(vsphereVM.Spec.Folder)
+		if vsphereVM.Spec.Thumbprint != "" {
+			scope.thumbprint = vsphereVM.Spec.Thumbprint
+		}
+	}
+	failureDomains := map[string]*infrav1.VSphereFailureDomain{}
+	for i := range vsphereFailureDomains.Items {
+		failureDomains[vsphereFailureDomains.Items[i].Name] = &vsphereFailureDomains.Items[i]
+	}
+	for _, vsphereDeploymentZone := range vsphereDeploymentZones.Items {
+		failureDomain, ok := failureDomains[vsphereDeploymentZone.Spec.FailureDomain]
+		if !ok || vsphereDeploymentZone.Spec.Server == "" {
+			continue
+		}
+		topology := failureDomain.Spec.Topology
+		scope := getScope(vsphereDeploymentZone.Spec.Server, topology.Datacenter)
+		scope.folders.Insert(vsphereDeploymentZone.Spec.PlacementConstraint.Folder)
+		if topology.ComputeCluster != nil && topology.Hosts != nil {
+			scope.vmGroups.Insert(orphans.VMGroup{ComputeCluster: *topology.ComputeCluster, Name: topology.Hosts.VMGroupName})
+		}
+	}
+
+	return scopes, orphans.NewOwners(c.ManagerID, vsphereVMs.Items, templates, clusterModules), nil
+}
+
+// getSession returns a session to the datacenter of the scope, with the
+// credentials provided to the manager.
+func (c *orphanCollector) getSession(ctx context.Context, scope *orphanScope) (*session.Session, error) {
+	params, _, err := identity.GetSessionParams(ctx, c.Client, c.ControllerManagerContext, session.NewParams().
+		WithServer(scope.server).
+		WithDatacenter(scope.datacenter).
+		WithThumbprint(scope.thumbprint), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	s, err := session.GetOrCreate(ctx, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get session to vCenter %s", scope.server)
+	}
+	return s, nil
+}
+
+// orphanScopeKey returns the key of the datacenter of a vCenter. The cluster
+// modules, which belong to the vCenter, have an empty datacenter.
+func orphanScopeKey(server, datacenter string) string {
+	return server + "/" + datacenter
+}
+
+// getVSphereOrphanName returns the name of the VSphereOrphan of the object,
+// which is derived from the type and the identity of the object.
+func getVSphereOrphanName(server, datacenter string, object orphans.Object) string {
+	hasher := fnv.New32a()
+	for _, value := range []string{server, datacenter, object.Ref, object.ComputeCluster, object.VMGroup} {
+		_, _ = hasher.Write([]byte(value))
+		_, _ = hasher.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s-%s", strings.ToLower(string(object.Type)), rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())))
+}
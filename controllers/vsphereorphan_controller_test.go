@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apirecord "k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/internal/test/helpers/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/orphans"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
+)
+
+func TestOrphanCollector(t *testing.T) {
+	model := simulator.VPX()
+	model.Host = 0
+	model.Machine = 3
+
+	simr, err := vcsim.NewBuilder().WithModel(model).Build()
+	if err != nil {
+		t.Fatalf("unable to create simulator: %s", err)
+	}
+	defer simr.Destroy()
+
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// The VMs look like they were cloned by the controller manager, and only
+	// the second one is mapped to a VSphereVM. The third one was cloned by
+	// another management cluster.
+	client, err := govmomi.NewClient(ctx, simr.ServerURL(), true)
+	g.Expect(err).NotTo(HaveOccurred())
+	finder := find.NewFinder(client.Client)
+	for name, managerID := range map[string]string{"DC0_C0_RP0_VM0": fake.ManagerID, "DC0_C0_RP0_VM1": fake.ManagerID, "DC0_C0_RP0_VM2": "other-manager-id"} {
+		vm, err := finder.VirtualMachine(ctx, name)
+		g.Expect(err).NotTo(HaveOccurred())
+		task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{
+			ExtraConfig: []types.BaseOptionValue{
+				&types.OptionValue{Key: "guestinfo.userdata", Value: "Zm9v"},
+				&types.OptionValue{Key: extra.ManagedByKey, Value: managerID},
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(task.Wait(ctx)).To(Succeed())
+	}
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{Name: "DC0_C0_RP0_VM1", Namespace: "test"},
+		Spec: infrav1.VSphereVMSpec{
+			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+				Server:     simr.ServerURL().Host,
+				Datacenter: "DC0",
+				Template:   "ubuntu",
+			},
+		},
+	}
+
+	controllerManagerCtx := fake.NewControllerManagerContext(vsphereVM)
+	controllerManagerCtx.SetCredentials(simr.Username(), simr.Password())
+	controllerManagerCtx.TaskLimiter = throttle.NewTaskLimiter(throttle.Options{MaxInFlight: 1})
+	collector := &orphanCollector{
+		ControllerManagerContext: controllerManagerCtx,
+		Recorder:                 apirecord.NewFakeRecorder(100),
+	}
+
+	// The orphaned VM is only reported while the deletions are disabled.
+	g.Expect(collector.reconcileOrphans(ctx)).To(Succeed())
+	vsphereOrphans := &infrav1.VSphereOrphanList{}
+	g.Expect(collector.Client.List(ctx, vsphereOrphans)).To(Succeed())
+	g.Expect(vsphereOrphans.Items).To(HaveLen(1))
+	vsphereOrphan := vsphereOrphans.Items[0]
+	g.Expect(vsphereOrphan.Spec.Type).To(Equal(infrav1.OrphanTypeVirtualMachine))
+	g.Expect(vsphereOrphan.Spec.Server).To(Equal(simr.ServerURL().Host))
+	g.Expect(vsphereOrphan.Spec.Datacenter).To(Equal("DC0"))
+	g.Expect(vsphereOrphan.Spec.Name).To(HaveSuffix("/DC0_C0_RP0_VM0"))
+	g.Expect(vsphereOrphan.Status.LastSeen).NotTo(BeNil())
+	g.Expect(vsphereOrphan.Status.DeleteAfter).NotTo(BeNil())
+	_, err = finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Once enabled, the orphaned VM is deleted after its grace period, within
+	// the capacity of the vCenter.
+	collector.Options.Delete = true
+	key := ctrlclient.ObjectKeyFromObject(vsphereVM).String()
+	g.Expect(controllerManagerCtx.TaskLimiter.Acquire(vsphereVM.Spec.Server, key, throttle.PriorityWorker)).To(BeTrue())
+	g.Expect(collector.reconcileOrphans(ctx)).To(Succeed())
+	_, err = finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).NotTo(HaveOccurred())
+	controllerManagerCtx.TaskLimiter.Release(vsphereVM.Spec.Server, key)
+	g.Expect(collector.reconcileOrphans(ctx)).To(Succeed())
+	g.Expect(collector.Client.List(ctx, vsphereOrphans)).To(Succeed())
+	g.Expect(vsphereOrphans.Items).To(BeEmpty())
+	_, err = finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).To(HaveOccurred())
+	_, err = finder.VirtualMachine(ctx, "DC0_C0_RP0_VM1")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = finder.VirtualMachine(ctx, "DC0_C0_RP0_VM2")
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestOrphanCollector_WatchFilter(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	// The VSphereOrphans of another watch filter are neither updated nor
+	// removed.
+	other := &infrav1.VSphereOrphan{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "virtualmachine-other",
+			Labels: map[string]string{clusterv1.WatchLabel: "other"},
+		},
+	}
+	controllerManagerCtx := fake.NewControllerManagerContext(other)
+	controllerManagerCtx.WatchFilterValue = "filter"
+	collector := &orphanCollector{
+		ControllerManagerContext: controllerManagerCtx,
+		Recorder:                 apirecord.NewFakeRecorder(100),
+	}
+	g.Expect(collector.reconcileOrphans(ctx)).To(Succeed())
+	g.Expect(collector.Client.Get(ctx, ctrlclient.ObjectKeyFromObject(other), &infrav1.VSphereOrphan{})).To(Succeed())
+
+	// The VSphereOrphans of the collector are labeled with its watch filter.
+	scope := &orphanScope{server: "vcenter", datacenter: "dc"}
+	object := orphans.Object{Type: infrav1.OrphanTypeVirtualMachine, Ref: "vm-42", Name: "vm"}
+	name := getVSphereOrphanName(scope.server, scope.datacenter, object)
+	g.Expect(collector.reconcileOrphan(ctx, name, foundOrphan{Object: object, scope: scope, datacenter: scope.datacenter})).To(Succeed())
+	vsphereOrphan := &infrav1.VSphereOrphan{}
+	g.Expect(collector.Client.Get(ctx, ctrlclient.ObjectKey{Name: name}, vsphereOrphan)).To(Succeed())
+	g.Expect(vsphereOrphan.Labels).To(HaveKeyWithValue(clusterv1.WatchLabel, "filter"))
+}
+
+func TestGetVSphereOrphanName(t *testing.T) {
+	g := NewWithT(t)
+
+	vm := orphans.Object{Type: infrav1.OrphanTypeVirtualMachine, Ref: "vm-42"}
+	name := getVSphereOrphanName("vcenter", "dc", vm)
+	g.Expect(name).To(HavePrefix("virtualmachine-"))
+	g.Expect(getVSphereOrphanName("vcenter", "dc", vm)).To(Equal(name))
+	g.Expect(getVSphereOrphanName("vcenter", "other-dc", vm)).NotTo(Equal(name))
+	member := orphans.Object{Type: infrav1.OrphanTypeVMGroupMember, Ref: "vm-42", ComputeCluster: "cluster", VMGroup: "group"}
+	g.Expect(getVSphereOrphanName("vcenter", "dc", member)).To(HavePrefix("vmgroupmember-"))
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
+)
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereremediations,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereremediations/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereremediationtemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch;delete
+
+// AddVSphereRemediationControllerToManager adds the VSphereRemediation controller to the provided manager.
+func AddVSphereRemediationControllerToManager(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, mgr manager.Manager, options controller.Options) error {
+	reconciler := vsphereRemediationReconciler{
+		ControllerManagerContext: controllerManagerCtx,
+		Recorder:                 mgr.GetEventRecorderFor("vsphereremediation-controller"),
+		VMService:                &govmomi.VMService{},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.VSphereRemediation{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), controllerManagerCtx.WatchFilterValue)).
+		Complete(reconciler)
+}
+
+// vsphereRemediationReconciler remediates the unhealthy Machines for which a
+// MachineHealthCheck created a VSphereRemediation. It takes the steps of the
+// remediation on the VM of the Machine, from the least to the most disruptive
+// one, until the Machine becomes healthy and the VSphereRemediation is
+// deleted by the MachineHealthCheck.
+type vsphereRemediationReconciler struct {
+	*capvcontext.ControllerManagerContext
+	Recorder  record.EventRecorder
+	VMService services.VirtualMachineService
+}
+
+func (r vsphereRemediationReconciler) Reconcile(ctx context.Context, request reconcile.Request) (_ reconcile.Result, reterr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// Fetch the VSphereRemediation for this request.
+	remediation := &infrav1.VSphereRemediation{}
+	if err := r.Client.Get(ctx, request.NamespacedName, remediation); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// The VSphereRemediation is deleted by the MachineHealthCheck once the
+	// Machine is healthy again.
+	if !remediation.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, nil
+	}
+
+	machine, err := clusterutilv1.GetOwnerMachine(ctx, r.Client, remediation.ObjectMeta)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if machine == nil {
+		log.Info("Waiting for MachineHealthCheck Controller to set OwnerRef on VSphereRemediation")
+		return reconcile.Result{}, nil
+	}
+	log = log.WithValues("Machine", klog.KObj(machine))
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, r.Client, machine.ObjectMeta)
+	if err == nil {
+		if annotations.IsPaused(cluster, remediation) {
+			log.Info("Reconciliation is paused for this object")
+			return reconcile.Result{}, nil
+		}
+	} else if annotations.HasPaused(remediation) {
+		log.Info("Reconciliation is paused for this object")
+		return reconcile.Result{}, nil
+	}
+
+	patchHelper, err := patch.NewHelper(remediation, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer func() {
+		if err := patchHelper.Patch(ctx, remediation); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	return r.reconcileNormal(ctx, remediation, machine)
+}
+
+func (r vsphereRemediationReconciler) reconcileNormal(ctx context.Context, remediation *infrav1.VSphereRemediation, machine *clusterv1.Machine) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if remediation.Status.Phase == infrav1.RemediationPhaseDeleting || remediation.Status.Phase == infrav1.RemediationPhaseFailed {
+		return reconcile.Result{}, nil
+	}
+
+	// Wait for the Machine to become healthy after the last step.
+	timeout := infrav1.RemediationDefaultTimeout
+	if remediation.Spec.Timeout != nil {
+		timeout = remediation.Spec.Timeout.Duration
+	}
+	if lastRemediated := remediation.Status.LastRemediated; lastRemediated != nil {
+		if remaining := time.Until(lastRemediated.Add(timeout)); remaining > 0 {
+			return reconcile.Result{RequeueAfter: remaining}, nil
+		}
+	}
+
+	steps := remediation.Spec.Steps
+	if len(steps) == 0 {
+		steps = infrav1.DefaultRemediationSteps
+	}
+	retryLimit := remediation.Spec.RetryLimit
+	if retryLimit <= 0 {
+		retryLimit = infrav1.RemediationDefaultRetryLimit
+	}
+
+	step, retryCount := remediation.Status.Step, remediation.Status.RetryCount
+	for {
+		// Escalate to the next step once the last one was attempted
+		// RetryLimit times.
+		if step == "" {
+			step = steps[0]
+		} else if retryCount >= retryLimit {
+			step, retryCount = nextRemediationStep(steps, step), 0
+		}
+
+		switch step {
+		case "":
+			log.Info("Failed to remediate Machine, all the remediation steps were taken")
+			r.Recorder.Event(remediation, corev1.EventTypeWarning, "RemediationFailed", "All the remediation steps were taken without the Machine becoming healthy")
+			remediation.Status.Phase = infrav1.RemediationPhaseFailed
+			return reconcile.Result{}, nil
+
+		case infrav1.RemediationStepDeleteMachine:
+			log.Info("Deleting Machine")
+			if err := r.Client.Delete(ctx, machine); err != nil && !apierrors.IsNotFound(err) {
+				r.Recorder.Eventf(remediation, corev1.EventTypeWarning, "RemediationStepFailed", "Failed to delete Machine: %v", err)
+				return reconcile.Result{}, errors.Wrapf(err, "failed to delete Machine %s", klog.KObj(machine))
+			}
+			r.Recorder.Event(remediation, corev1.EventTypeNormal, "MachineDeleted", "Deleted Machine to replace it")
+			remediation.Status.Phase = infrav1.RemediationPhaseDeleting
+			remediation.Status.Step = step
+			remediation.Status.RetryCount = 1
+			remediation.Status.LastRemediated = &metav1.Time{Time: time.Now()}
+			return reconcile.Result{}, nil
+		}
+
+		ok, err := r.remediateVM(ctx, machine, step)
+		if err != nil {
+			r.Recorder.Eventf(remediation, corev1.EventTypeWarning, "RemediationStepFailed", "Failed to take remediation step %s: %v", step, err)
+			return reconcile.Result{}, err
+		}
+		if ok {
+			break
+		}
+		log.Info("Skipping remediation step which cannot be taken on the VM", "step", step)
+		retryCount = retryLimit
+	}
+
+	retryCount++
+	r.Recorder.Eventf(remediation, corev1.EventTypeNormal, "RemediationStepTaken", "Took remediation step %s (attempt %d of %d)", step, retryCount, retryLimit)
+	remediation.Status.Phase = infrav1.RemediationPhaseRunning
+	remediation.Status.Step = step
+	remediation.Status.RetryCount = retryCount
+	remediation.Status.LastRemediated = &metav1.Time{Time: time.Now()}
+	return reconcile.Result{RequeueAfter: timeout}, nil
+}
+
+// remediateVM takes a step of the remediation on the VM of the Machine. It
+// returns false if the step cannot be taken, e.g. because the Machine has no
+// VSphereVM.
+func (r vsphereRemediationReconciler) remediateVM(ctx context.Context, machine *clusterv1.Machine, step infrav1.RemediationStep) (bool, error) {
+	infraRef := machine.Spec.InfrastructureRef
+	if infraRef.Kind != "VSphereMachine" || infraRef.Name == "" {
+		return false, nil
+	}
+	vsphereMachine := &infrav1.VSphereMachine{}
+	if err := r.Client.Get(ctx, ctrlclient.ObjectKey{Namespace: machine.Namespace, Name: infraRef.Name}, vsphereMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := r.Client.List(ctx, vsphereVMs, ctrlclient.InNamespace(machine.Namespace)); err != nil {
+		return false, err
+	}
+	var vsphereVM *infrav1.VSphereVM
+	for i := range vsphereVMs.Items {
+		for _, ref := range vsphereVMs.Items[i].OwnerReferences {
+			if ref.Kind == "VSphereMachine" && ref.UID == vsphereMachine.UID {
+				vsphereVM = &vsphereVMs.Items[i]
+			}
+		}
+	}
+	if vsphereVM == nil {
+		return false, nil
+	}
+
+	authSession, err := vmReconciler{ControllerManagerContext: r.ControllerManagerContext}.retrieveVcenterSession(ctx, vsphereVM)
+	if err != nil {
+		return false, err
+	}
+	vmCtx := &capvcontext.VMContext{
+		ControllerManagerContext: r.ControllerManagerContext,
+		VSphereVM:                vsphereVM,
+		Session:                  authSession,
+	}
+
+	// The task of the step is stored in the TaskRef of the VSphereVM, which
+	// is reconciled once the task completes.
+	patchHelper, err := patch.NewHelper(vsphereVM, r.Client)
+	if err != nil {
+		return false, err
+	}
+	ok, err := r.VMService.RemediateVM(ctx, vmCtx, step)
+	if err != nil || !ok {
+		return ok, err
+	}
+	if err := patchHelper.Patch(ctx, vsphereVM); err != nil {
+		return false, errors.Wrapf(err, "failed to patch VSphereVM %s", klog.KObj(vsphereVM))
+	}
+	return true, nil
+}
+
+// nextRemediationStep returns the step which follows the given step, or an
+// empty step if it is the last one.
+func nextRemediationStep(steps []infrav1.RemediationStep, step infrav1.RemediationStep) infrav1.RemediationStep {
+	for i := range steps {
+		if steps[i] == step && i+1 < len(steps) {
+			return steps[i+1]
+		}
+	}
+	return ""
+}
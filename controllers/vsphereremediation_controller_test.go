@@ -0,0 +1,196 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/vmware/govmomi/simulator"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apirecord "k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/internal/test/helpers/vcsim"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+	fake_svc "sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/fake"
+)
+
+func TestVSphereRemediationReconciler(t *testing.T) {
+	model := simulator.VPX()
+	model.Host = 0
+
+	simr, err := vcsim.NewBuilder().WithModel(model).Build()
+	if err != nil {
+		t.Fatalf("unable to create simulator: %s", err)
+	}
+	defer simr.Destroy()
+
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Spec: clusterv1.MachineSpec{
+			InfrastructureRef: corev1.ObjectReference{
+				APIVersion: infrav1.GroupVersion.String(),
+				Kind:       "VSphereMachine",
+				Name:       "foo",
+			},
+		},
+	}
+	vsphereMachine := &infrav1.VSphereMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+			UID:       "foo-vsphere-machine",
+		},
+	}
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			Namespace:       "test",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: infrav1.GroupVersion.String(), Kind: "VSphereMachine", Name: "foo", UID: vsphereMachine.UID}},
+		},
+		Spec: infrav1.VSphereVMSpec{
+			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+				Server: simr.ServerURL().Host,
+			},
+		},
+	}
+	newRemediation := func(spec infrav1.VSphereRemediationSpec, status infrav1.VSphereRemediationStatus) *infrav1.VSphereRemediation {
+		return &infrav1.VSphereRemediation{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "foo",
+				Namespace:       "test",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine", Name: "foo"}},
+			},
+			Spec:   spec,
+			Status: status,
+		}
+	}
+	elapsed := &metav1.Time{Time: time.Now().Add(-time.Hour)}
+
+	reconcile := func(g *WithT, fakeVMSvc *fake_svc.VMService, remediation *infrav1.VSphereRemediation) (ctrl.Result, *infrav1.VSphereRemediation, client.Client) {
+		controllerManagerCtx := fake.NewControllerManagerContext(machine.DeepCopy(), vsphereMachine.DeepCopy(), vsphereVM.DeepCopy(), remediation)
+		controllerManagerCtx.SetCredentials(simr.Username(), simr.Password())
+		r := vsphereRemediationReconciler{
+			ControllerManagerContext: controllerManagerCtx,
+			Recorder:                 apirecord.NewFakeRecorder(100),
+			VMService:                fakeVMSvc,
+		}
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: util.ObjectKey(remediation)})
+		g.Expect(err).NotTo(HaveOccurred())
+		obj := &infrav1.VSphereRemediation{}
+		g.Expect(r.Client.Get(context.Background(), util.ObjectKey(remediation), obj)).To(Succeed())
+		return result, obj, r.Client
+	}
+
+	t.Run("takes the first step which can be taken on the VM", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fakeVMSvc := new(fake_svc.VMService)
+		fakeVMSvc.On("RemediateVM", mock.Anything, infrav1.RemediationStepGuestReboot).Return(false, nil)
+		fakeVMSvc.On("RemediateVM", mock.Anything, infrav1.RemediationStepHardReset).Return(true, nil).Run(func(args mock.Arguments) {
+			args.Get(0).(*capvcontext.VMContext).VSphereVM.Status.TaskRef = "task-1"
+		})
+		result, remediation, c := reconcile(g, fakeVMSvc, newRemediation(infrav1.VSphereRemediationSpec{}, infrav1.VSphereRemediationStatus{}))
+		g.Expect(result.RequeueAfter).To(Equal(infrav1.RemediationDefaultTimeout))
+		g.Expect(remediation.Status.Phase).To(Equal(infrav1.RemediationPhaseRunning))
+		g.Expect(remediation.Status.Step).To(Equal(infrav1.RemediationStepHardReset))
+		g.Expect(remediation.Status.RetryCount).To(Equal(int32(1)))
+		g.Expect(remediation.Status.LastRemediated).NotTo(BeNil())
+		fakeVMSvc.AssertExpectations(t)
+
+		// The task of the step is patched as the TaskRef of the VSphereVM.
+		obj := &infrav1.VSphereVM{}
+		g.Expect(c.Get(context.Background(), util.ObjectKey(vsphereVM), obj)).To(Succeed())
+		g.Expect(obj.Status.TaskRef).To(Equal("task-1"))
+	})
+
+	t.Run("waits for the timeout of the last step", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fakeVMSvc := new(fake_svc.VMService)
+		result, remediation, _ := reconcile(g, fakeVMSvc, newRemediation(
+			infrav1.VSphereRemediationSpec{Timeout: &metav1.Duration{Duration: time.Hour}},
+			infrav1.VSphereRemediationStatus{Phase: infrav1.RemediationPhaseRunning, Step: infrav1.RemediationStepGuestReboot, RetryCount: 1, LastRemediated: &metav1.Time{Time: time.Now()}},
+		))
+		g.Expect(result.RequeueAfter).To(BeNumerically(">", 50*time.Minute))
+		g.Expect(remediation.Status.Step).To(Equal(infrav1.RemediationStepGuestReboot))
+		g.Expect(remediation.Status.RetryCount).To(Equal(int32(1)))
+		fakeVMSvc.AssertNotCalled(t, "RemediateVM", mock.Anything, mock.Anything)
+	})
+
+	t.Run("retries the last step up to the retry limit", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fakeVMSvc := new(fake_svc.VMService)
+		fakeVMSvc.On("RemediateVM", mock.Anything, infrav1.RemediationStepHardReset).Return(true, nil)
+		_, remediation, _ := reconcile(g, fakeVMSvc, newRemediation(
+			infrav1.VSphereRemediationSpec{RetryLimit: 2},
+			infrav1.VSphereRemediationStatus{Phase: infrav1.RemediationPhaseRunning, Step: infrav1.RemediationStepHardReset, RetryCount: 1, LastRemediated: elapsed},
+		))
+		g.Expect(remediation.Status.Step).To(Equal(infrav1.RemediationStepHardReset))
+		g.Expect(remediation.Status.RetryCount).To(Equal(int32(2)))
+
+		fakeVMSvc = new(fake_svc.VMService)
+		fakeVMSvc.On("RemediateVM", mock.Anything, infrav1.RemediationStepPowerCycle).Return(true, nil)
+		_, remediation, _ = reconcile(g, fakeVMSvc, newRemediation(
+			infrav1.VSphereRemediationSpec{RetryLimit: 2},
+			infrav1.VSphereRemediationStatus{Phase: infrav1.RemediationPhaseRunning, Step: infrav1.RemediationStepHardReset, RetryCount: 2, LastRemediated: elapsed},
+		))
+		g.Expect(remediation.Status.Step).To(Equal(infrav1.RemediationStepPowerCycle))
+		g.Expect(remediation.Status.RetryCount).To(Equal(int32(1)))
+	})
+
+	t.Run("deletes the Machine as the last step", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, remediation, c := reconcile(g, new(fake_svc.VMService), newRemediation(
+			infrav1.VSphereRemediationSpec{},
+			infrav1.VSphereRemediationStatus{Phase: infrav1.RemediationPhaseRunning, Step: infrav1.RemediationStepPowerCycle, RetryCount: 1, LastRemediated: elapsed},
+		))
+		g.Expect(result.IsZero()).To(BeTrue())
+		g.Expect(remediation.Status.Phase).To(Equal(infrav1.RemediationPhaseDeleting))
+		g.Expect(remediation.Status.Step).To(Equal(infrav1.RemediationStepDeleteMachine))
+		err := c.Get(context.Background(), util.ObjectKey(machine), &clusterv1.Machine{})
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("fails once all the steps were taken", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, remediation, c := reconcile(g, new(fake_svc.VMService), newRemediation(
+			infrav1.VSphereRemediationSpec{Steps: []infrav1.RemediationStep{infrav1.RemediationStepHardReset}},
+			infrav1.VSphereRemediationStatus{Phase: infrav1.RemediationPhaseRunning, Step: infrav1.RemediationStepHardReset, RetryCount: 1, LastRemediated: elapsed},
+		))
+		g.Expect(result.IsZero()).To(BeTrue())
+		g.Expect(remediation.Status.Phase).To(Equal(infrav1.RemediationPhaseFailed))
+		g.Expect(c.Get(context.Background(), util.ObjectKey(machine), &clusterv1.Machine{})).To(Succeed())
+	})
+}
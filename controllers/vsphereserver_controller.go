@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/blang/semver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// vsphereServerResyncPeriod is the interval at which the connectivity and the
+// version of the vCenter servers are checked again.
+const vsphereServerResyncPeriod = 5 * time.Minute
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereservers,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereservers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=vsphereclusteridentities,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+// AddVSphereServerControllerToManager adds the VSphereServer controller to the provided manager.
+func AddVSphereServerControllerToManager(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, mgr manager.Manager, options controller.Options) error {
+	reconciler := vsphereServerReconciler{
+		ControllerManagerContext: controllerManagerCtx,
+		Client:                   controllerManagerCtx.Client,
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.VSphereServer{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), controllerManagerCtx.WatchFilterValue)).
+		Complete(reconciler)
+}
+
+type vsphereServerReconciler struct {
+	*capvcontext.ControllerManagerContext
+	Client client.Client
+}
+
+func (r vsphereServerReconciler) Reconcile(ctx context.Context, req reconcile.Request) (_ reconcile.Result, reterr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereServer := &infrav1.VSphereServer{}
+	if err := r.Client.Get(ctx, req.NamespacedName, vsphereServer); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if annotations.HasPaused(vsphereServer) {
+		log.Info("Reconciliation is paused for this object")
+		return reconcile.Result{}, nil
+	}
+
+	if !vsphereServer.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, nil
+	}
+
+	patchHelper, err := patch.NewHelper(vsphereServer, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer func() {
+		conditions.SetSummary(vsphereServer, conditions.WithConditions(infrav1.VCenterAvailableCondition))
+
+		if err := patchHelper.Patch(ctx, vsphereServer); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	s, err := r.getVCenterSession(ctx, vsphereServer)
+	if err != nil {
+		conditions.MarkFalse(vsphereServer, infrav1.VCenterAvailableCondition, infrav1.VCenterUnreachableReason, clusterv1.ConditionSeverityError, err.Error())
+		return reconcile.Result{}, err
+	}
+	conditions.MarkTrue(vsphereServer, infrav1.VCenterAvailableCondition)
+
+	about := s.ServiceContent.About
+	vsphereServer.Status.Build = about.Build
+	if version, err := s.GetVersion(); err != nil {
+		log.Error(err, "Failed to get the version of the vCenter server")
+		vsphereServer.Status.Version = ""
+	} else {
+		vsphereServer.Status.Version = version
+	}
+	vsphereServer.Status.Capabilities = getVSphereServerCapabilities(ctx, s)
+
+	return reconcile.Result{RequeueAfter: vsphereServerResyncPeriod}, nil
+}
+
+func (r vsphereServerReconciler) getVCenterSession(ctx context.Context, vsphereServer *infrav1.VSphereServer) (*session.Session, error) {
+	// The VSphereServers are cluster-scoped, and are not restricted by the
+	// allowed namespaces of the identity.
+	params, _, err := identity.GetSessionParams(ctx, r.Client, r.ControllerManagerContext, session.NewParams(), nil, vsphereServer)
+	if err != nil {
+		return nil, err
+	}
+	return session.GetOrCreate(ctx, params)
+}
+
+// getVSphereServerCapabilities returns the features of the vCenter server
+// used by CAPV.
+func getVSphereServerCapabilities(ctx context.Context, s *session.Session) infrav1.VSphereServerCapabilities {
+	var capabilities infrav1.VSphereServerCapabilities
+
+	if apiVersion, err := semver.ParseTolerant(s.ServiceContent.About.ApiVersion); err == nil {
+		// The cluster modules were introduced with vSphere 7.0 and the
+		// instant clone API with vSphere 6.7.
+		capabilities.ClusterModules = apiVersion.Major >= 7
+		capabilities.InstantClone = apiVersion.GTE(semver.Version{Major: 6, Minor: 7})
+	}
+
+	if s.TagManager != nil {
+		userSession, err := s.TagManager.Session(ctx)
+		capabilities.Tagging = err == nil && userSession != nil
+	}
+	return capabilities
+}
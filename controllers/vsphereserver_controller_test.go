@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/simulator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/internal/test/helpers/vcsim"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestVSphereServerReconciler(t *testing.T) {
+	model := simulator.VPX()
+	model.Host = 0
+
+	simr, err := vcsim.NewBuilder().WithModel(model).Build()
+	if err != nil {
+		t.Fatalf("unable to create simulator: %s", err)
+	}
+	defer simr.Destroy()
+
+	t.Run("reports the version and the capabilities of the vCenter server", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx := context.Background()
+
+		vsphereServer := &infrav1.VSphereServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "vcenter"},
+			Spec:       infrav1.VSphereServerSpec{Server: simr.ServerURL().Host},
+		}
+		controllerManagerCtx := fake.NewControllerManagerContext(vsphereServer)
+		controllerManagerCtx.SetCredentials(simr.Username(), simr.Password())
+		r := vsphereServerReconciler{
+			ControllerManagerContext: controllerManagerCtx,
+			Client:                   controllerManagerCtx.Client,
+		}
+
+		result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(vsphereServer)})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.RequeueAfter).To(Equal(vsphereServerResyncPeriod))
+
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(vsphereServer), vsphereServer)).To(Succeed())
+		g.Expect(conditions.IsTrue(vsphereServer, infrav1.VCenterAvailableCondition)).To(BeTrue())
+		g.Expect(vsphereServer.Status.Version).NotTo(BeEmpty())
+		g.Expect(vsphereServer.Status.Build).NotTo(BeEmpty())
+		g.Expect(vsphereServer.Status.Capabilities.Tagging).To(BeTrue())
+	})
+
+	t.Run("reports the vCenter server as unavailable when its identity cannot be used", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx := context.Background()
+
+		vsphereServer := &infrav1.VSphereServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "vcenter"},
+			Spec: infrav1.VSphereServerSpec{
+				Server: simr.ServerURL().Host,
+				IdentityRef: &infrav1.VSphereIdentityReference{
+					Kind: infrav1.VSphereClusterIdentityKind,
+					Name: "identity",
+				},
+			},
+		}
+		identity := &infrav1.VSphereClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity"},
+			Spec:       infrav1.VSphereClusterIdentitySpec{SecretName: "identity-secret"},
+		}
+		controllerManagerCtx := fake.NewControllerManagerContext(vsphereServer, identity)
+		r := vsphereServerReconciler{
+			ControllerManagerContext: controllerManagerCtx,
+			Client:                   controllerManagerCtx.Client,
+		}
+
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(vsphereServer)})
+		g.Expect(err).To(HaveOccurred())
+
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(vsphereServer), vsphereServer)).To(Succeed())
+		g.Expect(conditions.IsFalse(vsphereServer, infrav1.VCenterAvailableCondition)).To(BeTrue())
+		g.Expect(conditions.GetReason(vsphereServer, infrav1.VCenterAvailableCondition)).To(Equal(infrav1.VCenterUnreachableReason))
+
+		// The identity can be used once it is ready, regardless of its
+		// allowed namespaces.
+		g.Expect(r.Client.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity-secret", Namespace: controllerManagerCtx.Namespace},
+			Data: map[string][]byte{
+				"username": []byte(simr.Username()),
+				"password": []byte(simr.Password()),
+			},
+		})).To(Succeed())
+		identity.Status.Ready = true
+		g.Expect(r.Client.Update(ctx, identity)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(vsphereServer)})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(vsphereServer), vsphereServer)).To(Succeed())
+		g.Expect(conditions.IsTrue(vsphereServer, infrav1.VCenterAvailableCondition)).To(BeTrue())
+	})
+}
@@ -57,9 +57,14 @@ import (
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/clustermodule"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi"
+	vcenterevents "sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/events"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/hosts"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/watcher"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
@@ -79,6 +84,20 @@ func AddVMControllerToManager(ctx context.Context, controllerManagerCtx *capvcon
 		remoteClusterCacheTracker: tracker,
 	}
 
+	// The watchers of the vCenter sessions are shared by the reconciles, so
+	// they run with the context of the manager.
+	watcher.SetManagerContext(ctx)
+
+	// Index the VSphereVMs to match them with the VMs of the vCenter events.
+	if err := vcenterevents.AddIndexes(ctx, mgr); err != nil {
+		return err
+	}
+
+	// Report the number of in-flight vCenter tasks based on the VSphereVMs in the cache.
+	if err := metrics.RegisterInFlightTaskCollector(mgr.GetClient()); err != nil {
+		return errors.Wrap(err, "failed to register in-flight task metrics")
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		// Watch the controlled, infrastructure resource.
 		For(&infrav1.VSphereVM{}).
@@ -86,8 +105,9 @@ func AddVMControllerToManager(ctx context.Context, controllerManagerCtx *capvcon
 		// Watch a GenericEvent channel for the controlled resource.
 		//
 		// This is useful when there are events outside of Kubernetes that
-		// should cause a resource to be synchronized, such as a goroutine
-		// waiting on some asynchronous, external task to complete.
+		// should cause a resource to be synchronized, such as the completion
+		// of a task or a change of the state of a VM reported by the watcher
+		// of the vCenter session.
 		WatchesRawSource(
 			&source.Channel{Source: controllerManagerCtx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM"))},
 			&handler.EnqueueRequestForObject{},
@@ -182,52 +202,90 @@ func (r vmReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.R
 	}
 	conditions.MarkTrue(vsphereVM, infrav1.VCenterAvailableCondition)
 
-	// Fetch the owner VSphereMachine.
-	vsphereMachine, err := util.GetOwnerVSphereMachine(ctx, r.Client, vsphereVM.ObjectMeta)
-	// vsphereMachine can be nil in cases where custom mover other than clusterctl
-	// moves the resources without ownerreferences set
-	// in that case nil vsphereMachine can cause panic and CrashLoopBackOff the pod
-	// preventing vspheremachine_controller from setting the ownerref
-	if err != nil {
-		return reconcile.Result{}, errors.Wrapf(err, "failed to get VSphereMachine for VSphereVM")
+	// Bridge the vCenter events of the VMs, e.g. HA restarts and host
+	// disconnections, into Kubernetes Events and VSphereVM conditions.
+	if err := vcenterevents.Start(ctx, r.ControllerManagerContext, r.Recorder, authSession.Client.Client); err != nil {
+		log.Error(err, "Failed to bridge vCenter events")
 	}
-	if vsphereMachine == nil {
-		log.Info("Waiting for VSphereMachine controller to set OwnerRef on VSphereVM")
-		return reconcile.Result{}, nil
+
+	// Monitor the maintenance mode of the ESXi hosts, so that the Nodes of the
+	// VMs are drained before their hosts are evacuated.
+	if err := hosts.Start(ctx, r.ControllerManagerContext, authSession.Client.Client); err != nil {
+		log.Error(err, "Failed to monitor ESXi hosts")
 	}
 
-	log = log.WithValues("VSphereMachine", klog.KObj(vsphereMachine))
-	ctx = ctrl.LoggerInto(ctx, log)
+	var (
+		vsphereCluster *infrav1.VSphereCluster
+		machine        *clusterv1.Machine
+		failureDomain  *string
+	)
+	if _, ok := vsphereVM.Labels[infrav1.MachinePoolNameLabel]; ok {
+		// The VSphereVMs of a VSphereMachinePool are created and deleted by
+		// its controller, and have neither a VSphereMachine nor a Machine.
+		if cluster == nil {
+			return reconcile.Result{}, errors.Errorf("failed to get Cluster of VSphereVM %s", vsphereVM.Name)
+		}
+		vsphereCluster, err = getVSphereCluster(ctx, r.Client, cluster)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if name := vsphereVM.Labels[infrav1.MachinePoolFailureDomainLabel]; name != "" {
+			failureDomain = &name
+		}
+	} else {
+		// Fetch the owner VSphereMachine.
+		vsphereMachine, err := util.GetOwnerVSphereMachine(ctx, r.Client, vsphereVM.ObjectMeta)
+		// vsphereMachine can be nil in cases where custom mover other than clusterctl
+		// moves the resources without ownerreferences set
+		// in that case nil vsphereMachine can cause panic and CrashLoopBackOff the pod
+		// preventing vspheremachine_controller from setting the ownerref
+		if err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to get VSphereMachine for VSphereVM")
+		}
+		if vsphereMachine == nil {
+			log.Info("Waiting for VSphereMachine controller to set OwnerRef on VSphereVM")
+			return reconcile.Result{}, nil
+		}
 
-	vsphereCluster, err := util.GetVSphereClusterFromVSphereMachine(ctx, r.Client, vsphereMachine)
-	if err != nil || vsphereCluster == nil {
-		return reconcile.Result{}, errors.Wrapf(err, "failed to get VSphereCluster from VSphereMachine")
-	}
+		log = log.WithValues("VSphereMachine", klog.KObj(vsphereMachine))
+		ctx = ctrl.LoggerInto(ctx, log)
 
-	log = log.WithValues("VSphereCluster", klog.KObj(vsphereCluster))
-	ctx = ctrl.LoggerInto(ctx, log)
+		vsphereCluster, err = util.GetVSphereClusterFromVSphereMachine(ctx, r.Client, vsphereMachine)
+		if err != nil || vsphereCluster == nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to get VSphereCluster from VSphereMachine")
+		}
 
-	// Fetch the CAPI Machine.
-	machine, err := clusterutilv1.GetOwnerMachine(ctx, r.Client, vsphereMachine.ObjectMeta)
-	if err != nil {
-		return reconcile.Result{}, errors.Wrapf(err, "failed to get Machine for VSphereMachine")
-	}
-	if machine == nil {
-		log.Info("Waiting for Machine controller to set OwnerRef on VSphereMachine")
-		return reconcile.Result{}, nil
+		// Fetch the CAPI Machine.
+		machine, err = clusterutilv1.GetOwnerMachine(ctx, r.Client, vsphereMachine.ObjectMeta)
+		if err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to get Machine for VSphereMachine")
+		}
+		if machine == nil {
+			log.Info("Waiting for Machine controller to set OwnerRef on VSphereMachine")
+			return reconcile.Result{}, nil
+		}
+		log = log.WithValues("Machine", klog.KObj(machine))
+		ctx = ctrl.LoggerInto(ctx, log)
+
+		// AddOwners adds the owners of Machine as k/v pairs to the logger.
+		// Specifically, it will add KubeadmControlPlane, MachineSet and MachineDeployment.
+		ctx, log, err = clog.AddOwners(ctx, r.Client, machine)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		failureDomain = machine.Spec.FailureDomain
 	}
-	log = log.WithValues("Machine", klog.KObj(machine))
+
+	log = log.WithValues("VSphereCluster", klog.KObj(vsphereCluster))
 	ctx = ctrl.LoggerInto(ctx, log)
 
-	// AddOwners adds the owners of Machine as k/v pairs to the logger.
-	// Specifically, it will add KubeadmControlPlane, MachineSet and MachineDeployment.
-	ctx, log, err = clog.AddOwners(ctx, r.Client, machine)
+	vsphereClusterIdentity, err := identity.GetIdentityForCluster(ctx, r.Client, vsphereCluster)
 	if err != nil {
-		return ctrl.Result{}, err
+		return reconcile.Result{}, errors.Wrapf(err, "failed to get VSphereClusterIdentity of VSphereCluster")
 	}
 
 	var vsphereFailureDomain *infrav1.VSphereFailureDomain
-	if failureDomain := machine.Spec.FailureDomain; failureDomain != nil {
+	if failureDomain != nil {
 		vsphereDeploymentZone := &infrav1.VSphereDeploymentZone{}
 		if err := r.Client.Get(ctx, apitypes.NamespacedName{Name: *failureDomain}, vsphereDeploymentZone); err != nil {
 			return reconcile.Result{}, errors.Wrapf(err, "failed to get VSphereDeploymentZone %s", *failureDomain)
@@ -244,6 +302,7 @@ func (r vmReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.R
 		ControllerManagerContext: r.ControllerManagerContext,
 		VSphereVM:                vsphereVM,
 		VSphereFailureDomain:     vsphereFailureDomain,
+		VSphereClusterIdentity:   vsphereClusterIdentity,
 		Session:                  authSession,
 		PatchHelper:              patchHelper,
 	}
@@ -311,7 +370,9 @@ func (r vmReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.R
 // This logic was moved to a smaller function outside the main Reconcile() loop
 // for the ease of testing.
 func (r vmReconciler) reconcile(ctx context.Context, vmCtx *capvcontext.VMContext, input fetchClusterModuleInput) (reconcile.Result, error) {
-	if feature.Gates.Enabled(feature.NodeAntiAffinity) {
+	// The VMs of a VSphereMachinePool have no Machine, and are not placed in
+	// the cluster modules.
+	if feature.Gates.Enabled(feature.NodeAntiAffinity) && input.Machine != nil {
 		clusterModuleInfo, err := r.fetchClusterModuleInfo(ctx, input)
 		// If cluster module information cannot be fetched for a VM being deleted,
 		// we should not block VM deletion since the cluster module is updated
@@ -328,7 +389,17 @@ func (r vmReconciler) reconcile(ctx context.Context, vmCtx *capvcontext.VMContex
 	}
 
 	// Handle non-deleted machines
-	return r.reconcileNormal(ctx, vmCtx)
+	result, err := r.reconcileNormal(ctx, vmCtx)
+	if err != nil || !vmCtx.VSphereVM.Status.Ready {
+		return result, err
+	}
+
+	// Drain the Node of a ready VM whose host is not in service.
+	hostMaintenanceResult, err := r.reconcileHostMaintenance(ctx, vmCtx, input.Machine)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return clusterutilv1.LowestNonZeroResult(result, hostMaintenanceResult), nil
 }
 
 func (r vmReconciler) reconcileDelete(ctx context.Context, vmCtx *capvcontext.VMContext) (reconcile.Result, error) {
@@ -430,6 +501,13 @@ func (r vmReconciler) reconcileNormal(ctx context.Context, vmCtx *capvcontext.VM
 	// Do not proceed until the backend VM is marked ready.
 	if vm.State != infrav1.VirtualMachineStateReady {
 		log.Info(fmt.Sprintf("VM state is %q, waiting for %q", vm.State, infrav1.VirtualMachineStateReady))
+		// A VM waiting for the capacity of its vCenter server or for the
+		// deployment of its Content Library item is not watched by any task,
+		// so try to clone it again later.
+		switch conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition) {
+		case infrav1.WaitingForVCenterCapacityReason, infrav1.DeployingContentLibraryItemReason:
+			return reconcile.Result{RequeueAfter: throttle.RequeueAfter}, nil
+		}
 		return reconcile.Result{}, nil
 	}
 
@@ -586,44 +664,71 @@ func (r vmReconciler) retrieveVcenterSession(ctx context.Context, vsphereVM *inf
 	params := session.NewParams().
 		WithServer(vsphereVM.Spec.Server).
 		WithDatacenter(vsphereVM.Spec.Datacenter).
-		WithUserInfo(r.ControllerManagerContext.Username, r.ControllerManagerContext.Password).
-		WithThumbprint(vsphereVM.Spec.Thumbprint).
-		WithFeatures(session.Feature{
-			EnableKeepAlive:   r.ControllerManagerContext.EnableKeepAlive,
-			KeepAliveDuration: r.ControllerManagerContext.KeepAliveDuration,
-		})
-	cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, r.Client, vsphereVM.ObjectMeta)
-	if err != nil {
-		log.V(4).Info("Using credentials provided to the manager to create the authenticated session, VSphereVM is missing cluster label or cluster does not exist")
-		return session.GetOrCreate(ctx, params)
-	}
+		WithThumbprint(vsphereVM.Spec.Thumbprint)
 
-	if cluster.Spec.InfrastructureRef == nil {
-		return nil, errors.Errorf("cannot retrieve vCenter session for cluster %s: Cluster.spec.infrastructureRef is nil", klog.KObj(cluster))
+	var (
+		vsphereCluster *infrav1.VSphereCluster
+		vsphereServer  *infrav1.VSphereServer
+	)
+	if cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, r.Client, vsphereVM.ObjectMeta); err != nil {
+		log.V(4).Info("VSphereVM is missing cluster label or cluster does not exist")
+	} else {
+		if cluster.Spec.InfrastructureRef == nil {
+			return nil, errors.Errorf("cannot retrieve vCenter session for cluster %s: Cluster.spec.infrastructureRef is nil", klog.KObj(cluster))
+		}
+		key := ctrlclient.ObjectKey{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Spec.InfrastructureRef.Name,
+		}
+		vsphereCluster = &infrav1.VSphereCluster{}
+		if err := r.Client.Get(ctx, key, vsphereCluster); err != nil {
+			log.V(4).Info("Failed to get VSphereCluster")
+			vsphereCluster = nil
+		} else if vsphereServer, err = r.getVSphereServer(ctx, vsphereVM, vsphereCluster); err != nil {
+			return nil, err
+		}
 	}
-	key := ctrlclient.ObjectKey{
-		Namespace: cluster.Namespace,
-		Name:      cluster.Spec.InfrastructureRef.Name,
+
+	params, _, err := identity.GetSessionParams(ctx, r.Client, r.ControllerManagerContext, params, vsphereCluster, vsphereServer)
+	if err != nil {
+		return nil, err
 	}
-	vsphereCluster := &infrav1.VSphereCluster{}
-	err = r.Client.Get(ctx, key, vsphereCluster)
+	return session.GetOrCreate(ctx, params)
+}
+
+// getVSphereServer returns the VSphereServer of the vCenter server of the
+// VSphereVM, which is the one of its VSphereCluster or, when the VSphereVM is
+// placed in a failure domain of another vCenter server, the one of the
+// VSphereDeploymentZone of this vCenter server. It returns nil if the vCenter
+// server of the VSphereVM has no VSphereServer.
+func (r vmReconciler) getVSphereServer(ctx context.Context, vsphereVM *infrav1.VSphereVM, vsphereCluster *infrav1.VSphereCluster) (*infrav1.VSphereServer, error) {
+	server := session.ServerHost(vsphereVM.Spec.Server)
+
+	vsphereServer, err := identity.GetVSphereServer(ctx, r.Client, vsphereCluster.Spec.ServerRef)
 	if err != nil {
-		log.V(4).Info("Using credentials provided to the manager to create the authenticated session, failed to get VSphereCluster")
-		return session.GetOrCreate(ctx, params)
+		return nil, err
+	}
+	if vsphereServer != nil && session.ServerHost(vsphereServer.Spec.Server) == server {
+		return vsphereServer, nil
 	}
 
-	if vsphereCluster.Spec.IdentityRef != nil {
-		creds, err := identity.GetCredentials(ctx, r.Client, vsphereCluster, r.ControllerManagerContext.Namespace)
+	deploymentZones := &infrav1.VSphereDeploymentZoneList{}
+	if err := r.Client.List(ctx, deploymentZones); err != nil {
+		return nil, errors.Wrap(err, "failed to list VSphereDeploymentZones")
+	}
+	for _, deploymentZone := range deploymentZones.Items {
+		if deploymentZone.Spec.ServerRef == "" || session.ServerHost(deploymentZone.Spec.Server) != server {
+			continue
+		}
+		vsphereServer, err := identity.GetVSphereServer(ctx, r.Client, deploymentZone.Spec.ServerRef)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get credentials from IdentityRef")
+			return nil, err
+		}
+		if session.ServerHost(vsphereServer.Spec.Server) == server {
+			return vsphereServer, nil
 		}
-		params = params.WithUserInfo(creds.Username, creds.Password)
-		return session.GetOrCreate(ctx, params)
 	}
-
-	// Fallback to using credentials provided to the manager
-	log.V(4).Info("Using credentials provided to the manager to create the authenticated session")
-	return session.GetOrCreate(ctx, params)
+	return nil, nil
 }
 
 func (r vmReconciler) fetchClusterModuleInfo(ctx context.Context, clusterModInput fetchClusterModuleInput) (*string, error) {
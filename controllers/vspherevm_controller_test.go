@@ -545,6 +545,74 @@ func TestRetrievingVCenterCredentialsFromCluster(t *testing.T) {
 	)
 }
 
+func TestVmReconciler_GetVSphereServer(t *testing.T) {
+	vsphereServer := &infrav1.VSphereServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vcenter1"},
+		Spec:       infrav1.VSphereServerSpec{Server: "vcenter1.foo.com"},
+	}
+	otherVSphereServer := &infrav1.VSphereServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vcenter2"},
+		Spec:       infrav1.VSphereServerSpec{Server: "vcenter2.foo.com"},
+	}
+	// The failure domain of the zone is on a second vCenter server.
+	deploymentZone := &infrav1.VSphereDeploymentZone{
+		ObjectMeta: metav1.ObjectMeta{Name: "zone-2"},
+		Spec: infrav1.VSphereDeploymentZoneSpec{
+			Server:        "vcenter2.foo.com",
+			ServerRef:     "vcenter2",
+			FailureDomain: "fd-2",
+		},
+	}
+	vsphereCluster := &infrav1.VSphereCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "vsphere-cluster", Namespace: "test"},
+		Spec:       infrav1.VSphereClusterSpec{Server: "vcenter1.foo.com", ServerRef: "vcenter1"},
+	}
+
+	tests := []struct {
+		name       string
+		server     string
+		wantServer string
+	}{
+		{
+			name:       "with the vCenter server of the VSphereCluster",
+			server:     "vcenter1.foo.com",
+			wantServer: "vcenter1",
+		},
+		{
+			name:       "with the vCenter server of a VSphereDeploymentZone",
+			server:     "https://vcenter2.foo.com/sdk",
+			wantServer: "vcenter2",
+		},
+		{
+			name:   "with a vCenter server without VSphereServer",
+			server: "vcenter3.foo.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			controllerManagerContext := fake.NewControllerManagerContext(vsphereServer.DeepCopy(), otherVSphereServer.DeepCopy(), deploymentZone.DeepCopy())
+			r := vmReconciler{ControllerManagerContext: controllerManagerContext}
+			vsphereVM := &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{Name: "vsphere-vm", Namespace: "test"},
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Server: tt.server},
+				},
+			}
+
+			got, err := r.getVSphereServer(ctx, vsphereVM, vsphereCluster)
+			g.Expect(err).NotTo(HaveOccurred())
+			if tt.wantServer == "" {
+				g.Expect(got).To(BeNil())
+				return
+			}
+			g.Expect(got).NotTo(BeNil())
+			g.Expect(got.Name).To(Equal(tt.wantServer))
+		})
+	}
+}
+
 func Test_reconcile(t *testing.T) {
 	ns := "test"
 	vsphereCluster := &infrav1.VSphereCluster{
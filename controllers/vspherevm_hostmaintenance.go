@@ -0,0 +1,270 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/hosts"
+)
+
+// drainRetryInterval is the interval between the evictions of the pods of a
+// Node being drained.
+const drainRetryInterval = 20 * time.Second
+
+// hostMaintenanceReasons are the reasons of the HostInService condition by
+// state of the ESXi host.
+var hostMaintenanceReasons = map[hosts.State]string{
+	hosts.StateEnteringMaintenance: infrav1.HostEnteringMaintenanceReason,
+	hosts.StateInMaintenance:       infrav1.HostInMaintenanceReason,
+	hosts.StateInQuarantine:        infrav1.HostInQuarantineReason,
+}
+
+// reconcileHostMaintenance cordons and drains the Node of the VSphereVM when
+// the ESXi host running its VM enters maintenance or quarantine mode, so that
+// the host is not blocked evacuating it. The Node is uncordoned once the host
+// is back in service or the VM was migrated to another host.
+// The Machines of the VMs which cannot be migrated, because of their PCI
+// devices or the host group of their failure domain, are marked for
+// remediation once their Node is drained.
+func (r vmReconciler) reconcileHostMaintenance(ctx context.Context, vmCtx *capvcontext.VMContext, machine *clusterv1.Machine) (reconcile.Result, error) {
+	vsphereVM := vmCtx.VSphereVM
+	if vsphereVM.Status.HostRef == "" || vmCtx.Session == nil {
+		return reconcile.Result{}, nil
+	}
+	// The state of the host is unknown until it is monitored.
+	state, ok := hosts.GetState(vmCtx.Session.Client.Client.URL().Host, vsphereVM.Status.HostRef)
+	if !ok {
+		return reconcile.Result{}, nil
+	}
+
+	if state == hosts.StateInService {
+		// The Node was cordoned if the host was not in service.
+		if conditions.IsFalse(vsphereVM, infrav1.HostInServiceCondition) && machine != nil && machine.Status.NodeRef != nil {
+			clusterClient, result, err := r.getWorkloadClusterClient(ctx, vmCtx)
+			if err != nil || !result.IsZero() {
+				return result, err
+			}
+			if err := r.uncordonNode(ctx, vmCtx, clusterClient, machine.Status.NodeRef.Name); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		conditions.MarkTrue(vsphereVM, infrav1.HostInServiceCondition)
+		return reconcile.Result{}, nil
+	}
+
+	conditions.MarkFalse(vsphereVM, infrav1.HostInServiceCondition, hostMaintenanceReasons[state], clusterv1.ConditionSeverityWarning,
+		"Host %s is %s", vsphereVM.Status.Host, state)
+	if machine == nil || machine.Status.NodeRef == nil {
+		return reconcile.Result{}, nil
+	}
+	clusterClient, result, err := r.getWorkloadClusterClient(ctx, vmCtx)
+	if err != nil || !result.IsZero() {
+		return result, err
+	}
+	return r.drainForHostMaintenance(ctx, vmCtx, clusterClient, machine)
+}
+
+// drainForHostMaintenance cordons and drains the Node of the Machine, and
+// marks the Machine for remediation once it is drained if its VM cannot be
+// migrated.
+func (r vmReconciler) drainForHostMaintenance(ctx context.Context, vmCtx *capvcontext.VMContext, clusterClient ctrlclient.Client, machine *clusterv1.Machine) (reconcile.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	nodeName := machine.Status.NodeRef.Name
+	if err := r.cordonNode(ctx, vmCtx, clusterClient, nodeName); err != nil {
+		return reconcile.Result{}, err
+	}
+	drained, err := drainNode(ctx, clusterClient, nodeName)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "failed to drain Node %s", nodeName)
+	}
+	if !drained {
+		log.Info("Waiting for Node to be drained for host maintenance", "Node", nodeName, "host", vmCtx.VSphereVM.Status.Host)
+		return reconcile.Result{RequeueAfter: drainRetryInterval}, nil
+	}
+
+	if canMigrate(vmCtx) {
+		return reconcile.Result{}, nil
+	}
+	if _, ok := machine.Annotations[clusterv1.RemediateMachineAnnotation]; ok {
+		return reconcile.Result{}, nil
+	}
+	patchHelper, err := patch.NewHelper(machine, r.Client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	annotations.AddAnnotations(machine, map[string]string{clusterv1.RemediateMachineAnnotation: ""})
+	if err := patchHelper.Patch(ctx, machine); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "failed to mark Machine %s for remediation", machine.Name)
+	}
+	log.Info("Marked Machine for remediation because its VM cannot be migrated off the host", "host", vmCtx.VSphereVM.Status.Host)
+	r.Recorder.Eventf(vmCtx.VSphereVM, corev1.EventTypeNormal, "RemediationRequested", "Marked Machine for remediation because its VM cannot be migrated off host %s", vmCtx.VSphereVM.Status.Host)
+	return reconcile.Result{}, nil
+}
+
+// canMigrate returns false if the VM of the VSphereVM cannot be migrated to
+// another host, because it has PCI passthrough devices or it is pinned to the
+// host group of its failure domain.
+func canMigrate(vmCtx *capvcontext.VMContext) bool {
+	if len(vmCtx.VSphereVM.Spec.PciDevices) > 0 {
+		return false
+	}
+	if vmCtx.VSphereFailureDomain != nil && vmCtx.VSphereFailureDomain.Spec.Topology.Hosts != nil {
+		return false
+	}
+	return true
+}
+
+// cordonNode marks the Node as unschedulable, unless it already is, e.g.
+// because it was cordoned by a user, in which case it is left cordoned once
+// the host is back in service.
+func (r vmReconciler) cordonNode(ctx context.Context, vmCtx *capvcontext.VMContext, clusterClient ctrlclient.Client, name string) error {
+	node := &corev1.Node{}
+	if err := clusterClient.Get(ctx, ctrlclient.ObjectKey{Name: name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get Node %s", name)
+	}
+	if node.Spec.Unschedulable {
+		return nil
+	}
+
+	patchBase := ctrlclient.MergeFrom(node.DeepCopy())
+	node.Spec.Unschedulable = true
+	annotations.AddAnnotations(node, map[string]string{infrav1.AnnotationHostMaintenanceCordoned: ""})
+	if err := clusterClient.Patch(ctx, node, patchBase); err != nil {
+		return errors.Wrapf(err, "failed to cordon Node %s", name)
+	}
+	ctrl.LoggerFrom(ctx).Info("Cordoned Node for host maintenance", "Node", name, "host", vmCtx.VSphereVM.Status.Host)
+	r.Recorder.Eventf(vmCtx.VSphereVM, corev1.EventTypeNormal, "NodeCordoned", "Cordoned Node %s because host %s is not in service", name, vmCtx.VSphereVM.Status.Host)
+	return nil
+}
+
+// uncordonNode marks the Node as schedulable if it was cordoned for host
+// maintenance.
+func (r vmReconciler) uncordonNode(ctx context.Context, vmCtx *capvcontext.VMContext, clusterClient ctrlclient.Client, name string) error {
+	node := &corev1.Node{}
+	if err := clusterClient.Get(ctx, ctrlclient.ObjectKey{Name: name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get Node %s", name)
+	}
+	if _, ok := node.Annotations[infrav1.AnnotationHostMaintenanceCordoned]; !ok {
+		return nil
+	}
+
+	patchBase := ctrlclient.MergeFrom(node.DeepCopy())
+	node.Spec.Unschedulable = false
+	delete(node.Annotations, infrav1.AnnotationHostMaintenanceCordoned)
+	if err := clusterClient.Patch(ctx, node, patchBase); err != nil {
+		return errors.Wrapf(err, "failed to uncordon Node %s", name)
+	}
+	ctrl.LoggerFrom(ctx).Info("Uncordoned Node after host maintenance", "Node", name, "host", vmCtx.VSphereVM.Status.Host)
+	r.Recorder.Eventf(vmCtx.VSphereVM, corev1.EventTypeNormal, "NodeUncordoned", "Uncordoned Node %s because host %s is in service", name, vmCtx.VSphereVM.Status.Host)
+	return nil
+}
+
+// drainNode evicts the pods of the Node, except the mirror pods and the pods
+// of DaemonSets, and returns true once there are no pods left to evict.
+// Evictions are retried later while they are refused by PodDisruptionBudgets.
+func drainNode(ctx context.Context, clusterClient ctrlclient.Client, name string) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	pods := &corev1.PodList{}
+	if err := clusterClient.List(ctx, pods, ctrlclient.MatchingFields{"spec.nodeName": name}); err != nil {
+		return false, errors.Wrapf(err, "failed to list the pods of Node %s", name)
+	}
+
+	drained := true
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !isEvictable(pod) {
+			continue
+		}
+		drained = false
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		err := clusterClient.SubResource("eviction").Create(ctx, pod, &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+		})
+		switch {
+		case err == nil:
+			log.V(4).Info("Evicted pod", "Pod", klog.KObj(pod))
+		case apierrors.IsNotFound(err):
+		case apierrors.IsTooManyRequests(err):
+			log.V(4).Info("Eviction of pod refused by PodDisruptionBudget", "Pod", klog.KObj(pod))
+		default:
+			return false, errors.Wrapf(err, "failed to evict pod %s", klog.KObj(pod))
+		}
+	}
+	return drained, nil
+}
+
+// isEvictable returns true if the pod has to be evicted to drain its Node.
+func isEvictable(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == "DaemonSet" {
+		return false
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// getWorkloadClusterClient returns the client of the ClusterCacheTracker to
+// the workload cluster of the VSphereVM. The pods are not cached by the
+// client, so that the pods of a Node can be listed without caching all the
+// pods of the cluster.
+func (r vmReconciler) getWorkloadClusterClient(ctx context.Context, vmCtx *capvcontext.VMContext) (ctrlclient.Client, reconcile.Result, error) {
+	cluster, err := clusterutilv1.GetClusterFromMetadata(ctx, r.Client, vmCtx.VSphereVM.ObjectMeta)
+	if err != nil {
+		return nil, reconcile.Result{}, err
+	}
+	clusterClient, err := r.remoteClusterCacheTracker.GetClient(ctx, ctrlclient.ObjectKeyFromObject(cluster))
+	if err != nil {
+		if errors.Is(err, remote.ErrClusterLocked) {
+			ctrl.LoggerFrom(ctx).V(5).Info("Requeuing because another worker has the lock on the ClusterCacheTracker")
+			return nil, reconcile.Result{RequeueAfter: time.Minute}, nil
+		}
+		return nil, reconcile.Result{}, err
+	}
+	return clusterClient, reconcile.Result{}, nil
+}
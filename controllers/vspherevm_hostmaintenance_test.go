@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apirecord "k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestDrainForHostMaintenance(t *testing.T) {
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "test",
+		},
+		Status: clusterv1.MachineStatus{
+			NodeRef: &corev1.ObjectReference{Name: "node"},
+		},
+	}
+	newPod := func(name string, mutate func(pod *corev1.Pod)) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node",
+			},
+		}
+		if mutate != nil {
+			mutate(pod)
+		}
+		return pod
+	}
+	newWorkloadClusterClient := func(node *corev1.Node) ctrlclient.Client {
+		return ctrlfake.NewClientBuilder().
+			WithObjects(
+				node,
+				newPod("app", nil),
+				newPod("other-node", func(pod *corev1.Pod) { pod.Spec.NodeName = "other" }),
+				newPod("completed", func(pod *corev1.Pod) { pod.Status.Phase = corev1.PodSucceeded }),
+				newPod("mirror", func(pod *corev1.Pod) {
+					pod.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: ""}
+				}),
+				newPod("daemonset", func(pod *corev1.Pod) {
+					pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds", Controller: ptr.To(true)}}
+				}),
+			).
+			WithIndex(&corev1.Pod{}, "spec.nodeName", func(o ctrlclient.Object) []string {
+				return []string{o.(*corev1.Pod).Spec.NodeName}
+			}).
+			Build()
+	}
+	newReconciler := func() (vmReconciler, *capvcontext.VMContext) {
+		controllerManagerCtx := fake.NewControllerManagerContext(machine.DeepCopy())
+		r := vmReconciler{
+			ControllerManagerContext: controllerManagerCtx,
+			Recorder:                 apirecord.NewFakeRecorder(100),
+		}
+		vmCtx := &capvcontext.VMContext{
+			ControllerManagerContext: controllerManagerCtx,
+			VSphereVM: &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "test"},
+				Status:     infrav1.VSphereVMStatus{Host: "esx1"},
+			},
+		}
+		return r, vmCtx
+	}
+	getPod := func(c ctrlclient.Client, name string) error {
+		return c.Get(context.Background(), ctrlclient.ObjectKey{Namespace: "default", Name: name}, &corev1.Pod{})
+	}
+
+	t.Run("cordons and drains the Node", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r, vmCtx := newReconciler()
+		clusterClient := newWorkloadClusterClient(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+
+		result, err := r.drainForHostMaintenance(context.Background(), vmCtx, clusterClient, machine.DeepCopy())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.RequeueAfter).To(Equal(drainRetryInterval))
+
+		node := &corev1.Node{}
+		g.Expect(clusterClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "node"}, node)).To(Succeed())
+		g.Expect(node.Spec.Unschedulable).To(BeTrue())
+		g.Expect(node.Annotations).To(HaveKey(infrav1.AnnotationHostMaintenanceCordoned))
+		g.Expect(apierrors.IsNotFound(getPod(clusterClient, "app"))).To(BeTrue())
+		for _, name := range []string{"other-node", "completed", "mirror", "daemonset"} {
+			g.Expect(getPod(clusterClient, name)).To(Succeed())
+		}
+
+		// The VM can be migrated once the Node is drained.
+		result, err = r.drainForHostMaintenance(context.Background(), vmCtx, clusterClient, machine.DeepCopy())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.IsZero()).To(BeTrue())
+		m := &clusterv1.Machine{}
+		g.Expect(r.Client.Get(context.Background(), util.ObjectKey(machine), m)).To(Succeed())
+		g.Expect(m.Annotations).NotTo(HaveKey(clusterv1.RemediateMachineAnnotation))
+	})
+
+	t.Run("marks the Machine for remediation when the VM cannot be migrated", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r, vmCtx := newReconciler()
+		vmCtx.VSphereVM.Spec.PciDevices = []infrav1.PCIDeviceSpec{{DeviceID: ptr.To(int32(0x1EB8)), VendorID: ptr.To(int32(0x10DE))}}
+		clusterClient := newWorkloadClusterClient(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}})
+
+		_, err := r.drainForHostMaintenance(context.Background(), vmCtx, clusterClient, machine.DeepCopy())
+		g.Expect(err).NotTo(HaveOccurred())
+		m := &clusterv1.Machine{}
+		g.Expect(r.Client.Get(context.Background(), util.ObjectKey(machine), m)).To(Succeed())
+		g.Expect(m.Annotations).NotTo(HaveKey(clusterv1.RemediateMachineAnnotation))
+
+		_, err = r.drainForHostMaintenance(context.Background(), vmCtx, clusterClient, machine.DeepCopy())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(r.Client.Get(context.Background(), util.ObjectKey(machine), m)).To(Succeed())
+		g.Expect(m.Annotations).To(HaveKey(clusterv1.RemediateMachineAnnotation))
+	})
+
+	t.Run("uncordons only the Nodes cordoned for host maintenance", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r, vmCtx := newReconciler()
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: map[string]string{infrav1.AnnotationHostMaintenanceCordoned: ""}},
+			Spec:       corev1.NodeSpec{Unschedulable: true},
+		}
+		clusterClient := newWorkloadClusterClient(node)
+		g.Expect(r.uncordonNode(context.Background(), vmCtx, clusterClient, "node")).To(Succeed())
+		g.Expect(clusterClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "node"}, node)).To(Succeed())
+		g.Expect(node.Spec.Unschedulable).To(BeFalse())
+		g.Expect(node.Annotations).NotTo(HaveKey(infrav1.AnnotationHostMaintenanceCordoned))
+
+		// A Node cordoned by a user is left cordoned.
+		clusterClient = newWorkloadClusterClient(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}, Spec: corev1.NodeSpec{Unschedulable: true}})
+		g.Expect(r.cordonNode(context.Background(), vmCtx, clusterClient, "node")).To(Succeed())
+		g.Expect(r.uncordonNode(context.Background(), vmCtx, clusterClient, "node")).To(Succeed())
+		g.Expect(clusterClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "node"}, node)).To(Succeed())
+		g.Expect(node.Spec.Unschedulable).To(BeTrue())
+	})
+}
@@ -33,6 +33,12 @@ const (
 	//
 	// alpha: v1.4
 	NodeAntiAffinity featuregate.Feature = "NodeAntiAffinity"
+
+	// MachinePool is a feature gate for the VSphereMachinePool functionality,
+	// the infrastructure of the CAPI MachinePools.
+	//
+	// alpha: v1.11
+	MachinePool featuregate.Feature = "MachinePool"
 )
 
 func init() {
@@ -44,4 +50,5 @@ func init() {
 var defaultCAPVFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
 	// Every feature should be initiated here:
 	NodeAntiAffinity: {Default: false, PreRelease: featuregate.Alpha},
+	MachinePool:      {Default: false, PreRelease: featuregate.Alpha},
 }
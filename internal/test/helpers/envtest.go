@@ -163,7 +163,7 @@ func NewTestEnvironment(ctx context.Context) *TestEnvironment {
 			return err
 		}
 
-		if err := (&webhooks.VSphereMachineWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+		if err := (&webhooks.VSphereMachineWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
 			return err
 		}
 
@@ -171,7 +171,7 @@ func NewTestEnvironment(ctx context.Context) *TestEnvironment {
 			return err
 		}
 
-		if err := (&webhooks.VSphereVMWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+		if err := (&webhooks.VSphereVMWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
 			return err
 		}
 
@@ -179,7 +179,11 @@ func NewTestEnvironment(ctx context.Context) *TestEnvironment {
 			return err
 		}
 
-		return (&webhooks.VSphereFailureDomainWebhook{}).SetupWebhookWithManager(mgr)
+		if err := (&webhooks.VSphereFailureDomainWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
+			return err
+		}
+
+		return (&webhooks.VSphereServerWebhook{}).SetupWebhookWithManager(mgr)
 	}
 
 	mgr, err := manager.New(ctx, managerOpts)
@@ -18,6 +18,7 @@ limitations under the License.
 package vcsim
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net/url"
 
@@ -43,6 +44,11 @@ func (s Simulator) ServerURL() *url.URL {
 	return s.server.URL
 }
 
+// Certificate returns the certificate of the Simulator's server.
+func (s Simulator) Certificate() *x509.Certificate {
+	return s.server.Certificate()
+}
+
 // Run a govc command on the Simulator.
 func (s Simulator) Run(commandStr string, buffers ...*gbytes.Buffer) error {
 	pwd, _ := s.server.URL.User.Password()
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+)
+
+// getClusterIdentity returns the VSphereClusterIdentity of the VSphereCluster
+// of the cluster an object belongs to. It returns nil if the cluster or its
+// VSphereCluster do not exist yet, or if the VSphereCluster uses no identity,
+// since the resources are checked again before the VMs are cloned.
+func getClusterIdentity(ctx context.Context, c client.Client, obj client.Object) (*infrav1.VSphereClusterIdentity, error) {
+	clusterName := obj.GetLabels()[clusterv1.ClusterNameLabel]
+	if c == nil || clusterName == "" {
+		return nil, nil
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: clusterName}, cluster); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	ref := cluster.Spec.InfrastructureRef
+	if ref == nil || ref.Kind != "VSphereCluster" {
+		return nil, nil
+	}
+
+	vsphereCluster := &infrav1.VSphereCluster{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: ref.Name}, vsphereCluster); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	vsphereClusterIdentity, err := identity.GetIdentityForCluster(ctx, c, vsphereCluster)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return vsphereClusterIdentity, nil
+}
+
+// getFailureDomainIdentities returns the VSphereClusterIdentities used by the
+// VSphereDeploymentZones of a VSphereFailureDomain: the identity of their
+// VSphereServer, or else the ones of the VSphereClusters on their server.
+func getFailureDomainIdentities(ctx context.Context, c client.Client, failureDomain *infrav1.VSphereFailureDomain) ([]*infrav1.VSphereClusterIdentity, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	deploymentZones := &infrav1.VSphereDeploymentZoneList{}
+	if err := c.List(ctx, deploymentZones); err != nil {
+		return nil, err
+	}
+
+	var identities []*infrav1.VSphereClusterIdentity
+	seen := map[string]bool{}
+	addIdentity := func(vsphereClusterIdentity *infrav1.VSphereClusterIdentity) {
+		if vsphereClusterIdentity != nil && !seen[vsphereClusterIdentity.Name] {
+			seen[vsphereClusterIdentity.Name] = true
+			identities = append(identities, vsphereClusterIdentity)
+		}
+	}
+
+	var vsphereClusters *infrav1.VSphereClusterList
+	for _, deploymentZone := range deploymentZones.Items {
+		if deploymentZone.Spec.FailureDomain != failureDomain.Name {
+			continue
+		}
+
+		if deploymentZone.Spec.ServerRef != "" {
+			vsphereClusterIdentity, err := identity.GetIdentityForServer(ctx, c, deploymentZone.Spec.ServerRef)
+			if err != nil {
+				return nil, client.IgnoreNotFound(err)
+			}
+			addIdentity(vsphereClusterIdentity)
+			continue
+		}
+
+		if vsphereClusters == nil {
+			vsphereClusters = &infrav1.VSphereClusterList{}
+			if err := c.List(ctx, vsphereClusters); err != nil {
+				return nil, err
+			}
+		}
+		for i := range vsphereClusters.Items {
+			vsphereCluster := &vsphereClusters.Items[i]
+			if vsphereCluster.Spec.Server != deploymentZone.Spec.Server {
+				continue
+			}
+			vsphereClusterIdentity, err := identity.GetIdentityForCluster(ctx, c, vsphereCluster)
+			if err != nil {
+				return nil, client.IgnoreNotFound(err)
+			}
+			addIdentity(vsphereClusterIdentity)
+		}
+	}
+	return identities, nil
+}
+
+// validateAllowedResource returns an error if the inventory object is not
+// allowed by the VSphereClusterIdentity. The objects selected by a pattern,
+// like the default "*" datacenter, are resolved and checked before the VMs
+// are cloned.
+func validateAllowedResource(fldPath *field.Path, vsphereClusterIdentity *infrav1.VSphereClusterIdentity, kind identity.ResourceKind, nameOrPath string) *field.Error {
+	if nameOrPath == "" || strings.ContainsAny(nameOrPath, "*?[") {
+		return nil
+	}
+	if err := identity.CheckAllowedResource(vsphereClusterIdentity, kind, nameOrPath); err != nil {
+		return field.Forbidden(fldPath, err.Error())
+	}
+	return nil
+}
+
+// validateCloneSpecAllowedResources returns an error for each inventory
+// object of the clone spec which is not allowed by the VSphereClusterIdentity.
+func validateCloneSpecAllowedResources(fldPath *field.Path, vsphereClusterIdentity *infrav1.VSphereClusterIdentity, spec infrav1.VirtualMachineCloneSpec) field.ErrorList {
+	if vsphereClusterIdentity == nil || vsphereClusterIdentity.Spec.AllowedResources == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	appendErr := func(err *field.Error) {
+		if err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+	appendErr(validateAllowedResource(fldPath.Child("datacenter"), vsphereClusterIdentity, identity.DatacenterResource, spec.Datacenter))
+	appendErr(validateAllowedResource(fldPath.Child("folder"), vsphereClusterIdentity, identity.FolderResource, spec.Folder))
+	appendErr(validateAllowedResource(fldPath.Child("resourcePool"), vsphereClusterIdentity, identity.ResourcePoolResource, spec.ResourcePool))
+	appendErr(validateAllowedResource(fldPath.Child("datastore"), vsphereClusterIdentity, identity.DatastoreResource, spec.Datastore))
+	appendErr(validateAllowedResource(fldPath.Child("datastoreCluster"), vsphereClusterIdentity, identity.DatastoreResource, spec.DatastoreCluster))
+	appendErr(validateAllowedResource(fldPath.Child("template"), vsphereClusterIdentity, identity.TemplateResource, spec.Template))
+	if item := spec.ContentLibraryItem; item != nil && item.Library != "" && item.Name != "" {
+		appendErr(validateAllowedResource(fldPath.Child("contentLibraryItem"), vsphereClusterIdentity, identity.TemplateResource, path.Join("/", item.Library, item.Name)))
+	}
+	for i, parent := range spec.InstantCloneParents {
+		appendErr(validateAllowedResource(fldPath.Child(fmt.Sprintf("instantCloneParents[%d]", i)), vsphereClusterIdentity, identity.TemplateResource, parent))
+	}
+	for i, device := range spec.Network.Devices {
+		appendErr(validateAllowedResource(fldPath.Child("network", fmt.Sprintf("devices[%d]", i), "networkName"), vsphereClusterIdentity, identity.NetworkResource, device.NetworkName))
+	}
+	return allErrs
+}
+
+// validateTopologyAllowedResources returns an error for each inventory object
+// of the topology which is not allowed by the VSphereClusterIdentity.
+func validateTopologyAllowedResources(fldPath *field.Path, vsphereClusterIdentity *infrav1.VSphereClusterIdentity, topology infrav1.Topology) field.ErrorList {
+	if vsphereClusterIdentity == nil || vsphereClusterIdentity.Spec.AllowedResources == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	appendErr := func(err *field.Error) {
+		if err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+	appendErr(validateAllowedResource(fldPath.Child("datacenter"), vsphereClusterIdentity, identity.DatacenterResource, topology.Datacenter))
+	appendErr(validateAllowedResource(fldPath.Child("datastore"), vsphereClusterIdentity, identity.DatastoreResource, topology.Datastore))
+	appendErr(validateAllowedResource(fldPath.Child("datastoreCluster"), vsphereClusterIdentity, identity.DatastoreResource, topology.DatastoreCluster))
+	for i, network := range topology.Networks {
+		appendErr(validateAllowedResource(fldPath.Child(fmt.Sprintf("networks[%d]", i)), vsphereClusterIdentity, identity.NetworkResource, network))
+	}
+	return allErrs
+}
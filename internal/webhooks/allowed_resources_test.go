@@ -0,0 +1,225 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func newAllowedResourcesClient() client.Client {
+	scheme := runtime.NewScheme()
+	_ = clusterv1.AddToScheme(scheme)
+	_ = infrav1.AddToScheme(scheme)
+
+	objs := []runtime.Object{
+		&clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "team-a"},
+			Spec: clusterv1.ClusterSpec{
+				InfrastructureRef: &corev1.ObjectReference{Kind: "VSphereCluster", Name: "team-a"},
+			},
+		},
+		&infrav1.VSphereCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "team-a"},
+			Spec: infrav1.VSphereClusterSpec{
+				Server:      "vcenter.example.com",
+				IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: "team-a"},
+			},
+		},
+		&infrav1.VSphereClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: infrav1.VSphereClusterIdentitySpec{
+				AllowedResources: &infrav1.AllowedResources{
+					Datacenters: []string{"dc0"},
+					Folders:     []string{"/dc0/vm/team-a/*"},
+					Networks:    []string{"team-a-*"},
+					Datastores:  []string{"team-a-ds"},
+					Templates:   []string{"ubuntu", "/team-a/*"},
+				},
+			},
+		},
+		&infrav1.VSphereDeploymentZone{
+			ObjectMeta: metav1.ObjectMeta{Name: "zone-a"},
+			Spec: infrav1.VSphereDeploymentZoneSpec{
+				Server:        "vcenter.example.com",
+				FailureDomain: "fd-a",
+			},
+		},
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+}
+
+func TestVSphereMachine_ValidateCreateAllowedResources(t *testing.T) {
+	c := newAllowedResourcesClient()
+
+	tests := []struct {
+		name        string
+		clusterName string
+		spec        infrav1.VirtualMachineCloneSpec
+		errContains []string
+	}{
+		{
+			name:        "allowed resources",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				Datacenter: "dc0",
+				Folder:     "/dc0/vm/team-a/workload",
+				Datastore:  "team-a-ds",
+				Network:    infrav1.NetworkSpec{Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "team-a-net"}}},
+			},
+		},
+		{
+			name:        "resources selected by pattern or name",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				Datacenter: "*",
+				Folder:     "workload",
+			},
+		},
+		{
+			name:        "resources not allowed",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				Datacenter: "dc1",
+				Folder:     "/dc0/vm/team-b/workload",
+				Datastore:  "team-b-ds",
+				Network:    infrav1.NetworkSpec{Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "team-a-net"}, {NetworkName: "VM Network"}}},
+				Template:   "/dc0/vm/windows",
+			},
+			errContains: []string{
+				`spec.template: Forbidden: template "/dc0/vm/windows"`,
+				`spec.datacenter: Forbidden: datacenter "dc1" is not allowed by VSphereClusterIdentity team-a`,
+				`spec.folder: Forbidden: folder "/dc0/vm/team-b/workload"`,
+				`spec.datastore: Forbidden: datastore "team-b-ds"`,
+				`spec.network.devices[1].networkName: Forbidden: network "VM Network"`,
+			},
+		},
+		{
+			name:        "allowed Content Library item",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				ContentLibraryItem: &infrav1.ContentLibraryItemSpec{Library: "team-a", Name: "ubuntu"},
+			},
+		},
+		{
+			name:        "Content Library item not allowed",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				ContentLibraryItem: &infrav1.ContentLibraryItemSpec{Library: "team-b", Name: "windows"},
+			},
+			errContains: []string{
+				`spec.contentLibraryItem: Forbidden: template "/team-b/windows" is not allowed by VSphereClusterIdentity team-a`,
+			},
+		},
+		{
+			name:        "allowed instant clone parents",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				CloneMode:           infrav1.InstantClone,
+				InstantCloneParents: []string{"ubuntu", "/team-a/ubuntu-parent"},
+			},
+		},
+		{
+			name:        "instant clone parent not allowed",
+			clusterName: "team-a",
+			spec: infrav1.VirtualMachineCloneSpec{
+				CloneMode:           infrav1.InstantClone,
+				InstantCloneParents: []string{"ubuntu", "/dc0/vm/windows-parent"},
+			},
+			errContains: []string{
+				`spec.instantCloneParents[1]: Forbidden: template "/dc0/vm/windows-parent" is not allowed by VSphereClusterIdentity team-a`,
+			},
+		},
+		{
+			name:        "unknown cluster",
+			clusterName: "team-b",
+			spec:        infrav1.VirtualMachineCloneSpec{Datacenter: "dc1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			objectMeta := metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "machine",
+				Labels:    map[string]string{clusterv1.ClusterNameLabel: tt.clusterName},
+			}
+			if tt.spec.Template == "" && tt.spec.ContentLibraryItem == nil {
+				tt.spec.Template = "ubuntu"
+			}
+
+			vsphereMachine := &infrav1.VSphereMachine{ObjectMeta: objectMeta, Spec: infrav1.VSphereMachineSpec{VirtualMachineCloneSpec: tt.spec}}
+			_, machineErr := (&VSphereMachineWebhook{Client: c}).ValidateCreate(context.Background(), vsphereMachine)
+			vsphereVM := &infrav1.VSphereVM{ObjectMeta: objectMeta, Spec: infrav1.VSphereVMSpec{VirtualMachineCloneSpec: tt.spec}}
+			_, vmErr := (&VSphereVMWebhook{Client: c}).ValidateCreate(context.Background(), vsphereVM)
+
+			for _, err := range []error{machineErr, vmErr} {
+				if len(tt.errContains) == 0 {
+					g.Expect(err).ToNot(HaveOccurred())
+					continue
+				}
+				g.Expect(err).To(HaveOccurred())
+				for _, errContains := range tt.errContains {
+					g.Expect(err.Error()).To(ContainSubstring(errContains))
+				}
+				g.Expect(err.Error()).ToNot(ContainSubstring("team-a-net"))
+			}
+		})
+	}
+}
+
+func TestVSphereFailureDomain_ValidateCreateAllowedResources(t *testing.T) {
+	c := newAllowedResourcesClient()
+
+	newFailureDomain := func(name string) *infrav1.VSphereFailureDomain {
+		return &infrav1.VSphereFailureDomain{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: infrav1.VSphereFailureDomainSpec{
+				Region: infrav1.FailureDomain{Name: "region", Type: infrav1.DatacenterFailureDomain, TagCategory: "k8s-region"},
+				Zone:   infrav1.FailureDomain{Name: "zone", Type: infrav1.DatacenterFailureDomain, TagCategory: "k8s-zone"},
+				Topology: infrav1.Topology{
+					Datacenter: "dc0",
+					Networks:   []string{"team-a-net", "VM Network"},
+					Datastore:  "team-b-ds",
+				},
+			},
+		}
+	}
+
+	g := NewWithT(t)
+	webhook := &VSphereFailureDomainWebhook{Client: c}
+
+	_, err := webhook.ValidateCreate(context.Background(), newFailureDomain("fd-a"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(`spec.topology.networks[1]: Forbidden: network "VM Network" is not allowed by VSphereClusterIdentity team-a`))
+	g.Expect(err.Error()).To(ContainSubstring(`spec.topology.datastore: Forbidden: datastore "team-b-ds"`))
+	g.Expect(err.Error()).ToNot(ContainSubstring("datacenter"))
+
+	// The failure domain is not used by any deployment zone.
+	_, err = webhook.ValidateCreate(context.Background(), newFailureDomain("fd-b"))
+	g.Expect(err).ToNot(HaveOccurred())
+}
@@ -17,9 +17,14 @@ limitations under the License.
 package webhooks
 
 import (
+	"fmt"
+
+	"github.com/google/uuid"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 )
 
 func aggregateObjErrors(gk schema.GroupKind, name string, allErrs field.ErrorList) error {
@@ -33,3 +38,176 @@ func aggregateObjErrors(gk schema.GroupKind, name string, allErrs field.ErrorLis
 		allErrs,
 	)
 }
+
+// validateVirtualMachineCloneSpec validates the settings of a clone spec which
+// depend on each other. The adoption spec is nil for templates.
+func validateVirtualMachineCloneSpec(fldPath *field.Path, spec infrav1.VirtualMachineCloneSpec, adopt *infrav1.VirtualMachineAdoptionSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateContentLibraryItem(fldPath, spec, adopt)...)
+	allErrs = append(allErrs, validateInstantClone(fldPath, spec)...)
+	allErrs = append(allErrs, validateDataDisks(fldPath, spec)...)
+	allErrs = append(allErrs, validateResourceAllocations(fldPath, spec)...)
+	return allErrs
+}
+
+// resourceAllocationSpecKeys are the keys of a clone spec which may be changed
+// once the VM is created, since they are applied to the existing VM.
+var resourceAllocationSpecKeys = []string{"cpuAllocation", "memoryAllocation"}
+
+// validateResourceAllocations validates the CPU and memory allocation of a
+// clone spec.
+func validateResourceAllocations(fldPath *field.Path, spec infrav1.VirtualMachineCloneSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateResourceAllocation(fldPath.Child("cpuAllocation"), spec.CPUAllocation)...)
+	allErrs = append(allErrs, validateResourceAllocation(fldPath.Child("memoryAllocation"), spec.MemoryAllocation)...)
+	if allocation := spec.MemoryAllocation; allocation != nil && allocation.Reservation != nil && spec.MemoryMiB > 0 && *allocation.Reservation > spec.MemoryMiB {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("memoryAllocation", "reservation"), *allocation.Reservation, "cannot be greater than memoryMiB"))
+	}
+	return allErrs
+}
+
+// validateResourceAllocation validates the allocation of a resource of a
+// clone spec.
+func validateResourceAllocation(fldPath *field.Path, allocation *infrav1.ResourceAllocation) field.ErrorList {
+	var allErrs field.ErrorList
+	if allocation == nil {
+		return allErrs
+	}
+	if allocation.Reservation != nil && allocation.Limit != nil && *allocation.Limit >= 0 && *allocation.Reservation > *allocation.Limit {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("reservation"), *allocation.Reservation, "cannot be greater than limit"))
+	}
+	if shares := allocation.Shares; shares != nil {
+		switch {
+		case shares.Level == infrav1.SharesLevelCustom && shares.Shares == 0:
+			allErrs = append(allErrs, field.Required(fldPath.Child("shares", "shares"), "must be set when level is Custom"))
+		case shares.Level != infrav1.SharesLevelCustom && shares.Shares != 0:
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("shares", "shares"), "can only be set when level is Custom"))
+		}
+	}
+	return allErrs
+}
+
+// resizeSpecKeys returns the keys of a clone spec which may be changed once
+// the VM is created, according to the resize policy of the updated spec.
+func resizeSpecKeys(spec infrav1.VirtualMachineCloneSpec) []string {
+	keys := []string{"resizePolicy"}
+	if spec.ResizePolicy == infrav1.ResizePolicyInPlace {
+		keys = append(keys, "numCPUs", "memoryMiB", "diskGiB")
+	}
+	return keys
+}
+
+// validateResize validates the changes to the resources of a clone spec.
+func validateResize(fldPath *field.Path, oldSpec, newSpec infrav1.VirtualMachineCloneSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if newSpec.ResizePolicy != infrav1.ResizePolicyInPlace {
+		return allErrs
+	}
+	if newSpec.DiskGiB < oldSpec.DiskGiB {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("diskGiB"), newSpec.DiskGiB, "cannot be decreased"))
+	}
+	return allErrs
+}
+
+// validateDataDisks validates the data disks of a clone spec.
+func validateDataDisks(fldPath *field.Path, spec infrav1.VirtualMachineCloneSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	names := map[string]bool{}
+	// SCSI controllers of different types cannot share a bus number.
+	scsiBusTypes := map[int32]infrav1.DiskControllerType{}
+	for i, dataDisk := range spec.DataDisks {
+		diskPath := fldPath.Child("dataDisks").Index(i)
+		if names[dataDisk.Name] {
+			allErrs = append(allErrs, field.Duplicate(diskPath.Child("name"), dataDisk.Name))
+		}
+		names[dataDisk.Name] = true
+
+		if dataDisk.ControllerBusNumber == nil {
+			continue
+		}
+		controllerType := dataDisk.ControllerType
+		if controllerType == "" {
+			controllerType = infrav1.DiskControllerTypePVSCSI
+		}
+		if controllerType == infrav1.DiskControllerTypeNVMe || controllerType == infrav1.DiskControllerTypeSATA {
+			continue
+		}
+		if t, ok := scsiBusTypes[*dataDisk.ControllerBusNumber]; ok && t != controllerType {
+			allErrs = append(allErrs, field.Invalid(diskPath.Child("controllerBusNumber"), *dataDisk.ControllerBusNumber, fmt.Sprintf("SCSI bus number is already used by a %s controller", t)))
+			continue
+		}
+		scsiBusTypes[*dataDisk.ControllerBusNumber] = controllerType
+	}
+	return allErrs
+}
+
+// validateContentLibraryItem validates the Content Library item of a clone spec,
+// and that a VM which is not adopted has either a template or an item to be
+// cloned from.
+func validateContentLibraryItem(fldPath *field.Path, spec infrav1.VirtualMachineCloneSpec, adopt *infrav1.VirtualMachineAdoptionSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	item := spec.ContentLibraryItem
+	if item == nil {
+		if spec.Template == "" && adopt == nil {
+			allErrs = append(allErrs, field.Required(fldPath.Child("template"), "either template or contentLibraryItem must be set"))
+		}
+		return allErrs
+	}
+	itemPath := fldPath.Child("contentLibraryItem")
+	if spec.Template != "" {
+		allErrs = append(allErrs, field.Forbidden(itemPath, "cannot be set together with template"))
+	}
+	switch {
+	case item.ID != "" && (item.Library != "" || item.Name != ""):
+		allErrs = append(allErrs, field.Forbidden(itemPath.Child("id"), "cannot be set together with library and name"))
+	case item.ID == "" && (item.Library == "" || item.Name == ""):
+		allErrs = append(allErrs, field.Required(itemPath, "either id or both library and name must be set"))
+	}
+	return allErrs
+}
+
+// validateInstantClone validates the instant clone settings of a clone spec.
+func validateInstantClone(fldPath *field.Path, spec infrav1.VirtualMachineCloneSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.CloneMode != infrav1.InstantClone {
+		return allErrs
+	}
+	if len(spec.InstantCloneParents) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("instantCloneParents"), "must be set when cloneMode is instantClone"))
+	}
+	// PCI devices can't be added to the running VMs created by an instant clone.
+	if len(spec.PciDevices) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("pciDevices"), "cannot be set when cloneMode is instantClone"))
+	}
+	// Disks can't be added by an instant clone either.
+	if len(spec.DataDisks) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("dataDisks"), "cannot be set when cloneMode is instantClone"))
+	}
+	// The instant clones inherit the CPUs and the memory of their parent,
+	// which an in-place resize would reset to the defaults of the unset
+	// NumCPUs and MemoryMiB.
+	if spec.ResizePolicy == infrav1.ResizePolicyInPlace {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("resizePolicy"), "cannot be InPlace when cloneMode is instantClone"))
+	}
+	return allErrs
+}
+
+// validateAdoption validates the reference to an existing VM to adopt.
+func validateAdoption(fldPath *field.Path, adopt *infrav1.VirtualMachineAdoptionSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if adopt == nil {
+		return allErrs
+	}
+	switch {
+	case adopt.MoRef == "" && adopt.BiosUUID == "":
+		allErrs = append(allErrs, field.Required(fldPath, "either moRef or biosUUID must be set"))
+	case adopt.MoRef != "" && adopt.BiosUUID != "":
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("biosUUID"), "cannot be set together with moRef"))
+	}
+	if adopt.BiosUUID != "" {
+		if _, err := uuid.Parse(adopt.BiosUUID); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("biosUUID"), adopt.BiosUUID, "should be a valid UUID"))
+		}
+	}
+	return allErrs
+}
@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/pkg/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
@@ -36,7 +38,12 @@ import (
 // +kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-vspherefailuredomain,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=vspherefailuredomains,verbs=create;update,versions=v1beta1,name=default.vspherefailuredomain.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
 
 // VSphereFailureDomainWebhook implements a validation and defaulting webhook for VSphereFailureDomain.
-type VSphereFailureDomainWebhook struct{}
+type VSphereFailureDomainWebhook struct {
+	// Client is used to check the topology against the allowed resources of
+	// the VSphereClusterIdentities of the VSphereDeploymentZones referencing
+	// the failure domain. The check is skipped if nil.
+	Client client.Client
+}
 
 var _ webhook.CustomValidator = &VSphereFailureDomainWebhook{}
 var _ webhook.CustomDefaulter = &VSphereFailureDomainWebhook{}
@@ -50,7 +57,7 @@ func (webhook *VSphereFailureDomainWebhook) SetupWebhookWithManager(mgr ctrl.Man
 }
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
-func (webhook *VSphereFailureDomainWebhook) ValidateCreate(_ context.Context, raw runtime.Object) (admission.Warnings, error) {
+func (webhook *VSphereFailureDomainWebhook) ValidateCreate(ctx context.Context, raw runtime.Object) (admission.Warnings, error) {
 	var allErrs field.ErrorList
 
 	obj, ok := raw.(*infrav1.VSphereFailureDomain)
@@ -77,6 +84,18 @@ func (webhook *VSphereFailureDomainWebhook) ValidateCreate(_ context.Context, ra
 		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "Topology", "ComputeCluster"), fmt.Sprintf("cannot be nil if zone's Failure Domain type is %s", obj.Spec.Zone.Type)))
 	}
 
+	if obj.Spec.Topology.Datastore != "" && obj.Spec.Topology.DatastoreCluster != "" {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "Topology", "DatastoreCluster"), "cannot be set if Datastore is set"))
+	}
+
+	identities, err := getFailureDomainIdentities(ctx, webhook.Client, obj)
+	if err != nil {
+		return nil, apierrors.NewInternalError(errors.Wrap(err, "failed to get VSphereClusterIdentities of VSphereFailureDomain"))
+	}
+	for _, vsphereClusterIdentity := range identities {
+		allErrs = append(allErrs, validateTopologyAllowedResources(field.NewPath("spec", "topology"), vsphereClusterIdentity, obj.Spec.Topology)...)
+	}
+
 	return nil, aggregateObjErrors(obj.GroupVersionKind().GroupKind(), obj.Name, allErrs)
 }
 
@@ -132,6 +132,26 @@ func TestVSphereFailureDomain_ValidateCreate(t *testing.T) {
 				},
 			}},
 		},
+		{
+			name: "both datastore and datastore cluster are set",
+			failureDomain: infrav1.VSphereFailureDomain{Spec: infrav1.VSphereFailureDomainSpec{
+				Region: infrav1.FailureDomain{
+					Name:        "foo",
+					Type:        infrav1.DatacenterFailureDomain,
+					TagCategory: "k8s-bar",
+				},
+				Zone: infrav1.FailureDomain{
+					Name:        "foo",
+					Type:        infrav1.DatacenterFailureDomain,
+					TagCategory: "k8s-bar",
+				},
+				Topology: infrav1.Topology{
+					Datacenter:       "/blah",
+					Datastore:        "ds",
+					DatastoreCluster: "pod",
+				},
+			}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -27,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
@@ -37,7 +38,11 @@ import (
 // +kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-vspheremachine,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=vspheremachines,versions=v1beta1,name=default.vspheremachine.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
 
 // VSphereMachineWebhook implements a validation and defaulting webhook for VSphereMachine.
-type VSphereMachineWebhook struct{}
+type VSphereMachineWebhook struct {
+	// Client is used to check the spec against the allowed resources of the
+	// VSphereClusterIdentity of the cluster. The check is skipped if nil.
+	Client client.Client
+}
 
 var _ webhook.CustomValidator = &VSphereMachineWebhook{}
 var _ webhook.CustomDefaulter = &VSphereMachineWebhook{}
@@ -63,7 +68,7 @@ func (webhook *VSphereMachineWebhook) Default(_ context.Context, obj runtime.Obj
 }
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
-func (webhook *VSphereMachineWebhook) ValidateCreate(_ context.Context, raw runtime.Object) (admission.Warnings, error) {
+func (webhook *VSphereMachineWebhook) ValidateCreate(ctx context.Context, raw runtime.Object) (admission.Warnings, error) {
 	var allErrs field.ErrorList
 
 	obj, ok := raw.(*infrav1.VSphereMachine)
@@ -93,6 +98,15 @@ func (webhook *VSphereMachineWebhook) ValidateCreate(_ context.Context, raw runt
 		}
 	}
 
+	allErrs = append(allErrs, validateVirtualMachineCloneSpec(field.NewPath("spec"), spec.VirtualMachineCloneSpec, spec.Adopt)...)
+	allErrs = append(allErrs, validateAdoption(field.NewPath("spec", "adopt"), spec.Adopt)...)
+
+	vsphereClusterIdentity, err := getClusterIdentity(ctx, webhook.Client, obj)
+	if err != nil {
+		return nil, apierrors.NewInternalError(errors.Wrap(err, "failed to get VSphereClusterIdentity of VSphereMachine"))
+	}
+	allErrs = append(allErrs, validateCloneSpecAllowedResources(field.NewPath("spec"), vsphereClusterIdentity, spec.VirtualMachineCloneSpec)...)
+
 	return nil, aggregateObjErrors(obj.GroupVersionKind().GroupKind(), obj.Name, allErrs)
 }
 
@@ -127,6 +141,11 @@ func (webhook *VSphereMachineWebhook) ValidateUpdate(_ context.Context, oldRaw r
 	oldVSphereMachineSpec := oldVSphereMachine["spec"].(map[string]interface{})
 
 	allowChangeKeys := []string{"providerID", "powerOffMode", "guestSoftPowerOffTimeout"}
+	// Allow changes to the resources of the VM if it can be resized.
+	allowChangeKeys = append(allowChangeKeys, resizeSpecKeys(newTyped.Spec.VirtualMachineCloneSpec)...)
+	// Allow changes to the resource allocation of the VM.
+	allowChangeKeys = append(allowChangeKeys, resourceAllocationSpecKeys...)
+	allErrs = append(allErrs, validateResourceAllocations(field.NewPath("spec"), newTyped.Spec.VirtualMachineCloneSpec)...)
 	for _, key := range allowChangeKeys {
 		delete(oldVSphereMachineSpec, key)
 		delete(newVSphereMachineSpec, key)
@@ -149,6 +168,12 @@ func (webhook *VSphereMachineWebhook) ValidateUpdate(_ context.Context, oldRaw r
 		}
 	}
 
+	oldTyped, ok := oldRaw.(*infrav1.VSphereMachine)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a VSphereMachine but got a %T", oldRaw))
+	}
+	allErrs = append(allErrs, validateResize(field.NewPath("spec"), oldTyped.Spec.VirtualMachineCloneSpec, newTyped.Spec.VirtualMachineCloneSpec)...)
+
 	if !reflect.DeepEqual(oldVSphereMachineSpec, newVSphereMachineSpec) {
 		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), "cannot be modified"))
 	}
@@ -22,6 +22,7 @@ import (
 
 	. "github.com/onsi/gomega"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 )
@@ -96,6 +97,128 @@ func TestVSphereMachine_ValidateCreate(t *testing.T) {
 			vsphereMachine: createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32", "192.168.0.3/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, &metav1.Duration{Duration: 1234}),
 			wantErr:        false,
 		},
+		{
+			name:           "instantCloneParents should be set with cloneMode set to instantClone",
+			vsphereMachine: createInstantCloneVSphereMachine(nil, nil),
+			wantErr:        true,
+		},
+		{
+			name:           "pciDevices should not be set with cloneMode set to instantClone",
+			vsphereMachine: createInstantCloneVSphereMachine([]string{"parent-0"}, []infrav1.PCIDeviceSpec{{DeviceID: ptr.To[int32](1), VendorID: ptr.To[int32](1)}}),
+			wantErr:        true,
+		},
+		{
+			name: "resizePolicy should not be InPlace with cloneMode set to instantClone",
+			vsphereMachine: func() *infrav1.VSphereMachine {
+				m := createInstantCloneVSphereMachine([]string{"parent-0"}, nil)
+				m.Spec.ResizePolicy = infrav1.ResizePolicyInPlace
+				return m
+			}(),
+			wantErr: true,
+		},
+		{
+			name:           "successful VSphereMachine creation with cloneMode set to instantClone",
+			vsphereMachine: createInstantCloneVSphereMachine([]string{"parent-0", "parent-1"}, nil),
+			wantErr:        false,
+		},
+		{
+			name:           "contentLibraryItem should not be set with template",
+			vsphereMachine: createContentLibraryVSphereMachine("ubuntu", infrav1.ContentLibraryItemSpec{ID: "item-id"}),
+			wantErr:        true,
+		},
+		{
+			name:           "contentLibraryItem id should not be set with library and name",
+			vsphereMachine: createContentLibraryVSphereMachine("", infrav1.ContentLibraryItemSpec{ID: "item-id", Library: "library", Name: "ubuntu"}),
+			wantErr:        true,
+		},
+		{
+			name:           "either template or contentLibraryItem should be set",
+			vsphereMachine: createTemplateVSphereMachine(""),
+			wantErr:        true,
+		},
+		{
+			name:           "contentLibraryItem should have both library and name",
+			vsphereMachine: createContentLibraryVSphereMachine("", infrav1.ContentLibraryItemSpec{Name: "ubuntu"}),
+			wantErr:        true,
+		},
+		{
+			name:           "successful VSphereMachine creation with contentLibraryItem set by id",
+			vsphereMachine: createContentLibraryVSphereMachine("", infrav1.ContentLibraryItemSpec{ID: "item-id"}),
+			wantErr:        false,
+		},
+		{
+			name:           "successful VSphereMachine creation with contentLibraryItem set by library and name",
+			vsphereMachine: createContentLibraryVSphereMachine("", infrav1.ContentLibraryItemSpec{Library: "library", Name: "ubuntu", CacheTemplate: true}),
+			wantErr:        false,
+		},
+		{
+			name:           "dataDisks should have unique names",
+			vsphereMachine: createDataDisksVSphereMachine(infrav1.DataDisk{Name: "data", SizeGiB: 10}, infrav1.DataDisk{Name: "data", SizeGiB: 20}),
+			wantErr:        true,
+		},
+		{
+			name: "dataDisks should not put SCSI controllers of different types on the same bus",
+			vsphereMachine: createDataDisksVSphereMachine(
+				infrav1.DataDisk{Name: "data", SizeGiB: 10, ControllerBusNumber: ptr.To[int32](1)},
+				infrav1.DataDisk{Name: "logs", SizeGiB: 10, ControllerType: infrav1.DiskControllerTypeLSILogic, ControllerBusNumber: ptr.To[int32](1)},
+			),
+			wantErr: true,
+		},
+		{
+			name: "dataDisks should not be set with cloneMode set to instantClone",
+			vsphereMachine: func() *infrav1.VSphereMachine {
+				m := createInstantCloneVSphereMachine([]string{"parent-0"}, nil)
+				m.Spec.DataDisks = []infrav1.DataDisk{{Name: "data", SizeGiB: 10}}
+				return m
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "successful VSphereMachine creation with dataDisks",
+			vsphereMachine: createDataDisksVSphereMachine(
+				infrav1.DataDisk{Name: "data", SizeGiB: 10, ControllerBusNumber: ptr.To[int32](1)},
+				infrav1.DataDisk{Name: "logs", SizeGiB: 10, ControllerBusNumber: ptr.To[int32](1)},
+				infrav1.DataDisk{Name: "scratch", SizeGiB: 10, ControllerType: infrav1.DiskControllerTypeNVMe, ControllerBusNumber: ptr.To[int32](1)},
+			),
+			wantErr: false,
+		},
+		{
+			name: "memoryAllocation reservation cannot be greater than memoryMiB",
+			vsphereMachine: func() *infrav1.VSphereMachine {
+				m := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+				m.Spec.MemoryMiB = 4096
+				m.Spec.MemoryAllocation = &infrav1.ResourceAllocation{Reservation: ptr.To[int64](8192)}
+				return m
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "cpuAllocation shares can only be set with the Custom level",
+			vsphereMachine: func() *infrav1.VSphereMachine {
+				m := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+				m.Spec.CPUAllocation = &infrav1.ResourceAllocation{Shares: &infrav1.ResourceShares{Level: infrav1.SharesLevelLow, Shares: 100}}
+				return m
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "successful VSphereMachine creation adopting a VM",
+			vsphereMachine: func() *infrav1.VSphereMachine {
+				m := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+				m.Spec.Adopt = &infrav1.VirtualMachineAdoptionSpec{MoRef: "vm-42", DeletionPolicy: infrav1.AdoptedVMDeletionPolicyRetain}
+				return m
+			}(),
+			wantErr: false,
+		},
+		{
+			name: "adopted VM must be referenced by moRef or BIOS UUID",
+			vsphereMachine: func() *infrav1.VSphereMachine {
+				m := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+				m.Spec.Adopt = &infrav1.VirtualMachineAdoptionSpec{}
+				return m
+			}(),
+			wantErr: true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(*testing.T) {
@@ -167,6 +290,24 @@ func TestVSphereMachine_ValidateUpdate(t *testing.T) {
 			vsphereMachine:    createVSphereMachine("foo.com", &someProviderID, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeSoft, nil),
 			wantErr:           false,
 		},
+		{
+			name:              "numCPUs cannot be updated without the InPlace resize policy",
+			oldVSphereMachine: createResizableVSphereMachine(infrav1.ResizePolicyNone, 2, 20),
+			vsphereMachine:    createResizableVSphereMachine(infrav1.ResizePolicyNone, 4, 20),
+			wantErr:           true,
+		},
+		{
+			name:              "numCPUs and diskGiB can be updated with the InPlace resize policy",
+			oldVSphereMachine: createResizableVSphereMachine(infrav1.ResizePolicyInPlace, 2, 20),
+			vsphereMachine:    createResizableVSphereMachine(infrav1.ResizePolicyInPlace, 4, 40),
+			wantErr:           false,
+		},
+		{
+			name:              "diskGiB cannot be decreased with the InPlace resize policy",
+			oldVSphereMachine: createResizableVSphereMachine(infrav1.ResizePolicyInPlace, 2, 40),
+			vsphereMachine:    createResizableVSphereMachine(infrav1.ResizePolicyInPlace, 2, 20),
+			wantErr:           true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(*testing.T) {
@@ -185,7 +326,8 @@ func createVSphereMachine(server string, providerID *string, preferredAPIServerC
 	VSphereMachine := &infrav1.VSphereMachine{
 		Spec: infrav1.VSphereMachineSpec{
 			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
-				Server: server,
+				Server:   server,
+				Template: "ubuntu-2204-kube-v1.29.0",
 				Network: infrav1.NetworkSpec{
 					PreferredAPIServerCIDR: preferredAPIServerCIDR,
 					Devices:                []infrav1.NetworkDeviceSpec{},
@@ -203,3 +345,38 @@ func createVSphereMachine(server string, providerID *string, preferredAPIServerC
 	}
 	return VSphereMachine
 }
+
+func createInstantCloneVSphereMachine(parents []string, pciDevices []infrav1.PCIDeviceSpec) *infrav1.VSphereMachine {
+	vSphereMachine := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereMachine.Spec.CloneMode = infrav1.InstantClone
+	vSphereMachine.Spec.InstantCloneParents = parents
+	vSphereMachine.Spec.PciDevices = pciDevices
+	return vSphereMachine
+}
+
+func createContentLibraryVSphereMachine(template string, item infrav1.ContentLibraryItemSpec) *infrav1.VSphereMachine {
+	vSphereMachine := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereMachine.Spec.Template = template
+	vSphereMachine.Spec.ContentLibraryItem = &item
+	return vSphereMachine
+}
+
+func createTemplateVSphereMachine(template string) *infrav1.VSphereMachine {
+	vSphereMachine := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereMachine.Spec.Template = template
+	return vSphereMachine
+}
+
+func createDataDisksVSphereMachine(dataDisks ...infrav1.DataDisk) *infrav1.VSphereMachine {
+	vSphereMachine := createVSphereMachine("foo.com", nil, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereMachine.Spec.DataDisks = dataDisks
+	return vSphereMachine
+}
+
+func createResizableVSphereMachine(resizePolicy infrav1.ResizePolicy, numCPUs, diskGiB int32) *infrav1.VSphereMachine {
+	vSphereMachine := createVSphereMachine("foo.com", &someProviderID, "", []string{"192.168.0.1/32"}, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereMachine.Spec.ResizePolicy = resizePolicy
+	vSphereMachine.Spec.NumCPUs = numCPUs
+	vSphereMachine.Spec.DiskGiB = diskGiB
+	return vSphereMachine
+}
@@ -65,6 +65,9 @@ func (webhook *VSphereMachineTemplateWebhook) ValidateCreate(_ context.Context,
 	if spec.ProviderID != nil {
 		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template", "spec", "providerID"), "cannot be set in templates"))
 	}
+	if spec.Adopt != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template", "spec", "adopt"), "cannot be set in templates"))
+	}
 	for _, device := range spec.Network.Devices {
 		if len(device.IPAddrs) != 0 {
 			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template", "spec", "network", "devices", "ipAddrs"), "cannot be set in templates"))
@@ -84,6 +87,8 @@ func (webhook *VSphereMachineTemplateWebhook) ValidateCreate(_ context.Context,
 			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "template", "spec", "guestSoftPowerOffTimeout"), spec.GuestSoftPowerOffTimeout, "should be greater than 0"))
 		}
 	}
+	allErrs = append(allErrs, validateVirtualMachineCloneSpec(field.NewPath("spec", "template", "spec"), spec.VirtualMachineCloneSpec, nil)...)
+
 	return nil, aggregateObjErrors(obj.GroupVersionKind().GroupKind(), obj.Name, allErrs)
 }
 
@@ -69,6 +69,15 @@ func TestVSphereMachineTemplate_ValidateCreate(t *testing.T) {
 			name:           "successful VSphereMachine creation with hardware version set",
 			vsphereMachine: createVSphereMachineTemplate("foo.com", "vmx-17", nil, "", []string{}),
 		},
+		{
+			name: "adopted VM cannot be set in templates",
+			vsphereMachine: func() *infrav1.VSphereMachineTemplate {
+				m := createVSphereMachineTemplate("foo.com", "vmx-17", nil, "", []string{})
+				m.Spec.Template.Spec.Adopt = &infrav1.VirtualMachineAdoptionSpec{MoRef: "vm-42"}
+				return m
+			}(),
+			wantErr: true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(*testing.T) {
@@ -152,7 +161,8 @@ func createVSphereMachineTemplate(server, hwVersion string, providerID *string,
 				Spec: infrav1.VSphereMachineSpec{
 					ProviderID: providerID,
 					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
-						Server: server,
+						Server:   server,
+						Template: "ubuntu-2204-kube-v1.29.0",
 						Network: infrav1.NetworkSpec{
 							PreferredAPIServerCIDR: preferredAPIServerCIDR,
 							Devices:                []infrav1.NetworkDeviceSpec{},
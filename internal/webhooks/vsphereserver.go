@@ -0,0 +1,99 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-vsphereserver,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=vsphereservers,versions=v1beta1,name=validation.vsphereserver.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
+
+// VSphereServerWebhook implements a validation webhook for VSphereServer.
+type VSphereServerWebhook struct{}
+
+var _ webhook.CustomValidator = &VSphereServerWebhook{}
+
+func (webhook *VSphereServerWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&infrav1.VSphereServer{}).
+		WithValidator(webhook).
+		Complete()
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
+func (webhook *VSphereServerWebhook) ValidateCreate(_ context.Context, raw runtime.Object) (admission.Warnings, error) {
+	obj, ok := raw.(*infrav1.VSphereServer)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a VSphereServer but got a %T", raw))
+	}
+	return nil, aggregateObjErrors(obj.GroupVersionKind().GroupKind(), obj.Name, validateVSphereServerSpec(obj.Spec))
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+func (webhook *VSphereServerWebhook) ValidateUpdate(_ context.Context, oldRaw runtime.Object, newRaw runtime.Object) (admission.Warnings, error) {
+	oldTyped, ok := oldRaw.(*infrav1.VSphereServer)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a VSphereServer but got a %T", oldRaw))
+	}
+	newTyped, ok := newRaw.(*infrav1.VSphereServer)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a VSphereServer but got a %T", newRaw))
+	}
+
+	allErrs := validateVSphereServerSpec(newTyped.Spec)
+	// The server is copied to the objects referencing the VSphereServer.
+	if newTyped.Spec.Server != oldTyped.Spec.Server {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "server"), "cannot be modified"))
+	}
+	return nil, aggregateObjErrors(newTyped.GroupVersionKind().GroupKind(), newTyped.Name, allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+func (webhook *VSphereServerWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateVSphereServerSpec(spec infrav1.VSphereServerSpec) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(spec.CABundle) > 0 && !x509.NewCertPool().AppendCertsFromPEM(spec.CABundle) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "caBundle"), "", "must contain at least one PEM encoded certificate"))
+	}
+	if proxy := spec.Proxy; proxy != nil {
+		if proxyURL, err := url.Parse(proxy.URL); err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "proxy", "url"), proxy.URL, "must be an http or https URL"))
+		} else if proxyURL.User != nil {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "proxy", "url"), "cannot contain credentials, use secretName instead"))
+		}
+	}
+	if ref := spec.IdentityRef; ref != nil && ref.Kind != infrav1.VSphereClusterIdentityKind {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("spec", "identityRef", "kind"), ref.Kind, []string{string(infrav1.VSphereClusterIdentityKind)}))
+	}
+	return allErrs
+}
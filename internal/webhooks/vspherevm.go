@@ -27,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
@@ -37,7 +38,11 @@ import (
 // +kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-vspherevm,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=vspherevms,versions=v1beta1,name=default.vspherevm.infrastructure.x-k8s.io,sideEffects=None,admissionReviewVersions=v1beta1
 
 // VSphereVMWebhook implements a validation and defaulting webhook for VSphereVM.
-type VSphereVMWebhook struct{}
+type VSphereVMWebhook struct {
+	// Client is used to check the spec against the allowed resources of the
+	// VSphereClusterIdentity of the cluster. The check is skipped if nil.
+	Client client.Client
+}
 
 var _ webhook.CustomValidator = &VSphereVMWebhook{}
 var _ webhook.CustomDefaulter = &VSphereVMWebhook{}
@@ -64,7 +69,7 @@ func (webhook *VSphereVMWebhook) Default(_ context.Context, obj runtime.Object)
 }
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
-func (webhook *VSphereVMWebhook) ValidateCreate(_ context.Context, raw runtime.Object) (admission.Warnings, error) {
+func (webhook *VSphereVMWebhook) ValidateCreate(ctx context.Context, raw runtime.Object) (admission.Warnings, error) {
 	var allErrs field.ErrorList
 	objValue, ok := raw.(*infrav1.VSphereVM)
 	if !ok {
@@ -95,6 +100,19 @@ func (webhook *VSphereVMWebhook) ValidateCreate(_ context.Context, raw runtime.O
 			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "guestSoftPowerOffTimeout"), spec.GuestSoftPowerOffTimeout, "should be greater than 0"))
 		}
 	}
+	allErrs = append(allErrs, validateVirtualMachineCloneSpec(field.NewPath("spec"), spec.VirtualMachineCloneSpec, spec.Adopt)...)
+	allErrs = append(allErrs, validateSnapshotPolicy(field.NewPath("spec", "snapshotPolicy"), spec.SnapshotPolicy)...)
+	allErrs = append(allErrs, validateAdoption(field.NewPath("spec", "adopt"), spec.Adopt)...)
+	if _, ok := objValue.Labels[infrav1.MachinePoolNameLabel]; ok && spec.DriftPolicy == infrav1.DriftPolicyRemediate {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("spec", "driftPolicy"), spec.DriftPolicy, []string{string(infrav1.DriftPolicyReport), string(infrav1.DriftPolicyCorrect)}))
+	}
+
+	vsphereClusterIdentity, err := getClusterIdentity(ctx, webhook.Client, objValue)
+	if err != nil {
+		return nil, apierrors.NewInternalError(errors.Wrap(err, "failed to get VSphereClusterIdentity of VSphereVM"))
+	}
+	allErrs = append(allErrs, validateCloneSpecAllowedResources(field.NewPath("spec"), vsphereClusterIdentity, spec.VirtualMachineCloneSpec)...)
+
 	return nil, aggregateObjErrors(objValue.GroupVersionKind().GroupKind(), objValue.Name, allErrs)
 }
 
@@ -119,6 +137,8 @@ func (webhook *VSphereVMWebhook) ValidateUpdate(_ context.Context, oldRaw runtim
 		}
 	}
 
+	allErrs = append(allErrs, validateSnapshotPolicy(field.NewPath("spec", "snapshotPolicy"), newTyped.Spec.SnapshotPolicy)...)
+
 	newVSphereVM, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newTyped)
 	if err != nil {
 		return nil, apierrors.NewInternalError(errors.Wrap(err, "failed to convert new VSphereVM to unstructured object"))
@@ -131,8 +151,8 @@ func (webhook *VSphereVMWebhook) ValidateUpdate(_ context.Context, oldRaw runtim
 	newVSphereVMSpec := newVSphereVM["spec"].(map[string]interface{})
 	oldVSphereVMSpec := oldVSphereVM["spec"].(map[string]interface{})
 
-	// Allow changes to bootstrapRef, thumbprint, powerOffMode, guestSoftPowerOffTimeout.
-	keys := []string{"bootstrapRef", "thumbprint", "powerOffMode", "guestSoftPowerOffTimeout"}
+	// Allow changes to bootstrapRef, thumbprint, powerOffMode, guestSoftPowerOffTimeout, snapshotPolicy, rollbackToSnapshot.
+	keys := []string{"bootstrapRef", "thumbprint", "powerOffMode", "guestSoftPowerOffTimeout", "snapshotPolicy", "rollbackToSnapshot"}
 	// Allow changes to os only if the old spec has empty OS field.
 	if oldTyped.Spec.OS == "" {
 		keys = append(keys, "os")
@@ -141,6 +161,12 @@ func (webhook *VSphereVMWebhook) ValidateUpdate(_ context.Context, oldRaw runtim
 	if oldTyped.Spec.BiosUUID == "" {
 		keys = append(keys, "biosUUID")
 	}
+	// Allow changes to the resources of the VM if it can be resized.
+	keys = append(keys, resizeSpecKeys(newTyped.Spec.VirtualMachineCloneSpec)...)
+	// Allow changes to the resource allocation of the VM.
+	keys = append(keys, resourceAllocationSpecKeys...)
+	allErrs = append(allErrs, validateResourceAllocations(field.NewPath("spec"), newTyped.Spec.VirtualMachineCloneSpec)...)
+	allErrs = append(allErrs, validateResize(field.NewPath("spec"), oldTyped.Spec.VirtualMachineCloneSpec, newTyped.Spec.VirtualMachineCloneSpec)...)
 	webhook.deleteSpecKeys(oldVSphereVMSpec, keys)
 	webhook.deleteSpecKeys(newVSphereVMSpec, keys)
 
@@ -164,6 +190,21 @@ func (webhook *VSphereVMWebhook) ValidateDelete(_ context.Context, _ runtime.Obj
 	return nil, nil
 }
 
+// validateSnapshotPolicy validates the snapshot policy of a VSphereVM.
+func validateSnapshotPolicy(fldPath *field.Path, policy *infrav1.VSphereVMSnapshotPolicy) field.ErrorList {
+	var allErrs field.ErrorList
+	if policy == nil {
+		return allErrs
+	}
+	if len(policy.Operations) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("operations"), "must contain at least one operation"))
+	}
+	if policy.RetentionPeriod != nil && policy.RetentionPeriod.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retentionPeriod"), policy.RetentionPeriod, "should be greater than 0"))
+	}
+	return allErrs
+}
+
 func (webhook *VSphereVMWebhook) deleteSpecKeys(spec map[string]interface{}, keys []string) {
 	if len(spec) == 0 || len(keys) == 0 {
 		return
@@ -23,6 +23,7 @@ import (
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 )
@@ -114,6 +115,51 @@ func TestVSphereVM_ValidateCreate(t *testing.T) {
 			vSphereVM: createVSphereVM(linuxVMName, "foo.com", "", "", "", []string{"192.168.0.1/32", "192.168.0.3/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, &metav1.Duration{Duration: -1234}),
 			wantErr:   true,
 		},
+		{
+			name:      "either template or contentLibraryItem should be set unless a VM is adopted",
+			vSphereVM: createTemplateVSphereVM(""),
+			wantErr:   true,
+		},
+		{
+			name:      "successful VSphereVM creation adopting a VM by moRef",
+			vSphereVM: createAdoptingVSphereVM(&infrav1.VirtualMachineAdoptionSpec{MoRef: "vm-42"}),
+			wantErr:   false,
+		},
+		{
+			name:      "successful VSphereVM creation adopting a VM by BIOS UUID",
+			vSphereVM: createAdoptingVSphereVM(&infrav1.VirtualMachineAdoptionSpec{BiosUUID: "42305f0b-dad7-1d3d-5727-0eafffffbbbf"}),
+			wantErr:   false,
+		},
+		{
+			name:      "adopted VM must be referenced by moRef or BIOS UUID",
+			vSphereVM: createAdoptingVSphereVM(&infrav1.VirtualMachineAdoptionSpec{}),
+			wantErr:   true,
+		},
+		{
+			name:      "adopted VM cannot be referenced by both moRef and BIOS UUID",
+			vSphereVM: createAdoptingVSphereVM(&infrav1.VirtualMachineAdoptionSpec{MoRef: "vm-42", BiosUUID: "42305f0b-dad7-1d3d-5727-0eafffffbbbf"}),
+			wantErr:   true,
+		},
+		{
+			name:      "BIOS UUID of the adopted VM must be a valid UUID",
+			vSphereVM: createAdoptingVSphereVM(&infrav1.VirtualMachineAdoptionSpec{BiosUUID: "foo"}),
+			wantErr:   true,
+		},
+		{
+			name:      "successful VSphereVM creation with the Remediate drift policy",
+			vSphereVM: createDriftVSphereVM(infrav1.DriftPolicyRemediate, ""),
+			wantErr:   false,
+		},
+		{
+			name:      "successful VSphereMachinePool VSphereVM creation with the Correct drift policy",
+			vSphereVM: createDriftVSphereVM(infrav1.DriftPolicyCorrect, "pool"),
+			wantErr:   false,
+		},
+		{
+			name:      "Remediate drift policy is not supported for the VSphereVMs of a VSphereMachinePool",
+			vSphereVM: createDriftVSphereVM(infrav1.DriftPolicyRemediate, "pool"),
+			wantErr:   true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(*testing.T) {
@@ -209,6 +255,63 @@ func TestVSphereVM_ValidateUpdate(t *testing.T) {
 			vSphereVM:    createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "AA:BB:CC:DD:EE", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil),
 			wantErr:      true,
 		},
+		{
+			name:         "resources cannot be updated without the InPlace resize policy",
+			oldVSphereVM: createResizableVSphereVM(infrav1.ResizePolicyNone, 2, 4096, 20),
+			vSphereVM:    createResizableVSphereVM(infrav1.ResizePolicyNone, 4, 8192, 20),
+			wantErr:      true,
+		},
+		{
+			name:         "resources can be updated with the InPlace resize policy",
+			oldVSphereVM: createResizableVSphereVM(infrav1.ResizePolicyNone, 2, 4096, 20),
+			vSphereVM:    createResizableVSphereVM(infrav1.ResizePolicyInPlace, 4, 8192, 40),
+			wantErr:      false,
+		},
+		{
+			name:         "snapshotPolicy and rollbackToSnapshot can be updated",
+			oldVSphereVM: createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil),
+			vSphereVM: createSnapshotVSphereVM(&infrav1.VSphereVMSnapshotPolicy{
+				Operations: []infrav1.SnapshotOperation{infrav1.SnapshotOperationHardwareUpgrade},
+			}, "capv-pre-hardwareupgrade-vmx-19"),
+			wantErr: false,
+		},
+		{
+			name:         "snapshotPolicy retentionPeriod should be greater than 0",
+			oldVSphereVM: createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil),
+			vSphereVM: createSnapshotVSphereVM(&infrav1.VSphereVMSnapshotPolicy{
+				Operations:      []infrav1.SnapshotOperation{infrav1.SnapshotOperationHardwareUpgrade},
+				RetentionPeriod: &metav1.Duration{},
+			}, ""),
+			wantErr: true,
+		},
+		{
+			name:         "cpuAllocation and memoryAllocation can be updated",
+			oldVSphereVM: createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil),
+			vSphereVM: createResourceAllocationVSphereVM(
+				&infrav1.ResourceAllocation{Reservation: ptr.To[int64](1000), Shares: &infrav1.ResourceShares{Level: infrav1.SharesLevelHigh}},
+				&infrav1.ResourceAllocation{Reservation: ptr.To[int64](2048), Limit: ptr.To[int64](-1)}),
+			wantErr: false,
+		},
+		{
+			name:         "cpuAllocation reservation cannot be greater than the limit",
+			oldVSphereVM: createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil),
+			vSphereVM: createResourceAllocationVSphereVM(
+				&infrav1.ResourceAllocation{Reservation: ptr.To[int64](2000), Limit: ptr.To[int64](1000)}, nil),
+			wantErr: true,
+		},
+		{
+			name:         "memoryAllocation shares must be set with the Custom level",
+			oldVSphereVM: createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil),
+			vSphereVM: createResourceAllocationVSphereVM(nil,
+				&infrav1.ResourceAllocation{Shares: &infrav1.ResourceShares{Level: infrav1.SharesLevelCustom}}),
+			wantErr: true,
+		},
+		{
+			name:         "disk cannot be shrunk with the InPlace resize policy",
+			oldVSphereVM: createResizableVSphereVM(infrav1.ResizePolicyInPlace, 2, 4096, 40),
+			vSphereVM:    createResizableVSphereVM(infrav1.ResizePolicyInPlace, 2, 4096, 20),
+			wantErr:      true,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(*testing.T) {
@@ -230,7 +333,8 @@ func createVSphereVM(name, server, biosUUID, preferredAPIServerCIDR, thumbprint
 		},
 		Spec: infrav1.VSphereVMSpec{
 			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
-				Server: server,
+				Server:   server,
+				Template: "ubuntu-2204-kube-v1.29.0",
 				Network: infrav1.NetworkSpec{
 					PreferredAPIServerCIDR: preferredAPIServerCIDR,
 					Devices:                []infrav1.NetworkDeviceSpec{},
@@ -254,3 +358,48 @@ func createVSphereVM(name, server, biosUUID, preferredAPIServerCIDR, thumbprint
 	}
 	return VSphereVM
 }
+
+func createResizableVSphereVM(resizePolicy infrav1.ResizePolicy, numCPUs int32, memoryMiB int64, diskGiB int32) *infrav1.VSphereVM {
+	vSphereVM := createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereVM.Spec.ResizePolicy = resizePolicy
+	vSphereVM.Spec.NumCPUs = numCPUs
+	vSphereVM.Spec.MemoryMiB = memoryMiB
+	vSphereVM.Spec.DiskGiB = diskGiB
+	return vSphereVM
+}
+
+func createResourceAllocationVSphereVM(cpuAllocation, memoryAllocation *infrav1.ResourceAllocation) *infrav1.VSphereVM {
+	vSphereVM := createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereVM.Spec.CPUAllocation = cpuAllocation
+	vSphereVM.Spec.MemoryAllocation = memoryAllocation
+	return vSphereVM
+}
+
+func createSnapshotVSphereVM(snapshotPolicy *infrav1.VSphereVMSnapshotPolicy, rollbackToSnapshot string) *infrav1.VSphereVM {
+	vSphereVM := createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereVM.Spec.SnapshotPolicy = snapshotPolicy
+	vSphereVM.Spec.RollbackToSnapshot = rollbackToSnapshot
+	return vSphereVM
+}
+
+func createTemplateVSphereVM(template string) *infrav1.VSphereVM {
+	vSphereVM := createVSphereVM("vsphere-vm-1", "foo.com", biosUUID, "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereVM.Spec.Template = template
+	return vSphereVM
+}
+
+func createDriftVSphereVM(driftPolicy infrav1.DriftPolicy, machinePoolName string) *infrav1.VSphereVM {
+	vSphereVM := createVSphereVM("vsphere-vm-1", "foo.com", "", "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereVM.Spec.DriftPolicy = driftPolicy
+	if machinePoolName != "" {
+		vSphereVM.Labels = map[string]string{infrav1.MachinePoolNameLabel: machinePoolName}
+	}
+	return vSphereVM
+}
+
+func createAdoptingVSphereVM(adopt *infrav1.VirtualMachineAdoptionSpec) *infrav1.VSphereVM {
+	vSphereVM := createVSphereVM("vsphere-vm-1", "foo.com", "", "", "", []string{"192.168.0.1/32"}, nil, infrav1.Linux, infrav1.VirtualMachinePowerOpModeTrySoft, nil)
+	vSphereVM.Spec.Template = ""
+	vSphereVM.Spec.Adopt = adopt
+	return vSphereVM
+}
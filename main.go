@@ -29,6 +29,7 @@ import (
 	perrors "github.com/pkg/errors"
 	"github.com/spf13/pflag"
 	"gopkg.in/fsnotify.v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
@@ -84,6 +85,12 @@ var (
 	vSphereVMConcurrency              int
 	vSphereClusterIdentityConcurrency int
 	vSphereDeploymentZoneConcurrency  int
+	vSphereRemediationConcurrency     int
+	vSphereMachinePoolConcurrency     int
+	vSphereMachineTemplateConcurrency int
+	vSphereServerConcurrency          int
+
+	orphanCollectorOptions controllers.OrphanCollectorOptions
 
 	tlsOptions         = capiflags.TLSOptions{}
 	diagnosticsOptions = capiflags.DiagnosticsOptions{}
@@ -131,6 +138,36 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&vSphereDeploymentZoneConcurrency, "vspheredeploymentzone-concurrency", 10,
 		"Number of vSphere deployment zones to process simultaneously")
 
+	fs.IntVar(&vSphereRemediationConcurrency, "vsphereremediation-concurrency", 10,
+		"Number of vSphere remediations to process simultaneously")
+
+	fs.IntVar(&vSphereMachinePoolConcurrency, "vspheremachinepool-concurrency", 10,
+		"Number of vSphere machine pools to process simultaneously")
+
+	fs.IntVar(&vSphereMachineTemplateConcurrency, "vspheremachinetemplate-concurrency", 10,
+		"Number of vSphere machine templates to process simultaneously")
+
+	fs.IntVar(&vSphereServerConcurrency, "vsphereserver-concurrency", 10,
+		"Number of vSphere servers to process simultaneously")
+
+	fs.Float64Var(&managerOpts.TaskLimits.QPS, "vcenter-task-qps", 0,
+		"Number of clone and destroy tasks per second started on each vCenter server. The rate is not limited if unset.")
+
+	fs.IntVar(&managerOpts.TaskLimits.Burst, "vcenter-task-burst", 10,
+		"Number of clone and destroy tasks which can be started at once on each vCenter server, when vcenter-task-qps is set.")
+
+	fs.IntVar(&managerOpts.TaskLimits.MaxInFlight, "vcenter-max-in-flight-tasks", 0,
+		"Maximum number of clone and destroy tasks running at the same time on each vCenter server. The number of tasks is not limited if unset.")
+
+	fs.DurationVar(&orphanCollectorOptions.Interval, "orphan-collection-interval", 0,
+		"Interval at which the vCenter objects created by CAPV which no CAPV object maps to anymore are collected as VSphereOrphans. The collection is disabled if unset.")
+
+	fs.DurationVar(&orphanCollectorOptions.GracePeriod, "orphan-collection-grace-period", 24*time.Hour,
+		"Duration after which the collected VSphereOrphans are deleted from vCenter, when orphan-collection-delete is set")
+
+	fs.BoolVar(&orphanCollectorOptions.Delete, "orphan-collection-delete", false,
+		"Delete the collected VSphereOrphans from vCenter after their grace period. The orphans are only reported if unset.")
+
 	fs.StringVar(
 		&managerOpts.PodName,
 		"pod-name",
@@ -335,22 +372,24 @@ func main() {
 
 	setupChecks(mgr)
 
+	// initialize notifier for capv-manager-bootstrap-credentials before
+	// starting the manager, which blocks until the manager is stopped.
+	// The credentials are still read from the file at startup if it cannot be
+	// watched, but are not rotated without restarting the manager.
+	if watch, err := manager.InitializeWatch(mgr.GetControllerManagerContext(), &managerOpts); err != nil {
+		setupLog.Error(err, "failed to initialize watch on CAPV credentials file")
+	} else {
+		defer func(watch *fsnotify.Watcher) {
+			_ = watch.Close()
+		}(watch)
+	}
+	defer session.Clear()
+
 	setupLog.Info("Starting manager", "version", version.Get().String())
 	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "Error starting manager")
 		os.Exit(1)
 	}
-
-	// initialize notifier for capv-manager-bootstrap-credentials
-	watch, err := manager.InitializeWatch(mgr.GetControllerManagerContext(), &managerOpts)
-	if err != nil {
-		setupLog.Error(err, "failed to initialize watch on CAPV credentials file")
-		os.Exit(1)
-	}
-	defer func(watch *fsnotify.Watcher) {
-		_ = watch.Close()
-	}(watch)
-	defer session.Clear()
 }
 
 func setupVAPIControllers(ctx context.Context, controllerCtx *capvcontext.ControllerManagerContext, mgr ctrlmgr.Manager, tracker *remote.ClusterCacheTracker) error {
@@ -358,7 +397,7 @@ func setupVAPIControllers(ctx context.Context, controllerCtx *capvcontext.Contro
 		return err
 	}
 
-	if err := (&webhooks.VSphereMachineWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+	if err := (&webhooks.VSphereMachineWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
 		return err
 	}
 
@@ -366,7 +405,7 @@ func setupVAPIControllers(ctx context.Context, controllerCtx *capvcontext.Contro
 		return err
 	}
 
-	if err := (&webhooks.VSphereVMWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+	if err := (&webhooks.VSphereVMWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
 		return err
 	}
 
@@ -374,7 +413,11 @@ func setupVAPIControllers(ctx context.Context, controllerCtx *capvcontext.Contro
 		return err
 	}
 
-	if err := (&webhooks.VSphereFailureDomainWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+	if err := (&webhooks.VSphereFailureDomainWebhook{Client: mgr.GetClient()}).SetupWebhookWithManager(mgr); err != nil {
+		return err
+	}
+
+	if err := (&webhooks.VSphereServerWebhook{}).SetupWebhookWithManager(mgr); err != nil {
 		return err
 	}
 
@@ -391,7 +434,34 @@ func setupVAPIControllers(ctx context.Context, controllerCtx *capvcontext.Contro
 		return err
 	}
 
-	return controllers.AddVSphereDeploymentZoneControllerToManager(ctx, controllerCtx, mgr, concurrency(vSphereDeploymentZoneConcurrency))
+	if err := controllers.AddVSphereDeploymentZoneControllerToManager(ctx, controllerCtx, mgr, concurrency(vSphereDeploymentZoneConcurrency)); err != nil {
+		return err
+	}
+
+	if err := controllers.AddVSphereMachineTemplateControllerToManager(ctx, controllerCtx, mgr, concurrency(vSphereMachineTemplateConcurrency)); err != nil {
+		return err
+	}
+
+	if err := controllers.AddVSphereServerControllerToManager(ctx, controllerCtx, mgr, concurrency(vSphereServerConcurrency)); err != nil {
+		return err
+	}
+
+	if feature.Gates.Enabled(feature.MachinePool) {
+		if err := controllers.AddVSphereMachinePoolControllerToManager(ctx, controllerCtx, mgr, concurrency(vSphereMachinePoolConcurrency)); err != nil {
+			return err
+		}
+	}
+
+	// A manager watching a single namespace does not see all the VSphereVMs,
+	// so it would report the VMs of the other namespaces as orphaned.
+	if orphanCollectorOptions.Interval > 0 && watchNamespace != "" {
+		return perrors.New("orphan collection cannot be enabled when watching a single namespace")
+	}
+	if err := controllers.AddOrphanCollectorToManager(ctx, controllerCtx, mgr, orphanCollectorOptions); err != nil {
+		return err
+	}
+
+	return controllers.AddVSphereRemediationControllerToManager(ctx, controllerCtx, mgr, concurrency(vSphereRemediationConcurrency))
 }
 
 func setupSupervisorControllers(ctx context.Context, controllerCtx *capvcontext.ControllerManagerContext, mgr ctrlmgr.Manager, tracker *remote.ClusterCacheTracker) error {
@@ -456,6 +526,13 @@ func setupRemoteClusterCacheTracker(ctx context.Context, mgr ctrlmgr.Manager) (*
 			SecretCachingClient: secretCachingClient,
 			ControllerName:      controllerName,
 			Log:                 &ctrl.Log,
+			// The pods are listed by Node to drain them for host maintenance,
+			// without caching all the pods of the workload clusters.
+			ClientUncachedObjects: []client.Object{
+				&corev1.ConfigMap{},
+				&corev1.Secret{},
+				&corev1.Pod{},
+			},
 		},
 	)
 	if err != nil {
@@ -42,25 +42,18 @@ func (s *service) fetchSessionForObject(ctx context.Context, clusterCtx *capvcon
 func (s *service) newParams(clusterCtx capvcontext.ClusterContext) *session.Params {
 	return session.NewParams().
 		WithServer(clusterCtx.VSphereCluster.Spec.Server).
-		WithThumbprint(clusterCtx.VSphereCluster.Spec.Thumbprint).
-		WithFeatures(session.Feature{
-			EnableKeepAlive:   s.ControllerManagerContext.EnableKeepAlive,
-			KeepAliveDuration: s.ControllerManagerContext.KeepAliveDuration,
-		})
+		WithThumbprint(clusterCtx.VSphereCluster.Spec.Thumbprint)
 }
 
 func (s *service) fetchSession(ctx context.Context, clusterCtx *capvcontext.ClusterContext, params *session.Params) (*session.Session, error) {
-	if clusterCtx.VSphereCluster.Spec.IdentityRef != nil {
-		creds, err := identity.GetCredentials(ctx, s.Client, clusterCtx.VSphereCluster, s.ControllerManagerContext.Namespace)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to get credentials from IdentityRef")
-		}
-
-		params = params.WithUserInfo(creds.Username, creds.Password)
-		return session.GetOrCreate(ctx, params)
+	vsphereServer, err := identity.GetVSphereServer(ctx, s.Client, clusterCtx.VSphereCluster.Spec.ServerRef)
+	if err != nil {
+		return nil, err
+	}
+	params, _, err = identity.GetSessionParams(ctx, s.Client, s.ControllerManagerContext, params, clusterCtx.VSphereCluster, vsphereServer)
+	if err != nil {
+		return nil, err
 	}
-
-	params = params.WithUserInfo(s.ControllerManagerContext.Username, s.ControllerManagerContext.Password)
 	return session.GetOrCreate(ctx, params)
 }
 
@@ -26,6 +26,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 )
 
 // ControllerManagerContext is the context of the controller that owns the
@@ -60,13 +62,18 @@ type ControllerManagerContext struct {
 	Scheme *runtime.Scheme
 
 	// Username is the username for the account used to access remote vSphere
-	// endpoints.
+	// endpoints. It must be read with GetCredentials once the controllers are
+	// started, since it is updated when the credentials are rotated.
 	Username string
 
 	// Password is the password for the account used to access remote vSphere
-	// endpoints.
+	// endpoints. It must be read with GetCredentials once the controllers are
+	// started, since it is updated when the credentials are rotated.
 	Password string
 
+	// credentialsMU protects Username and Password.
+	credentialsMU sync.RWMutex
+
 	// EnableKeepAlive is a session feature to enable keep alive handler
 	// for better load management on vSphere api server
 	EnableKeepAlive bool
@@ -81,6 +88,15 @@ type ControllerManagerContext struct {
 	// WatchFilterValue is used to filter incoming objects by label.
 	WatchFilterValue string
 
+	// ManagerID identifies the management cluster and the watch filter of the
+	// controller manager. It is recorded on the VMs cloned by CAPV, so that
+	// the orphan collector only collects the VMs of its controller manager.
+	ManagerID string
+
+	// TaskLimiter limits the clone and destroy tasks started on each vCenter
+	// server. Nothing is limited if nil.
+	TaskLimiter *throttle.TaskLimiter
+
 	genericEventCache sync.Map
 }
 
@@ -89,6 +105,22 @@ func (c *ControllerManagerContext) String() string {
 	return c.Name
 }
 
+// GetCredentials returns the username and password for the account used to
+// access remote vSphere endpoints.
+func (c *ControllerManagerContext) GetCredentials() (username, password string) {
+	c.credentialsMU.RLock()
+	defer c.credentialsMU.RUnlock()
+	return c.Username, c.Password
+}
+
+// SetCredentials updates the username and password for the account used to
+// access remote vSphere endpoints.
+func (c *ControllerManagerContext) SetCredentials(username, password string) {
+	c.credentialsMU.Lock()
+	defer c.credentialsMU.Unlock()
+	c.Username, c.Password = username, password
+}
+
 // GetGenericEventChannelFor returns a generic event channel for a resource
 // specified by the provided GroupVersionKind.
 func (c *ControllerManagerContext) GetGenericEventChannelFor(gvk schema.GroupVersionKind) chan event.GenericEvent {
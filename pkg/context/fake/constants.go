@@ -36,6 +36,9 @@ const (
 	// for the fake controller manager.
 	LeaderElectionID = ControllerManagerName + "-runtime"
 
+	// ManagerID is the identity of the fake controller manager.
+	ManagerID = "00000000-0000-0000-0000-000000000003"
+
 	// Namespace is the fake namespace.
 	Namespace = "default"
 
@@ -22,6 +22,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -40,6 +41,7 @@ func NewControllerManagerContext(initObjects ...client.Object) *capvcontext.Cont
 	scheme := runtime.NewScheme()
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = clusterv1.AddToScheme(scheme)
+	_ = expv1.AddToScheme(scheme)
 	_ = controlplanev1.AddToScheme(scheme)
 	_ = infrav1.AddToScheme(scheme)
 	_ = vmwarev1.AddToScheme(scheme)
@@ -48,6 +50,11 @@ func NewControllerManagerContext(initObjects ...client.Object) *capvcontext.Cont
 
 	clientWithObjects := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(
 		&infrav1.VSphereVM{},
+		&infrav1.VSphereRemediation{},
+		&infrav1.VSphereMachinePool{},
+		&infrav1.VSphereMachineTemplate{},
+		&infrav1.VSphereOrphan{},
+		&infrav1.VSphereServer{},
 		&vmwarev1.VSphereCluster{},
 	).WithObjects(initObjects...).Build()
 
@@ -59,5 +66,6 @@ func NewControllerManagerContext(initObjects ...client.Object) *capvcontext.Cont
 		Name:                    ControllerManagerName,
 		LeaderElectionNamespace: LeaderElectionNamespace,
 		LeaderElectionID:        LeaderElectionID,
+		ManagerID:               ManagerID,
 	}
 }
@@ -35,6 +35,11 @@ type VMContext struct {
 	PatchHelper          *patch.Helper
 	Session              *session.Session
 	VSphereFailureDomain *infrav1.VSphereFailureDomain
+
+	// VSphereClusterIdentity is the identity of the VSphereCluster of the
+	// VSphereVM, whose AllowedResources restrict the inventory objects the VM
+	// is created with. It is nil if the VSphereCluster uses no identity.
+	VSphereClusterIdentity *infrav1.VSphereClusterIdentity
 }
 
 // String returns VSphereVMGroupVersionKind VSphereVMNamespace/VSphereVMName.
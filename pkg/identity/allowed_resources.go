@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+// ResourceKind is a kind of vSphere inventory object restricted by the
+// AllowedResources of a VSphereClusterIdentity.
+type ResourceKind string
+
+const (
+	// DatacenterResource is the kind of the datacenters.
+	DatacenterResource = ResourceKind("datacenter")
+	// FolderResource is the kind of the VM folders.
+	FolderResource = ResourceKind("folder")
+	// ResourcePoolResource is the kind of the resource pools.
+	ResourcePoolResource = ResourceKind("resource pool")
+	// NetworkResource is the kind of the networks.
+	NetworkResource = ResourceKind("network")
+	// DatastoreResource is the kind of the datastores and datastore clusters.
+	DatastoreResource = ResourceKind("datastore")
+	// TemplateResource is the kind of the VM templates and of the Content
+	// Library items.
+	TemplateResource = ResourceKind("template")
+)
+
+// ResourceNotAllowedError is returned when a vSphere inventory object is not
+// allowed by the AllowedResources of a VSphereClusterIdentity.
+type ResourceNotAllowedError struct {
+	Identity string
+	Kind     ResourceKind
+	Resource string
+}
+
+func (e *ResourceNotAllowedError) Error() string {
+	return fmt.Sprintf("%s %q is not allowed by VSphereClusterIdentity %s", e.Kind, e.Resource, e.Identity)
+}
+
+// GetIdentityForCluster returns the VSphereClusterIdentity used by the
+// VSphereCluster, referenced directly or by its VSphereServer, or nil if it
+// does not use one.
+func GetIdentityForCluster(ctx context.Context, c client.Client, cluster *infrav1.VSphereCluster) (*infrav1.VSphereClusterIdentity, error) {
+	if cluster.Spec.ServerRef != "" {
+		return GetIdentityForServer(ctx, c, cluster.Spec.ServerRef)
+	}
+	return getIdentity(ctx, c, cluster.Spec.IdentityRef)
+}
+
+// GetIdentityForServer returns the VSphereClusterIdentity referenced by the
+// VSphereServer, or nil if it does not reference one.
+func GetIdentityForServer(ctx context.Context, c client.Client, serverName string) (*infrav1.VSphereClusterIdentity, error) {
+	vsphereServer := &infrav1.VSphereServer{}
+	if err := c.Get(ctx, client.ObjectKey{Name: serverName}, vsphereServer); err != nil {
+		return nil, err
+	}
+	return getIdentity(ctx, c, vsphereServer.Spec.IdentityRef)
+}
+
+func getIdentity(ctx context.Context, c client.Client, ref *infrav1.VSphereIdentityReference) (*infrav1.VSphereClusterIdentity, error) {
+	if ref == nil || ref.Kind != infrav1.VSphereClusterIdentityKind {
+		return nil, nil
+	}
+	identity := &infrav1.VSphereClusterIdentity{}
+	if err := c.Get(ctx, client.ObjectKey{Name: ref.Name}, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// CheckAllowedResource returns a ResourceNotAllowedError if the vSphere
+// inventory object of the kind, given by its name or its inventory path, is
+// not allowed by the VSphereClusterIdentity. All the objects are allowed if
+// the identity is nil or has no AllowedResources.
+func CheckAllowedResource(identity *infrav1.VSphereClusterIdentity, kind ResourceKind, nameOrPath string) error {
+	if identity == nil || identity.Spec.AllowedResources == nil {
+		return nil
+	}
+
+	var patterns []string
+	allowed := identity.Spec.AllowedResources
+	switch kind {
+	case DatacenterResource:
+		patterns = allowed.Datacenters
+	case FolderResource:
+		patterns = allowed.Folders
+	case ResourcePoolResource:
+		patterns = allowed.ResourcePools
+	case NetworkResource:
+		patterns = allowed.Networks
+	case DatastoreResource:
+		patterns = allowed.Datastores
+	case TemplateResource:
+		patterns = allowed.Templates
+	default:
+		return fmt.Errorf("unknown kind %s of vSphere inventory object", kind)
+	}
+
+	if IsResourceAllowed(patterns, nameOrPath) {
+		return nil
+	}
+	return &ResourceNotAllowedError{Identity: identity.Name, Kind: kind, Resource: nameOrPath}
+}
+
+// IsResourceAllowed returns true if the vSphere inventory object given by its
+// name or its inventory path matches one of the patterns. All the objects are
+// allowed if there is no pattern.
+func IsResourceAllowed(patterns []string, nameOrPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchResource(pattern, nameOrPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource matches a pattern starting with a slash against the inventory
+// path of the object, and any other pattern against its name. The inventory
+// path of an object given by its name or by a relative path is unknown until
+// it is resolved in vCenter, so it matches the patterns starting with a slash.
+func matchResource(pattern, nameOrPath string) bool {
+	isInventoryPath := strings.HasPrefix(nameOrPath, "/")
+	switch {
+	case strings.HasPrefix(pattern, "/"):
+		if !isInventoryPath {
+			return true
+		}
+	case strings.Contains(nameOrPath, "/"):
+		nameOrPath = path.Base(nameOrPath)
+	}
+	matched, err := path.Match(pattern, nameOrPath)
+	return err == nil && matched
+}
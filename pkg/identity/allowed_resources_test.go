@@ -0,0 +1,200 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func TestIsResourceAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		patterns   []string
+		nameOrPath string
+		want       bool
+	}{
+		{
+			name:       "no pattern",
+			nameOrPath: "/dc0/vm/team-b",
+			want:       true,
+		},
+		{
+			name:       "name",
+			patterns:   []string{"team-a"},
+			nameOrPath: "team-a",
+			want:       true,
+		},
+		{
+			name:       "name against inventory path",
+			patterns:   []string{"team-a"},
+			nameOrPath: "/dc0/vm/team-a",
+			want:       true,
+		},
+		{
+			name:       "name pattern",
+			patterns:   []string{"team-a-*"},
+			nameOrPath: "/dc0/vm/team-b-folder",
+			want:       false,
+		},
+		{
+			name:       "inventory path pattern",
+			patterns:   []string{"/dc0/vm/team-a/*"},
+			nameOrPath: "/dc0/vm/team-a/workload",
+			want:       true,
+		},
+		{
+			name:       "inventory path pattern does not match nested objects",
+			patterns:   []string{"/dc0/vm/team-a/*"},
+			nameOrPath: "/dc0/vm/team-a/workload/nested",
+			want:       false,
+		},
+		{
+			name:       "inventory path pattern against name",
+			patterns:   []string{"/dc0/vm/team-a/*"},
+			nameOrPath: "workload",
+			want:       true,
+		},
+		{
+			name:       "second pattern",
+			patterns:   []string{"/dc0/vm/team-a/*", "/dc1/vm/team-a"},
+			nameOrPath: "/dc1/vm/team-a",
+			want:       true,
+		},
+		{
+			name:       "malformed pattern",
+			patterns:   []string{"[team-a"},
+			nameOrPath: "[team-a",
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(IsResourceAllowed(tt.patterns, tt.nameOrPath)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestCheckAllowedResource(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(CheckAllowedResource(nil, DatastoreResource, "/dc0/datastore/ds0")).To(Succeed())
+
+	identity := &infrav1.VSphereClusterIdentity{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	g.Expect(CheckAllowedResource(identity, DatastoreResource, "/dc0/datastore/ds0")).To(Succeed())
+
+	identity.Spec.AllowedResources = &infrav1.AllowedResources{
+		Datastores: []string{"/dc0/datastore/team-a-*"},
+		Networks:   []string{"VM Network"},
+		Templates:  []string{"/team-a/*"},
+	}
+	g.Expect(CheckAllowedResource(identity, DatastoreResource, "/dc0/datastore/team-a-ds0")).To(Succeed())
+	g.Expect(CheckAllowedResource(identity, TemplateResource, "/team-a/ubuntu")).To(Succeed())
+	g.Expect(CheckAllowedResource(identity, TemplateResource, "/team-b/ubuntu")).To(HaveOccurred())
+	g.Expect(CheckAllowedResource(identity, NetworkResource, "/dc0/network/VM Network")).To(Succeed())
+	g.Expect(CheckAllowedResource(identity, FolderResource, "/dc0/vm/team-b")).To(Succeed())
+
+	err := CheckAllowedResource(identity, DatastoreResource, "/dc0/datastore/team-b-ds0")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err).To(BeAssignableToTypeOf(&ResourceNotAllowedError{}))
+	g.Expect(err.Error()).To(Equal(`datastore "/dc0/datastore/team-b-ds0" is not allowed by VSphereClusterIdentity team-a`))
+}
+
+func TestGetIdentityForCluster(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = infrav1.AddToScheme(scheme)
+
+	objs := []runtime.Object{
+		&infrav1.VSphereClusterIdentity{ObjectMeta: metav1.ObjectMeta{Name: "cluster-identity"}},
+		&infrav1.VSphereClusterIdentity{ObjectMeta: metav1.ObjectMeta{Name: "server-identity"}},
+		&infrav1.VSphereServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "vcenter"},
+			Spec: infrav1.VSphereServerSpec{
+				Server:      "vcenter.example.com",
+				IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: "server-identity"},
+			},
+		},
+		&infrav1.VSphereServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "vcenter-without-identity"},
+			Spec:       infrav1.VSphereServerSpec{Server: "vcenter.example.com"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+
+	tests := []struct {
+		name    string
+		spec    infrav1.VSphereClusterSpec
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "without identity",
+		},
+		{
+			name: "secret identity",
+			spec: infrav1.VSphereClusterSpec{IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.SecretKind, Name: "secret"}},
+		},
+		{
+			name: "cluster identity",
+			spec: infrav1.VSphereClusterSpec{IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: "cluster-identity"}},
+			want: "cluster-identity",
+		},
+		{
+			name: "identity of the VSphereServer",
+			spec: infrav1.VSphereClusterSpec{ServerRef: "vcenter"},
+			want: "server-identity",
+		},
+		{
+			name: "VSphereServer without identity",
+			spec: infrav1.VSphereClusterSpec{ServerRef: "vcenter-without-identity"},
+		},
+		{
+			name:    "missing VSphereServer",
+			spec:    infrav1.VSphereClusterSpec{ServerRef: "missing"},
+			wantErr: true,
+		},
+		{
+			name:    "missing identity",
+			spec:    infrav1.VSphereClusterSpec{IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: "missing"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			identity, err := GetIdentityForCluster(context.Background(), c, &infrav1.VSphereCluster{Spec: tt.spec})
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			if tt.want == "" {
+				g.Expect(identity).To(BeNil())
+				return
+			}
+			g.Expect(identity.Name).To(Equal(tt.want))
+		})
+	}
+}
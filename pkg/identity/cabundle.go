@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+// GetCABundle returns the PEM encoded CA bundle referenced in the namespace.
+func GetCABundle(ctx context.Context, c client.Client, ref *infrav1.CABundleReference, namespace string) ([]byte, error) {
+	key := ref.Key
+	if key == "" {
+		key = infrav1.DefaultCABundleKey
+	}
+	objKey := client.ObjectKey{Namespace: namespace, Name: ref.Name}
+
+	var caBundle []byte
+	switch ref.Kind {
+	case infrav1.ConfigMapCABundleKind:
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, objKey, configMap); err != nil {
+			return nil, err
+		}
+		caBundle = []byte(configMap.Data[key])
+	case infrav1.SecretCABundleKind:
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, objKey, secret); err != nil {
+			return nil, err
+		}
+		caBundle = secret.Data[key]
+	default:
+		return nil, fmt.Errorf("unknown type %s used for CA bundle", ref.Kind)
+	}
+
+	if len(caBundle) == 0 {
+		return nil, fmt.Errorf("%s %s/%s has no CA bundle in key %s", ref.Kind, namespace, ref.Name, key)
+	}
+	return caBundle, nil
+}
+
+// GetCABundleForCluster returns the CA bundle used to verify the certificate
+// of the VCenter server of the VSphereCluster: the one referenced by the
+// VSphereCluster, else the one referenced by its VSphereClusterIdentity. It
+// returns nil if neither references one.
+func GetCABundleForCluster(ctx context.Context, c client.Client, cluster *infrav1.VSphereCluster, controllerNamespace string) ([]byte, error) {
+	if ref := cluster.Spec.CABundleRef; ref != nil {
+		return GetCABundle(ctx, c, ref, cluster.Namespace)
+	}
+
+	ref := cluster.Spec.IdentityRef
+	if ref == nil || ref.Kind != infrav1.VSphereClusterIdentityKind {
+		return nil, nil
+	}
+	return GetCABundleForIdentity(ctx, c, ref.Name, controllerNamespace)
+}
+
+// GetCABundleForIdentity returns the CA bundle referenced by the
+// VSphereClusterIdentity, or nil if it does not reference one.
+func GetCABundleForIdentity(ctx context.Context, c client.Client, name, controllerNamespace string) ([]byte, error) {
+	identity := &infrav1.VSphereClusterIdentity{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, identity); err != nil {
+		return nil, err
+	}
+	if identity.Spec.CABundleRef == nil {
+		return nil, nil
+	}
+	return GetCABundle(ctx, c, identity.Spec.CABundleRef, controllerNamespace)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func TestGetCABundleForCluster(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = infrav1.AddToScheme(scheme)
+
+	objs := []runtime.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-ca"},
+			Data:       map[string]string{"bundle.pem": "cluster-bundle"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "capv-system", Name: "identity-ca"},
+			Data:       map[string][]byte{infrav1.DefaultCABundleKey: []byte("identity-bundle")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "capv-system", Name: "empty-ca"},
+		},
+		&infrav1.VSphereClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity"},
+			Spec: infrav1.VSphereClusterIdentitySpec{
+				CABundleRef: &infrav1.CABundleReference{Kind: infrav1.SecretCABundleKind, Name: "identity-ca"},
+			},
+		},
+		&infrav1.VSphereClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity-without-ca"},
+		},
+		&infrav1.VSphereClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "identity-with-empty-ca"},
+			Spec: infrav1.VSphereClusterIdentitySpec{
+				CABundleRef: &infrav1.CABundleReference{Kind: infrav1.ConfigMapCABundleKind, Name: "empty-ca"},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+
+	identityRef := func(name string) *infrav1.VSphereIdentityReference {
+		return &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: name}
+	}
+
+	tests := []struct {
+		name    string
+		spec    infrav1.VSphereClusterSpec
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "without CA bundle",
+		},
+		{
+			name: "CA bundle of the cluster",
+			spec: infrav1.VSphereClusterSpec{
+				CABundleRef: &infrav1.CABundleReference{Kind: infrav1.ConfigMapCABundleKind, Name: "cluster-ca", Key: "bundle.pem"},
+				IdentityRef: identityRef("identity"),
+			},
+			want: []byte("cluster-bundle"),
+		},
+		{
+			name: "CA bundle of the identity",
+			spec: infrav1.VSphereClusterSpec{IdentityRef: identityRef("identity")},
+			want: []byte("identity-bundle"),
+		},
+		{
+			name: "identity without CA bundle",
+			spec: infrav1.VSphereClusterSpec{IdentityRef: identityRef("identity-without-ca")},
+		},
+		{
+			name:    "identity with an empty CA bundle",
+			spec:    infrav1.VSphereClusterSpec{IdentityRef: identityRef("identity-with-empty-ca")},
+			wantErr: true,
+		},
+		{
+			name: "missing CA bundle",
+			spec: infrav1.VSphereClusterSpec{
+				CABundleRef: &infrav1.CABundleReference{Kind: infrav1.SecretCABundleKind, Name: "missing"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			cluster := &infrav1.VSphereCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+				Spec:       tt.spec,
+			}
+			caBundle, err := GetCABundleForCluster(context.Background(), c, cluster, "capv-system")
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(caBundle).To(Equal(tt.want))
+		})
+	}
+}
@@ -19,6 +19,8 @@ package identity
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"strings"
@@ -36,12 +38,40 @@ const (
 	UsernameKey = "username"
 	// PasswordKey is the key used for the password.
 	PasswordKey = "password"
+	// TokenKey is the key used for the SAML bearer token.
+	TokenKey = "token"
 )
 
-// Credentials are the user credentials used with the VSphere API.
+// Credentials are the user credentials used with the VSphere API. The
+// certificate and the private key of a solution user, or a SAML bearer token,
+// are used instead of the username and the password if set.
 type Credentials struct {
 	Username string
 	Password string
+
+	// Certificate and PrivateKey are the PEM encoded TLS keypair of a
+	// solution user, used to issue a holder-of-key token from the STS.
+	Certificate string
+	PrivateKey  string
+
+	// Token is a SAML bearer token issued by the STS.
+	Token string
+}
+
+// Validate returns an error if the TLS keypair of the credentials cannot be
+// used to sign the requests to the STS, which requires an RSA private key.
+func (c Credentials) Validate() error {
+	if c.Certificate == "" && c.PrivateKey == "" {
+		return nil
+	}
+	keyPair, err := tls.X509KeyPair([]byte(c.Certificate), []byte(c.PrivateKey))
+	if err != nil {
+		return fmt.Errorf("invalid TLS keypair: %w", err)
+	}
+	if _, ok := keyPair.PrivateKey.(*rsa.PrivateKey); !ok {
+		return errors.New("invalid TLS keypair: the private key must be an RSA key")
+	}
+	return nil
 }
 
 // GetCredentials returns the VCenter credentials for the VSphereCluster.
@@ -49,15 +79,35 @@ func GetCredentials(ctx context.Context, c client.Client, cluster *infrav1.VSphe
 	if err := validateInputs(c, cluster); err != nil {
 		return nil, err
 	}
+	return getCredentials(ctx, c, cluster.Spec.IdentityRef, cluster.Namespace, controllerNamespace)
+}
 
-	ref := cluster.Spec.IdentityRef
+// GetCredentialsForServer returns the VCenter credentials of the VSphereServer
+// for the objects of the namespace. The namespace is empty for the
+// cluster-scoped objects, which are not restricted by the allowed namespaces
+// of the VSphereClusterIdentity.
+func GetCredentialsForServer(ctx context.Context, c client.Client, vsphereServer *infrav1.VSphereServer, namespace, controllerNamespace string) (*Credentials, error) {
+	if c == nil {
+		return nil, errors.New("kubernetes client is required")
+	}
+	ref := vsphereServer.Spec.IdentityRef
+	if ref == nil {
+		return nil, errors.New("IdentityRef is required")
+	}
+	if ref.Kind != infrav1.VSphereClusterIdentityKind {
+		return nil, fmt.Errorf("type %s cannot be used for the identity of a VSphereServer", ref.Kind)
+	}
+	return getCredentials(ctx, c, ref, namespace, controllerNamespace)
+}
+
+func getCredentials(ctx context.Context, c client.Client, ref *infrav1.VSphereIdentityReference, namespace, controllerNamespace string) (*Credentials, error) {
 	secret := &corev1.Secret{}
 	var secretKey client.ObjectKey
 
 	switch ref.Kind {
 	case infrav1.SecretKind:
 		secretKey = client.ObjectKey{
-			Namespace: cluster.Namespace,
+			Namespace: namespace,
 			Name:      ref.Name,
 		}
 	case infrav1.VSphereClusterIdentityKind:
@@ -73,24 +123,26 @@ func GetCredentials(ctx context.Context, c client.Client, cluster *infrav1.VSphe
 			return nil, errors.New("identity isn't ready to be used yet")
 		}
 
-		if identity.Spec.AllowedNamespaces == nil {
-			return nil, errors.New("allowedNamespaces set to nil, no namespaces are allowed to use this identity")
-		}
+		if namespace != "" {
+			if identity.Spec.AllowedNamespaces == nil {
+				return nil, errors.New("allowedNamespaces set to nil, no namespaces are allowed to use this identity")
+			}
 
-		selector, err := metav1.LabelSelectorAsSelector(&identity.Spec.AllowedNamespaces.Selector)
-		if err != nil {
-			return nil, errors.New("failed to build selector")
-		}
+			selector, err := metav1.LabelSelectorAsSelector(&identity.Spec.AllowedNamespaces.Selector)
+			if err != nil {
+				return nil, errors.New("failed to build selector")
+			}
 
-		ns := &corev1.Namespace{}
-		nsKey := client.ObjectKey{
-			Name: cluster.Namespace,
-		}
-		if err := c.Get(ctx, nsKey, ns); err != nil {
-			return nil, err
-		}
-		if !selector.Matches(labels.Set(ns.GetLabels())) {
-			return nil, fmt.Errorf("namespace %s is not allowed to use specifified identity", cluster.Namespace)
+			ns := &corev1.Namespace{}
+			nsKey := client.ObjectKey{
+				Name: namespace,
+			}
+			if err := c.Get(ctx, nsKey, ns); err != nil {
+				return nil, err
+			}
+			if !selector.Matches(labels.Set(ns.GetLabels())) {
+				return nil, fmt.Errorf("namespace %s is not allowed to use specifified identity", namespace)
+			}
 		}
 
 		secretKey = client.ObjectKey{
@@ -105,12 +157,20 @@ func GetCredentials(ctx context.Context, c client.Client, cluster *infrav1.VSphe
 		return nil, err
 	}
 
-	credentials := &Credentials{
-		Username: getData(secret, UsernameKey),
-		Password: getData(secret, PasswordKey),
-	}
+	return GetCredentialsFromSecret(secret), nil
+}
 
-	return credentials, nil
+// GetCredentialsFromSecret returns the VCenter credentials stored in the secret:
+// the TLS keypair of a kubernetes.io/tls Secret, a SAML bearer token, or a
+// username and a password.
+func GetCredentialsFromSecret(secret *corev1.Secret) *Credentials {
+	return &Credentials{
+		Username:    getData(secret, UsernameKey),
+		Password:    getData(secret, PasswordKey),
+		Certificate: getData(secret, corev1.TLSCertKey),
+		PrivateKey:  getData(secret, corev1.TLSPrivateKeyKey),
+		Token:       getData(secret, TokenKey),
+	}
 }
 
 func validateInputs(c client.Client, cluster *infrav1.VSphereCluster) error {
@@ -17,7 +17,17 @@ limitations under the License.
 package identity
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -444,3 +454,93 @@ func TestIsOwnedByIdentityOrCluster(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCredentialsFromSecret(t *testing.T) {
+	certificate, privateKey := createTestKeyPair(t, false)
+	ecdsaCertificate, ecdsaPrivateKey := createTestKeyPair(t, true)
+
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		want    Credentials
+		wantErr string
+	}{
+		{
+			name: "username and password",
+			data: map[string][]byte{UsernameKey: []byte("user"), PasswordKey: []byte("pass")},
+			want: Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name: "TLS keypair",
+			data: map[string][]byte{corev1.TLSCertKey: []byte(certificate), corev1.TLSPrivateKeyKey: []byte(privateKey)},
+			want: Credentials{Certificate: certificate, PrivateKey: privateKey},
+		},
+		{
+			name: "token",
+			data: map[string][]byte{TokenKey: []byte("token")},
+			want: Credentials{Token: "token"},
+		},
+		{
+			name:    "certificate without private key",
+			data:    map[string][]byte{corev1.TLSCertKey: []byte(certificate)},
+			want:    Credentials{Certificate: certificate},
+			wantErr: "invalid TLS keypair",
+		},
+		{
+			name:    "ECDSA private key",
+			data:    map[string][]byte{corev1.TLSCertKey: []byte(ecdsaCertificate), corev1.TLSPrivateKeyKey: []byte(ecdsaPrivateKey)},
+			want:    Credentials{Certificate: ecdsaCertificate, PrivateKey: ecdsaPrivateKey},
+			wantErr: "must be an RSA key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			creds := GetCredentialsFromSecret(&corev1.Secret{Data: tt.data})
+			g.Expect(*creds).To(Equal(tt.want))
+
+			err := creds.Validate()
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+// createTestKeyPair returns a PEM encoded self-signed certificate and its
+// private key, which is an ECDSA key if ecdsaKey is set and an RSA key
+// otherwise.
+func createTestKeyPair(t *testing.T, ecdsaKey bool) (certificate, privateKey string) {
+	t.Helper()
+
+	var key crypto.Signer
+	var err error
+	if ecdsaKey {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "capv-solution-user"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	privateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	return certificate, privateKey
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+// ServerConnection are the settings used to connect to the VCenter server of
+// a VSphereServer which are held by the objects it references.
+type ServerConnection struct {
+	// Credentials are the credentials of the identity of the VSphereServer,
+	// or nil if it has none.
+	Credentials *Credentials
+
+	// CABundle is the CA bundle of the VSphereServer, else the one referenced
+	// by its identity.
+	CABundle []byte
+
+	// ProxyURL is the URL of the proxy of the VSphereServer, or nil if it
+	// has none.
+	ProxyURL *url.URL
+}
+
+// GetServerConnection returns the connection settings of the VSphereServer
+// for the objects of the namespace. The namespace is empty for the
+// cluster-scoped objects, which are not restricted by the allowed namespaces
+// of the VSphereClusterIdentity.
+func GetServerConnection(ctx context.Context, c client.Client, vsphereServer *infrav1.VSphereServer, namespace, controllerNamespace string) (*ServerConnection, error) {
+	conn := &ServerConnection{CABundle: vsphereServer.Spec.CABundle}
+
+	if vsphereServer.Spec.IdentityRef != nil {
+		creds, err := GetCredentialsForServer(ctx, c, vsphereServer, namespace, controllerNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get credentials from IdentityRef: %w", err)
+		}
+		conn.Credentials = creds
+
+		if len(conn.CABundle) == 0 {
+			caBundle, err := GetCABundleForIdentity(ctx, c, vsphereServer.Spec.IdentityRef.Name, controllerNamespace)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get CA bundle from IdentityRef: %w", err)
+			}
+			conn.CABundle = caBundle
+		}
+	}
+
+	proxyURL, err := GetProxyURL(ctx, c, vsphereServer, controllerNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get proxy: %w", err)
+	}
+	conn.ProxyURL = proxyURL
+	return conn, nil
+}
+
+// GetProxyURL returns the URL of the proxy of the VSphereServer, with the
+// credentials of its Secret if any. It returns nil if the VSphereServer has
+// no proxy.
+func GetProxyURL(ctx context.Context, c client.Client, vsphereServer *infrav1.VSphereServer, controllerNamespace string) (*url.URL, error) {
+	proxy := vsphereServer.Spec.Proxy
+	if proxy == nil {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if proxy.SecretName == "" {
+		return proxyURL, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: controllerNamespace, Name: proxy.SecretName}, secret); err != nil {
+		return nil, err
+	}
+	creds := GetCredentialsFromSecret(secret)
+	proxyURL.User = url.UserPassword(creds.Username, creds.Password)
+	return proxyURL, nil
+}
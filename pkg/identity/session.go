@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"fmt"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// GetVSphereServer returns the VSphereServer with the name, or nil if the
+// name is empty.
+func GetVSphereServer(ctx context.Context, c client.Client, name string) (*infrav1.VSphereServer, error) {
+	if name == "" {
+		return nil, nil
+	}
+	vsphereServer := &infrav1.VSphereServer{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, vsphereServer); err != nil {
+		return nil, fmt.Errorf("failed to get VSphereServer %s: %w", name, err)
+	}
+	return vsphereServer, nil
+}
+
+// GetSessionParams completes the parameters of a vCenter session with the
+// session features of the manager, and with the connection settings and the
+// credentials of the VSphereServer if not nil, else with the CA bundle and the
+// credentials of the VSphereCluster if not nil. The credentials provided to
+// the manager are used if neither of them has an identity. It returns the
+// credentials the session is created with.
+func GetSessionParams(ctx context.Context, c client.Client, controllerManagerCtx *capvcontext.ControllerManagerContext, params *session.Params, vsphereCluster *infrav1.VSphereCluster, vsphereServer *infrav1.VSphereServer) (*session.Params, Credentials, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	params = params.WithFeatures(session.Feature{
+		EnableKeepAlive:   controllerManagerCtx.EnableKeepAlive,
+		KeepAliveDuration: controllerManagerCtx.KeepAliveDuration,
+	})
+
+	var credentials *Credentials
+	switch {
+	case vsphereServer != nil:
+		// The identity of the VSphereServer is restricted by the allowed
+		// namespaces of the VSphereClusterIdentity for the VSphereClusters,
+		// but not for the cluster-scoped objects.
+		namespace := ""
+		if vsphereCluster != nil {
+			namespace = vsphereCluster.Namespace
+		}
+		conn, err := GetServerConnection(ctx, c, vsphereServer, namespace, controllerManagerCtx.Namespace)
+		if err != nil {
+			return nil, Credentials{}, fmt.Errorf("failed to get connection settings from VSphereServer %s: %w", vsphereServer.Name, err)
+		}
+		params = params.WithVSphereServer(vsphereServer).
+			WithCABundle(conn.CABundle).
+			WithProxy(conn.ProxyURL)
+		if conn.Credentials != nil {
+			log.V(4).Info("Using credentials from VSphereServer IdentityRef to create the authenticated session")
+			credentials = conn.Credentials
+		}
+
+	case vsphereCluster != nil:
+		caBundle, err := GetCABundleForCluster(ctx, c, vsphereCluster, controllerManagerCtx.Namespace)
+		if err != nil {
+			return nil, Credentials{}, fmt.Errorf("failed to get CA bundle: %w", err)
+		}
+		params = params.WithCABundle(caBundle)
+		if vsphereCluster.Spec.IdentityRef != nil {
+			creds, err := GetCredentials(ctx, c, vsphereCluster, controllerManagerCtx.Namespace)
+			if err != nil {
+				return nil, Credentials{}, fmt.Errorf("failed to get credentials from IdentityRef: %w", err)
+			}
+			log.V(4).Info("Using credentials from VSphereCluster IdentityRef to create the authenticated session")
+			credentials = creds
+		}
+	}
+
+	if credentials == nil {
+		log.V(4).Info("Using credentials provided to the manager to create the authenticated session")
+		credentials = &Credentials{}
+		credentials.Username, credentials.Password = controllerManagerCtx.GetCredentials()
+	}
+	params = params.WithUserInfo(credentials.Username, credentials.Password).
+		WithCertificate(credentials.Certificate, credentials.PrivateKey).
+		WithToken(credentials.Token)
+	return params, *credentials, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+func TestGetSessionParams(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = infrav1.AddToScheme(scheme)
+
+	objs := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-secret"},
+			Data:       map[string][]byte{UsernameKey: []byte("cluster-user"), PasswordKey: []byte("cluster-password")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "capv-system", Name: "server-secret"},
+			Data:       map[string][]byte{TokenKey: []byte("server-token")},
+		},
+		&infrav1.VSphereClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "server-identity"},
+			Spec:       infrav1.VSphereClusterIdentitySpec{SecretName: "server-secret"},
+			Status:     infrav1.VSphereClusterIdentityStatus{Ready: true},
+		},
+		&infrav1.VSphereServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "server"},
+			Spec: infrav1.VSphereServerSpec{
+				Server:      "vcenter.local",
+				IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.VSphereClusterIdentityKind, Name: "server-identity"},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+	controllerManagerCtx := &capvcontext.ControllerManagerContext{Namespace: "capv-system"}
+	controllerManagerCtx.SetCredentials("manager-user", "manager-password")
+
+	vsphereServer, err := GetVSphereServer(context.Background(), c, "server")
+	NewWithT(t).Expect(err).NotTo(HaveOccurred())
+
+	tests := []struct {
+		name           string
+		vsphereCluster *infrav1.VSphereCluster
+		vsphereServer  *infrav1.VSphereServer
+		want           Credentials
+		wantErr        bool
+	}{
+		{
+			name: "credentials provided to the manager",
+			want: Credentials{Username: "manager-user", Password: "manager-password"},
+		},
+		{
+			name: "VSphereCluster without identity",
+			vsphereCluster: &infrav1.VSphereCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+			},
+			want: Credentials{Username: "manager-user", Password: "manager-password"},
+		},
+		{
+			name: "identity of the VSphereCluster",
+			vsphereCluster: &infrav1.VSphereCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+				Spec: infrav1.VSphereClusterSpec{
+					IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.SecretKind, Name: "cluster-secret"},
+				},
+			},
+			want: Credentials{Username: "cluster-user", Password: "cluster-password"},
+		},
+		{
+			name: "missing identity of the VSphereCluster",
+			vsphereCluster: &infrav1.VSphereCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+				Spec: infrav1.VSphereClusterSpec{
+					IdentityRef: &infrav1.VSphereIdentityReference{Kind: infrav1.SecretKind, Name: "missing"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name:          "identity of the VSphereServer",
+			vsphereServer: vsphereServer,
+			want:          Credentials{Token: "server-token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			params, credentials, err := GetSessionParams(context.Background(), c, controllerManagerCtx, session.NewParams(), tt.vsphereCluster, tt.vsphereServer)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(params).NotTo(BeNil())
+			g.Expect(credentials).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestGetVSphereServer(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	_ = infrav1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&infrav1.VSphereServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "server"},
+	}).Build()
+
+	vsphereServer, err := GetVSphereServer(context.Background(), c, "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vsphereServer).To(BeNil())
+
+	vsphereServer, err = GetVSphereServer(context.Background(), c, "server")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vsphereServer.Name).To(Equal("server"))
+
+	_, err = GetVSphereServer(context.Background(), c, "missing")
+	g.Expect(err).To(HaveOccurred())
+}
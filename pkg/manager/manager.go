@@ -27,18 +27,24 @@ import (
 	ncpv1 "github.com/vmware-tanzu/vm-operator/external/ncp/api/v1alpha1"
 	topologyv1 "github.com/vmware-tanzu/vm-operator/external/tanzu-topology/api/v1alpha1"
 	"gopkg.in/fsnotify.v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
 	controlplanev1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	infrav1alpha3 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1alpha3"
 	infrav1alpha4 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1alpha4"
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	vmwarev1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/vmware/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 )
 
 // Manager is a CAPV controller manager.
@@ -56,6 +62,7 @@ func New(ctx context.Context, opts Options) (Manager, error) {
 
 	_ = clientgoscheme.AddToScheme(opts.Scheme)
 	_ = clusterv1.AddToScheme(opts.Scheme)
+	_ = expv1.AddToScheme(opts.Scheme)
 	_ = infrav1alpha3.AddToScheme(opts.Scheme)
 	_ = infrav1alpha4.AddToScheme(opts.Scheme)
 	_ = infrav1.AddToScheme(opts.Scheme)
@@ -75,6 +82,11 @@ func New(ctx context.Context, opts Options) (Manager, error) {
 		return nil, errors.Wrap(err, "unable to create manager")
 	}
 
+	managerID, err := getManagerID(ctx, mgr.GetAPIReader(), opts.WatchFilterValue)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build the controller manager context.
 	controllerManagerContext := &capvcontext.ControllerManagerContext{
 		WatchNamespaces:         opts.Cache.DefaultNamespaces,
@@ -91,6 +103,8 @@ func New(ctx context.Context, opts Options) (Manager, error) {
 		KeepAliveDuration:       opts.KeepAliveDuration,
 		NetworkProvider:         opts.NetworkProvider,
 		WatchFilterValue:        opts.WatchFilterValue,
+		ManagerID:               managerID,
+		TaskLimiter:             throttle.NewTaskLimiter(opts.TaskLimits),
 	}
 
 	// Add the requested items to the manager.
@@ -104,6 +118,20 @@ func New(ctx context.Context, opts Options) (Manager, error) {
 	}, nil
 }
 
+// getManagerID returns the identity of the controller manager, which is the
+// UID of the kube-system namespace of the management cluster, followed by the
+// watch filter value if any.
+func getManagerID(ctx context.Context, c client.Reader, watchFilterValue string) (string, error) {
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: metav1.NamespaceSystem}, namespace); err != nil {
+		return "", errors.Wrapf(err, "unable to get namespace %s", metav1.NamespaceSystem)
+	}
+	if watchFilterValue == "" {
+		return string(namespace.UID), nil
+	}
+	return fmt.Sprintf("%s/%s", namespace.UID, watchFilterValue), nil
+}
+
 type manager struct {
 	ctrl.Manager
 	controllerManagerCtx *capvcontext.ControllerManagerContext
@@ -137,6 +165,13 @@ func InitializeWatch(controllerManagerContext *capvcontext.ControllerManagerCont
 				controllerManagerContext.Logger.Error(err, "Received error on CAPV credential watcher")
 			case event := <-watch.Events:
 				controllerManagerContext.Logger.Info(fmt.Sprintf("Received event %v on the credential file %s", event, capvCredentialsFile))
+				// The credentials file mounted from a Secret is replaced rather
+				// than written on update, which removes the watch on it.
+				if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					if err := watch.Add(capvCredentialsFile); err != nil {
+						controllerManagerContext.Logger.Error(err, "Failed to watch the replaced CAPV credentials file")
+					}
+				}
 				updateEventCh <- true
 			}
 		}
@@ -145,8 +180,27 @@ func InitializeWatch(controllerManagerContext *capvcontext.ControllerManagerCont
 	go func() {
 		for range updateEventCh {
 			UpdateCredentials(managerOpts)
+			rotateCredentials(controllerManagerContext, managerOpts)
 		}
 	}()
 
 	return watch, err
 }
+
+// rotateCredentials passes the credentials read from the credentials file to
+// the controller manager context, and drains the sessions created with the
+// previous credentials.
+func rotateCredentials(controllerManagerContext *capvcontext.ControllerManagerContext, managerOpts *Options) {
+	username, password := controllerManagerContext.GetCredentials()
+	if managerOpts.Username == username && managerOpts.Password == password {
+		return
+	}
+	if managerOpts.Username == "" || managerOpts.Password == "" {
+		controllerManagerContext.Logger.Info("Ignoring incomplete CAPV credentials", "file", managerOpts.CredentialsFile)
+		return
+	}
+
+	controllerManagerContext.SetCredentials(managerOpts.Username, managerOpts.Password)
+	controllerManagerContext.Logger.Info("Rotated CAPV credentials", "username", managerOpts.Username)
+	session.Drain(ctrl.LoggerInto(context.Background(), controllerManagerContext.Logger), session.NewParams().WithUserInfo(username, password))
+}
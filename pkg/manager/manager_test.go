@@ -19,6 +19,7 @@ package manager
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -55,7 +56,9 @@ password: '%s'
 			Password:        password,
 		}
 
-		watch, err := InitializeWatch(fake.NewControllerManagerContext(), managerOptsTest)
+		controllerManagerCtx := fake.NewControllerManagerContext()
+		controllerManagerCtx.SetCredentials(username, password)
+		watch, err := InitializeWatch(controllerManagerCtx, managerOptsTest)
 		// Match initial credentials
 		g.Expect(err).ToNot(HaveOccurred())
 		g.Expect(managerOptsTest.Username).To(Equal(username))
@@ -70,9 +73,52 @@ password: '%s'
 			return managerOptsTest.Username == updatedUsername && managerOptsTest.Password == updatedPassword
 		}, 10*time.Second).Should(BeTrue())
 
+		// The rotated credentials are passed to the controllers.
+		g.Eventually(func() bool {
+			u, p := controllerManagerCtx.GetCredentials()
+			return u == updatedUsername && p == updatedPassword
+		}, 10*time.Second).Should(BeTrue())
+
+		defer func(watch *fsnotify.Watcher) {
+			_ = watch.Close()
+		}(watch)
+	})
+
+	t.Run("keep watching the credentials file once it is replaced", func(t *testing.T) {
+		dir := t.TempDir()
+		credentialsFile := filepath.Join(dir, "credentials.yaml")
+		g.Expect(os.WriteFile(credentialsFile, []byte(fmt.Sprintf(contentFmt, username, password)), 0o600)).To(Succeed())
+
+		managerOptsTest := &Options{
+			CredentialsFile: credentialsFile,
+			Username:        username,
+			Password:        password,
+		}
+		controllerManagerCtx := fake.NewControllerManagerContext()
+		controllerManagerCtx.SetCredentials(username, password)
+		watch, err := InitializeWatch(controllerManagerCtx, managerOptsTest)
+		g.Expect(err).ToNot(HaveOccurred())
 		defer func(watch *fsnotify.Watcher) {
 			_ = watch.Close()
 		}(watch)
+
+		// Replace the file like the kubelet does when a Secret is updated.
+		replace := func(u, p string) {
+			tmpFile := filepath.Join(dir, "credentials.tmp")
+			g.Expect(os.WriteFile(tmpFile, []byte(fmt.Sprintf(contentFmt, u, p)), 0o600)).To(Succeed())
+			g.Expect(os.Rename(tmpFile, credentialsFile)).To(Succeed())
+		}
+		replace(username, updatedPassword)
+		g.Eventually(func() bool {
+			u, p := controllerManagerCtx.GetCredentials()
+			return u == username && p == updatedPassword
+		}, 10*time.Second).Should(BeTrue())
+
+		replace(updatedUsername, updatedPassword)
+		g.Eventually(func() bool {
+			u, p := controllerManagerCtx.GetCredentials()
+			return u == updatedUsername && p == updatedPassword
+		}, 10*time.Second).Should(BeTrue())
 	})
 
 	t.Run("send an error on watch error channel", func(t *testing.T) {
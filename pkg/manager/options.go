@@ -30,6 +30,7 @@ import (
 	"sigs.k8s.io/yaml"
 
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 )
 
 // AddToManagerFunc is a function that can be optionally specified with
@@ -87,6 +88,12 @@ type Options struct {
 	//
 	// Defaults to the empty string and by that not filter anything.
 	WatchFilterValue string
+
+	// TaskLimits are the limits of the clone and destroy tasks started on
+	// each vCenter server.
+	//
+	// Defaults to no limits.
+	TaskLimits throttle.Options
 }
 
 func (o *Options) defaults() {
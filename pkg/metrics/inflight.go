@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+// listTimeout is the maximum time spent listing VSphereVMs during a scrape.
+const listTimeout = 10 * time.Second
+
+var tasksInFlightDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metricsNamespace, vcenterSubsystem, "tasks_in_flight"),
+	"Number of VSphereVMs with an in-flight vCenter task, by vCenter server.",
+	[]string{"server"}, nil,
+)
+
+// inFlightTaskCollector reports the number of in-flight vCenter tasks by
+// counting the VSphereVMs which have Status.TaskRef set.
+type inFlightTaskCollector struct {
+	reader client.Reader
+}
+
+// NewInFlightTaskCollector returns a prometheus.Collector which reports the
+// number of in-flight tasks per vCenter server, based on VSphereVM.Status.TaskRef.
+func NewInFlightTaskCollector(reader client.Reader) prometheus.Collector {
+	return &inFlightTaskCollector{reader: reader}
+}
+
+// RegisterInFlightTaskCollector registers the in-flight task collector with
+// the controller-runtime metrics registry. Registering it more than once is a no-op.
+func RegisterInFlightTaskCollector(reader client.Reader) error {
+	if err := metrics.Registry.Register(NewInFlightTaskCollector(reader)); err != nil {
+		if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *inFlightTaskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tasksInFlightDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *inFlightTaskCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	vms := &infrav1.VSphereVMList{}
+	if err := c.reader.List(ctx, vms); err != nil {
+		ctrl.Log.WithName("metrics").Error(err, "Failed to list VSphereVMs for in-flight task metrics")
+		return
+	}
+
+	inFlight := map[string]int{}
+	for _, vm := range vms.Items {
+		if _, ok := inFlight[vm.Spec.Server]; !ok {
+			inFlight[vm.Spec.Server] = 0
+		}
+		if vm.Status.TaskRef != "" {
+			inFlight[vm.Spec.Server]++
+		}
+	}
+
+	for server, count := range inFlight {
+		ch <- prometheus.MustNewConstMetric(tasksInFlightDesc, prometheus.GaugeValue, float64(count), server)
+	}
+}
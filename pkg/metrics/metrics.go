@@ -0,0 +1,252 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains the Prometheus metrics CAPV exposes about its
+// interactions with vCenter.
+//
+// All metrics are registered with the controller-runtime metrics registry
+// and are served on the manager's metrics endpoint.
+package metrics
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "capv"
+
+	vcenterSubsystem = "vcenter"
+	sessionSubsystem = "session"
+)
+
+// Operation is the kind of vCenter operation a task was started for.
+type Operation string
+
+const (
+	// OperationClone is a VM clone.
+	OperationClone Operation = "clone"
+
+	// OperationPowerOn is a VM power on.
+	OperationPowerOn Operation = "powerOn"
+
+	// OperationPowerOff is a VM power off.
+	OperationPowerOff Operation = "powerOff"
+
+	// OperationReconfigure is a VM reconfigure, e.g. to update the metadata or devices.
+	OperationReconfigure Operation = "reconfigure"
+
+	// OperationUpgrade is a VM hardware version upgrade.
+	OperationUpgrade Operation = "upgrade"
+
+	// OperationDestroy is a VM destroy.
+	OperationDestroy Operation = "destroy"
+
+	// OperationSnapshot is the creation, removal or revert of a VM snapshot.
+	OperationSnapshot Operation = "snapshot"
+
+	// OperationReset is a VM reset.
+	OperationReset Operation = "reset"
+
+	// OperationOther is any operation not listed above.
+	OperationOther Operation = "other"
+)
+
+// Task results used as label value for the task duration.
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+// unknownFault is used as the fault label value when the type of a fault cannot be determined.
+const unknownFault = "Unknown"
+
+var (
+	// TaskDuration is the time a vCenter task took from start to completion, by operation and result.
+	TaskDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: vcenterSubsystem,
+			Name:      "task_duration_seconds",
+			Help:      "Duration of vCenter tasks from start to completion.",
+			Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1200},
+		},
+		[]string{"operation", "result"},
+	)
+
+	// TaskFailures counts failed vCenter operations, by operation and fault type.
+	TaskFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: vcenterSubsystem,
+			Name:      "task_failures_total",
+			Help:      "Total number of failed vCenter operations by fault type.",
+		},
+		[]string{"operation", "fault"},
+	)
+
+	// TasksWaiting is the number of VSphereVMs waiting for the capacity of
+	// their vCenter server to start a task.
+	TasksWaiting = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: vcenterSubsystem,
+			Name:      "tasks_waiting",
+			Help:      "Number of VSphereVMs waiting for the capacity of their vCenter server to start a task.",
+		},
+		[]string{"server"},
+	)
+
+	// SessionCacheHits counts the times an active cached session was reused.
+	SessionCacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: sessionSubsystem,
+			Name:      "cache_hits_total",
+			Help:      "Total number of vCenter session requests served by an active cached session.",
+		},
+		[]string{"server"},
+	)
+
+	// SessionCacheMisses counts the times a new session had to be created.
+	SessionCacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: sessionSubsystem,
+			Name:      "cache_misses_total",
+			Help:      "Total number of vCenter session requests which required creating a new session.",
+		},
+		[]string{"server"},
+	)
+
+	// SessionsDrained counts the cached sessions drained because the
+	// credentials they were created with were rotated.
+	SessionsDrained = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: sessionSubsystem,
+			Name:      "drained_total",
+			Help:      "Total number of cached vCenter sessions drained after a rotation of their credentials.",
+		},
+		[]string{"server"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		TaskDuration,
+		TaskFailures,
+		TasksWaiting,
+		SessionCacheHits,
+		SessionCacheMisses,
+		SessionsDrained,
+	)
+}
+
+// descriptionIDToOperation maps vCenter task description IDs to operations.
+var descriptionIDToOperation = map[string]Operation{
+	"VirtualMachine.clone":                   OperationClone,
+	"VirtualMachine.instantClone":            OperationClone,
+	"VirtualMachine.powerOn":                 OperationPowerOn,
+	"Datacenter.powerOnVm":                   OperationPowerOn,
+	"VirtualMachine.powerOff":                OperationPowerOff,
+	"VirtualMachine.reconfigure":             OperationReconfigure,
+	"VirtualMachine.upgradeVirtualHardware":  OperationUpgrade,
+	"VirtualMachine.destroy":                 OperationDestroy,
+	"VirtualMachine.createSnapshot":          OperationSnapshot,
+	"VirtualMachine.revertToCurrentSnapshot": OperationSnapshot,
+	"vm.Snapshot.remove":                     OperationSnapshot,
+	"vm.Snapshot.revert":                     OperationSnapshot,
+	"VirtualMachine.reset":                   OperationReset,
+}
+
+// OperationForTask returns the Operation of a task based on its description ID.
+func OperationForTask(info types.TaskInfo) Operation {
+	if op, ok := descriptionIDToOperation[info.DescriptionId]; ok {
+		return op
+	}
+	return OperationOther
+}
+
+// ObserveTask records the duration of a completed task and, if it failed,
+// its fault type. Tasks which are not yet completed are ignored.
+func ObserveTask(info types.TaskInfo) {
+	var result string
+	switch info.State {
+	case types.TaskInfoStateSuccess:
+		result = resultSuccess
+	case types.TaskInfoStateError:
+		result = resultError
+	default:
+		return
+	}
+
+	op := OperationForTask(info)
+	if info.StartTime != nil && info.CompleteTime != nil {
+		TaskDuration.WithLabelValues(string(op), result).Observe(info.CompleteTime.Sub(*info.StartTime).Seconds())
+	}
+
+	if result == resultError {
+		fault := unknownFault
+		if info.Error != nil {
+			fault = faultName(info.Error.Fault)
+		}
+		TaskFailures.WithLabelValues(string(op), fault).Inc()
+	}
+}
+
+// RecordFailure records an error returned by vCenter when triggering an operation,
+// before a task could be created for it.
+func RecordFailure(op Operation, err error) {
+	if err == nil {
+		return
+	}
+	TaskFailures.WithLabelValues(string(op), FaultName(err)).Inc()
+}
+
+// FaultName returns the type name of the vSphere fault wrapped in err, e.g. "InvalidArgument".
+func FaultName(err error) string {
+	err = errors.Cause(err)
+	switch {
+	case soap.IsSoapFault(err):
+		return faultName(soap.ToSoapFault(err).VimFault())
+	case soap.IsVimFault(err):
+		return faultName(soap.ToVimFault(err))
+	}
+	if taskErr, ok := err.(task.Error); ok {
+		return faultName(taskErr.Fault())
+	}
+	return unknownFault
+}
+
+// faultName returns the name of the type of a vSphere fault, which may either be
+// a value or a pointer.
+func faultName(fault any) string {
+	t := reflect.TypeOf(fault)
+	if t == nil {
+		return unknownFault
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
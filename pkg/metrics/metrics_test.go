@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func TestObserveTask(t *testing.T) {
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		g := NewWithT(t)
+
+		vm := object.NewVirtualMachine(c, simulator.Map.Any("VirtualMachine").Reference())
+
+		// A successful power off.
+		task, err := vm.PowerOff(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		info := waitForTaskInfo(ctx, g, task)
+		g.Expect(OperationForTask(info)).To(Equal(OperationPowerOff))
+
+		ObserveTask(info)
+		g.Expect(histogramCount(g, string(OperationPowerOff), resultSuccess)).To(Equal(uint64(1)))
+
+		// Powering off an already powered off VM fails with an InvalidPowerState fault.
+		task, err = vm.PowerOff(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		info = waitForTaskInfo(ctx, g, task)
+		g.Expect(info.State).To(Equal(types.TaskInfoStateError))
+
+		ObserveTask(info)
+		g.Expect(histogramCount(g, string(OperationPowerOff), resultError)).To(Equal(uint64(1)))
+		g.Expect(testutil.ToFloat64(TaskFailures.WithLabelValues(string(OperationPowerOff), "InvalidPowerState"))).To(Equal(float64(1)))
+
+		// Tasks which are not completed are ignored.
+		ObserveTask(types.TaskInfo{State: types.TaskInfoStateRunning, DescriptionId: "VirtualMachine.destroy"})
+		g.Expect(histogramCount(g, string(OperationDestroy), resultSuccess)).To(BeZero())
+	})
+}
+
+func TestRecordFailure(t *testing.T) {
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		g := NewWithT(t)
+
+		vm := object.NewVirtualMachine(c, types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-does-not-exist"})
+		_, err := vm.PowerOn(ctx)
+		g.Expect(err).To(HaveOccurred())
+
+		g.Expect(FaultName(err)).To(Equal("ManagedObjectNotFound"))
+		RecordFailure(OperationPowerOn, err)
+		g.Expect(testutil.ToFloat64(TaskFailures.WithLabelValues(string(OperationPowerOn), "ManagedObjectNotFound"))).To(Equal(float64(1)))
+	})
+}
+
+func TestInFlightTaskCollector(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	newVM := func(name, server, taskRef string) *infrav1.VSphereVM {
+		vm := &infrav1.VSphereVM{}
+		vm.Name = name
+		vm.Namespace = "default"
+		vm.Spec.Server = server
+		vm.Status.TaskRef = taskRef
+		return vm
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newVM("vm-1", "vcenter-a", "task-1"),
+		newVM("vm-2", "vcenter-a", "task-2"),
+		newVM("vm-3", "vcenter-a", ""),
+		newVM("vm-4", "vcenter-b", ""),
+	).Build()
+
+	expected := `
+# HELP capv_vcenter_tasks_in_flight Number of VSphereVMs with an in-flight vCenter task, by vCenter server.
+# TYPE capv_vcenter_tasks_in_flight gauge
+capv_vcenter_tasks_in_flight{server="vcenter-a"} 2
+capv_vcenter_tasks_in_flight{server="vcenter-b"} 0
+`
+	g.Expect(testutil.CollectAndCompare(NewInFlightTaskCollector(c), strings.NewReader(expected))).To(Succeed())
+}
+
+func waitForTaskInfo(ctx context.Context, g *WithT, task *object.Task) types.TaskInfo {
+	// The error is ignored since failed tasks are expected in the tests.
+	_ = task.Wait(ctx)
+
+	var obj mo.Task
+	g.Expect(task.Properties(ctx, task.Reference(), []string{"info"}, &obj)).To(Succeed())
+	return obj.Info
+}
+
+func histogramCount(g *WithT, operation, result string) uint64 {
+	observer, err := TaskDuration.GetMetricWithLabelValues(operation, result)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	m := &dto.Metric{}
+	g.Expect(observer.(prometheus.Metric).Write(m)).To(Succeed())
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+)
+
+// reconcileAdoption finds the existing VM referenced by the VSphereVM, checks
+// that it matches the spec and records its BIOS UUID in the spec, so that the
+// VM is found by findVM instead of being cloned.
+func (vms *VMService) reconcileAdoption(ctx context.Context, vmCtx *capvcontext.VMContext) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	adopt := vmCtx.VSphereVM.Spec.Adopt
+	if adopt == nil || vmCtx.VSphereVM.Spec.BiosUUID != "" {
+		return nil
+	}
+
+	vmRef, err := findVMToAdopt(ctx, vmCtx)
+	if err != nil {
+		return err
+	}
+	var o mo.VirtualMachine
+	if err := vmCtx.Session.RetrieveOne(ctx, vmRef, []string{"config.uuid", "config.template", "config.hardware", "config.extraConfig"}, &o); err != nil {
+		return errors.Wrapf(err, "error getting configuration of VM %s", vmRef.Value)
+	}
+	if o.Config == nil {
+		return errors.Errorf("unable to get the configuration of VM %s", vmRef.Value)
+	}
+	if err := checkVMToAdopt(vmCtx.VSphereVM, o.Config); err != nil {
+		return errors.Wrapf(err, "VM %s cannot be adopted", vmRef.Value)
+	}
+
+	log.Info("Adopting VM", "vmRef", vmRef, "biosUUID", o.Config.Uuid)
+	conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.AdoptingReason, clusterv1.ConditionSeverityInfo, "")
+	vmCtx.VSphereVM.Spec.BiosUUID = o.Config.Uuid
+	return nil
+}
+
+// findVMToAdopt returns the reference of the VM to adopt, found by its
+// managed object reference or its BIOS UUID.
+func findVMToAdopt(ctx context.Context, vmCtx *capvcontext.VMContext) (types.ManagedObjectReference, error) {
+	adopt := vmCtx.VSphereVM.Spec.Adopt
+	if adopt.MoRef != "" {
+		return types.ManagedObjectReference{Type: "VirtualMachine", Value: adopt.MoRef}, nil
+	}
+
+	objRef, err := vmCtx.Session.FindByBIOSUUID(ctx, adopt.BiosUUID)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if objRef == nil {
+		return types.ManagedObjectReference{}, errNotFound{uuid: adopt.BiosUUID}
+	}
+	return objRef.Reference(), nil
+}
+
+// checkVMToAdopt returns an error if the VM does not match the VSphereVM, or
+// is already adopted by another VSphereVM.
+func checkVMToAdopt(vsphereVM *infrav1.VSphereVM, config *types.VirtualMachineConfigInfo) error {
+	if config.Template {
+		return errors.New("VM is a template")
+	}
+	if owner, ok := getExtraConfigValue(config, extra.AdoptedByKey); ok && owner != "" && owner != string(vsphereVM.UID) {
+		return errors.Errorf("VM is already adopted by the VSphereVM with UID %s", owner)
+	}
+
+	// The CPU and the memory of the VM are only changed when the resize
+	// policy allows it.
+	if vsphereVM.Spec.ResizePolicy == infrav1.ResizePolicyInPlace {
+		return nil
+	}
+	if numCPUs := vsphereVM.Spec.NumCPUs; numCPUs > 0 && numCPUs != config.Hardware.NumCPU {
+		return errors.Errorf("VM has %d CPUs instead of %d", config.Hardware.NumCPU, numCPUs)
+	}
+	if memoryMiB := vsphereVM.Spec.MemoryMiB; memoryMiB > 0 && memoryMiB != int64(config.Hardware.MemoryMB) {
+		return errors.Errorf("VM has %d MiB of memory instead of %d", config.Hardware.MemoryMB, memoryMiB)
+	}
+	return nil
+}
+
+// reconcileAdoptedBy records the UID of the VSphereVM in the extra
+// configuration of the VM it adopted, so that the VM is not adopted by
+// another VSphereVM.
+func (vms *VMService) reconcileAdoptedBy(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	if virtualMachineCtx.VSphereVM.Spec.Adopt == nil {
+		return true, nil
+	}
+	return vms.reconcileAdoptionKeys(ctx, virtualMachineCtx, map[string]string{
+		extra.AdoptedByKey: string(virtualMachineCtx.VSphereVM.UID),
+		extra.RetainedKey:  "",
+	})
+}
+
+// releaseVM clears the UID of the VSphereVM from the extra configuration of
+// the VM it adopted, and marks the VM as retained when the VSphereVM is
+// deleted, so that it is not collected as an orphan.
+func (vms *VMService) releaseVM(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	return vms.reconcileAdoptionKeys(ctx, virtualMachineCtx, map[string]string{
+		extra.AdoptedByKey: "",
+		extra.RetainedKey:  "true",
+	})
+}
+
+// reconcileAdoptionKeys sets the keys of the extra configuration of the VM
+// which differ from the expected values. An empty value removes the key.
+// The keys are not changed if the VM was adopted by another VSphereVM since
+// it was adopted by this one, and the reconfiguration fails if the VM is
+// reconfigured after its extra configuration is read.
+func (vms *VMService) reconcileAdoptionKeys(ctx context.Context, virtualMachineCtx *virtualMachineContext, expected map[string]string) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"config.changeVersion", "config.extraConfig"}, &o); err != nil {
+		return false, errors.Wrapf(err, "error getting extra configuration of VM %s", virtualMachineCtx.VSphereVM.Name)
+	}
+	if o.Config == nil {
+		return false, errors.Errorf("unable to get the extra configuration of VM %s", virtualMachineCtx.VSphereVM.Name)
+	}
+	if owner, _ := getExtraConfigValue(o.Config, extra.AdoptedByKey); owner != "" && owner != string(virtualMachineCtx.VSphereVM.UID) {
+		// A VM adopted by another VSphereVM is left to it when released.
+		if expected[extra.AdoptedByKey] == "" {
+			log.Info("Not releasing VM adopted by another VSphereVM", "adoptedBy", owner)
+			return true, nil
+		}
+		return false, errors.Errorf("VM %s is already adopted by the VSphereVM with UID %s", virtualMachineCtx.Ref.Value, owner)
+	}
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var extraConfig []types.BaseOptionValue
+	for _, key := range keys {
+		if actual, _ := getExtraConfigValue(o.Config, key); actual != expected[key] {
+			extraConfig = append(extraConfig, &types.OptionValue{Key: key, Value: expected[key]})
+		}
+	}
+	if len(extraConfig) == 0 {
+		return true, nil
+	}
+
+	log.Info("Updating adoption of VM", "adoptedBy", expected[extra.AdoptedByKey])
+	task, err := virtualMachineCtx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{ChangeVersion: o.Config.ChangeVersion, ExtraConfig: extraConfig})
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationReconfigure, err)
+		return false, errors.Wrapf(err, "error trigging reconfigure op for vm %s", ctx)
+	}
+	virtualMachineCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+	return false, nil
+}
+
+// isRetained returns whether the VM of the VSphereVM is an adopted VM which
+// is left in vCenter when the VSphereVM is deleted.
+func isRetained(vsphereVM *infrav1.VSphereVM) bool {
+	adopt := vsphereVM.Spec.Adopt
+	return adopt != nil && adopt.DeletionPolicy != infrav1.AdoptedVMDeletionPolicyDelete
+}
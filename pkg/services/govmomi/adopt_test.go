@@ -0,0 +1,138 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+func TestAdoptVM(t *testing.T) {
+	g := NewWithT(t)
+
+	// The model is created without TLS, which is required by getAuthSession.
+	model := simulator.VPX()
+	g.Expect(model.Create()).To(Succeed())
+
+	g.Expect(model.Run(func(ctx context.Context, c *vim25.Client) error {
+		authSession, err := getAuthSession(ctx, c.URL().Host)
+		g.Expect(err).ToNot(HaveOccurred())
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		var o mo.VirtualMachine
+		g.Expect(vm.Properties(ctx, vm.Reference(), []string{"config.uuid", "config.hardware"}, &o)).To(Succeed())
+
+		newVMContext := func(adopt *infrav1.VirtualMachineAdoptionSpec) *capvcontext.VMContext {
+			return &capvcontext.VMContext{
+				Session: authSession,
+				VSphereVM: &infrav1.VSphereVM{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "vsphereVM1",
+						Namespace: "my-namespace",
+						UID:       "vsphere-vm-1",
+					},
+					Spec: infrav1.VSphereVMSpec{
+						VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+							NumCPUs:   o.Config.Hardware.NumCPU,
+							MemoryMiB: int64(o.Config.Hardware.MemoryMB),
+						},
+						Adopt: adopt,
+					},
+				},
+			}
+		}
+		waitForTask := func(vmCtx *capvcontext.VMContext) {
+			task := object.NewTask(c, types.ManagedObjectReference{Type: morefTypeTask, Value: vmCtx.VSphereVM.Status.TaskRef})
+			g.Expect(task.Wait(ctx)).To(Succeed())
+			vmCtx.VSphereVM.Status.TaskRef = ""
+		}
+		vms := &VMService{}
+
+		// The VM is found by its managed object reference or its BIOS UUID.
+		for _, adopt := range []*infrav1.VirtualMachineAdoptionSpec{
+			{MoRef: vm.Reference().Value},
+			{BiosUUID: o.Config.Uuid},
+		} {
+			vmCtx := newVMContext(adopt)
+			g.Expect(vms.reconcileAdoption(ctx, vmCtx)).To(Succeed())
+			g.Expect(vmCtx.VSphereVM.Spec.BiosUUID).To(Equal(o.Config.Uuid))
+			g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition)).To(Equal(infrav1.AdoptingReason))
+		}
+
+		// A VM which does not match the spec is not adopted.
+		vmCtx := newVMContext(&infrav1.VirtualMachineAdoptionSpec{MoRef: vm.Reference().Value})
+		vmCtx.VSphereVM.Spec.NumCPUs = o.Config.Hardware.NumCPU + 1
+		g.Expect(vms.reconcileAdoption(ctx, vmCtx)).ToNot(Succeed())
+		g.Expect(vmCtx.VSphereVM.Spec.BiosUUID).To(BeEmpty())
+
+		// Once adopted, the VM records the UID of its VSphereVM.
+		vmCtx = newVMContext(&infrav1.VirtualMachineAdoptionSpec{MoRef: vm.Reference().Value})
+		virtualMachineCtx := &virtualMachineContext{VMContext: *vmCtx, Obj: vm, Ref: vm.Reference()}
+		ok, err := vms.reconcileAdoptedBy(ctx, virtualMachineCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+		waitForTask(&virtualMachineCtx.VMContext)
+		ok, err = vms.reconcileAdoptedBy(ctx, virtualMachineCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+
+		// The VM cannot be adopted by another VSphereVM, even if it already
+		// recorded the VM, and is not released by it.
+		vmCtx = newVMContext(&infrav1.VirtualMachineAdoptionSpec{MoRef: vm.Reference().Value})
+		vmCtx.VSphereVM.UID = "vsphere-vm-2"
+		g.Expect(vms.reconcileAdoption(ctx, vmCtx)).ToNot(Succeed())
+		otherVirtualMachineCtx := &virtualMachineContext{VMContext: *vmCtx, Obj: vm, Ref: vm.Reference()}
+		_, err = vms.reconcileAdoptedBy(ctx, otherVirtualMachineCtx)
+		g.Expect(err).To(HaveOccurred())
+		ok, err = vms.releaseVM(ctx, otherVirtualMachineCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		g.Expect(otherVirtualMachineCtx.VSphereVM.Status.TaskRef).To(BeEmpty())
+
+		// Once released, the VM can be adopted again.
+		ok, err = vms.releaseVM(ctx, virtualMachineCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+		waitForTask(&virtualMachineCtx.VMContext)
+		g.Expect(vms.reconcileAdoption(ctx, vmCtx)).To(Succeed())
+		return nil
+	})).To(Succeed())
+}
+
+func Test_isRetained(t *testing.T) {
+	g := NewWithT(t)
+
+	vsphereVM := &infrav1.VSphereVM{}
+	g.Expect(isRetained(vsphereVM)).To(BeFalse())
+	vsphereVM.Spec.Adopt = &infrav1.VirtualMachineAdoptionSpec{MoRef: "vm-42"}
+	g.Expect(isRetained(vsphereVM)).To(BeTrue())
+	vsphereVM.Spec.Adopt.DeletionPolicy = infrav1.AdoptedVMDeletionPolicyDelete
+	g.Expect(isRetained(vsphereVM)).To(BeFalse())
+}
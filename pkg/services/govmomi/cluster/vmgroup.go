@@ -69,6 +69,29 @@ func (vg VMGroup) Add(ctx context.Context, vmObj types.ManagedObjectReference) (
 	return vg.ClusterComputeResource.Reconfigure(ctx, spec, true)
 }
 
+// Remove a VSphere VM object from the VM Group.
+func (vg VMGroup) Remove(ctx context.Context, vmObj types.ManagedObjectReference) (*object.Task, error) {
+	vms := []types.ManagedObjectReference{}
+	for _, vm := range vg.listVMs() {
+		if vm != vmObj {
+			vms = append(vms, vm)
+		}
+	}
+	vg.ClusterVmGroup.Vm = vms
+
+	spec := &types.ClusterConfigSpecEx{
+		GroupSpec: []types.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{
+					Operation: types.ArrayUpdateOperationEdit,
+				},
+				Info: vg.ClusterVmGroup,
+			},
+		},
+	}
+	return vg.ClusterComputeResource.Reconfigure(ctx, spec, true)
+}
+
 // HasVM returns whether a VSphere VM object is a member of the VM Group.
 func (vg VMGroup) HasVM(vmObj types.ManagedObjectReference) (bool, error) {
 	vms := vg.listVMs()
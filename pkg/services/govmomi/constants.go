@@ -19,6 +19,10 @@ package govmomi
 
 const (
 	morefTypeTask = "Task"
+
+	// instantCloneTaskDescriptionID is the description ID of the tasks of the
+	// InstantClone API.
+	instantCloneTaskDescriptionID = "VirtualMachine.instantClone"
 )
 
 const (
@@ -0,0 +1,229 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterutilv1 "sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
+)
+
+// reconcileDrift compares the configuration of the VM with its VSphereVM,
+// reports the fields which differ in the ConfigDrifted condition, and handles
+// the drift according to the drift policy of the VSphereVM.
+func (vms *VMService) reconcileDrift(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereVM := virtualMachineCtx.VSphereVM
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"config.hardware", "config.extraConfig"}, &o); err != nil {
+		return false, errors.Wrapf(err, "error getting configuration of VM %s", vsphereVM.Name)
+	}
+	if o.Config == nil {
+		return false, errors.Errorf("unable to get the configuration of VM %s", vsphereVM.Name)
+	}
+
+	drift := getConfigDrift(vsphereVM, o.Config)
+	if len(drift) == 0 {
+		markConfigDrifted(vsphereVM, corev1.ConditionFalse, "", "", "")
+		return true, nil
+	}
+	message := strings.Join(drift, ", ")
+
+	switch vsphereVM.Spec.DriftPolicy {
+	case infrav1.DriftPolicyCorrect:
+		markConfigDrifted(vsphereVM, corev1.ConditionTrue, infrav1.DriftCorrectingReason, clusterv1.ConditionSeverityInfo, message)
+
+		// The CPU and the memory are reverted by reconcileResize, which power
+		// cycles the VM if required.
+		extraConfig := getExtraConfigDrift(vsphereVM, o.Config)
+		if len(extraConfig) == 0 {
+			return true, nil
+		}
+		log.Info("Reverting custom VMX keys of VM", "drift", message)
+		task, err := virtualMachineCtx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{ExtraConfig: extraConfig})
+		if err != nil {
+			metrics.RecordFailure(metrics.OperationReconfigure, err)
+			return false, errors.Wrapf(err, "error trigging reconfigure op for vm %s", ctx)
+		}
+		virtualMachineCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+		return false, nil
+
+	case infrav1.DriftPolicyRemediate:
+		if err := requestRemediation(ctx, virtualMachineCtx); err != nil {
+			return false, err
+		}
+		markConfigDrifted(vsphereVM, corev1.ConditionTrue, infrav1.RemediationRequestedReason, clusterv1.ConditionSeverityWarning, message)
+		return true, nil
+
+	default:
+		if !conditions.IsTrue(vsphereVM, infrav1.ConfigDriftedCondition) {
+			log.Info("Configuration of VM drifted", "drift", message)
+		}
+		markConfigDrifted(vsphereVM, corev1.ConditionTrue, infrav1.DriftDetectedReason, clusterv1.ConditionSeverityWarning, message)
+		return true, nil
+	}
+}
+
+// markConfigDrifted sets the ConfigDrifted condition, which is true when the
+// VM drifted. The condition helpers of Cluster API only support conditions
+// which are true when everything is fine, so the condition is set directly.
+func markConfigDrifted(vsphereVM *infrav1.VSphereVM, status corev1.ConditionStatus, reason string, severity clusterv1.ConditionSeverity, message string) {
+	conditions.Set(vsphereVM, &clusterv1.Condition{
+		Type:     infrav1.ConfigDriftedCondition,
+		Status:   status,
+		Reason:   reason,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// getConfigDrift returns the description of the fields of the VSphereVM which
+// differ in the configuration of its VM.
+func getConfigDrift(vsphereVM *infrav1.VSphereVM, config *types.VirtualMachineConfigInfo) []string {
+	var drift []string
+	differs := func(field string, expected, actual interface{}) {
+		drift = append(drift, fmt.Sprintf("%s (expected %v, actual %v)", field, expected, actual))
+	}
+
+	if detectsResourceDrift(vsphereVM) {
+		numCPUs, numCoresPerSocket, memMiB := vcenter.VMResources(vsphereVM)
+		if numCPUs != config.Hardware.NumCPU {
+			differs("numCPUs", numCPUs, config.Hardware.NumCPU)
+		}
+		if vsphereVM.Spec.NumCoresPerSocket != 0 && numCoresPerSocket != config.Hardware.NumCoresPerSocket {
+			differs("numCoresPerSocket", numCoresPerSocket, config.Hardware.NumCoresPerSocket)
+		}
+		if memMiB != int64(config.Hardware.MemoryMB) {
+			differs("memoryMiB", memMiB, config.Hardware.MemoryMB)
+		}
+	}
+
+	nics := object.VirtualDeviceList(config.Hardware.Device).SelectByType((*types.VirtualEthernetCard)(nil))
+	devices := vsphereVM.Spec.Network.Devices
+	if len(nics) != len(devices) {
+		differs("network.devices", fmt.Sprintf("%d devices", len(devices)), fmt.Sprintf("%d devices", len(nics)))
+	} else {
+		for i, device := range devices {
+			macAddress := nics[i].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard().MacAddress
+			if device.MACAddr != "" && !strings.EqualFold(device.MACAddr, macAddress) {
+				differs(fmt.Sprintf("network.devices[%d].macAddr", i), device.MACAddr, macAddress)
+			}
+		}
+	}
+
+	for _, option := range getExtraConfigDrift(vsphereVM, config) {
+		value := option.GetOptionValue()
+		actual := "<unset>"
+		if v, ok := getExtraConfigValue(config, value.Key); ok {
+			actual = fmt.Sprintf("%q", v)
+		}
+		differs(fmt.Sprintf("customVMXKeys[%s]", value.Key), fmt.Sprintf("%q", value.Value), actual)
+	}
+	return drift
+}
+
+// detectsResourceDrift returns true if the CPU and the memory of the VM are
+// compared with the VSphereVM. They are not with the InPlace resize policy,
+// whose changes are applied to the VM by reconcileResize, nor for instant
+// clones, which have the CPU and the memory of their parent VM.
+func detectsResourceDrift(vsphereVM *infrav1.VSphereVM) bool {
+	return vsphereVM.Spec.ResizePolicy != infrav1.ResizePolicyInPlace && vsphereVM.Status.CloneMode != infrav1.InstantClone
+}
+
+// getExtraConfigDrift returns the custom VMX keys of the VSphereVM which
+// differ in the configuration of its VM, sorted by key.
+func getExtraConfigDrift(vsphereVM *infrav1.VSphereVM, config *types.VirtualMachineConfigInfo) []types.BaseOptionValue {
+	keys := make([]string, 0, len(vsphereVM.Spec.CustomVMXKeys))
+	for key := range vsphereVM.Spec.CustomVMXKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var drift []types.BaseOptionValue
+	for _, key := range keys {
+		expected := vsphereVM.Spec.CustomVMXKeys[key]
+		if actual, ok := getExtraConfigValue(config, key); !ok || actual != expected {
+			drift = append(drift, &types.OptionValue{Key: key, Value: expected})
+		}
+	}
+	return drift
+}
+
+// getExtraConfigValue returns the value of the key in the extra configuration
+// of the VM, and whether it is set.
+func getExtraConfigValue(config *types.VirtualMachineConfigInfo, key string) (string, bool) {
+	for _, option := range config.ExtraConfig {
+		if value := option.GetOptionValue(); value.Key == key {
+			return fmt.Sprint(value.Value), true
+		}
+	}
+	return "", false
+}
+
+// requestRemediation marks the Machine of the VSphereVM for remediation by its
+// MachineHealthCheck.
+func requestRemediation(ctx context.Context, virtualMachineCtx *virtualMachineContext) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereMachine, err := util.GetOwnerVSphereMachine(ctx, virtualMachineCtx.Client, virtualMachineCtx.VSphereVM.ObjectMeta)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get VSphereMachine for VSphereVM")
+	}
+	if vsphereMachine == nil {
+		return errors.Errorf("failed to get VSphereMachine for VSphereVM %s", virtualMachineCtx.VSphereVM.Name)
+	}
+	machine, err := clusterutilv1.GetOwnerMachine(ctx, virtualMachineCtx.Client, vsphereMachine.ObjectMeta)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get Machine for VSphereMachine")
+	}
+	if machine == nil {
+		return errors.Errorf("failed to get Machine for VSphereMachine %s", vsphereMachine.Name)
+	}
+	if _, ok := machine.Annotations[clusterv1.RemediateMachineAnnotation]; ok {
+		return nil
+	}
+
+	patchHelper, err := patch.NewHelper(machine, virtualMachineCtx.Client)
+	if err != nil {
+		return err
+	}
+	annotations.AddAnnotations(machine, map[string]string{clusterv1.RemediateMachineAnnotation: ""})
+	if err := patchHelper.Patch(ctx, machine); err != nil {
+		return errors.Wrapf(err, "failed to mark Machine %s for remediation", machine.Name)
+	}
+	log.Info("Marked Machine for remediation because the configuration of its VM drifted")
+	return nil
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func Test_getConfigDrift(t *testing.T) {
+	config := &types.VirtualMachineConfigInfo{
+		Hardware: types.VirtualHardware{
+			NumCPU:            4,
+			NumCoresPerSocket: 2,
+			MemoryMB:          8192,
+			Device: []types.BaseVirtualDevice{
+				&types.VirtualVmxnet3{VirtualVmxnet: types.VirtualVmxnet{VirtualEthernetCard: types.VirtualEthernetCard{MacAddress: "00:50:56:00:00:01"}}},
+			},
+		},
+		ExtraConfig: []types.BaseOptionValue{
+			&types.OptionValue{Key: "foo", Value: "bar"},
+		},
+	}
+	newVSphereVM := func() *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					NumCPUs:           4,
+					NumCoresPerSocket: 2,
+					MemoryMiB:         8192,
+					Network: infrav1.NetworkSpec{
+						Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "VM Network", MACAddr: "00:50:56:00:00:01"}},
+					},
+					CustomVMXKeys: map[string]string{"foo": "bar"},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		mutate   func(vsphereVM *infrav1.VSphereVM)
+		expected []string
+	}{
+		{
+			name:   "no drift",
+			mutate: func(*infrav1.VSphereVM) {},
+		},
+		{
+			name: "CPU and memory drift",
+			mutate: func(vsphereVM *infrav1.VSphereVM) {
+				vsphereVM.Spec.NumCPUs = 2
+				vsphereVM.Spec.NumCoresPerSocket = 1
+				vsphereVM.Spec.MemoryMiB = 4096
+			},
+			expected: []string{
+				"numCPUs (expected 2, actual 4)",
+				"numCoresPerSocket (expected 1, actual 2)",
+				"memoryMiB (expected 4096, actual 8192)",
+			},
+		},
+		{
+			name: "CPU and memory are not compared with the InPlace resize policy",
+			mutate: func(vsphereVM *infrav1.VSphereVM) {
+				vsphereVM.Spec.ResizePolicy = infrav1.ResizePolicyInPlace
+				vsphereVM.Spec.NumCPUs = 2
+			},
+		},
+		{
+			name: "CPU and memory are not compared for instant clones",
+			mutate: func(vsphereVM *infrav1.VSphereVM) {
+				vsphereVM.Status.CloneMode = infrav1.InstantClone
+				vsphereVM.Spec.NumCPUs = 2
+			},
+		},
+		{
+			name: "network device drift",
+			mutate: func(vsphereVM *infrav1.VSphereVM) {
+				vsphereVM.Spec.Network.Devices = append(vsphereVM.Spec.Network.Devices, infrav1.NetworkDeviceSpec{NetworkName: "VM Network"})
+			},
+			expected: []string{"network.devices (expected 2 devices, actual 1 devices)"},
+		},
+		{
+			name: "MAC address drift",
+			mutate: func(vsphereVM *infrav1.VSphereVM) {
+				vsphereVM.Spec.Network.Devices[0].MACAddr = "00:50:56:00:00:02"
+			},
+			expected: []string{"network.devices[0].macAddr (expected 00:50:56:00:00:02, actual 00:50:56:00:00:01)"},
+		},
+		{
+			name: "custom VMX keys drift",
+			mutate: func(vsphereVM *infrav1.VSphereVM) {
+				vsphereVM.Spec.CustomVMXKeys = map[string]string{"foo": "baz", "new": "value"}
+			},
+			expected: []string{
+				`customVMXKeys[foo] (expected "baz", actual "bar")`,
+				`customVMXKeys[new] (expected "value", actual <unset>)`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			vsphereVM := newVSphereVM()
+			tc.mutate(vsphereVM)
+			g.Expect(getConfigDrift(vsphereVM, config)).To(Equal(tc.expected))
+		})
+	}
+}
+
+func Test_reconcileDrift(t *testing.T) {
+	newVSphereVM := func(policy infrav1.DriftPolicy) *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "vsphereVM1",
+				Namespace: "my-namespace",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: infrav1.GroupVersion.String(),
+					Kind:       "VSphereMachine",
+					Name:       "vsphereMachine1",
+				}},
+			},
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					DriftPolicy: policy,
+					NumCPUs:     2,
+					MemoryMiB:   2048,
+					Network: infrav1.NetworkSpec{
+						Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "VM Network"}},
+					},
+					CustomVMXKeys: map[string]string{"foo": "bar"},
+				},
+			},
+		}
+	}
+	// newVirtualMachineContext returns the context of a VM with the
+	// configuration of the VSphereVM, except for its custom VMX keys.
+	newVirtualMachineContext := func(ctx context.Context, g *WithT, c *vim25.Client, policy infrav1.DriftPolicy) *virtualMachineContext {
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{NumCPUs: 2, NumCoresPerSocket: 2, MemoryMB: 2048})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(task.Wait(ctx)).To(Succeed())
+
+		vmCtx := emptyVirtualMachineContext()
+		vmCtx.Obj = vm
+		vmCtx.VSphereVM = newVSphereVM(policy)
+		return vmCtx
+	}
+
+	t.Run("with the Report policy the drift is reported", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vmCtx := newVirtualMachineContext(ctx, g, c, "")
+
+			vms := &VMService{}
+			ok, err := vms.reconcileDrift(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).To(BeEmpty())
+			condition := conditions.Get(vmCtx.VSphereVM, infrav1.ConfigDriftedCondition)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+			g.Expect(condition.Reason).To(Equal(infrav1.DriftDetectedReason))
+			g.Expect(condition.Message).To(Equal(`customVMXKeys[foo] (expected "bar", actual <unset>)`))
+
+			// Once the drift is gone, the condition reports it.
+			vmCtx.VSphereVM.Spec.CustomVMXKeys = nil
+			ok, err = vms.reconcileDrift(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(conditions.IsFalse(vmCtx.VSphereVM, infrav1.ConfigDriftedCondition)).To(BeTrue())
+			return nil
+		})
+	})
+
+	t.Run("with the Correct policy the drift is reverted", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vmCtx := newVirtualMachineContext(ctx, g, c, infrav1.DriftPolicyCorrect)
+
+			vms := &VMService{}
+			ok, err := vms.reconcileDrift(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.ConfigDriftedCondition)).To(Equal(infrav1.DriftCorrectingReason))
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+			task := object.NewTask(c, types.ManagedObjectReference{Type: "Task", Value: vmCtx.VSphereVM.Status.TaskRef})
+			g.Expect(task.Wait(ctx)).To(Succeed())
+
+			ok, err = vms.reconcileDrift(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(conditions.IsFalse(vmCtx.VSphereVM, infrav1.ConfigDriftedCondition)).To(BeTrue())
+			return nil
+		})
+	})
+
+	t.Run("with the Remediate policy the Machine is marked for remediation", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vmCtx := newVirtualMachineContext(ctx, g, c, infrav1.DriftPolicyRemediate)
+			machine := &clusterv1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "machine1",
+					Namespace: "my-namespace",
+				},
+			}
+			vsphereMachine := &infrav1.VSphereMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "vsphereMachine1",
+					Namespace: "my-namespace",
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: clusterv1.GroupVersion.String(),
+						Kind:       "Machine",
+						Name:       "machine1",
+					}},
+				},
+			}
+			vmCtx.ControllerManagerContext = fake.NewControllerManagerContext(machine, vsphereMachine)
+
+			vms := &VMService{}
+			ok, err := vms.reconcileDrift(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.ConfigDriftedCondition)).To(Equal(infrav1.RemediationRequestedReason))
+			g.Expect(vmCtx.Client.Get(ctx, client.ObjectKeyFromObject(machine), machine)).To(Succeed())
+			g.Expect(machine.Annotations).To(HaveKey(clusterv1.RemediateMachineAnnotation))
+			return nil
+		})
+	})
+}
@@ -0,0 +1,469 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events contains tools to bridge the vCenter events of the VMs of
+// the VSphereVMs into Kubernetes Events and VSphereVM conditions.
+package events
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+var (
+	// bridges are the bridges by vCenter server. There is a single bridge per
+	// vCenter server, even when there are several sessions to it, so that the
+	// vCenter events are bridged once.
+	bridges sync.Map
+
+	// bridgesMU avoids starting several bridges for a vCenter server.
+	bridgesMU sync.Mutex
+)
+
+var (
+	// pollInterval is the interval between the reads of the vCenter events.
+	pollInterval = 10 * time.Second
+
+	// pageSize is the maximum number of vCenter events read at once.
+	pageSize int32 = 100
+
+	// dedupWindow is the time during which the same vCenter event is not
+	// recorded again for a VSphereVM, e.g. when its host is flapping.
+	dedupWindow = 5 * time.Minute
+
+	// eventsQPS and eventsBurst limit the rate of the Kubernetes Events
+	// recorded by a bridge, so that an incident affecting many VMs at once
+	// does not flood the API server.
+	eventsQPS   float32 = 1
+	eventsBurst         = 20
+)
+
+// mapping is how a vCenter event is bridged.
+type mapping struct {
+	// eventType is the type of the Kubernetes Event.
+	eventType string
+	// reason is the reason of the Kubernetes Event.
+	reason string
+	// setCondition updates the conditions of the VSphereVM, if not nil.
+	setCondition func(vsphereVM *infrav1.VSphereVM, message string)
+}
+
+// removedEventType is the type of the vCenter events of the removed VMs.
+const removedEventType = "VmRemovedEvent"
+
+// mappings are the mappings of the bridged vCenter events by type.
+var mappings = map[string]mapping{
+	"VmDisconnectedEvent": {
+		eventType: corev1.EventTypeWarning,
+		reason:    infrav1.HostDisconnectedReason,
+		setCondition: func(vsphereVM *infrav1.VSphereVM, message string) {
+			conditions.MarkFalse(vsphereVM, infrav1.HostConnectedCondition, infrav1.HostDisconnectedReason, clusterv1.ConditionSeverityWarning, message)
+		},
+	},
+	"VmConnectedEvent": {
+		eventType: corev1.EventTypeNormal,
+		reason:    "HostConnected",
+		setCondition: func(vsphereVM *infrav1.VSphereVM, _ string) {
+			conditions.MarkTrue(vsphereVM, infrav1.HostConnectedCondition)
+		},
+	},
+	"VmRestartedOnAlternateHostEvent": {
+		eventType: corev1.EventTypeWarning,
+		reason:    infrav1.HARestartedReason,
+		setCondition: func(vsphereVM *infrav1.VSphereVM, message string) {
+			conditions.MarkFalse(vsphereVM, infrav1.VMUninterruptedCondition, infrav1.HARestartedReason, clusterv1.ConditionSeverityWarning, message)
+			// The VM runs on another host, which is connected.
+			conditions.MarkTrue(vsphereVM, infrav1.HostConnectedCondition)
+		},
+	},
+	"VmDasBeingResetEvent": {
+		eventType: corev1.EventTypeWarning,
+		reason:    infrav1.HAResetReason,
+		setCondition: func(vsphereVM *infrav1.VSphereVM, message string) {
+			conditions.MarkFalse(vsphereVM, infrav1.VMUninterruptedCondition, infrav1.HAResetReason, clusterv1.ConditionSeverityWarning, message)
+		},
+	},
+	"VmDasBeingResetWithScreenshotEvent": {
+		eventType: corev1.EventTypeWarning,
+		reason:    infrav1.HAResetReason,
+		setCondition: func(vsphereVM *infrav1.VSphereVM, message string) {
+			conditions.MarkFalse(vsphereVM, infrav1.VMUninterruptedCondition, infrav1.HAResetReason, clusterv1.ConditionSeverityWarning, message)
+		},
+	},
+	"VmFailoverFailed": {
+		eventType: corev1.EventTypeWarning,
+		reason:    "HAFailoverFailed",
+	},
+	"VmMigratedEvent": {
+		eventType: corev1.EventTypeNormal,
+		reason:    "Migrated",
+	},
+	"DrsVmMigratedEvent": {
+		eventType: corev1.EventTypeNormal,
+		reason:    "Migrated",
+	},
+}
+
+const (
+	// VSphereVMRefField is the field of the VSphereVMs indexed by the
+	// vCenter server and the reference of their VM.
+	VSphereVMRefField = "status.vmRef"
+
+	// VSphereVMUIDField is the field of the VSphereVMs indexed by their UID,
+	// which is the instance UUID of the VMs they clone.
+	VSphereVMUIDField = "metadata.uid"
+
+	// VSphereVMBiosUUIDField is the field of the VSphereVMs indexed by the
+	// vCenter server and the BIOS UUID of their VM.
+	VSphereVMBiosUUIDField = "spec.biosUUID"
+)
+
+// AddIndexes adds the indexes of the VSphereVMs used to match them with the
+// VMs of the vCenter events to the manager.
+func AddIndexes(ctx context.Context, mgr manager.Manager) error {
+	for field, extractValue := range map[string]client.IndexerFunc{
+		VSphereVMRefField:      VSphereVMByRef,
+		VSphereVMUIDField:      VSphereVMByUID,
+		VSphereVMBiosUUIDField: VSphereVMByBiosUUID,
+	} {
+		if err := mgr.GetFieldIndexer().IndexField(ctx, &infrav1.VSphereVM{}, field, extractValue); err != nil {
+			return errors.Wrapf(err, "failed to index VSphereVMs by %s", field)
+		}
+	}
+	return nil
+}
+
+// VSphereVMByRef returns the index value of the VM reference of a VSphereVM.
+func VSphereVMByRef(o client.Object) []string {
+	vsphereVM, ok := o.(*infrav1.VSphereVM)
+	if !ok || vsphereVM.Status.VMRef == "" {
+		return nil
+	}
+	return []string{serverIndexValue(session.ServerHost(vsphereVM.Spec.Server), vsphereVM.Status.VMRef)}
+}
+
+// VSphereVMByUID returns the index value of the UID of a VSphereVM.
+func VSphereVMByUID(o client.Object) []string {
+	if o.GetUID() == "" {
+		return nil
+	}
+	return []string{string(o.GetUID())}
+}
+
+// VSphereVMByBiosUUID returns the index value of the BIOS UUID of a
+// VSphereVM.
+func VSphereVMByBiosUUID(o client.Object) []string {
+	vsphereVM, ok := o.(*infrav1.VSphereVM)
+	if !ok || vsphereVM.Spec.BiosUUID == "" {
+		return nil
+	}
+	return []string{serverIndexValue(session.ServerHost(vsphereVM.Spec.Server), vsphereVM.Spec.BiosUUID)}
+}
+
+// serverIndexValue returns the index value of an identifier of a VM which is
+// only unique within its vCenter server. The server is the host of the URL of
+// the vCenter server, as reported by the clients of the bridges.
+func serverIndexValue(server, value string) string {
+	return server + "/" + value
+}
+
+// Bridge reads the vCenter events of the VMs, and records them as Kubernetes
+// Events on the VSphereVMs of the VMs and their owner VSphereMachines. Some
+// vCenter events also update the conditions of the VSphereVMs.
+// The VMs are matched with the VSphereVMs by the VM reference of their status,
+// by their instance UUID, which is the UID of the VSphereVM for the cloned
+// VMs, or by their BIOS UUID, e.g. for the adopted VMs. The VSphereVMs are
+// looked up with the indexes added by AddIndexes.
+type Bridge struct {
+	client   *vim25.Client
+	server   string
+	k8s      client.Client
+	recorder record.EventRecorder
+	limiter  flowcontrol.RateLimiter
+
+	// uuids are the UUIDs of the VMs of the vCenter events, until the VMs
+	// are removed.
+	uuids map[types.ManagedObjectReference]vmUUIDs
+	// recorded are the times of the recorded vCenter events by VSphereVM,
+	// reason and message.
+	recorded map[string]time.Time
+}
+
+// Start starts the bridge of the vCenter server of the client if it is not
+// running.
+func Start(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, recorder record.EventRecorder, c *vim25.Client) error {
+	server := c.URL().Host
+	if _, ok := bridges.Load(server); ok {
+		return nil
+	}
+
+	bridgesMU.Lock()
+	defer bridgesMU.Unlock()
+
+	if _, ok := bridges.Load(server); ok {
+		return nil
+	}
+	log := controllerManagerCtx.Logger.WithName("vcenter-events").WithValues("server", server)
+	b, err := start(ctx, log, c, controllerManagerCtx.Client, recorder)
+	if err != nil {
+		return err
+	}
+	bridges.Store(server, b)
+	return nil
+}
+
+func start(ctx context.Context, log logr.Logger, c *vim25.Client, k8s client.Client, recorder record.EventRecorder) (*Bridge, error) {
+	eventTypes := make([]string, 0, len(mappings)+1)
+	for eventType := range mappings {
+		eventTypes = append(eventTypes, eventType)
+	}
+	// The UUIDs of the removed VMs are forgotten.
+	eventTypes = append(eventTypes, removedEventType)
+	collector, err := event.NewManager(c).CreateCollectorForEvents(ctx, types.EventFilterSpec{
+		Entity: &types.EventFilterSpecByEntity{
+			Entity:    c.ServiceContent.RootFolder,
+			Recursion: types.EventFilterSpecRecursionOptionAll,
+		},
+		EventTypeId: eventTypes,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create collector of vCenter events")
+	}
+	// Only the vCenter events from now on are bridged.
+	if err := collector.Reset(ctx); err != nil {
+		_ = collector.Destroy(ctx)
+		return nil, errors.Wrap(err, "failed to reset collector of vCenter events")
+	}
+
+	b := &Bridge{
+		client:   c,
+		server:   c.URL().Host,
+		k8s:      k8s,
+		recorder: recorder,
+		limiter:  flowcontrol.NewTokenBucketRateLimiter(eventsQPS, eventsBurst),
+		uuids:    map[types.ManagedObjectReference]vmUUIDs{},
+		recorded: map[string]time.Time{},
+	}
+	// The bridge outlives the reconcile starting it.
+	log.Info("Bridging vCenter events")
+	go b.run(ctrl.LoggerInto(context.Background(), log), collector)
+	return b, nil
+}
+
+// run reads the vCenter events until the session of the vCenter client is
+// gone, e.g. because it was logged out.
+func (b *Bridge) run(ctx context.Context, collector *event.HistoryCollector) {
+	log := ctrl.LoggerFrom(ctx)
+
+	for {
+		events, err := collector.ReadNextEvents(ctx, pageSize)
+		if err != nil {
+			log.Error(err, "Stopped bridging vCenter events")
+			bridges.CompareAndDelete(b.server, b)
+			return
+		}
+		if len(events) > 0 {
+			if err := b.bridge(ctx, events); err != nil {
+				log.Error(err, "Failed to bridge vCenter events")
+			}
+		}
+		// There are more events to read.
+		if len(events) == int(pageSize) {
+			continue
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// bridge records the vCenter events on the VSphereVMs of their VMs.
+func (b *Bridge) bridge(ctx context.Context, events []types.BaseEvent) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	now := time.Now()
+	for key, recorded := range b.recorded {
+		if now.Sub(recorded) > dedupWindow {
+			delete(b.recorded, key)
+		}
+	}
+
+	// The events are read from the oldest to the newest, so that the
+	// conditions reflect the newest events.
+	for _, e := range events {
+		vmArg := e.GetEvent().Vm
+		if vmArg == nil {
+			continue
+		}
+		if _, ok := e.(*types.VmRemovedEvent); ok {
+			delete(b.uuids, vmArg.Vm)
+			continue
+		}
+		m, ok := mappings[reflect.TypeOf(e).Elem().Name()]
+		if !ok {
+			continue
+		}
+		vsphereVM, err := b.getVSphereVM(ctx, vmArg.Vm)
+		if err != nil {
+			return err
+		}
+		if vsphereVM == nil {
+			continue
+		}
+
+		message := e.GetEvent().FullFormattedMessage
+		log := log.WithValues("VSphereVM", klog.KObj(vsphereVM), "reason", m.reason)
+		if m.setCondition != nil {
+			if err := b.setCondition(ctx, vsphereVM, m, message); err != nil {
+				log.Error(err, "Failed to update VSphereVM conditions from vCenter event")
+			}
+		}
+
+		key := string(vsphereVM.UID) + "/" + m.reason + "/" + message
+		if _, ok := b.recorded[key]; ok {
+			log.V(4).Info("Skipping duplicate vCenter event")
+			continue
+		}
+		if !b.limiter.TryAccept() {
+			log.V(4).Info("Skipping vCenter event, too many events")
+			continue
+		}
+		b.recorded[key] = now
+		log.V(4).Info("Recording vCenter event", "message", message)
+		b.recorder.Event(vsphereVM, m.eventType, m.reason, message)
+		if vsphereMachine := getOwnerVSphereMachine(vsphereVM); vsphereMachine != nil {
+			b.recorder.Event(vsphereMachine, m.eventType, m.reason, message)
+		}
+	}
+	return nil
+}
+
+// getVSphereVM returns the VSphereVM of the VM, or nil if there is none.
+func (b *Bridge) getVSphereVM(ctx context.Context, ref types.ManagedObjectReference) (*infrav1.VSphereVM, error) {
+	vsphereVM, err := b.findVSphereVM(ctx, client.MatchingFields{VSphereVMRefField: serverIndexValue(b.server, ref.Value)})
+	if err != nil || vsphereVM != nil {
+		return vsphereVM, err
+	}
+
+	// The VSphereVMs whose VM is not ready yet have no VM reference.
+	uuids := b.getUUIDs(ctx, ref)
+	if uuids.instanceUUID != "" {
+		vsphereVM, err := b.findVSphereVM(ctx, client.MatchingFields{VSphereVMUIDField: uuids.instanceUUID})
+		if err != nil || vsphereVM != nil {
+			return vsphereVM, err
+		}
+	}
+	if uuids.biosUUID != "" {
+		return b.findVSphereVM(ctx, client.MatchingFields{VSphereVMBiosUUIDField: serverIndexValue(b.server, uuids.biosUUID)})
+	}
+	return nil, nil
+}
+
+// findVSphereVM returns the VSphereVM matching the fields, or nil if there is
+// none or if several VSphereVMs match them.
+func (b *Bridge) findVSphereVM(ctx context.Context, fields client.MatchingFields) (*infrav1.VSphereVM, error) {
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := b.k8s.List(ctx, vsphereVMs, fields); err != nil {
+		return nil, errors.Wrap(err, "failed to list VSphereVMs")
+	}
+	if len(vsphereVMs.Items) != 1 {
+		return nil, nil
+	}
+	return &vsphereVMs.Items[0], nil
+}
+
+// vmUUIDs are the UUIDs of a VM.
+type vmUUIDs struct {
+	instanceUUID string
+	biosUUID     string
+}
+
+// getUUIDs returns the UUIDs of the VM, which are empty if they cannot be
+// retrieved, e.g. because the VM was deleted.
+func (b *Bridge) getUUIDs(ctx context.Context, ref types.ManagedObjectReference) vmUUIDs {
+	if uuids, ok := b.uuids[ref]; ok {
+		return uuids
+	}
+
+	var vm mo.VirtualMachine
+	if err := property.DefaultCollector(b.client).RetrieveOne(ctx, ref, []string{"config.instanceUuid", "config.uuid"}, &vm); err != nil {
+		ctrl.LoggerFrom(ctx).V(4).Info("Failed to get UUIDs of VM", "ref", ref, "err", err.Error())
+		return vmUUIDs{}
+	}
+	var uuids vmUUIDs
+	if vm.Config != nil {
+		uuids = vmUUIDs{instanceUUID: vm.Config.InstanceUuid, biosUUID: vm.Config.Uuid}
+	}
+	// The UUIDs of a VM do not change, which avoids retrieving them for
+	// every vCenter event.
+	b.uuids[ref] = uuids
+	return uuids
+}
+
+// setCondition updates the conditions of the VSphereVM from a vCenter event.
+func (b *Bridge) setCondition(ctx context.Context, vsphereVM *infrav1.VSphereVM, m mapping, message string) error {
+	patchHelper, err := patch.NewHelper(vsphereVM, b.k8s)
+	if err != nil {
+		return err
+	}
+	m.setCondition(vsphereVM, message)
+	return patchHelper.Patch(ctx, vsphereVM, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+		infrav1.HostConnectedCondition,
+		infrav1.VMUninterruptedCondition,
+	}})
+}
+
+// getOwnerVSphereMachine returns the owner VSphereMachine of the VSphereVM,
+// with only the metadata required to record events on it.
+func getOwnerVSphereMachine(vsphereVM *infrav1.VSphereVM) *infrav1.VSphereMachine {
+	for _, ref := range vsphereVM.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			continue
+		}
+		if ref.Kind == "VSphereMachine" && gv.Group == infrav1.GroupVersion.Group {
+			vsphereMachine := &infrav1.VSphereMachine{}
+			vsphereMachine.SetNamespace(vsphereVM.Namespace)
+			vsphereMachine.SetName(ref.Name)
+			vsphereMachine.SetUID(ref.UID)
+			return vsphereMachine
+		}
+	}
+	return nil
+}
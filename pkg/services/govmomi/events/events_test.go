@@ -0,0 +1,209 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestBridge(t *testing.T) {
+	pollInterval = 100 * time.Millisecond
+	defer func() { pollInterval = 10 * time.Second }()
+
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		g := NewWithT(t)
+
+		finder := find.NewFinder(c)
+		vm, err := finder.VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		otherVM, err := finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		refVM, err := finder.VirtualMachine(ctx, "DC0_H0_VM1")
+		g.Expect(err).ToNot(HaveOccurred())
+		biosUUIDVM, err := finder.VirtualMachine(ctx, "DC0_C0_RP0_VM1")
+		g.Expect(err).ToNot(HaveOccurred())
+		var vmMo, biosUUIDVMMo mo.VirtualMachine
+		g.Expect(property.DefaultCollector(c).RetrieveOne(ctx, vm.Reference(), []string{"config.instanceUuid"}, &vmMo)).To(Succeed())
+		g.Expect(property.DefaultCollector(c).RetrieveOne(ctx, biosUUIDVM.Reference(), []string{"config.uuid"}, &biosUUIDVMMo)).To(Succeed())
+
+		vsphereVM := &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "vsphereVM1",
+				Namespace: "my-namespace",
+				UID:       apitypes.UID(vmMo.Config.InstanceUuid),
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: infrav1.GroupVersion.String(),
+					Kind:       "VSphereMachine",
+					Name:       "vsphereMachine1",
+					UID:        "vsphereMachine1-uid",
+				}},
+			},
+		}
+		// The VSphereVMs whose VM is ready are matched by their VM reference,
+		// and the adopted VSphereVMs by their BIOS UUID, whatever the form of
+		// the URL of their vCenter server.
+		refVSphereVM := &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{Name: "vsphereVM2", Namespace: "my-namespace", UID: "vsphereVM2-uid"},
+			Spec:       infrav1.VSphereVMSpec{VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Server: "https://" + c.URL().Host}},
+			Status:     infrav1.VSphereVMStatus{VMRef: refVM.Reference().Value},
+		}
+		biosUUIDVSphereVM := &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{Name: "vsphereVM3", Namespace: "my-namespace", UID: "vsphereVM3-uid"},
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Server: c.URL().Host + "/sdk"},
+				BiosUUID:                biosUUIDVMMo.Config.Uuid,
+			},
+		}
+		controllerManagerCtx := fake.NewControllerManagerContext()
+		controllerManagerCtx.Client = fakeclient.NewClientBuilder().
+			WithScheme(controllerManagerCtx.Scheme).
+			WithObjects(vsphereVM, refVSphereVM, biosUUIDVSphereVM).
+			WithStatusSubresource(&infrav1.VSphereVM{}).
+			WithIndex(&infrav1.VSphereVM{}, VSphereVMRefField, VSphereVMByRef).
+			WithIndex(&infrav1.VSphereVM{}, VSphereVMUIDField, VSphereVMByUID).
+			WithIndex(&infrav1.VSphereVM{}, VSphereVMBiosUUIDField, VSphereVMByBiosUUID).
+			Build()
+		recorder := record.NewFakeRecorder(10)
+		g.Expect(Start(ctx, controllerManagerCtx, recorder, c)).To(Succeed())
+		// The bridge is started once per vCenter server.
+		g.Expect(Start(ctx, controllerManagerCtx, recorder, c)).To(Succeed())
+
+		postEvent := func(vm *object.VirtualMachine, e types.BaseEvent) {
+			e.GetEvent().Vm = &types.VmEventArgument{Vm: vm.Reference()}
+			g.Expect(event.NewManager(c).PostEvent(ctx, e)).To(Succeed())
+		}
+		expectEvent := func(eventType, reason string) {
+			var e string
+			g.Eventually(recorder.Events, 10*time.Second).Should(Receive(&e))
+			g.Expect(e).To(HavePrefix(eventType + " " + reason))
+		}
+		expectEvents := func(eventType, reason string) {
+			// The event is recorded on the VSphereVM and its VSphereMachine.
+			for i := 0; i < 2; i++ {
+				var e string
+				g.Eventually(recorder.Events, 10*time.Second).Should(Receive(&e))
+				g.Expect(e).To(HavePrefix(eventType + " " + reason))
+			}
+		}
+		getVSphereVM := func() *infrav1.VSphereVM {
+			obj := &infrav1.VSphereVM{}
+			g.Expect(controllerManagerCtx.Client.Get(ctx, client.ObjectKeyFromObject(vsphereVM), obj)).To(Succeed())
+			return obj
+		}
+
+		// The events of the VMs of VSphereVMs are recorded, and update the
+		// conditions.
+		postEvent(vm, &types.VmDisconnectedEvent{})
+		expectEvents(corev1.EventTypeWarning, infrav1.HostDisconnectedReason)
+		g.Eventually(func() bool {
+			return conditions.IsFalse(getVSphereVM(), infrav1.HostConnectedCondition)
+		}, 10*time.Second).Should(BeTrue())
+		g.Expect(conditions.GetReason(getVSphereVM(), infrav1.HostConnectedCondition)).To(Equal(infrav1.HostDisconnectedReason))
+
+		// The same event is not recorded again, but the conditions are
+		// updated.
+		postEvent(vm, &types.VmConnectedEvent{})
+		expectEvents(corev1.EventTypeNormal, "HostConnected")
+		postEvent(vm, &types.VmDisconnectedEvent{})
+		g.Eventually(func() bool {
+			return conditions.IsFalse(getVSphereVM(), infrav1.HostConnectedCondition)
+		}, 10*time.Second).Should(BeTrue())
+		g.Consistently(recorder.Events, time.Second).ShouldNot(Receive())
+
+		postEvent(vm, &types.VmRestartedOnAlternateHostEvent{})
+		expectEvents(corev1.EventTypeWarning, infrav1.HARestartedReason)
+		g.Eventually(func() bool {
+			return conditions.IsFalse(getVSphereVM(), infrav1.VMUninterruptedCondition)
+		}, 10*time.Second).Should(BeTrue())
+		g.Expect(conditions.IsTrue(getVSphereVM(), infrav1.HostConnectedCondition)).To(BeTrue())
+
+		postEvent(refVM, &types.VmDisconnectedEvent{})
+		expectEvent(corev1.EventTypeWarning, infrav1.HostDisconnectedReason)
+		postEvent(biosUUIDVM, &types.VmDisconnectedEvent{})
+		expectEvent(corev1.EventTypeWarning, infrav1.HostDisconnectedReason)
+
+		// The events of other VMs and the events which are not bridged are
+		// ignored.
+		postEvent(otherVM, &types.VmDisconnectedEvent{})
+		postEvent(vm, &types.VmPoweredOffEvent{})
+		g.Consistently(recorder.Events, time.Second).ShouldNot(Receive())
+
+		// The bridge stops once the session is logged out.
+		g.Expect(session.NewManager(c).Logout(ctx)).To(Succeed())
+		g.Eventually(func() bool {
+			_, ok := bridges.Load(c.URL().Host)
+			return ok
+		}, 10*time.Second).Should(BeFalse())
+	})
+}
+
+func TestBridge_RemovedVM(t *testing.T) {
+	g := NewWithT(t)
+
+	ref := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"}
+	b := &Bridge{
+		uuids:    map[types.ManagedObjectReference]vmUUIDs{ref: {instanceUUID: "instance-uuid", biosUUID: "bios-uuid"}},
+		recorded: map[string]time.Time{},
+	}
+
+	// The UUIDs of a removed VM are forgotten.
+	removed := &types.VmRemovedEvent{}
+	removed.Vm = &types.VmEventArgument{Vm: ref}
+	g.Expect(b.bridge(context.Background(), []types.BaseEvent{removed})).To(Succeed())
+	g.Expect(b.uuids).To(BeEmpty())
+}
+
+func TestVSphereVMIndexes(t *testing.T) {
+	g := NewWithT(t)
+
+	// The VSphereVMs are indexed by the host of the URL of their vCenter
+	// server, as reported by the clients.
+	for _, server := range []string{"fd00::1", "[fd00::1]", "https://[fd00::1]/sdk"} {
+		vsphereVM := &infrav1.VSphereVM{
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Server: server},
+				BiosUUID:                "bios-uuid",
+			},
+			Status: infrav1.VSphereVMStatus{VMRef: "vm-1"},
+		}
+		g.Expect(VSphereVMByRef(vsphereVM)).To(ConsistOf("[fd00::1]/vm-1"), server)
+		g.Expect(VSphereVMByBiosUUID(vsphereVM)).To(ConsistOf("[fd00::1]/bios-uuid"), server)
+	}
+}
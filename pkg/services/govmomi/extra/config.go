@@ -33,6 +33,42 @@ const (
 	guestInfoCloudInitEncoding = "guestinfo.userdata.encoding"
 )
 
+const (
+	// AdoptedByKey is the key which records the UID of the VSphereVM which
+	// adopted an existing VM.
+	AdoptedByKey = "capv.adoptedBy"
+
+	// RetainedKey is the key set on the adopted VMs which were retained when
+	// their VSphereVM was deleted, so that they are not collected as orphans.
+	RetainedKey = "capv.retained"
+
+	// ManagedByKey is the key which records the identity of the controller
+	// manager which cloned a VM, so that the orphan collector of a controller
+	// manager only collects its own VMs.
+	ManagedByKey = "capv.managedBy"
+)
+
+// HasUserData returns whether the extra configuration contains the user data
+// set on the VMs cloned by CAPV.
+func HasUserData(values []types.BaseOptionValue) bool {
+	for _, value := range values {
+		switch value.GetOptionValue().Key {
+		case guestInfoCloudInitData, guestInfoIgnitionData:
+			return true
+		}
+	}
+	return false
+}
+
+// SetManagedBy sets the identity of the controller manager which cloned the
+// VM at the key "capv.managedBy".
+func (e *Config) SetManagedBy(managerID string) {
+	*e = append(*e, &types.OptionValue{
+		Key:   ManagedByKey,
+		Value: managerID,
+	})
+}
+
 // SetCustomVMXKeys sets the custom VMX keys as
 // OptionValues in extraConfig.
 func (e *Config) SetCustomVMXKeys(customKeys map[string]string) error {
@@ -0,0 +1,514 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hosts contains tools to monitor the maintenance mode of the ESXi
+// hosts running the VMs of the VSphereVMs.
+package hosts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// State is the maintenance state of an ESXi host.
+type State string
+
+const (
+	// StateInService is the state of a host which runs VMs normally.
+	StateInService State = "InService"
+
+	// StateEnteringMaintenance is the state of a host with a queued or running
+	// task entering maintenance mode, which waits for the VMs to be evacuated.
+	StateEnteringMaintenance State = "EnteringMaintenance"
+
+	// StateInMaintenance is the state of a host in maintenance mode.
+	StateInMaintenance State = "InMaintenance"
+
+	// StateInQuarantine is the state of a host in quarantine mode, which is
+	// degraded and evacuated by DRS when possible.
+	StateInQuarantine State = "InQuarantine"
+)
+
+var (
+	// monitors are the monitors by vCenter server. There is a single monitor
+	// per vCenter server, even when there are several sessions to it.
+	monitors sync.Map
+
+	// monitorsMU avoids starting several monitors for a vCenter server.
+	monitorsMU sync.Mutex
+)
+
+var (
+	// maxWaitSeconds is the maximum time waiting for updates, after which the
+	// monitor checks that the session of the vCenter client is still active.
+	maxWaitSeconds int32 = 60
+
+	// hostProperties are the properties of the hosts which determine their
+	// maintenance state.
+	hostProperties = []string{"name", "runtime.inMaintenanceMode", "runtime.inQuarantineMode", "recentTask"}
+
+	// taskProperties are the properties of the tasks entering maintenance
+	// mode used to detect their completion.
+	taskProperties = []string{"info.state"}
+
+	// destroyTimeout is the maximum time destroying the property collector
+	// and the views of a stopped monitor.
+	destroyTimeout = 10 * time.Second
+)
+
+const (
+	// enterMaintenanceModeTask is the description ID of the tasks entering
+	// maintenance mode.
+	enterMaintenanceModeTask = "HostSystem.enterMaintenanceMode"
+
+	morefTypeHostSystem = "HostSystem"
+	morefTypeTask       = "Task"
+)
+
+// host is the last known state of the properties of a host.
+type host struct {
+	name          string
+	inMaintenance bool
+	inQuarantine  bool
+	entering      bool
+	// enteringTasks are the queued or running tasks entering maintenance
+	// mode of the host.
+	enteringTasks []types.ManagedObjectReference
+}
+
+func (h host) state() State {
+	switch {
+	case h.inMaintenance:
+		return StateInMaintenance
+	case h.entering:
+		return StateEnteringMaintenance
+	case h.inQuarantine:
+		return StateInQuarantine
+	default:
+		return StateInService
+	}
+}
+
+// Monitor watches the maintenance state of all the hosts of a vCenter server
+// with a single property collector, and triggers a reconcile of the VSphereVMs
+// running on a host when its state changes.
+type Monitor struct {
+	client *vim25.Client
+	server string
+	k8s    client.Client
+	events chan<- event.GenericEvent
+	// taskView is the list of the tasks entering maintenance mode, whose
+	// completion clears the EnteringMaintenance state of their host.
+	taskView *view.ListView
+
+	// hosts are the hosts by reference, and tasks are the references of the
+	// hosts by the tasks entering maintenance mode. They are only accessed by
+	// the goroutine of the monitor.
+	hosts map[types.ManagedObjectReference]*host
+	tasks map[types.ManagedObjectReference]types.ManagedObjectReference
+
+	mu sync.Mutex
+	// states are the states of the hosts by reference. The references are
+	// unique for the vCenter server of the monitor, unlike the names of the
+	// hosts.
+	states map[types.ManagedObjectReference]State
+}
+
+// Start starts the monitor of the vCenter server of the client if it is not
+// running.
+func Start(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, c *vim25.Client) error {
+	server := c.URL().Host
+	if _, ok := monitors.Load(server); ok {
+		return nil
+	}
+
+	monitorsMU.Lock()
+	defer monitorsMU.Unlock()
+
+	if _, ok := monitors.Load(server); ok {
+		return nil
+	}
+	log := controllerManagerCtx.Logger.WithName("host-monitor").WithValues("server", server)
+	m, err := start(ctx, log, c, controllerManagerCtx.Client, controllerManagerCtx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM")))
+	if err != nil {
+		return err
+	}
+	monitors.Store(server, m)
+	return nil
+}
+
+// GetState returns the maintenance state of the host of the vCenter server,
+// by the value of its Managed Object Reference. It returns false if the state
+// is unknown, e.g. because the monitor of the vCenter server is not running.
+func GetState(server, hostRef string) (State, bool) {
+	m, ok := monitors.Load(server)
+	if !ok {
+		return "", false
+	}
+	return m.(*Monitor).getState(types.ManagedObjectReference{Type: morefTypeHostSystem, Value: hostRef})
+}
+
+func start(ctx context.Context, log logr.Logger, c *vim25.Client, k8s client.Client, events chan<- event.GenericEvent) (*Monitor, error) {
+	viewManager := view.NewManager(c)
+	containerView, err := viewManager.CreateContainerView(ctx, c.ServiceContent.RootFolder, []string{morefTypeHostSystem}, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create container view of hosts")
+	}
+	taskView, err := viewManager.CreateListView(ctx, nil)
+	if err != nil {
+		_ = containerView.Destroy(ctx)
+		return nil, errors.Wrap(err, "failed to create list view of tasks")
+	}
+	pc, err := property.DefaultCollector(c).Create(ctx)
+	if err != nil {
+		destroy(ctx, containerView, taskView)
+		return nil, errors.Wrap(err, "failed to create property collector of hosts")
+	}
+	_, err = pc.CreateFilter(ctx, types.CreateFilter{
+		Spec: types.PropertyFilterSpec{
+			ObjectSet: []types.ObjectSpec{
+				{
+					Obj:  containerView.Reference(),
+					Skip: types.NewBool(true),
+					SelectSet: []types.BaseSelectionSpec{
+						&types.TraversalSpec{Type: "ContainerView", Path: "view"},
+					},
+				},
+				{
+					Obj:  taskView.Reference(),
+					Skip: types.NewBool(true),
+					SelectSet: []types.BaseSelectionSpec{
+						&types.TraversalSpec{Type: "ListView", Path: "view"},
+					},
+				},
+			},
+			PropSet: []types.PropertySpec{
+				{Type: morefTypeHostSystem, PathSet: hostProperties},
+				{Type: morefTypeTask, PathSet: taskProperties},
+			},
+		},
+		PartialUpdates: true,
+	})
+	if err != nil {
+		destroy(ctx, pc, containerView, taskView)
+		return nil, errors.Wrap(err, "failed to create filter of hosts")
+	}
+
+	m := &Monitor{
+		client:   c,
+		server:   c.URL().Host,
+		k8s:      k8s,
+		events:   events,
+		taskView: taskView,
+		hosts:    map[types.ManagedObjectReference]*host{},
+		tasks:    map[types.ManagedObjectReference]types.ManagedObjectReference{},
+		states:   map[types.ManagedObjectReference]State{},
+	}
+	// The initial state of the hosts is known once the monitor is started.
+	version, err := m.update(ctrl.LoggerInto(ctx, log), pc)
+	if err != nil {
+		destroy(ctx, pc, containerView, taskView)
+		return nil, errors.Wrap(err, "failed to get the state of hosts")
+	}
+	// The monitor outlives the reconcile starting it.
+	log.Info("Monitoring hosts")
+	go m.run(ctrl.LoggerInto(context.Background(), log), pc, version, containerView)
+	return m, nil
+}
+
+// destroyer is a property collector or a view of the monitor.
+type destroyer interface {
+	Destroy(ctx context.Context) error
+}
+
+// destroy destroys the property collector and the views of the monitor.
+func destroy(ctx context.Context, objs ...destroyer) {
+	for _, obj := range objs {
+		_ = obj.Destroy(ctx)
+	}
+}
+
+// run waits for the updates of the hosts until the session of the vCenter
+// client is gone, e.g. because it was logged out.
+func (m *Monitor) run(ctx context.Context, pc *property.Collector, version string, containerView *view.ContainerView) {
+	log := ctrl.LoggerFrom(ctx)
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), destroyTimeout)
+		defer cancel()
+		destroy(ctx, pc, containerView, m.taskView)
+	}()
+
+	err := m.waitForUpdates(ctx, pc, version)
+	log.Error(err, "Stopped monitoring hosts")
+	monitors.CompareAndDelete(m.server, m)
+}
+
+// update reads the current state of the hosts without waiting, and returns
+// the version of the updates.
+func (m *Monitor) update(ctx context.Context, pc *property.Collector) (string, error) {
+	res, err := methods.WaitForUpdatesEx(ctx, m.client, &types.WaitForUpdatesEx{
+		This:    pc.Reference(),
+		Options: &types.WaitOptions{MaxWaitSeconds: ptr.To[int32](0)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if res.Returnval == nil {
+		return "", nil
+	}
+	for _, filterUpdate := range res.Returnval.FilterSet {
+		for _, update := range filterUpdate.ObjectSet {
+			m.onUpdate(ctx, update)
+		}
+	}
+	return res.Returnval.Version, nil
+}
+
+// waitForUpdates waits for the updates of the hosts after the version until
+// it fails. The version of the updates is kept when the maximum wait time is
+// exceeded, so that the current state of the hosts is not sent again.
+func (m *Monitor) waitForUpdates(ctx context.Context, pc *property.Collector, version string) error {
+	req := types.WaitForUpdatesEx{
+		This:    pc.Reference(),
+		Version: version,
+		Options: &types.WaitOptions{MaxWaitSeconds: ptr.To(maxWaitSeconds)},
+	}
+	for {
+		res, err := methods.WaitForUpdatesEx(ctx, m.client, &req)
+		if err != nil {
+			return err
+		}
+		// The maximum wait time was exceeded.
+		if res.Returnval == nil {
+			continue
+		}
+
+		req.Version = res.Returnval.Version
+		for _, filterUpdate := range res.Returnval.FilterSet {
+			for _, update := range filterUpdate.ObjectSet {
+				if ref, changed := m.onUpdate(ctx, update); changed {
+					m.reconcileVSphereVMs(ctx, ref)
+				}
+			}
+		}
+	}
+}
+
+// onUpdate updates the state of the host, or of the host of the task entering
+// maintenance mode, and returns its reference and whether its state changed.
+func (m *Monitor) onUpdate(ctx context.Context, update types.ObjectUpdate) (types.ManagedObjectReference, bool) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if update.Obj.Type == morefTypeTask {
+		return m.onTaskUpdate(ctx, update)
+	}
+
+	h, ok := m.hosts[update.Obj]
+	if !ok {
+		h = &host{}
+		m.hosts[update.Obj] = h
+	}
+	before := h.state()
+
+	if update.Kind == types.ObjectUpdateKindLeave {
+		m.setEnteringTasks(ctx, update.Obj, h, nil)
+		delete(m.hosts, update.Obj)
+		m.mu.Lock()
+		delete(m.states, update.Obj)
+		m.mu.Unlock()
+		return update.Obj, before != StateInService
+	}
+
+	for _, change := range update.ChangeSet {
+		switch change.Name {
+		case "name":
+			h.name, _ = change.Val.(string)
+		case "runtime.inMaintenanceMode":
+			h.inMaintenance, _ = change.Val.(bool)
+		case "runtime.inQuarantineMode":
+			h.inQuarantine, _ = change.Val.(bool)
+		case "recentTask":
+			var recentTasks []types.ManagedObjectReference
+			if tasks, ok := change.Val.(types.ArrayOfManagedObjectReference); ok {
+				recentTasks = tasks.ManagedObjectReference
+			}
+			enteringTasks, err := m.getEnteringMaintenanceTasks(ctx, recentTasks)
+			if err != nil {
+				log.Error(err, "Failed to get the recent tasks of host", "ref", update.Obj)
+				continue
+			}
+			m.setEnteringTasks(ctx, update.Obj, h, enteringTasks)
+		}
+	}
+
+	return update.Obj, m.setState(ctx, update.Obj, h, before)
+}
+
+// onTaskUpdate clears the task entering maintenance mode from its host once
+// it completes, e.g. because it was cancelled or it failed, and returns the
+// reference of the host and whether its state changed.
+func (m *Monitor) onTaskUpdate(ctx context.Context, update types.ObjectUpdate) (types.ManagedObjectReference, bool) {
+	hostRef, ok := m.tasks[update.Obj]
+	if !ok {
+		return hostRef, false
+	}
+	if update.Kind != types.ObjectUpdateKindLeave {
+		completed := false
+		for _, change := range update.ChangeSet {
+			if change.Name != "info.state" {
+				continue
+			}
+			switch change.Val.(types.TaskInfoState) {
+			case types.TaskInfoStateSuccess, types.TaskInfoStateError:
+				completed = true
+			}
+		}
+		if !completed {
+			return hostRef, false
+		}
+	}
+
+	h, ok := m.hosts[hostRef]
+	if !ok {
+		m.forgetTask(ctx, update.Obj)
+		return hostRef, false
+	}
+	before := h.state()
+	var enteringTasks []types.ManagedObjectReference
+	for _, task := range h.enteringTasks {
+		if task != update.Obj {
+			enteringTasks = append(enteringTasks, task)
+		}
+	}
+	m.setEnteringTasks(ctx, hostRef, h, enteringTasks)
+	return hostRef, m.setState(ctx, hostRef, h, before)
+}
+
+// setState stores the state of the host, and returns whether it changed.
+func (m *Monitor) setState(ctx context.Context, ref types.ManagedObjectReference, h *host, before State) bool {
+	after := h.state()
+	m.mu.Lock()
+	m.states[ref] = after
+	m.mu.Unlock()
+	if after == before {
+		return false
+	}
+	ctrl.LoggerFrom(ctx).Info("Host maintenance state changed", "host", h.name, "ref", ref.Value, "state", after)
+	return true
+}
+
+// setEnteringTasks sets the tasks entering maintenance mode of the host, and
+// watches them until they complete.
+func (m *Monitor) setEnteringTasks(ctx context.Context, ref types.ManagedObjectReference, h *host, tasks []types.ManagedObjectReference) {
+	log := ctrl.LoggerFrom(ctx)
+
+	entering := map[types.ManagedObjectReference]bool{}
+	for _, task := range tasks {
+		entering[task] = true
+		if _, ok := m.tasks[task]; ok {
+			continue
+		}
+		m.tasks[task] = ref
+		if _, err := m.taskView.Add(ctx, []types.ManagedObjectReference{task}); err != nil {
+			log.Error(err, "Failed to watch task entering maintenance mode", "taskRef", task.Value)
+		}
+	}
+	for _, task := range h.enteringTasks {
+		if !entering[task] {
+			m.forgetTask(ctx, task)
+		}
+	}
+	h.enteringTasks = tasks
+	h.entering = len(tasks) > 0
+}
+
+// forgetTask stops watching the task entering maintenance mode.
+func (m *Monitor) forgetTask(ctx context.Context, task types.ManagedObjectReference) {
+	delete(m.tasks, task)
+	if _, err := m.taskView.Remove(ctx, []types.ManagedObjectReference{task}); err != nil {
+		ctrl.LoggerFrom(ctx).V(4).Info("Failed to stop watching task entering maintenance mode", "taskRef", task.Value, "err", err.Error())
+	}
+}
+
+// getEnteringMaintenanceTasks returns the queued or running tasks entering
+// maintenance mode among the tasks.
+func (m *Monitor) getEnteringMaintenanceTasks(ctx context.Context, tasks []types.ManagedObjectReference) ([]types.ManagedObjectReference, error) {
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+	var moTasks []mo.Task
+	if err := property.DefaultCollector(m.client).Retrieve(ctx, tasks, []string{"info.descriptionId", "info.state"}, &moTasks); err != nil {
+		return nil, err
+	}
+	var enteringTasks []types.ManagedObjectReference
+	for _, task := range moTasks {
+		if task.Info.DescriptionId != enterMaintenanceModeTask {
+			continue
+		}
+		switch task.Info.State {
+		case types.TaskInfoStateQueued, types.TaskInfoStateRunning:
+			enteringTasks = append(enteringTasks, task.Reference())
+		}
+	}
+	return enteringTasks, nil
+}
+
+// reconcileVSphereVMs triggers a reconcile of the VSphereVMs running on the
+// host.
+func (m *Monitor) reconcileVSphereVMs(ctx context.Context, ref types.ManagedObjectReference) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := m.k8s.List(ctx, vsphereVMs); err != nil {
+		log.Error(err, "Failed to list VSphereVMs")
+		return
+	}
+	for i := range vsphereVMs.Items {
+		vsphereVM := &vsphereVMs.Items[i]
+		if vsphereVM.Status.HostRef != ref.Value || session.ServerHost(vsphereVM.Spec.Server) != m.server {
+			continue
+		}
+		log.V(4).Info("Triggering GenericEvent", "VSphereVM", klog.KObj(vsphereVM), "hostRef", ref.Value)
+		m.events <- event.GenericEvent{Object: vsphereVM}
+	}
+}
+
+func (m *Monitor) getState(ref types.ManagedObjectReference) (State, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.states[ref]
+	return state, ok
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hosts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestMonitor(t *testing.T) {
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vsphereVM1",
+			Namespace: "my-namespace",
+		},
+	}
+	otherVSphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vsphereVM2",
+			Namespace: "my-namespace",
+		},
+	}
+	otherServerVSphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vsphereVM3",
+			Namespace: "my-namespace",
+		},
+		Spec: infrav1.VSphereVMSpec{
+			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+				Server: "other.vcenter.local",
+			},
+		},
+	}
+
+	maxWaitSeconds = 1
+	defer func() { maxWaitSeconds = 60 }()
+
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		g := NewWithT(t)
+
+		server := c.URL().Host
+		finder := find.NewFinder(c)
+		host, err := finder.HostSystem(ctx, "DC0_H0")
+		g.Expect(err).ToNot(HaveOccurred())
+		otherHost, err := finder.HostSystem(ctx, "DC0_C0_H0")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// The VSphereVMs are matched by the reference of their host and their
+		// vCenter server, whatever the form of its URL.
+		vsphereVM.Spec.Server = "https://" + server + "/sdk"
+		vsphereVM.Status.Host = "DC0_H0"
+		vsphereVM.Status.HostRef = host.Reference().Value
+		otherVSphereVM.Spec.Server = server
+		otherVSphereVM.Status.Host = "DC0_C0_H0"
+		otherVSphereVM.Status.HostRef = otherHost.Reference().Value
+		otherServerVSphereVM.Status.Host = "DC0_H0"
+		otherServerVSphereVM.Status.HostRef = host.Reference().Value
+
+		controllerManagerCtx := fake.NewControllerManagerContext(vsphereVM, otherVSphereVM, otherServerVSphereVM)
+		events := controllerManagerCtx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM"))
+		expectEvent := func() {
+			var e event.GenericEvent
+			g.Eventually(events, 10*time.Second).Should(Receive(&e))
+			g.Expect(e.Object.GetName()).To(Equal(vsphereVM.Name))
+			g.Consistently(events, time.Second).ShouldNot(Receive())
+		}
+
+		_, ok := GetState(server, host.Reference().Value)
+		g.Expect(ok).To(BeFalse())
+
+		g.Expect(Start(ctx, controllerManagerCtx, c)).To(Succeed())
+		g.Expect(Start(ctx, controllerManagerCtx, c)).To(Succeed())
+		state, ok := GetState(server, host.Reference().Value)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(state).To(Equal(StateInService))
+
+		getState := func() State {
+			state, _ := GetState(server, host.Reference().Value)
+			return state
+		}
+
+		// The changes of the maintenance state of a host trigger a reconcile
+		// of the VSphereVMs running on it. The state of the host is updated
+		// in the inventory, since the tasks of the simulator complete at once.
+		obj := simulator.Map.Get(host.Reference())
+		task := simulator.CreateTask(obj, "enterMaintenanceMode", nil)
+		simulator.Map.Update(obj, []types.PropertyChange{{Name: "recentTask", Val: []types.ManagedObjectReference{task.Self}}})
+		expectEvent()
+		g.Expect(getState()).To(Equal(StateEnteringMaintenance))
+
+		// The EnteringMaintenance state is cleared once the task entering
+		// maintenance mode fails or is cancelled, even if it is still one of
+		// the recent tasks of the host.
+		simulator.Map.Update(task, []types.PropertyChange{{Name: "info.state", Val: types.TaskInfoStateError}})
+		expectEvent()
+		g.Expect(getState()).To(Equal(StateInService))
+
+		task = simulator.CreateTask(obj, "enterMaintenanceMode", nil)
+		simulator.Map.Update(obj, []types.PropertyChange{{Name: "recentTask", Val: []types.ManagedObjectReference{task.Self}}})
+		expectEvent()
+		g.Expect(getState()).To(Equal(StateEnteringMaintenance))
+
+		simulator.Map.Update(obj, []types.PropertyChange{
+			{Name: "runtime.inMaintenanceMode", Val: true},
+			{Name: "recentTask", Val: []types.ManagedObjectReference{}},
+		})
+		expectEvent()
+		g.Expect(getState()).To(Equal(StateInMaintenance))
+
+		simulator.Map.Update(obj, []types.PropertyChange{{Name: "runtime.inMaintenanceMode", Val: false}})
+		expectEvent()
+		g.Expect(getState()).To(Equal(StateInService))
+
+		// The monitor stops once the session is logged out.
+		g.Expect(session.NewManager(c).Logout(ctx)).To(Succeed())
+		g.Eventually(func() bool {
+			_, ok := GetState(server, host.Reference().Value)
+			return ok
+		}, 10*time.Second).Should(BeFalse())
+	})
+}
+
+func TestHostState(t *testing.T) {
+	tests := []struct {
+		name string
+		host host
+		want State
+	}{
+		{
+			name: "host in service",
+			host: host{},
+			want: StateInService,
+		},
+		{
+			name: "host entering maintenance mode",
+			host: host{entering: true, inQuarantine: true},
+			want: StateEnteringMaintenance,
+		},
+		{
+			name: "host in maintenance mode",
+			host: host{inMaintenance: true, entering: true},
+			want: StateInMaintenance,
+		},
+		{
+			name: "host in quarantine mode",
+			host: host{inQuarantine: true},
+			want: StateInQuarantine,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tt.host.state()).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package orphans contains tools to find and delete the vCenter objects
+// created by CAPV which no CAPV object maps to anymore.
+package orphans
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	govmomicluster "github.com/vmware/govmomi/vapi/cluster"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/cluster"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// vmProperties are the properties of the VMs used to map them to their
+// VSphereVMs.
+var vmProperties = []string{"name", "config.uuid", "config.instanceUuid", "config.template", "config.extraConfig"}
+
+// Object is a vCenter object which no CAPV object maps to.
+type Object struct {
+	// Type is the kind of the object.
+	Type infrav1.OrphanType
+
+	// Ref is the managed object reference of the VM, or the UUID of the
+	// cluster module.
+	Ref string
+
+	// Name is the inventory path of the VM, or the name of the compute
+	// cluster of the cluster module.
+	Name string
+
+	// ComputeCluster is the compute cluster of the VM group of a VM group
+	// member.
+	ComputeCluster string
+
+	// VMGroup is the name of the VM group of a VM group member.
+	VMGroup string
+}
+
+// VMGroup is a VM group of a failure domain.
+type VMGroup struct {
+	// ComputeCluster is the name or inventory path of the compute cluster.
+	ComputeCluster string
+
+	// Name is the name of the VM group.
+	Name string
+}
+
+// Owners are the CAPV objects which the vCenter objects map to.
+type Owners struct {
+	managerID     string
+	biosUUIDs     sets.Set[string]
+	instanceUUIDs sets.Set[string]
+	names         sets.Set[string]
+
+	// ClusterModules are the UUIDs of the cluster modules of the
+	// VSphereClusters.
+	ClusterModules sets.Set[string]
+}
+
+// NewOwners returns the owners of the VMs of the VSphereVMs, of the VMs used
+// as templates or instant clone parents, and of the cluster modules. Only the
+// VMs cloned by the controller manager identified by managerID can be
+// orphaned.
+func NewOwners(managerID string, vsphereVMs []infrav1.VSphereVM, templates, clusterModules []string) *Owners {
+	owners := &Owners{
+		managerID:      managerID,
+		biosUUIDs:      sets.New[string](),
+		instanceUUIDs:  sets.New[string](),
+		names:          sets.New[string](templates...),
+		ClusterModules: sets.New[string](clusterModules...),
+	}
+	// The VMs are found by BIOS UUID, by instance UUID, which is the UID of
+	// their VSphereVM, or by name, like in findVM.
+	for i := range vsphereVMs {
+		vsphereVM := &vsphereVMs[i]
+		if vsphereVM.Spec.BiosUUID != "" {
+			owners.biosUUIDs.Insert(vsphereVM.Spec.BiosUUID)
+		}
+		owners.instanceUUIDs.Insert(string(vsphereVM.UID))
+		owners.names.Insert(vsphereVM.Name)
+	}
+	return owners
+}
+
+// isOrphaned returns whether the VM was cloned by the controller manager and
+// is not mapped to any VSphereVM. The VMs which were not cloned by the
+// controller manager, like the templates, the VMs of other management clusters
+// or watch filters and the adopted VMs which were retained, are never
+// orphaned.
+func (o *Owners) isOrphaned(vm *mo.VirtualMachine) bool {
+	if vm.Config == nil || vm.Config.Template || !extra.HasUserData(vm.Config.ExtraConfig) {
+		return false
+	}
+	managed := false
+	for _, value := range vm.Config.ExtraConfig {
+		option := value.GetOptionValue()
+		v, _ := option.Value.(string)
+		switch option.Key {
+		case extra.RetainedKey, extra.AdoptedByKey:
+			if v != "" {
+				return false
+			}
+		case extra.ManagedByKey:
+			managed = o.managerID != "" && v == o.managerID
+		}
+	}
+	return managed && !o.biosUUIDs.Has(vm.Config.Uuid) && !o.instanceUUIDs.Has(vm.Config.InstanceUuid) && !o.names.Has(vm.Name)
+}
+
+// FindVirtualMachines returns the orphaned VMs in the folders, and in their
+// sub folders.
+func FindVirtualMachines(ctx context.Context, s *session.Session, folders []string, owners *Owners) ([]Object, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var orphans []Object
+	seen := sets.New[types.ManagedObjectReference]()
+	for _, folderPath := range folders {
+		folder, err := s.Finder.FolderOrDefault(ctx, folderPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find folder %q", folderPath)
+		}
+		vms, err := recursiveList(ctx, s, folder.Reference())
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list VMs in folder %q", folder.InventoryPath)
+		}
+		for i := range vms {
+			vm := &vms[i]
+			if seen.Has(vm.Reference()) || !owners.isOrphaned(vm) {
+				continue
+			}
+			seen.Insert(vm.Reference())
+			name := vm.Name
+			if element, err := s.Finder.Element(ctx, vm.Reference()); err == nil {
+				name = element.Path
+			}
+			log.V(4).Info("Found orphaned VM", "vm", name, "vmRef", vm.Reference())
+			orphans = append(orphans, Object{
+				Type: infrav1.OrphanTypeVirtualMachine,
+				Ref:  vm.Reference().Value,
+				Name: name,
+			})
+		}
+	}
+	return orphans, nil
+}
+
+// recursiveList returns the VMs in the folder and in its sub folders.
+func recursiveList(ctx context.Context, s *session.Session, root types.ManagedObjectReference) ([]mo.VirtualMachine, error) {
+	v, err := view.NewManager(s.Client.Client).CreateContainerView(ctx, root, []string{"VirtualMachine"}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = v.Destroy(ctx) }()
+
+	var vms []mo.VirtualMachine
+	if err := v.Retrieve(ctx, []string{"VirtualMachine"}, vmProperties, &vms); err != nil {
+		return nil, err
+	}
+	return vms, nil
+}
+
+// FindVMGroupMembers returns the orphaned VMs which are members of the VM
+// groups, except the ones already reported as orphaned VMs.
+func FindVMGroupMembers(ctx context.Context, s *session.Session, vmGroups []VMGroup, owners *Owners, orphanedVMs sets.Set[string]) ([]Object, error) {
+	var orphans []Object
+	for _, vmGroup := range vmGroups {
+		group, err := cluster.FindVMGroup(ctx, sessionContext{s}, vmGroup.ComputeCluster, vmGroup.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find VM group %s of compute cluster %s", vmGroup.Name, vmGroup.ComputeCluster)
+		}
+		if len(group.ClusterVmGroup.Vm) == 0 {
+			continue
+		}
+		var vms []mo.VirtualMachine
+		if err := s.Retrieve(ctx, group.ClusterVmGroup.Vm, vmProperties, &vms); err != nil {
+			return nil, errors.Wrapf(err, "unable to get the members of VM group %s", vmGroup.Name)
+		}
+		for i := range vms {
+			vm := &vms[i]
+			if orphanedVMs.Has(vm.Reference().Value) || !owners.isOrphaned(vm) {
+				continue
+			}
+			orphans = append(orphans, Object{
+				Type:           infrav1.OrphanTypeVMGroupMember,
+				Ref:            vm.Reference().Value,
+				Name:           vm.Name,
+				ComputeCluster: vmGroup.ComputeCluster,
+				VMGroup:        vmGroup.Name,
+			})
+		}
+	}
+	return orphans, nil
+}
+
+// FindClusterModules returns the cluster modules which are not used by any
+// VSphereCluster, and whose members are all orphaned VMs. The cluster modules
+// without members are never orphaned, as they may belong to another management
+// cluster.
+func FindClusterModules(ctx context.Context, s *session.Session, owners *Owners, orphanedVMs sets.Set[string]) ([]Object, error) {
+	manager := govmomicluster.NewManager(s.TagManager.Client)
+	modules, err := manager.ListModules(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list cluster modules")
+	}
+
+	var orphans []Object
+	for _, module := range modules {
+		if owners.ClusterModules.Has(module.Module) {
+			continue
+		}
+		members, err := manager.ListModuleMembers(ctx, module.Module)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list members of cluster module %s", module.Module)
+		}
+		orphaned := len(members) > 0
+		for _, member := range members {
+			if !orphanedVMs.Has(member.Value) {
+				orphaned = false
+				break
+			}
+		}
+		if !orphaned {
+			continue
+		}
+		name := module.Cluster
+		if element, err := s.Finder.Element(ctx, types.ManagedObjectReference{Type: "ClusterComputeResource", Value: module.Cluster}); err == nil {
+			name = element.Path
+		}
+		orphans = append(orphans, Object{
+			Type: infrav1.OrphanTypeClusterModule,
+			Ref:  module.Module,
+			Name: name,
+		})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Ref < orphans[j].Ref })
+	return orphans, nil
+}
+
+// Delete deletes the orphaned object from vCenter. The VMs are powered off
+// and destroyed, the cluster modules are deleted, and the VMs are removed from
+// their VM groups.
+func Delete(ctx context.Context, s *session.Session, orphan Object) error {
+	switch orphan.Type {
+	case infrav1.OrphanTypeVirtualMachine:
+		vm := object.NewVirtualMachine(s.Client.Client, types.ManagedObjectReference{Type: "VirtualMachine", Value: orphan.Ref})
+		powerState, err := vm.PowerState(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get power state of VM %s", orphan.Name)
+		}
+		if powerState == types.VirtualMachinePowerStatePoweredOn {
+			task, err := vm.PowerOff(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "unable to power off VM %s", orphan.Name)
+			}
+			if err := task.Wait(ctx); err != nil {
+				return errors.Wrapf(err, "unable to power off VM %s", orphan.Name)
+			}
+		}
+		task, err := vm.Destroy(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "unable to destroy VM %s", orphan.Name)
+		}
+		return errors.Wrapf(task.Wait(ctx), "unable to destroy VM %s", orphan.Name)
+
+	case infrav1.OrphanTypeClusterModule:
+		manager := govmomicluster.NewManager(s.TagManager.Client)
+		return errors.Wrapf(manager.DeleteModule(ctx, orphan.Ref), "unable to delete cluster module %s", orphan.Ref)
+
+	case infrav1.OrphanTypeVMGroupMember:
+		group, err := cluster.FindVMGroup(ctx, sessionContext{s}, orphan.ComputeCluster, orphan.VMGroup)
+		if err != nil {
+			return errors.Wrapf(err, "unable to find VM group %s of compute cluster %s", orphan.VMGroup, orphan.ComputeCluster)
+		}
+		task, err := group.Remove(ctx, types.ManagedObjectReference{Type: "VirtualMachine", Value: orphan.Ref})
+		if err != nil {
+			return errors.Wrapf(err, "unable to remove VM %s from VM group %s", orphan.Name, orphan.VMGroup)
+		}
+		return errors.Wrapf(task.Wait(ctx), "unable to remove VM %s from VM group %s", orphan.Name, orphan.VMGroup)
+
+	default:
+		return errors.Errorf("unknown orphan type %q", orphan.Type)
+	}
+}
+
+// sessionContext provides the session to the functions of the cluster
+// package.
+type sessionContext struct {
+	session *session.Session
+}
+
+func (c sessionContext) GetSession() *session.Session {
+	return c.session
+}
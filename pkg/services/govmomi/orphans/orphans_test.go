@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+)
+
+func TestOwners_isOrphaned(t *testing.T) {
+	owners := NewOwners("manager-id", []infrav1.VSphereVM{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "by-name", UID: "by-instance-uuid"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "other"},
+			Spec:       infrav1.VSphereVMSpec{BiosUUID: "by-bios-uuid"},
+		},
+	}, []string{"template"}, nil)
+
+	newVM := func(name, biosUUID, instanceUUID string, extraConfig ...types.BaseOptionValue) *mo.VirtualMachine {
+		return &mo.VirtualMachine{
+			ManagedEntity: mo.ManagedEntity{Name: name},
+			Config: &types.VirtualMachineConfigInfo{
+				Uuid:         biosUUID,
+				InstanceUuid: instanceUUID,
+				ExtraConfig: append([]types.BaseOptionValue{
+					&types.OptionValue{Key: "guestinfo.userdata", Value: "Zm9v"},
+					&types.OptionValue{Key: extra.ManagedByKey, Value: "manager-id"},
+				}, extraConfig...),
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		vm   *mo.VirtualMachine
+		want bool
+	}{
+		{
+			name: "unmapped VM",
+			vm:   newVM("vm", "bios-uuid", "instance-uuid"),
+			want: true,
+		},
+		{
+			name: "VM mapped by name",
+			vm:   newVM("by-name", "bios-uuid", "instance-uuid"),
+			want: false,
+		},
+		{
+			name: "VM mapped by BIOS UUID",
+			vm:   newVM("vm", "by-bios-uuid", "instance-uuid"),
+			want: false,
+		},
+		{
+			name: "VM mapped by instance UUID",
+			vm:   newVM("vm", "bios-uuid", "by-instance-uuid"),
+			want: false,
+		},
+		{
+			name: "template used to clone the VMs",
+			vm:   newVM("template", "bios-uuid", "instance-uuid"),
+			want: false,
+		},
+		{
+			name: "VM not cloned by CAPV",
+			vm: &mo.VirtualMachine{
+				ManagedEntity: mo.ManagedEntity{Name: "vm"},
+				Config:        &types.VirtualMachineConfigInfo{Uuid: "bios-uuid", InstanceUuid: "instance-uuid"},
+			},
+			want: false,
+		},
+		{
+			name: "VM cloned by another controller manager",
+			vm: &mo.VirtualMachine{
+				ManagedEntity: mo.ManagedEntity{Name: "vm"},
+				Config: &types.VirtualMachineConfigInfo{
+					Uuid:         "bios-uuid",
+					InstanceUuid: "instance-uuid",
+					ExtraConfig: []types.BaseOptionValue{
+						&types.OptionValue{Key: "guestinfo.userdata", Value: "Zm9v"},
+						&types.OptionValue{Key: extra.ManagedByKey, Value: "other-manager-id"},
+					},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "VM cloned without controller manager identity",
+			vm: &mo.VirtualMachine{
+				ManagedEntity: mo.ManagedEntity{Name: "vm"},
+				Config: &types.VirtualMachineConfigInfo{
+					Uuid:         "bios-uuid",
+					InstanceUuid: "instance-uuid",
+					ExtraConfig:  []types.BaseOptionValue{&types.OptionValue{Key: "guestinfo.userdata", Value: "Zm9v"}},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "retained VM",
+			vm:   newVM("vm", "bios-uuid", "instance-uuid", &types.OptionValue{Key: extra.RetainedKey, Value: "true"}),
+			want: false,
+		},
+		{
+			name: "adopted VM",
+			vm:   newVM("vm", "bios-uuid", "instance-uuid", &types.OptionValue{Key: extra.AdoptedByKey, Value: "uid"}),
+			want: false,
+		},
+		{
+			name: "VM with cleared adoption keys",
+			vm: newVM("vm", "bios-uuid", "instance-uuid",
+				&types.OptionValue{Key: extra.AdoptedByKey, Value: ""},
+				&types.OptionValue{Key: extra.RetainedKey, Value: ""}),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(owners.isOrphaned(tt.vm)).To(Equal(tt.want))
+		})
+	}
+}
@@ -105,12 +105,12 @@ func (vms *VMService) triggerSoftPowerOff(ctx context.Context, virtualMachineCtx
 		return true, nil
 	}
 
-	var o mo.VirtualMachine
-	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"guest.guestStateChangeSupported"}, &o); err != nil {
+	guestStateChangeSupported, err := isGuestStateChangeSupported(ctx, virtualMachineCtx)
+	if err != nil {
 		return false, err
 	}
 
-	if o.Guest.GuestStateChangeSupported == nil || !*o.Guest.GuestStateChangeSupported {
+	if !guestStateChangeSupported {
 		if virtualMachineCtx.VSphereVM.Spec.PowerOffMode == infrav1.VirtualMachinePowerOpModeTrySoft {
 			// Returning false to force a power off.
 			return false, nil
@@ -131,3 +131,13 @@ func (vms *VMService) triggerSoftPowerOff(ctx context.Context, virtualMachineCtx
 		"guest soft power off initiated on VM %s", client.ObjectKeyFromObject(virtualMachineCtx.VSphereVM))
 	return true, nil
 }
+
+// isGuestStateChangeSupported returns true if the guest of the VM can be shut
+// down or rebooted.
+func isGuestStateChangeSupported(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"guest.guestStateChangeSupported"}, &o); err != nil {
+		return false, err
+	}
+	return o.Guest != nil && o.Guest.GuestStateChangeSupported != nil && *o.Guest.GuestStateChangeSupported, nil
+}
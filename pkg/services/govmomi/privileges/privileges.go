@@ -0,0 +1,507 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package privileges contains tools to check the privileges of the user of a
+// vCenter session on the inventory objects used by CAPV.
+package privileges
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	vapivcenter "github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+const (
+	// cloneTemplatePrivilege is needed on a VM template to clone it.
+	cloneTemplatePrivilege = "VirtualMachine.Provisioning.DeployTemplate"
+	// cloneVMPrivilege is needed on a VM to clone it, including the instant
+	// clones.
+	cloneVMPrivilege = "VirtualMachine.Provisioning.Clone"
+	// storageProfilePrivilege is needed on the root folder to use the storage
+	// policies.
+	storageProfilePrivilege = "StorageProfile.View"
+	// attachTagPrivilege is needed on the objects the tags are attached to.
+	attachTagPrivilege = "InventoryService.Tagging.AttachTag"
+	// editClusterPrivilege is needed on a compute cluster to add the VMs to
+	// its VM groups.
+	editClusterPrivilege = "Host.Inventory.EditCluster"
+)
+
+var (
+	// vmPrivileges are needed on the folder of the VMs, and inherited by the
+	// VMs, to create, configure, power and delete them.
+	vmPrivileges = []string{
+		"VirtualMachine.Config.AddNewDisk",
+		"VirtualMachine.Config.AddRemoveDevice",
+		"VirtualMachine.Config.AdvancedConfig",
+		"VirtualMachine.Config.CPUCount",
+		"VirtualMachine.Config.DiskExtend",
+		"VirtualMachine.Config.EditDevice",
+		"VirtualMachine.Config.Memory",
+		"VirtualMachine.Config.Resource",
+		"VirtualMachine.Config.Settings",
+		"VirtualMachine.Interact.PowerOff",
+		"VirtualMachine.Interact.PowerOn",
+		"VirtualMachine.Interact.Reset",
+		"VirtualMachine.Inventory.CreateFromExisting",
+		"VirtualMachine.Inventory.Delete",
+	}
+
+	// snapshotPrivileges are needed on the folder of the VMs with a snapshot
+	// policy, or rolled back to a snapshot.
+	snapshotPrivileges = []string{
+		"VirtualMachine.State.CreateSnapshot",
+		"VirtualMachine.State.RemoveSnapshot",
+		"VirtualMachine.State.RevertToSnapshot",
+	}
+
+	// contentLibraryTemplatePrivileges are needed on the folder of the VMs
+	// to cache the Content Library items as local templates, and to clone
+	// them.
+	contentLibraryTemplatePrivileges = []string{
+		cloneTemplatePrivilege,
+		"VirtualMachine.Config.Rename",
+		"VirtualMachine.Provisioning.MarkAsTemplate",
+		"VirtualMachine.State.CreateSnapshot",
+	}
+
+	// tagCategoryPrivileges are needed on the root folder to create the tag
+	// categories and the tags of the failure domains configured by CAPV.
+	tagCategoryPrivileges = []string{
+		"InventoryService.Tagging.CreateCategory",
+		"InventoryService.Tagging.CreateTag",
+	}
+)
+
+// Kind is the kind of an inventory object.
+type Kind string
+
+const (
+	// RootFolderKind is the kind of the root folder, on which the privileges
+	// of the objects which are not in the inventory, like the tag categories
+	// and the storage policies, are checked.
+	RootFolderKind = Kind("root folder")
+	// TemplateKind is the kind of the templates the VMs are cloned from.
+	TemplateKind = Kind("template")
+	// DatacenterKind is the kind of the datacenters.
+	DatacenterKind = Kind("datacenter")
+	// ComputeClusterKind is the kind of the compute clusters.
+	ComputeClusterKind = Kind("compute cluster")
+	// FolderKind is the kind of the VM folders.
+	FolderKind = Kind("folder")
+	// ResourcePoolKind is the kind of the resource pools.
+	ResourcePoolKind = Kind("resource pool")
+	// DatastoreKind is the kind of the datastores and datastore clusters.
+	DatastoreKind = Kind("datastore")
+	// NetworkKind is the kind of the networks.
+	NetworkKind = Kind("network")
+)
+
+// Missing are the privileges missing on an inventory object.
+type Missing struct {
+	// Kind is the kind of the object.
+	Kind Kind
+
+	// Name is the inventory path of the object.
+	Name string
+
+	// Privileges are the IDs of the missing privileges, sorted.
+	Privileges []string
+}
+
+func (m Missing) String() string {
+	return fmt.Sprintf("%s %q: %s", m.Kind, m.Name, strings.Join(m.Privileges, ", "))
+}
+
+// Message returns the message listing the missing privileges reported in the
+// PrivilegesSufficient condition.
+func Message(missing []Missing) string {
+	objects := make([]string, 0, len(missing))
+	for _, m := range missing {
+		objects = append(objects, m.String())
+	}
+	return "missing privileges on " + strings.Join(objects, "; ")
+}
+
+// entity is an inventory object and the privileges needed on it.
+type entity struct {
+	kind       Kind
+	name       string
+	privileges sets.Set[string]
+}
+
+// Checker collects the inventory objects used by the VMs and the failure
+// domains of a vCenter server, and checks the privileges of the user of a
+// session on them.
+type Checker struct {
+	session *session.Session
+
+	// entities are the objects to check by reference, and refs the order in
+	// which they were added.
+	entities map[types.ManagedObjectReference]*entity
+	refs     []types.ManagedObjectReference
+
+	// finders are the finders of the datacenters by name.
+	finders map[string]*find.Finder
+
+	// found are the objects already looked up by datacenter, kind and name,
+	// since the VMs of a cluster mostly use the same objects.
+	found map[string]*foundObject
+
+	// errs are the errors to resolve the objects.
+	errs []error
+}
+
+// foundObject is the result of the lookup of an object.
+type foundObject struct {
+	name string
+	ref  types.ManagedObjectReference
+	ok   bool
+}
+
+// NewChecker returns a Checker using the session.
+func NewChecker(s *session.Session) *Checker {
+	return &Checker{
+		session:  s,
+		entities: map[types.ManagedObjectReference]*entity{},
+		finders:  map[string]*find.Finder{},
+		found:    map[string]*foundObject{},
+	}
+}
+
+// AddVM adds the template, the folder, the resource pool, the datastore and
+// the networks of the VSphereVM, with the privileges needed by its features.
+// The template of a Content Library item is the VM template backing an item
+// of the vm-template type. The objects which cannot be found are reported by
+// Check.
+func (c *Checker) AddVM(ctx context.Context, vm *infrav1.VSphereVM) {
+	spec := vm.Spec
+	finder, err := c.finder(ctx, spec.Datacenter)
+	if err != nil {
+		c.errs = append(c.errs, err)
+		return
+	}
+
+	switch {
+	case spec.ContentLibraryItem != nil:
+		c.addContentLibraryItem(ctx, *spec.ContentLibraryItem)
+	case spec.Template != "":
+		c.addTemplate(ctx, finder, spec.Datacenter, spec.Template, spec.CloneMode == infrav1.InstantClone)
+	}
+
+	if folder, ok := c.lookup(spec.Datacenter, FolderKind, spec.Folder, func() (string, types.ManagedObjectReference, error) {
+		folder, err := finder.FolderOrDefault(ctx, spec.Folder)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find folder %q", spec.Folder)
+		}
+		return folder.InventoryPath, folder.Reference(), nil
+	}); ok {
+		c.add(FolderKind, folder.name, folder.ref, vmPrivileges...)
+		if vm.Spec.SnapshotPolicy != nil || vm.Spec.RollbackToSnapshot != "" {
+			c.add(FolderKind, folder.name, folder.ref, snapshotPrivileges...)
+		}
+		if spec.ContentLibraryItem != nil && spec.ContentLibraryItem.CacheTemplate {
+			c.add(FolderKind, folder.name, folder.ref, contentLibraryTemplatePrivileges...)
+		}
+		if len(spec.TagIDs) > 0 {
+			c.add(FolderKind, folder.name, folder.ref, attachTagPrivilege)
+		}
+	}
+
+	if pool, ok := c.lookup(spec.Datacenter, ResourcePoolKind, spec.ResourcePool, func() (string, types.ManagedObjectReference, error) {
+		pool, err := finder.ResourcePoolOrDefault(ctx, spec.ResourcePool)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find resource pool %q", spec.ResourcePool)
+		}
+		return pool.InventoryPath, pool.Reference(), nil
+	}); ok {
+		c.add(ResourcePoolKind, pool.name, pool.ref, "Resource.AssignVMToPool")
+	}
+
+	c.addDatastore(ctx, finder, spec.Datacenter, spec.Datastore, spec.DatastoreCluster)
+
+	for _, device := range spec.Network.Devices {
+		if device.NetworkName != "" {
+			c.addNetwork(ctx, finder, spec.Datacenter, device.NetworkName)
+		}
+	}
+
+	usesStoragePolicy := spec.StoragePolicyName != ""
+	for _, disk := range spec.DataDisks {
+		usesStoragePolicy = usesStoragePolicy || disk.StoragePolicyName != ""
+	}
+	if usesStoragePolicy {
+		c.addRootFolder(storageProfilePrivilege)
+	}
+}
+
+// AddFailureDomain adds the datacenter, the compute cluster, the datastore
+// and the networks of the VSphereFailureDomain, and the tag categories of the
+// failure domains configured by CAPV.
+func (c *Checker) AddFailureDomain(ctx context.Context, failureDomain *infrav1.VSphereFailureDomain) {
+	topology := failureDomain.Spec.Topology
+	finder, err := c.finder(ctx, topology.Datacenter)
+	if err != nil {
+		c.errs = append(c.errs, err)
+		return
+	}
+
+	autoConfigure := false
+	var datacenterPrivileges, computeClusterPrivileges []string
+	for _, fd := range []infrav1.FailureDomain{failureDomain.Spec.Region, failureDomain.Spec.Zone} {
+		if !ptr.Deref(fd.AutoConfigure, false) {
+			continue
+		}
+		autoConfigure = true
+		switch fd.Type {
+		case infrav1.DatacenterFailureDomain:
+			datacenterPrivileges = append(datacenterPrivileges, attachTagPrivilege)
+		case infrav1.ComputeClusterFailureDomain:
+			computeClusterPrivileges = append(computeClusterPrivileges, attachTagPrivilege)
+		}
+	}
+	if autoConfigure {
+		c.addRootFolder(tagCategoryPrivileges...)
+	}
+	if topology.Hosts != nil {
+		computeClusterPrivileges = append(computeClusterPrivileges, editClusterPrivilege)
+	}
+
+	if len(datacenterPrivileges) > 0 {
+		datacenter, err := finder.DatacenterOrDefault(ctx, topology.Datacenter)
+		if err != nil {
+			c.errs = append(c.errs, errors.Wrapf(err, "unable to find datacenter %q", topology.Datacenter))
+		} else {
+			c.add(DatacenterKind, datacenter.InventoryPath, datacenter.Reference(), datacenterPrivileges...)
+		}
+	}
+	if topology.ComputeCluster != nil && len(computeClusterPrivileges) > 0 {
+		computeCluster, err := finder.ClusterComputeResource(ctx, *topology.ComputeCluster)
+		if err != nil {
+			c.errs = append(c.errs, errors.Wrapf(err, "unable to find compute cluster %q", *topology.ComputeCluster))
+		} else {
+			c.add(ComputeClusterKind, computeCluster.InventoryPath, computeCluster.Reference(), computeClusterPrivileges...)
+		}
+	}
+
+	c.addDatastore(ctx, finder, topology.Datacenter, topology.Datastore, topology.DatastoreCluster)
+	for _, network := range topology.Networks {
+		c.addNetwork(ctx, finder, topology.Datacenter, network)
+	}
+}
+
+// Check returns the privileges missing on the objects. It also returns an
+// error if some of the objects could not be found, in which case the missing
+// privileges are the ones of the objects found.
+func (c *Checker) Check(ctx context.Context) ([]Missing, error) {
+	if len(c.refs) == 0 {
+		return nil, kerrors.NewAggregate(c.errs)
+	}
+
+	userSession, err := c.session.SessionManager.UserSession(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get user session")
+	}
+	if userSession == nil {
+		return nil, errors.New("unable to get user session: not authenticated")
+	}
+
+	authorizationManager := object.NewAuthorizationManager(c.session.Client.Client)
+	results, err := authorizationManager.FetchUserPrivilegeOnEntities(ctx, c.refs, userSession.UserName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch privileges of user %s", userSession.UserName)
+	}
+	granted := map[types.ManagedObjectReference]sets.Set[string]{}
+	for _, result := range results {
+		granted[result.Entity] = sets.New[string](result.Privileges...)
+	}
+
+	var missing []Missing
+	for _, ref := range c.refs {
+		e := c.entities[ref]
+		if privileges := e.privileges.Difference(granted[ref]); privileges.Len() > 0 {
+			missing = append(missing, Missing{Kind: e.kind, Name: e.name, Privileges: sets.List(privileges)})
+		}
+	}
+	return missing, kerrors.NewAggregate(c.errs)
+}
+
+// finder returns a finder of the datacenter.
+func (c *Checker) finder(ctx context.Context, datacenter string) (*find.Finder, error) {
+	if finder, ok := c.finders[datacenter]; ok {
+		return finder, nil
+	}
+	finder := find.NewFinder(c.session.Client.Client, false)
+	dc, err := finder.DatacenterOrDefault(ctx, datacenter)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find datacenter %q", datacenter)
+	}
+	finder.SetDatacenter(dc)
+	c.finders[datacenter] = finder
+	return finder, nil
+}
+
+// add adds the privileges needed on the object.
+func (c *Checker) add(kind Kind, name string, ref types.ManagedObjectReference, privileges ...string) {
+	e, ok := c.entities[ref]
+	if !ok {
+		e = &entity{kind: kind, name: name, privileges: sets.New[string]()}
+		c.entities[ref] = e
+		c.refs = append(c.refs, ref)
+	}
+	e.privileges.Insert(privileges...)
+}
+
+func (c *Checker) addRootFolder(privileges ...string) {
+	c.add(RootFolderKind, "/", c.session.Client.ServiceContent.RootFolder, privileges...)
+}
+
+// lookup returns the object of the datacenter looked up by find, or false if
+// it cannot be found, in which case the error is reported once by Check.
+func (c *Checker) lookup(datacenter string, kind Kind, name string, find func() (string, types.ManagedObjectReference, error)) (*foundObject, bool) {
+	key := fmt.Sprintf("%s/%s/%s", datacenter, kind, name)
+	if found, ok := c.found[key]; ok {
+		return found, found.ok
+	}
+
+	found := &foundObject{}
+	var err error
+	if found.name, found.ref, err = find(); err != nil {
+		c.errs = append(c.errs, err)
+	} else {
+		found.ok = true
+	}
+	c.found[key] = found
+	return found, found.ok
+}
+
+func (c *Checker) addTemplate(ctx context.Context, finder *find.Finder, datacenter, name string, instantClone bool) {
+	// The privilege needed depends on whether the template is a VM, so it is
+	// looked up as part of the template.
+	var privilege string
+	template, ok := c.lookup(datacenter, TemplateKind, fmt.Sprintf("%s/%t", name, instantClone), func() (string, types.ManagedObjectReference, error) {
+		vm, err := finder.VirtualMachine(ctx, name)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find template %q", name)
+		}
+
+		privilege = cloneVMPrivilege
+		if !instantClone {
+			var o mo.VirtualMachine
+			if err := vm.Properties(ctx, vm.Reference(), []string{"config.template"}, &o); err != nil {
+				return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get properties of template %q", name)
+			}
+			if o.Config != nil && o.Config.Template {
+				privilege = cloneTemplatePrivilege
+			}
+		}
+		return vm.InventoryPath, vm.Reference(), nil
+	})
+	// The privilege was already added if the template was looked up before.
+	if ok && privilege != "" {
+		c.add(TemplateKind, template.name, template.ref, privilege)
+	}
+}
+
+// addContentLibraryItem adds the VM template backing the Content Library item
+// if it is of the vm-template type. The items of the ovf type have no
+// template in the inventory.
+func (c *Checker) addContentLibraryItem(ctx context.Context, itemSpec infrav1.ContentLibraryItemSpec) {
+	key := itemSpec.ID
+	if key == "" {
+		key = path.Join(itemSpec.Library, itemSpec.Name)
+	}
+	found, ok := c.lookup("", TemplateKind, "item/"+key, func() (string, types.ManagedObjectReference, error) {
+		item, err := template.FindContentLibraryItem(ctx, c.session, itemSpec)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, err
+		}
+		if item.Type != template.ContentLibraryItemTypeVMTemplate {
+			return "", types.ManagedObjectReference{}, nil
+		}
+
+		// The tags manager wraps the authenticated REST client of the session.
+		info, err := vapivcenter.NewManager(c.session.TagManager.Client).GetLibraryTemplateInfo(ctx, item.ID)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get template of Content Library item %q", item.Name)
+		}
+		if info.VmTemplate == "" {
+			return "", types.ManagedObjectReference{}, nil
+		}
+		ref := types.ManagedObjectReference{Type: "VirtualMachine", Value: info.VmTemplate}
+		name, err := find.InventoryPath(ctx, c.session.Client.Client, ref)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get inventory path of template of Content Library item %q", item.Name)
+		}
+		return name, ref, nil
+	})
+	if ok && found.ref.Value != "" {
+		c.add(TemplateKind, found.name, found.ref, cloneTemplatePrivilege)
+	}
+}
+
+func (c *Checker) addDatastore(ctx context.Context, finder *find.Finder, datacenter, datastore, datastoreCluster string) {
+	var found *foundObject
+	var ok bool
+	switch {
+	case datastore != "":
+		found, ok = c.lookup(datacenter, DatastoreKind, datastore, func() (string, types.ManagedObjectReference, error) {
+			ds, err := finder.Datastore(ctx, datastore)
+			if err != nil {
+				return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find datastore %q", datastore)
+			}
+			return ds.InventoryPath, ds.Reference(), nil
+		})
+	case datastoreCluster != "":
+		found, ok = c.lookup(datacenter, DatastoreKind, "cluster/"+datastoreCluster, func() (string, types.ManagedObjectReference, error) {
+			pod, err := finder.DatastoreCluster(ctx, datastoreCluster)
+			if err != nil {
+				return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find datastore cluster %q", datastoreCluster)
+			}
+			return pod.InventoryPath, pod.Reference(), nil
+		})
+	}
+	if ok {
+		c.add(DatastoreKind, found.name, found.ref, "Datastore.AllocateSpace")
+	}
+}
+
+func (c *Checker) addNetwork(ctx context.Context, finder *find.Finder, datacenter, name string) {
+	if network, ok := c.lookup(datacenter, NetworkKind, name, func() (string, types.ManagedObjectReference, error) {
+		network, err := finder.Network(ctx, name)
+		if err != nil {
+			return "", types.ManagedObjectReference{}, errors.Wrapf(err, "unable to find network %q", name)
+		}
+		return network.GetInventoryPath(), network.Reference(), nil
+	}); ok {
+		c.add(NetworkKind, network.name, network.ref, "Network.Assign")
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package privileges
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/library"
+	_ "github.com/vmware/govmomi/vapi/simulator" // run init func to register the tagging API endpoints.
+	"k8s.io/utils/ptr"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+func initSimulator(t *testing.T) (*simulator.Model, *session.Session, *simulator.Server) {
+	t.Helper()
+
+	model := simulator.VPX()
+	model.Host = 0
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+
+	server := model.Service.NewServer()
+	pass, _ := server.URL.User.Password()
+
+	authSession, err := session.GetOrCreate(
+		context.TODO(),
+		session.NewParams().
+			WithServer(server.URL.Host).
+			WithUserInfo(server.URL.User.Username(), pass))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return model, authSession, server
+}
+
+// removeAdminPrivileges removes privileges from the Admin role, whose
+// privileges are the ones of the user on all the objects of the simulator.
+func removeAdminPrivileges(ctx context.Context, t *testing.T, s *session.Session, privileges ...string) {
+	t.Helper()
+
+	authorizationManager := object.NewAuthorizationManager(s.Client.Client)
+	roles, err := authorizationManager.RoleList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := roles.ByName("Admin")
+	var ids []string
+	for _, id := range admin.Privilege {
+		if !contains(privileges, id) {
+			ids = append(ids, id)
+		}
+	}
+	if err := authorizationManager.UpdateRole(ctx, admin.RoleId, admin.Name, ids); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestChecker(t *testing.T) {
+	model, s, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+
+	vm := &infrav1.VSphereVM{
+		Spec: infrav1.VSphereVMSpec{
+			VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+				Template:  "DC0_C0_RP0_VM0",
+				Datastore: "LocalDS_0",
+				Network:   infrav1.NetworkSpec{Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "VM Network"}}},
+			},
+			SnapshotPolicy: &infrav1.VSphereVMSnapshotPolicy{},
+		},
+	}
+	failureDomain := &infrav1.VSphereFailureDomain{
+		Spec: infrav1.VSphereFailureDomainSpec{
+			Region: infrav1.FailureDomain{Name: "region", Type: infrav1.DatacenterFailureDomain, TagCategory: "k8s-region"},
+			Zone:   infrav1.FailureDomain{Name: "zone", Type: infrav1.ComputeClusterFailureDomain, TagCategory: "k8s-zone"},
+			Topology: infrav1.Topology{
+				Datacenter:     "DC0",
+				ComputeCluster: ptr.To("DC0_C0"),
+				Hosts:          &infrav1.FailureDomainHosts{VMGroupName: "vm-group", HostGroupName: "host-group"},
+			},
+		},
+	}
+
+	t.Run("reports no missing privileges when all of them are granted", func(t *testing.T) {
+		g := NewWithT(t)
+		checker := NewChecker(s)
+		checker.AddVM(ctx, vm)
+		checker.AddFailureDomain(ctx, failureDomain)
+
+		missing, err := checker.Check(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(missing).To(BeEmpty())
+	})
+
+	t.Run("reports the privileges missing on each object", func(t *testing.T) {
+		g := NewWithT(t)
+		removeAdminPrivileges(ctx, t, s,
+			"VirtualMachine.Provisioning.Clone",
+			"VirtualMachine.State.CreateSnapshot",
+			"Network.Assign",
+			"Host.Inventory.EditCluster",
+		)
+
+		// The Admin role of the simulator has no tagging privileges.
+		autoConfigured := failureDomain.DeepCopy()
+		autoConfigured.Spec.Region.AutoConfigure = ptr.To(true)
+
+		checker := NewChecker(s)
+		checker.AddVM(ctx, vm)
+		checker.AddFailureDomain(ctx, autoConfigured)
+
+		missing, err := checker.Check(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(missing).To(Equal([]Missing{
+			{Kind: TemplateKind, Name: "/DC0/vm/DC0_C0_RP0_VM0", Privileges: []string{"VirtualMachine.Provisioning.Clone"}},
+			{Kind: FolderKind, Name: "/DC0/vm", Privileges: []string{"VirtualMachine.State.CreateSnapshot"}},
+			{Kind: NetworkKind, Name: "/DC0/network/VM Network", Privileges: []string{"Network.Assign"}},
+			{Kind: RootFolderKind, Name: "/", Privileges: []string{"InventoryService.Tagging.CreateCategory", "InventoryService.Tagging.CreateTag"}},
+			{Kind: DatacenterKind, Name: "/DC0", Privileges: []string{"InventoryService.Tagging.AttachTag"}},
+			{Kind: ComputeClusterKind, Name: "/DC0/host/DC0_C0", Privileges: []string{"Host.Inventory.EditCluster"}},
+		}))
+		g.Expect(Message(missing[:2])).To(Equal(`missing privileges on template "/DC0/vm/DC0_C0_RP0_VM0": VirtualMachine.Provisioning.Clone; ` +
+			`folder "/DC0/vm": VirtualMachine.State.CreateSnapshot`))
+	})
+
+	t.Run("reports the objects which cannot be found", func(t *testing.T) {
+		g := NewWithT(t)
+		checker := NewChecker(s)
+		checker.AddVM(ctx, &infrav1.VSphereVM{
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					Datastore: "missing-ds",
+					Network:   infrav1.NetworkSpec{Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "VM Network"}}},
+				},
+			},
+		})
+
+		missing, err := checker.Check(ctx)
+		g.Expect(err).To(MatchError(ContainSubstring(`unable to find datastore "missing-ds"`)))
+		g.Expect(missing).To(Equal([]Missing{
+			{Kind: NetworkKind, Name: "/DC0/network/VM Network", Privileges: []string{"Network.Assign"}},
+		}))
+	})
+
+	t.Run("reports the privileges needed to cache the Content Library items", func(t *testing.T) {
+		g := NewWithT(t)
+		datastore, err := object.NewSearchIndex(s.Client.Client).FindByInventoryPath(ctx, "/DC0/datastore/LocalDS_0")
+		g.Expect(err).ToNot(HaveOccurred())
+		manager := library.NewManager(s.TagManager.Client)
+		libraryID, err := manager.CreateLibrary(ctx, library.Library{
+			Name:    "golden-images",
+			Type:    "LOCAL",
+			Storage: []library.StorageBackings{{DatastoreID: datastore.Reference().Value, Type: "DATASTORE"}},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		_, err = manager.CreateLibraryItem(ctx, library.Item{Name: "ubuntu", Type: template.ContentLibraryItemTypeOVF, LibraryID: libraryID})
+		g.Expect(err).ToNot(HaveOccurred())
+		removeAdminPrivileges(ctx, t, s, "VirtualMachine.Provisioning.MarkAsTemplate")
+
+		checker := NewChecker(s)
+		checker.AddVM(ctx, &infrav1.VSphereVM{
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					ContentLibraryItem: &infrav1.ContentLibraryItemSpec{Library: "golden-images", Name: "ubuntu", CacheTemplate: true},
+					Datastore:          "LocalDS_0",
+				},
+			},
+		})
+
+		missing, err := checker.Check(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(missing).To(Equal([]Missing{
+			{Kind: FolderKind, Name: "/DC0/vm", Privileges: []string{"VirtualMachine.Provisioning.MarkAsTemplate", "VirtualMachine.State.CreateSnapshot"}},
+		}))
+	})
+}
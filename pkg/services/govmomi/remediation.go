@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+)
+
+// RemediateVM takes a step of the remediation of the Machine of a VM. It
+// returns false if the step cannot be taken on the VM, e.g. a guest reboot
+// without VMware Tools.
+//
+// The vCenter task of the step is set as the TaskRef of the VSphereVM, which
+// is reconciled once the task completes, and must be patched by the caller.
+//
+// The VM is not powered on again by a power cycle, which is left to the
+// reconcile of its VSphereVM.
+func (vms *VMService) RemediateVM(ctx context.Context, vmCtx *capvcontext.VMContext, step infrav1.RemediationStep) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vmRef, err := findVM(ctx, vmCtx)
+	if err != nil {
+		// A VM which does not exist cannot be remediated, but its Machine
+		// can still be deleted.
+		if isNotFound(err) || isFolderNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// A step is not taken while another task runs on the VM, e.g. the power on
+	// of a previous power cycle.
+	if task := getTask(ctx, vmCtx); task != nil {
+		if task.Info.State == types.TaskInfoStateQueued || task.Info.State == types.TaskInfoStateRunning {
+			return false, errors.Errorf("task %s is still running on vm %s", task.Reference().Value, vmCtx.VSphereVM.Name)
+		}
+	}
+
+	virtualMachineCtx := &virtualMachineContext{
+		VMContext: *vmCtx,
+		Obj:       object.NewVirtualMachine(vmCtx.Session.Client.Client, vmRef),
+		Ref:       vmRef,
+	}
+
+	powerState, err := vms.getPowerState(ctx, virtualMachineCtx)
+	if err != nil {
+		return false, err
+	}
+
+	switch step {
+	case infrav1.RemediationStepGuestReboot:
+		if powerState != infrav1.VirtualMachinePowerStatePoweredOn {
+			return false, nil
+		}
+		vmwareToolsRunning, err := virtualMachineCtx.Obj.IsToolsRunning(ctx)
+		if err != nil {
+			return false, err
+		}
+		if !vmwareToolsRunning {
+			log.Info("Unable to reboot the guest of VM because VMware Tools is not running")
+			return false, nil
+		}
+		guestStateChangeSupported, err := isGuestStateChangeSupported(ctx, virtualMachineCtx)
+		if err != nil {
+			return false, err
+		}
+		if !guestStateChangeSupported {
+			log.Info("Unable to reboot the guest of VM because guest state change is not supported")
+			return false, nil
+		}
+		log.Info("Rebooting the guest of VM")
+		if err := virtualMachineCtx.Obj.RebootGuest(ctx); err != nil {
+			return false, errors.Wrapf(err, "failed to reboot the guest of vm %s", vmCtx.VSphereVM.Name)
+		}
+		return true, nil
+
+	case infrav1.RemediationStepHardReset:
+		if powerState != infrav1.VirtualMachinePowerStatePoweredOn {
+			return false, nil
+		}
+		log.Info("Resetting VM")
+		task, err := virtualMachineCtx.Obj.Reset(ctx)
+		if err != nil {
+			metrics.RecordFailure(metrics.OperationReset, err)
+			return false, errors.Wrapf(err, "failed to reset vm %s", vmCtx.VSphereVM.Name)
+		}
+		setRemediationTaskRef(ctx, vmCtx, vmRef, task)
+		return true, nil
+
+	case infrav1.RemediationStepPowerCycle:
+		if powerState != infrav1.VirtualMachinePowerStatePoweredOn {
+			// The VM is already powered off, and is powered on by the
+			// reconcile of its VSphereVM.
+			return true, nil
+		}
+		log.Info("Powering off VM")
+		task, err := virtualMachineCtx.Obj.PowerOff(ctx)
+		if err != nil {
+			metrics.RecordFailure(metrics.OperationPowerOff, err)
+			return false, errors.Wrapf(err, "failed to power off vm %s", vmCtx.VSphereVM.Name)
+		}
+		setRemediationTaskRef(ctx, vmCtx, vmRef, task)
+		return true, nil
+
+	default:
+		return false, errors.Errorf("unsupported remediation step %q for vm %s", step, vmCtx.VSphereVM.Name)
+	}
+}
+
+// setRemediationTaskRef sets the task of a remediation step as the TaskRef of
+// the VSphereVM, and watches it so that the VSphereVM is reconciled once the
+// task completes.
+func setRemediationTaskRef(ctx context.Context, vmCtx *capvcontext.VMContext, vmRef types.ManagedObjectReference, task *object.Task) {
+	vmCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+	if vmCtx.ControllerManagerContext != nil {
+		watchVSphereVM(ctx, vmCtx, vmRef)
+	}
+}
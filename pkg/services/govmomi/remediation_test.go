@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+func TestRemediateVM(t *testing.T) {
+	g := NewWithT(t)
+
+	// The model is created without TLS, which is required by getAuthSession.
+	model := simulator.VPX()
+	g.Expect(model.Create()).To(Succeed())
+
+	g.Expect(model.Run(func(ctx context.Context, c *vim25.Client) error {
+		authSession, err := getAuthSession(ctx, c.URL().Host)
+		g.Expect(err).ToNot(HaveOccurred())
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		var o mo.VirtualMachine
+		g.Expect(vm.Properties(ctx, vm.Reference(), []string{"config.uuid"}, &o)).To(Succeed())
+
+		vmCtx := &capvcontext.VMContext{
+			Session: authSession,
+			VSphereVM: &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "vsphereVM1",
+					Namespace: "my-namespace",
+				},
+				Spec: infrav1.VSphereVMSpec{
+					BiosUUID: o.Config.Uuid,
+				},
+			},
+		}
+		powerState := func() types.VirtualMachinePowerState {
+			state, err := vm.PowerState(ctx)
+			g.Expect(err).ToNot(HaveOccurred())
+			return state
+		}
+		// The task of a step is set as the TaskRef of the VSphereVM.
+		waitForTask := func() {
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+			task := object.NewTask(c, types.ManagedObjectReference{Type: morefTypeTask, Value: vmCtx.VSphereVM.Status.TaskRef})
+			g.Expect(task.Wait(ctx)).To(Succeed())
+			vmCtx.VSphereVM.Status.TaskRef = ""
+		}
+		vms := &VMService{}
+
+		// The guest cannot be rebooted without VMware Tools.
+		ok, err := vms.RemediateVM(ctx, vmCtx, infrav1.RemediationStepGuestReboot)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+
+		ok, err = vms.RemediateVM(ctx, vmCtx, infrav1.RemediationStepHardReset)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		waitForTask()
+		g.Expect(powerState()).To(Equal(types.VirtualMachinePowerStatePoweredOn))
+
+		// The VM is powered off by a power cycle, and is left to be powered
+		// on by the reconcile of its VSphereVM.
+		ok, err = vms.RemediateVM(ctx, vmCtx, infrav1.RemediationStepPowerCycle)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		waitForTask()
+		g.Expect(powerState()).To(Equal(types.VirtualMachinePowerStatePoweredOff))
+
+		// A powered off VM cannot be reset.
+		ok, err = vms.RemediateVM(ctx, vmCtx, infrav1.RemediationStepHardReset)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+
+		// A VM which does not exist cannot be remediated.
+		vmCtx.VSphereVM.Spec.BiosUUID = "00000000-0000-0000-0000-000000000000"
+		ok, err = vms.RemediateVM(ctx, vmCtx, infrav1.RemediationStepPowerCycle)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+		return nil
+	})).To(Succeed())
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+)
+
+// reconcileResize applies changes to the number of CPUs, the memory and the
+// size of the primary disk of a VSphereVM with the InPlace resize policy to
+// its VM. The changes are applied to the running VM if it allows hot-adding
+// them, otherwise the VM is powered off first and reconcilePowerState powers
+// it back on once it is reconfigured. The disk of a VM with snapshots is not
+// grown until the snapshots are removed.
+// It also reverts the drift of the number of CPUs and the memory of the VM of
+// a VSphereVM with the Correct drift policy.
+func (vms *VMService) reconcileResize(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereVM := virtualMachineCtx.VSphereVM
+	correctsDrift := vsphereVM.Spec.DriftPolicy == infrav1.DriftPolicyCorrect && detectsResourceDrift(vsphereVM)
+	if vsphereVM.Spec.ResizePolicy != infrav1.ResizePolicyInPlace && !correctsDrift {
+		return true, nil
+	}
+
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"config.hardware", "config.cpuHotAddEnabled", "config.memoryHotAddEnabled", "runtime.powerState", "snapshot"}, &o); err != nil {
+		return false, errors.Wrapf(err, "error getting hardware information from VM %s", vsphereVM.Name)
+	}
+
+	configSpec, hot, diskDeferred, err := getResizeConfigSpec(vsphereVM, o)
+	if err != nil {
+		// The VM keeps running with its current resources until the spec is fixed.
+		conditions.MarkFalse(vsphereVM, infrav1.ResizedCondition, infrav1.ResizeFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return true, nil
+	}
+	if configSpec == nil {
+		if diskDeferred {
+			conditions.MarkFalse(vsphereVM, infrav1.ResizedCondition, infrav1.WaitingForSnapshotsRemovalReason, clusterv1.ConditionSeverityInfo,
+				"disk cannot be grown while the VM has snapshots")
+			return true, nil
+		}
+		if conditions.Has(vsphereVM, infrav1.ResizedCondition) {
+			conditions.MarkTrue(vsphereVM, infrav1.ResizedCondition)
+		}
+		return true, nil
+	}
+
+	if o.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn && !hot {
+		conditions.MarkFalse(vsphereVM, infrav1.ResizedCondition, infrav1.WaitingForPowerCycleReason, clusterv1.ConditionSeverityInfo,
+			"VM must be powered off to apply the resize")
+
+		softPowerOffPending, err := vms.triggerSoftPowerOff(ctx, virtualMachineCtx)
+		if err != nil || softPowerOffPending {
+			return false, err
+		}
+
+		log.Info("Powering off VM to apply the resize")
+		task, err := virtualMachineCtx.Obj.PowerOff(ctx)
+		if err != nil {
+			metrics.RecordFailure(metrics.OperationPowerOff, err)
+			return false, errors.Wrapf(err, "failed to trigger power off op for vm %s", ctx)
+		}
+		virtualMachineCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+		return false, nil
+	}
+
+	// The guest was shut down for the resize, not for the deletion of the VM.
+	conditions.Delete(vsphereVM, infrav1.GuestSoftPowerOffSucceededCondition)
+
+	log.Info("Resizing VM", "numCPUs", configSpec.NumCPUs, "memoryMiB", configSpec.MemoryMB, "hotAdd", hot)
+	task, err := virtualMachineCtx.Obj.Reconfigure(ctx, *configSpec)
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationReconfigure, err)
+		conditions.MarkFalse(vsphereVM, infrav1.ResizedCondition, infrav1.ResizeFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return false, errors.Wrapf(err, "error trigging reconfigure op for vm %s", ctx)
+	}
+	conditions.MarkFalse(vsphereVM, infrav1.ResizedCondition, infrav1.ResizingReason, clusterv1.ConditionSeverityInfo, "")
+	virtualMachineCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+	return false, nil
+}
+
+// getResizeConfigSpec returns the config spec which resizes the VM to the
+// resources of the VSphereVM, or nil if the VM already has these resources.
+// It also returns whether the config spec can be applied to the running VM,
+// and whether the disk is not grown because the VM has snapshots.
+func getResizeConfigSpec(vsphereVM *infrav1.VSphereVM, vm mo.VirtualMachine) (*types.VirtualMachineConfigSpec, bool, bool, error) {
+	if vm.Config == nil {
+		return nil, false, false, errors.Errorf("unable to get the configuration of VM %s", vsphereVM.Name)
+	}
+	hardware := vm.Config.Hardware
+	numCPUs, numCoresPerSocket, memMiB := vcenter.VMResources(vsphereVM)
+
+	configSpec := &types.VirtualMachineConfigSpec{}
+	changed, hot, diskDeferred := false, true, false
+
+	if numCPUs != hardware.NumCPU {
+		changed = true
+		configSpec.NumCPUs = numCPUs
+		// CPUs can only be hot-added in multiples of the cores per socket.
+		if numCPUs < hardware.NumCPU || !ptr.Deref(vm.Config.CpuHotAddEnabled, false) ||
+			(hardware.NumCoresPerSocket > 0 && numCPUs%hardware.NumCoresPerSocket != 0) {
+			hot = false
+		}
+	}
+	// The cores per socket are only changed when they are set explicitly, or
+	// when they do not divide the number of CPUs anymore.
+	if (vsphereVM.Spec.NumCoresPerSocket != 0 && numCoresPerSocket != hardware.NumCoresPerSocket) ||
+		(hardware.NumCoresPerSocket > 0 && numCPUs%hardware.NumCoresPerSocket != 0) {
+		changed, hot = true, false
+		configSpec.NumCoresPerSocket = numCoresPerSocket
+	}
+
+	if memMiB != int64(hardware.MemoryMB) {
+		changed = true
+		configSpec.MemoryMB = memMiB
+		if memMiB < int64(hardware.MemoryMB) || !ptr.Deref(vm.Config.MemoryHotAddEnabled, false) {
+			hot = false
+		}
+	}
+
+	// The disk of linked clones and instant clones is a delta disk of the
+	// disk of the source VM, which is not resized.
+	if vsphereVM.Spec.ResizePolicy == infrav1.ResizePolicyInPlace && vsphereVM.Spec.DiskGiB > 0 && vsphereVM.Status.CloneMode == infrav1.FullClone {
+		disks := object.VirtualDeviceList(hardware.Device).SelectByType((*types.VirtualDisk)(nil))
+		if len(disks) == 0 {
+			return nil, false, false, errors.Errorf("Invalid disk count: %d", len(disks))
+		}
+		primaryDisk := disks[0].(*types.VirtualDisk)
+		capacityKB := int64(vsphereVM.Spec.DiskGiB) * 1024 * 1024
+		switch {
+		case capacityKB < primaryDisk.CapacityInKB:
+			return nil, false, false, errors.Errorf("can't resize disk down, current capacity is larger: %dKiB > %dKiB", primaryDisk.CapacityInKB, capacityKB)
+		case capacityKB > primaryDisk.CapacityInKB && vm.Snapshot != nil && len(vm.Snapshot.RootSnapshotList) > 0:
+			diskDeferred = true
+		case capacityKB > primaryDisk.CapacityInKB:
+			changed = true
+			primaryDisk.CapacityInKB = capacityKB
+			primaryDisk.CapacityInBytes = 0
+			configSpec.DeviceChange = append(configSpec.DeviceChange, &types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationEdit,
+				Device:    primaryDisk,
+			})
+		}
+	}
+
+	if !changed {
+		return nil, false, diskDeferred, nil
+	}
+	return configSpec, hot, diskDeferred, nil
+}
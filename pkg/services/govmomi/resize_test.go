@@ -0,0 +1,295 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func Test_getResizeConfigSpec(t *testing.T) {
+	newVM := func(numCPUs, numCoresPerSocket, memoryMB int32, diskGiB int64, cpuHotAdd, memoryHotAdd bool) mo.VirtualMachine {
+		return mo.VirtualMachine{
+			Config: &types.VirtualMachineConfigInfo{
+				CpuHotAddEnabled:    ptr.To(cpuHotAdd),
+				MemoryHotAddEnabled: ptr.To(memoryHotAdd),
+				Hardware: types.VirtualHardware{
+					NumCPU:            numCPUs,
+					NumCoresPerSocket: numCoresPerSocket,
+					MemoryMB:          memoryMB,
+					Device: []types.BaseVirtualDevice{
+						&types.VirtualDisk{CapacityInKB: diskGiB * 1024 * 1024},
+					},
+				},
+			},
+		}
+	}
+	newVSphereVM := func(numCPUs int32, memoryMiB int64, diskGiB int32, cloneMode infrav1.CloneMode) *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					ResizePolicy: infrav1.ResizePolicyInPlace,
+					NumCPUs:      numCPUs,
+					MemoryMiB:    memoryMiB,
+					DiskGiB:      diskGiB,
+				},
+			},
+			Status: infrav1.VSphereVMStatus{
+				CloneMode: cloneMode,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		vsphereVM          *infrav1.VSphereVM
+		vm                 mo.VirtualMachine
+		expectSpec         bool
+		expectHot          bool
+		expectDiskDeferred bool
+		expectError        string
+	}{
+		{
+			name:      "no change",
+			vsphereVM: newVSphereVM(4, 8192, 40, infrav1.FullClone),
+			vm:        newVM(4, 4, 8192, 40, false, false),
+		},
+		{
+			name:       "CPU and memory are hot-added",
+			vsphereVM:  newVSphereVM(4, 8192, 20, infrav1.FullClone),
+			vm:         newVM(2, 2, 4096, 20, true, true),
+			expectSpec: true,
+			expectHot:  true,
+		},
+		{
+			name:       "CPU is added without hot-add",
+			vsphereVM:  newVSphereVM(4, 4096, 20, infrav1.FullClone),
+			vm:         newVM(2, 2, 4096, 20, false, true),
+			expectSpec: true,
+			expectHot:  false,
+		},
+		{
+			name:       "CPU is added which is not a multiple of the cores per socket",
+			vsphereVM:  newVSphereVM(6, 4096, 20, infrav1.FullClone),
+			vm:         newVM(4, 4, 4096, 20, true, true),
+			expectSpec: true,
+			expectHot:  false,
+		},
+		{
+			name:       "memory is removed",
+			vsphereVM:  newVSphereVM(2, 2048, 20, infrav1.FullClone),
+			vm:         newVM(2, 2, 4096, 20, true, true),
+			expectSpec: true,
+			expectHot:  false,
+		},
+		{
+			name:       "disk is grown on the running VM",
+			vsphereVM:  newVSphereVM(2, 4096, 40, infrav1.FullClone),
+			vm:         newVM(2, 2, 4096, 20, false, false),
+			expectSpec: true,
+			expectHot:  true,
+		},
+		{
+			name:      "disk is not grown while the VM has snapshots",
+			vsphereVM: newVSphereVM(2, 4096, 40, infrav1.FullClone),
+			vm: func() mo.VirtualMachine {
+				vm := newVM(2, 2, 4096, 20, false, false)
+				vm.Snapshot = &types.VirtualMachineSnapshotInfo{RootSnapshotList: []types.VirtualMachineSnapshotTree{{Name: "capv-pre-hardwareupgrade-vmx-19"}}}
+				return vm
+			}(),
+			expectDiskDeferred: true,
+		},
+		{
+			name:      "disk of a linked clone is not resized",
+			vsphereVM: newVSphereVM(2, 4096, 40, infrav1.LinkedClone),
+			vm:        newVM(2, 2, 4096, 20, false, false),
+		},
+		{
+			name:        "disk cannot be shrunk",
+			vsphereVM:   newVSphereVM(2, 4096, 20, infrav1.FullClone),
+			vm:          newVM(2, 2, 4096, 40, false, false),
+			expectError: "can't resize disk down",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			configSpec, hot, diskDeferred, err := getResizeConfigSpec(tc.vsphereVM, tc.vm)
+			if tc.expectError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectError)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(diskDeferred).To(Equal(tc.expectDiskDeferred))
+			if !tc.expectSpec {
+				g.Expect(configSpec).To(BeNil())
+				return
+			}
+			g.Expect(configSpec).ToNot(BeNil())
+			g.Expect(hot).To(Equal(tc.expectHot))
+		})
+	}
+}
+
+func Test_reconcileResize(t *testing.T) {
+	newVSphereVM := func() *infrav1.VSphereVM {
+		return &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "vsphereVM1",
+				Namespace: "my-namespace",
+			},
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					ResizePolicy: infrav1.ResizePolicyInPlace,
+					NumCPUs:      4,
+					MemoryMiB:    4096,
+				},
+				PowerOffMode: infrav1.VirtualMachinePowerOpModeHard,
+			},
+		}
+	}
+
+	t.Run("when the VM is powered off it is reconfigured", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+			g.Expect(err).ToNot(HaveOccurred())
+			task, err := vm.PowerOff(ctx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(task.Wait(ctx)).To(Succeed())
+
+			vmCtx := emptyVirtualMachineContext()
+			vmCtx.Obj = vm
+			vmCtx.VSphereVM = newVSphereVM()
+
+			vms := &VMService{}
+			ok, err := vms.reconcileResize(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+			g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.ResizedCondition)).To(Equal(infrav1.ResizingReason))
+			reconfigureTask := object.NewTask(c, types.ManagedObjectReference{Type: "Task", Value: vmCtx.VSphereVM.Status.TaskRef})
+			g.Expect(reconfigureTask.Wait(ctx)).To(Succeed())
+
+			var o mo.VirtualMachine
+			g.Expect(vm.Properties(ctx, vm.Reference(), []string{"config.hardware"}, &o)).To(Succeed())
+			g.Expect(o.Config.Hardware.NumCPU).To(Equal(int32(4)))
+			g.Expect(o.Config.Hardware.MemoryMB).To(Equal(int32(4096)))
+
+			// Once the VM is resized, the condition reports it.
+			ok, err = vms.reconcileResize(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(conditions.IsTrue(vmCtx.VSphereVM, infrav1.ResizedCondition)).To(BeTrue())
+			return nil
+		})
+	})
+
+	t.Run("when the VM is powered on without hot-add it is powered off", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			vmCtx := emptyVirtualMachineContext()
+			vmCtx.Obj = vm
+			vmCtx.VSphereVM = newVSphereVM()
+
+			vms := &VMService{}
+			ok, err := vms.reconcileResize(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+			g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.ResizedCondition)).To(Equal(infrav1.WaitingForPowerCycleReason))
+			return nil
+		})
+	})
+
+	t.Run("when the VM has snapshots only its CPU and memory are resized", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+			g.Expect(err).ToNot(HaveOccurred())
+			task, err := vm.PowerOff(ctx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(task.Wait(ctx)).To(Succeed())
+			task, err = vm.CreateSnapshot(ctx, "capv-pre-hardwareupgrade-vmx-19", "", false, false)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(task.Wait(ctx)).To(Succeed())
+
+			vmCtx := emptyVirtualMachineContext()
+			vmCtx.Obj = vm
+			vmCtx.VSphereVM = newVSphereVM()
+			vmCtx.VSphereVM.Spec.DiskGiB = 100
+			vmCtx.VSphereVM.Status.CloneMode = infrav1.FullClone
+
+			vms := &VMService{}
+			ok, err := vms.reconcileResize(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			reconfigureTask := object.NewTask(c, types.ManagedObjectReference{Type: "Task", Value: vmCtx.VSphereVM.Status.TaskRef})
+			g.Expect(reconfigureTask.Wait(ctx)).To(Succeed())
+
+			var o mo.VirtualMachine
+			g.Expect(vm.Properties(ctx, vm.Reference(), []string{"config.hardware"}, &o)).To(Succeed())
+			g.Expect(o.Config.Hardware.NumCPU).To(Equal(int32(4)))
+			disks := object.VirtualDeviceList(o.Config.Hardware.Device).SelectByType((*types.VirtualDisk)(nil))
+			g.Expect(disks[0].(*types.VirtualDisk).CapacityInKB).To(BeNumerically("<", int64(100)*1024*1024))
+
+			// The disk is not grown until the snapshots are removed.
+			vmCtx.VSphereVM.Status.TaskRef = ""
+			ok, err = vms.reconcileResize(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).To(BeEmpty())
+			g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.ResizedCondition)).To(Equal(infrav1.WaitingForSnapshotsRemovalReason))
+			return nil
+		})
+	})
+
+	t.Run("when the resize policy is not InPlace nothing is done", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := emptyVirtualMachineContext()
+		vmCtx.VSphereVM = newVSphereVM()
+		vmCtx.VSphereVM.Spec.ResizePolicy = infrav1.ResizePolicyNone
+
+		vms := &VMService{}
+		ok, err := vms.reconcileResize(context.Background(), vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		g.Expect(conditions.Has(vmCtx.VSphereVM, infrav1.ResizedCondition)).To(BeFalse())
+	})
+}
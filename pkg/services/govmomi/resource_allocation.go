@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+)
+
+// reconcileResourceAllocation reverts the changes made in vSphere to the CPU
+// and memory allocation of the VM which are managed by the VSphereVM.
+func (vms *VMService) reconcileResourceAllocation(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereVM := virtualMachineCtx.VSphereVM
+	if vsphereVM.Spec.CPUAllocation == nil && vsphereVM.Spec.MemoryAllocation == nil {
+		return true, nil
+	}
+
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"config.cpuAllocation", "config.memoryAllocation"}, &o); err != nil {
+		return false, errors.Wrapf(err, "error getting resource allocation of VM %s", vsphereVM.Name)
+	}
+	if o.Config == nil {
+		return false, errors.Errorf("unable to get the configuration of VM %s", vsphereVM.Name)
+	}
+
+	configSpec := getResourceAllocationConfigSpec(vsphereVM, o.Config)
+	if configSpec == nil {
+		return true, nil
+	}
+
+	log.Info("Reconfiguring resource allocation of VM")
+	task, err := virtualMachineCtx.Obj.Reconfigure(ctx, *configSpec)
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationReconfigure, err)
+		return false, errors.Wrapf(err, "error trigging reconfigure op for vm %s", ctx)
+	}
+	virtualMachineCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+	return false, nil
+}
+
+// getResourceAllocationConfigSpec returns the config spec which applies the
+// resource allocation of the VSphereVM to its VM, or nil if the VM already
+// has this resource allocation.
+func getResourceAllocationConfigSpec(vsphereVM *infrav1.VSphereVM, config *types.VirtualMachineConfigInfo) *types.VirtualMachineConfigSpec {
+	cpuAllocation := vsphereVM.Spec.CPUAllocation
+	memoryAllocation := vsphereVM.Spec.MemoryAllocation
+	// The memory reservation of VMs with PCI devices is locked to their memory.
+	if memoryAllocation != nil && len(vsphereVM.Spec.PciDevices) > 0 {
+		memoryAllocation = memoryAllocation.DeepCopy()
+		memoryAllocation.Reservation = nil
+	}
+
+	cpuChanged := vcenter.ResourceAllocationChanged(cpuAllocation, config.CpuAllocation)
+	memoryChanged := vcenter.ResourceAllocationChanged(memoryAllocation, config.MemoryAllocation)
+	if !cpuChanged && !memoryChanged {
+		return nil
+	}
+
+	configSpec := &types.VirtualMachineConfigSpec{}
+	if cpuChanged {
+		configSpec.CpuAllocation = vcenter.ResourceAllocationInfo(cpuAllocation)
+	}
+	if memoryChanged {
+		configSpec.MemoryAllocation = vcenter.ResourceAllocationInfo(memoryAllocation)
+	}
+	return configSpec
+}
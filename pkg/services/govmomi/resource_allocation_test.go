@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func Test_getResourceAllocationConfigSpec(t *testing.T) {
+	config := &types.VirtualMachineConfigInfo{
+		CpuAllocation: &types.ResourceAllocationInfo{
+			Reservation: ptr.To[int64](1000),
+			Limit:       ptr.To[int64](-1),
+			Shares:      &types.SharesInfo{Level: types.SharesLevelNormal, Shares: 2000},
+		},
+		MemoryAllocation: &types.ResourceAllocationInfo{
+			Reservation: ptr.To[int64](4096),
+			Limit:       ptr.To[int64](-1),
+			Shares:      &types.SharesInfo{Level: types.SharesLevelCustom, Shares: 100},
+		},
+	}
+
+	testCases := []struct {
+		name             string
+		cpuAllocation    *infrav1.ResourceAllocation
+		memoryAllocation *infrav1.ResourceAllocation
+		pciDevices       []infrav1.PCIDeviceSpec
+		expectCPU        bool
+		expectMemory     bool
+	}{
+		{
+			name: "no allocation is managed",
+		},
+		{
+			name:             "the allocation matches",
+			cpuAllocation:    &infrav1.ResourceAllocation{Reservation: ptr.To[int64](1000), Shares: &infrav1.ResourceShares{Level: infrav1.SharesLevelNormal}},
+			memoryAllocation: &infrav1.ResourceAllocation{Limit: ptr.To[int64](-1), Shares: &infrav1.ResourceShares{Level: infrav1.SharesLevelCustom, Shares: 100}},
+		},
+		{
+			name:          "the CPU reservation drifted",
+			cpuAllocation: &infrav1.ResourceAllocation{Reservation: ptr.To[int64](2000)},
+			expectCPU:     true,
+		},
+		{
+			name:             "the custom memory shares drifted",
+			memoryAllocation: &infrav1.ResourceAllocation{Shares: &infrav1.ResourceShares{Level: infrav1.SharesLevelCustom, Shares: 200}},
+			expectMemory:     true,
+		},
+		{
+			name:             "the memory reservation of a VM with PCI devices is ignored",
+			memoryAllocation: &infrav1.ResourceAllocation{Reservation: ptr.To[int64](2048)},
+			pciDevices:       []infrav1.PCIDeviceSpec{{DeviceID: ptr.To[int32](1), VendorID: ptr.To[int32](1)}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			vsphereVM := &infrav1.VSphereVM{
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						CPUAllocation:    tc.cpuAllocation,
+						MemoryAllocation: tc.memoryAllocation,
+						PciDevices:       tc.pciDevices,
+					},
+				},
+			}
+			configSpec := getResourceAllocationConfigSpec(vsphereVM, config)
+			if !tc.expectCPU && !tc.expectMemory {
+				g.Expect(configSpec).To(BeNil())
+				return
+			}
+			g.Expect(configSpec).ToNot(BeNil())
+			g.Expect(configSpec.CpuAllocation != nil).To(Equal(tc.expectCPU))
+			g.Expect(configSpec.MemoryAllocation != nil).To(Equal(tc.expectMemory))
+		})
+	}
+}
+
+func Test_reconcileResourceAllocation(t *testing.T) {
+	g := NewWithT(t)
+
+	simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmCtx := emptyVirtualMachineContext()
+		vmCtx.Obj = vm
+		vmCtx.VSphereVM = &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "vsphereVM1",
+				Namespace: "my-namespace",
+			},
+			Spec: infrav1.VSphereVMSpec{
+				VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+					CPUAllocation: &infrav1.ResourceAllocation{
+						Reservation: ptr.To[int64](500),
+						Shares:      &infrav1.ResourceShares{Level: infrav1.SharesLevelHigh},
+					},
+				},
+			},
+		}
+
+		vms := &VMService{}
+		ok, err := vms.reconcileResourceAllocation(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+		g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+		task := object.NewTask(c, types.ManagedObjectReference{Type: "Task", Value: vmCtx.VSphereVM.Status.TaskRef})
+		g.Expect(task.Wait(ctx)).To(Succeed())
+		vmCtx.VSphereVM.Status.TaskRef = ""
+
+		var o mo.VirtualMachine
+		g.Expect(vm.Properties(ctx, vm.Reference(), []string{"config.cpuAllocation"}, &o)).To(Succeed())
+		g.Expect(*o.Config.CpuAllocation.Reservation).To(Equal(int64(500)))
+		g.Expect(o.Config.CpuAllocation.Shares.Level).To(Equal(types.SharesLevelHigh))
+
+		// Once the allocation is applied, the VM is not reconfigured anymore.
+		ok, err = vms.reconcileResourceAllocation(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		g.Expect(vmCtx.VSphereVM.Status.TaskRef).To(BeEmpty())
+		return nil
+	})
+}
@@ -41,12 +41,15 @@ import (
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/cluster"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/clustermodules"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/ipam"
 	govmominet "sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/net"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/pci"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/util"
 )
 
@@ -71,11 +74,18 @@ func (vms *VMService) ReconcileVM(ctx context.Context, vmCtx *capvcontext.VMCont
 		return vm, err
 	}
 
-	// This deferred function will trigger a reconcile event for the
-	// VSphereVM resource once its associated task completes. If
-	// there is no task for the VSphereVM resource then no reconcile
-	// event is triggered.
-	defer reconcileVSphereVMOnTaskCompletion(ctx, vmCtx)
+	// This deferred function watches the VM and the task of the VSphereVM
+	// resource, so that a reconcile event is triggered once the state of the
+	// VM changes or the task completes.
+	var vmRef types.ManagedObjectReference
+	defer func() { watchVSphereVM(ctx, vmCtx, vmRef) }()
+
+	// An existing VM referenced by the VSphereVM is adopted instead of being
+	// cloned.
+	if err := vms.reconcileAdoption(ctx, vmCtx); err != nil {
+		conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.AdoptionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return vm, err
+	}
 
 	// Before going further, we need the VM's managed object reference.
 	vmRef, err := findVM(ctx, vmCtx)
@@ -100,6 +110,13 @@ func (vms *VMService) ReconcileVM(ctx context.Context, vmCtx *capvcontext.VMCont
 			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningReason, clusterv1.ConditionSeverityInfo, "")
 		}
 
+		// Check the inventory objects of the VM against the allowed resources
+		// of the identity of its cluster before cloning it.
+		if err := vcenter.CheckAllowedResources(ctx, vmCtx); err != nil {
+			markCloningFailed(vmCtx, err)
+			return vm, err
+		}
+
 		// Get the bootstrap data.
 		bootstrapData, format, err := vms.getBootstrapData(ctx, vmCtx)
 		if err != nil {
@@ -107,10 +124,21 @@ func (vms *VMService) ReconcileVM(ctx context.Context, vmCtx *capvcontext.VMCont
 			return vm, err
 		}
 
+		// Wait for the capacity of the vCenter server before cloning the VM.
+		if !acquireTask(vmCtx) {
+			ctrl.LoggerFrom(ctx).Info("Waiting for vCenter capacity to clone VM")
+			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.WaitingForVCenterCapacityReason, clusterv1.ConditionSeverityInfo, "")
+			return vm, nil
+		}
+		if conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition) == infrav1.WaitingForVCenterCapacityReason {
+			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningReason, clusterv1.ConditionSeverityInfo, "")
+		}
+
 		// Create the VM.
 		err = createVM(ctx, vmCtx, bootstrapData, format)
 		if err != nil {
-			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			releaseTask(vmCtx)
+			markCloningFailed(vmCtx, err)
 			return vm, err
 		}
 		return vm, nil
@@ -131,11 +159,39 @@ func (vms *VMService) ReconcileVM(ctx context.Context, vmCtx *capvcontext.VMCont
 
 	vms.reconcileUUID(ctx, virtualMachineCtx)
 
+	if ok, err := vms.reconcileInstanceUUID(ctx, virtualMachineCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileAdoptedBy(ctx, virtualMachineCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if err := vms.reconcileDataDisks(ctx, virtualMachineCtx); err != nil {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileSnapshots(ctx, virtualMachineCtx); err != nil || !ok {
+		return vm, err
+	}
+
 	if ok, err := vms.reconcileHardwareVersion(ctx, virtualMachineCtx); err != nil || !ok {
 		return vm, err
 	}
 
-	if err := vms.reconcilePCIDevices(ctx, virtualMachineCtx); err != nil {
+	if ok, err := vms.reconcileDrift(ctx, virtualMachineCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileResize(ctx, virtualMachineCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcileResourceAllocation(ctx, virtualMachineCtx); err != nil || !ok {
+		return vm, err
+	}
+
+	if ok, err := vms.reconcilePCIDevices(ctx, virtualMachineCtx); err != nil || !ok {
 		return vm, err
 	}
 
@@ -147,8 +203,12 @@ func (vms *VMService) ReconcileVM(ctx context.Context, vmCtx *capvcontext.VMCont
 		return vm, err
 	}
 
-	if ok, err := vms.reconcileMetadata(ctx, virtualMachineCtx); err != nil || !ok {
-		return vm, err
+	// The metadata of an adopted VM is left as it is, so that its guest is
+	// not initialized again.
+	if vmCtx.VSphereVM.Spec.Adopt == nil {
+		if ok, err := vms.reconcileMetadata(ctx, virtualMachineCtx); err != nil || !ok {
+			return vm, err
+		}
 	}
 
 	if err := vms.reconcileStoragePolicy(ctx, virtualMachineCtx); err != nil {
@@ -195,11 +255,11 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 		return reconcile.Result{}, vm, err
 	}
 
-	// This deferred function will trigger a reconcile event for the
-	// VSphereVM resource once its associated task completes. If
-	// there is no task for the VSphereVM resource then no reconcile
-	// event is triggered.
-	defer reconcileVSphereVMOnTaskCompletion(ctx, vmCtx)
+	// This deferred function watches the VM and the task of the VSphereVM
+	// resource, so that a reconcile event is triggered once the VM is powered
+	// off or the task completes.
+	var vmRef types.ManagedObjectReference
+	defer func() { watchVSphereVM(ctx, vmCtx, vmRef) }()
 
 	// Before going further, we need the VM's managed object reference.
 	vmRef, err := findVM(ctx, vmCtx)
@@ -207,7 +267,13 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 		// If the VM's MoRef could not be found then the VM no longer exists. This
 		// is the desired state.
 		if isNotFound(err) || isFolderNotFound(err) {
+			// A VM deployed from a Content Library item is not found
+			// until it is configured, so it is destroyed once deployed.
+			if ok, err := vcenter.DestroyContentLibraryDeployment(ctx, vmCtx); err != nil || !ok {
+				return reconcile.Result{RequeueAfter: throttle.RequeueAfter}, vm, err
+			}
 			vm.State = infrav1.VirtualMachineStateNotFound
+			unwatchVSphereVM(ctx, vmCtx)
 			return reconcile.Result{}, vm, nil
 		}
 		return reconcile.Result{}, vm, err
@@ -225,6 +291,21 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 		State:     &vm,
 	}
 
+	// An adopted VM with the Retain deletion policy is released instead of
+	// being destroyed, and is left running.
+	if isRetained(vmCtx.VSphereVM) {
+		if err := vms.removeFromClusterModule(ctx, virtualMachineCtx); err != nil {
+			return reconcile.Result{}, vm, err
+		}
+		if ok, err := vms.releaseVM(ctx, virtualMachineCtx); err != nil || !ok {
+			return reconcile.Result{}, vm, err
+		}
+		log.Info("Adopted VM is retained")
+		vm.State = infrav1.VirtualMachineStateNotFound
+		unwatchVSphereVM(ctx, vmCtx)
+		return reconcile.Result{}, vm, nil
+	}
+
 	// Shut down the VM
 	powerState, err := vms.getPowerState(ctx, virtualMachineCtx)
 	if err != nil {
@@ -246,6 +327,7 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 		// Hard shut off VM.
 		task, err := virtualMachineCtx.Obj.PowerOff(ctx)
 		if err != nil {
+			metrics.RecordFailure(metrics.OperationPowerOff, err)
 			return reconcile.Result{}, vm, err
 		}
 
@@ -264,16 +346,15 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 	}
 
 	log.Info("VM is powered off")
-	if vmCtx.ClusterModuleInfo != nil {
-		log := log.WithValues("moduleUUID", *vmCtx.ClusterModuleInfo)
-		ctx := ctrl.LoggerInto(ctx, log)
+	if err := vms.removeFromClusterModule(ctx, virtualMachineCtx); err != nil {
+		return reconcile.Result{}, vm, err
+	}
 
-		provider := clustermodules.NewProvider(vmCtx.Session.TagManager.Client)
-		err := provider.RemoveMoRefFromModule(ctx, *vmCtx.ClusterModuleInfo, virtualMachineCtx.Ref)
-		if err != nil && !rest.IsStatusError(err, http.StatusNotFound) {
-			return reconcile.Result{}, vm, err
-		}
-		vmCtx.VSphereVM.Status.ModuleUUID = nil
+	// Wait for the capacity of the vCenter server before destroying the VM.
+	if !acquireTask(vmCtx) {
+		log.Info("Waiting for vCenter capacity to destroy VM")
+		conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.WaitingForVCenterCapacityReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{RequeueAfter: throttle.RequeueAfter}, vm, nil
 	}
 
 	// At this point the VM is not powered on and can be destroyed. Store the
@@ -281,6 +362,8 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 	log.Info("Destroying vm")
 	task, err := virtualMachineCtx.Obj.Destroy(ctx)
 	if err != nil {
+		releaseTask(vmCtx)
+		metrics.RecordFailure(metrics.OperationDestroy, err)
 		return reconcile.Result{}, vm, err
 	}
 	vmCtx.VSphereVM.Status.TaskRef = task.Reference().Value
@@ -288,6 +371,24 @@ func (vms *VMService) DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContex
 	return reconcile.Result{}, vm, nil
 }
 
+// removeFromClusterModule removes the VM from the cluster module of the
+// VSphereVM, if any.
+func (vms *VMService) removeFromClusterModule(ctx context.Context, virtualMachineCtx *virtualMachineContext) error {
+	if virtualMachineCtx.ClusterModuleInfo == nil {
+		return nil
+	}
+	log := ctrl.LoggerFrom(ctx).WithValues("moduleUUID", *virtualMachineCtx.ClusterModuleInfo)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	provider := clustermodules.NewProvider(virtualMachineCtx.Session.TagManager.Client)
+	err := provider.RemoveMoRefFromModule(ctx, *virtualMachineCtx.ClusterModuleInfo, virtualMachineCtx.Ref)
+	if err != nil && !rest.IsStatusError(err, http.StatusNotFound) {
+		return err
+	}
+	virtualMachineCtx.VSphereVM.Status.ModuleUUID = nil
+	return nil
+}
+
 func (vms *VMService) reconcileNetworkStatus(ctx context.Context, virtualMachineCtx *virtualMachineContext) error {
 	netStatus, err := vms.getNetworkStatus(ctx, virtualMachineCtx)
 	if err != nil {
@@ -355,6 +456,7 @@ func (vms *VMService) reconcilePowerState(ctx context.Context, virtualMachineCtx
 		log.Info("Powering on VM")
 		task, err := virtualMachineCtx.Obj.PowerOn(ctx)
 		if err != nil {
+			metrics.RecordFailure(metrics.OperationPowerOn, err)
 			conditions.MarkFalse(virtualMachineCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.PoweringOnFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 			return false, errors.Wrapf(err, "failed to trigger power on op for vm %s", ctx)
 		}
@@ -366,10 +468,9 @@ func (vms *VMService) reconcilePowerState(ctx context.Context, virtualMachineCtx
 			return false, err
 		}
 
-		// Once the VM is successfully powered on, a reconcile request should be
-		// triggered once the VM reports IP addresses are available.
-		reconcileVSphereVMWhenNetworkIsReady(ctx, virtualMachineCtx, task)
-
+		// Once the VM is successfully powered on, a reconcile request is
+		// triggered by the watcher of the VM every time the VM reports new IP
+		// addresses.
 		log.Info("Wait for VM to be powered on")
 		return false, nil
 	case infrav1.VirtualMachinePowerStatePoweredOn:
@@ -476,6 +577,48 @@ func (vms *VMService) reconcileUUID(ctx context.Context, virtualMachineCtx *virt
 	virtualMachineCtx.State.BiosUUID = virtualMachineCtx.Obj.UUID(ctx)
 }
 
+// reconcileInstanceUUID sets the instance UUID of an instant clone to the UID
+// of the VSphereVM, like the clone spec does for the other clones, since the
+// InstantClone API does not allow setting it. The VM is then found by its
+// instance UUID rather than by its inventory path.
+func (vms *VMService) reconcileInstanceUUID(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	if virtualMachineCtx.VSphereVM.Status.CloneMode != infrav1.InstantClone || virtualMachineCtx.VSphereVM.Spec.Adopt != nil {
+		return true, nil
+	}
+
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Ref, []string{"config.instanceUuid"}, &o); err != nil {
+		return false, errors.Wrapf(err, "error getting instance UUID of %s", ctx)
+	}
+	instanceUUID := string(virtualMachineCtx.VSphereVM.UID)
+	if o.Config == nil || o.Config.InstanceUuid == instanceUUID {
+		return true, nil
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Setting instance UUID of instant clone", "instanceUUID", instanceUUID)
+	task, err := virtualMachineCtx.Obj.Reconfigure(ctx, types.VirtualMachineConfigSpec{InstanceUuid: instanceUUID})
+	if err != nil {
+		return false, errors.Wrapf(err, "error setting instance UUID of %s", ctx)
+	}
+	virtualMachineCtx.VSphereVM.Status.TaskRef = task.Reference().Value
+	return false, nil
+}
+
+// reconcileDataDisks reports the UUID of the data disks added to the VM when
+// it was created.
+func (vms *VMService) reconcileDataDisks(ctx context.Context, virtualMachineCtx *virtualMachineContext) error {
+	dataDisks := virtualMachineCtx.VSphereVM.Status.DataDisks
+	if len(dataDisks) == 0 {
+		return nil
+	}
+	devices, err := virtualMachineCtx.Obj.Device(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error getting devices for %s", ctx)
+	}
+	vcenter.SetDataDiskUUIDs(dataDisks, devices)
+	return nil
+}
+
 func (vms *VMService) reconcileHardwareVersion(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
 	log := ctrl.LoggerFrom(ctx)
 
@@ -489,6 +632,13 @@ func (vms *VMService) reconcileHardwareVersion(ctx context.Context, virtualMachi
 			return false, errors.Wrapf(err, "failed to parse hardware version")
 		}
 		if toUpgrade {
+			if isSnapshotOperationSuspended(virtualMachineCtx.VSphereVM, infrav1.SnapshotOperationHardwareUpgrade) {
+				log.Info("Skipping hardware version upgrade while the VM is rolled back to a snapshot", "snapshot", virtualMachineCtx.VSphereVM.Spec.RollbackToSnapshot)
+				return true, nil
+			}
+			if ok, err := vms.reconcileSnapshotBeforeOperation(ctx, virtualMachineCtx, infrav1.SnapshotOperationHardwareUpgrade, virtualMachineCtx.VSphereVM.Spec.HardwareVersion); err != nil || !ok {
+				return false, err
+			}
 			log.Info("Upgrading hardware version", "fromVersion", virtualMachine.Config.Version, "toVersion", virtualMachineCtx.VSphereVM.Spec.HardwareVersion)
 			task, err := virtualMachineCtx.Obj.UpgradeVM(ctx, virtualMachineCtx.VSphereVM.Spec.HardwareVersion)
 			if err != nil {
@@ -501,13 +651,13 @@ func (vms *VMService) reconcileHardwareVersion(ctx context.Context, virtualMachi
 	return true, nil
 }
 
-func (vms *VMService) reconcilePCIDevices(ctx context.Context, virtualMachineCtx *virtualMachineContext) error {
+func (vms *VMService) reconcilePCIDevices(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	if expectedPciDevices := virtualMachineCtx.VSphereVM.Spec.VirtualMachineCloneSpec.PciDevices; len(expectedPciDevices) != 0 {
 		specsToBeAdded, err := pci.CalculateDevicesToBeAdded(ctx, virtualMachineCtx.Obj, expectedPciDevices)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		if len(specsToBeAdded) == 0 {
@@ -515,12 +665,12 @@ func (vms *VMService) reconcilePCIDevices(ctx context.Context, virtualMachineCtx
 				conditions.Delete(virtualMachineCtx.VSphereVM, infrav1.PCIDevicesDetachedCondition)
 			}
 			log.V(5).Info("No new PCI devices to be added")
-			return nil
+			return true, nil
 		}
 
 		powerState, err := virtualMachineCtx.Obj.PowerState(ctx)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if powerState == types.VirtualMachinePowerStatePoweredOn {
 			// This would arise only when the PCI device is manually removed from
@@ -531,14 +681,25 @@ func (vms *VMService) reconcilePCIDevices(ctx context.Context, virtualMachineCtx
 				infrav1.NotFoundReason,
 				clusterv1.ConditionSeverityWarning,
 				"PCI devices removed after VM was powered on")
-			return errors.Errorf("missing PCI devices")
+			return false, errors.Errorf("missing PCI devices")
+		}
+		if isSnapshotOperationSuspended(virtualMachineCtx.VSphereVM, infrav1.SnapshotOperationPCIDeviceChange) {
+			log.Info("Skipping PCI device change while the VM is rolled back to a snapshot", "snapshot", virtualMachineCtx.VSphereVM.Spec.RollbackToSnapshot)
+			return true, nil
+		}
+		key, err := pciDevicesKey(specsToBeAdded)
+		if err != nil {
+			return false, err
+		}
+		if ok, err := vms.reconcileSnapshotBeforeOperation(ctx, virtualMachineCtx, infrav1.SnapshotOperationPCIDeviceChange, key); err != nil || !ok {
+			return false, err
 		}
 		log.Info("PCI devices to be added", "number", len(specsToBeAdded))
 		if err := virtualMachineCtx.Obj.AddDevice(ctx, pci.ConstructDeviceSpecs(specsToBeAdded)...); err != nil {
-			return errors.Wrapf(err, "error adding pci devices for %q", ctx)
+			return false, errors.Wrapf(err, "error adding pci devices for %q", ctx)
 		}
 	}
-	return nil
+	return true, nil
 }
 
 func (vms *VMService) getMetadata(ctx context.Context, virtualMachineCtx *virtualMachineContext) (string, error) {
@@ -587,6 +748,7 @@ func (vms *VMService) reconcileHostInfo(ctx context.Context, virtualMachineCtx *
 		return err
 	}
 	virtualMachineCtx.VSphereVM.Status.Host = name
+	virtualMachineCtx.VSphereVM.Status.HostRef = host.Reference().Value
 	return nil
 }
 
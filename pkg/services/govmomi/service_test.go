@@ -18,23 +18,34 @@ package govmomi
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"path"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	pbmsimulator "github.com/vmware/govmomi/pbm/simulator"
 	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/library"
+	_ "github.com/vmware/govmomi/vapi/simulator" // run init func to register the content library API endpoints.
+	vapivcenter "github.com/vmware/govmomi/vapi/vcenter"
 	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	capvfake "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 )
 
 const (
@@ -88,7 +99,8 @@ func Test_reconcilePCIDevices(t *testing.T) {
 				},
 			}
 
-			g.Expect(vms.reconcilePCIDevices(ctx, vmCtx)).ToNot(HaveOccurred())
+			_, err = vms.reconcilePCIDevices(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
 
 			// get the VM's virtual device list
 			devices, err := vm.Device(ctx)
@@ -230,3 +242,180 @@ func storagePolicyModel() (*simulator.Model, error) {
 	model.Host = 1
 	return model, nil
 }
+
+func Test_reconcileInstanceUUID(t *testing.T) {
+	simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+		g := NewWithT(t)
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmCtx := emptyVirtualMachineContext()
+		vmCtx.Obj = vm
+		vmCtx.Ref = vm.Reference()
+		vmCtx.VSphereVM = &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "vsphereVM1",
+				Namespace: "my-namespace",
+				UID:       "5a1a3b6e-1c1e-4d0a-9a5c-2c3b1d0e9f01",
+			},
+		}
+		vms := &VMService{}
+
+		// The instance UUID of the other clones is set by the clone spec.
+		ok, err := vms.reconcileInstanceUUID(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		g.Expect(vmCtx.VSphereVM.Status.TaskRef).To(BeEmpty())
+
+		vmCtx.VSphereVM.Status.CloneMode = infrav1.InstantClone
+		ok, err = vms.reconcileInstanceUUID(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeFalse())
+		g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+
+		task := object.NewTask(c, types.ManagedObjectReference{Type: morefTypeTask, Value: vmCtx.VSphereVM.Status.TaskRef})
+		g.Expect(task.Wait(ctx)).To(Succeed())
+		ok, err = vms.reconcileInstanceUUID(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ok).To(BeTrue())
+		return nil
+	})
+}
+
+func TestReconcileVM_ContentLibraryItem(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	model := simulator.VPX()
+	model.Host = 0
+	g.Expect(model.Create()).To(Succeed())
+	t.Cleanup(model.Remove)
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+	server := model.Service.NewServer()
+	t.Cleanup(server.Close)
+	pass, _ := server.URL.User.Password()
+
+	// The watchers started by the reconciles run until the context is done,
+	// and cancel their wait for updates which the server waits for on close.
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(func() {
+		cancel()
+		time.Sleep(time.Second)
+	})
+
+	authSession, err := session.GetOrCreate(ctx,
+		session.NewParams().
+			WithServer(server.URL.Host).
+			WithUserInfo(server.URL.User.Username(), pass).
+			WithDatacenter("*"))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The Content Library item is a VM template of the simulator.
+	source, err := authSession.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).ToNot(HaveOccurred())
+	datastore, err := authSession.Finder.Datastore(ctx, "LocalDS_0")
+	g.Expect(err).ToNot(HaveOccurred())
+	folder, err := authSession.Finder.DefaultFolder(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	pool, err := authSession.Finder.DefaultResourcePool(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	libraryID, err := library.NewManager(authSession.TagManager.Client).CreateLibrary(ctx, library.Library{
+		Name:    "golden-images",
+		Type:    "LOCAL",
+		Storage: []library.StorageBackings{{DatastoreID: datastore.Reference().Value, Type: "DATASTORE"}},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	itemID, err := vapivcenter.NewManager(authSession.TagManager.Client).CreateTemplate(ctx, vapivcenter.Template{
+		Name:      "ubuntu",
+		Library:   libraryID,
+		SourceVM:  source.Reference().Value,
+		Placement: &vapivcenter.Placement{Folder: folder.Reference().Value, ResourcePool: pool.Reference().Value},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	newVMContext := func(name, uid string) *capvcontext.VMContext {
+		vmCtx := capvfake.NewVMContext(ctx, capvfake.NewControllerManagerContext())
+		vmCtx.Session = authSession
+		vmCtx.VSphereVM.Name = name
+		vmCtx.VSphereVM.UID = apitypes.UID(uid)
+		vmCtx.VSphereVM.Spec.Server = server.URL.Host
+		vmCtx.VSphereVM.Spec.Datacenter = "DC0"
+		vmCtx.VSphereVM.Spec.Datastore = "LocalDS_0"
+		vmCtx.VSphereVM.Spec.ContentLibraryItem = &infrav1.ContentLibraryItemSpec{ID: itemID}
+		return vmCtx
+	}
+	findVM := func(name string) *object.VirtualMachine {
+		vm, err := authSession.Finder.VirtualMachine(ctx, path.Join(folder.InventoryPath, name))
+		if err != nil {
+			return nil
+		}
+		return vm
+	}
+	vms := &VMService{}
+
+	t.Run("configures the deployed VM before it is found", func(t *testing.T) {
+		g := NewWithT(t)
+		vmCtx := newVMContext("deployed-vm", "00000000-0000-0000-0000-000000000010")
+		limiter := throttle.NewTaskLimiter(throttle.Options{MaxInFlight: 1})
+		vmCtx.TaskLimiter = limiter
+
+		_, err := vms.ReconcileVM(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// The simulator deploys the vm-template items as templates, which
+		// cannot be reconfigured.
+		g.Eventually(func() *object.VirtualMachine { return findVM("deployed-vm-00000000") }).ShouldNot(BeNil())
+		g.Expect(findVM("deployed-vm-00000000").MarkAsVirtualMachine(ctx, *pool, nil)).To(Succeed())
+
+		// The VM is deployed with a temporary name, so the reconciles keep
+		// waiting for the deployment instead of finding the VM which is not
+		// configured yet.
+		g.Eventually(func() string {
+			vm, err := vms.ReconcileVM(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(vm.State).To(BeEquivalentTo(infrav1.VirtualMachineStatePending))
+			// The deployment holds the capacity of the vCenter until its
+			// reconfigure task completes.
+			g.Expect(limiter.Acquire(server.URL.Host, "other", throttle.PriorityControlPlane)).To(BeFalse())
+			return vmCtx.VSphereVM.Status.TaskRef
+		}).ShouldNot(BeEmpty())
+		g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition)).To(Equal(infrav1.CloningReason))
+
+		task := object.NewTask(authSession.Client.Client, types.ManagedObjectReference{Type: morefTypeTask, Value: vmCtx.VSphereVM.Status.TaskRef})
+		g.Expect(task.Wait(ctx)).To(Succeed())
+		_, err = vms.ReconcileVM(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(limiter.Acquire(server.URL.Host, "other", throttle.PriorityControlPlane)).To(BeTrue())
+
+		// The reconfigure gives the VM its name and its instance UUID.
+		g.Expect(findVM("deployed-vm-00000000")).To(BeNil())
+		vm := findVM("deployed-vm")
+		g.Expect(vm).ToNot(BeNil())
+		var o mo.VirtualMachine
+		g.Expect(vm.Properties(ctx, vm.Reference(), []string{"config.instanceUuid"}, &o)).To(Succeed())
+		g.Expect(o.Config.InstanceUuid).To(Equal(string(vmCtx.VSphereVM.UID)))
+	})
+
+	t.Run("destroys the VM deployed for a deleted VSphereVM", func(t *testing.T) {
+		g := NewWithT(t)
+		vmCtx := newVMContext("deleted-vm", "00000000-0000-0000-0000-000000000011")
+
+		vm, err := vms.ReconcileVM(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(vm.State).To(BeEquivalentTo(infrav1.VirtualMachineStatePending))
+		g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition)).To(Equal(infrav1.DeployingContentLibraryItemReason))
+
+		// The deletion waits for the deployment, then destroys its VM.
+		g.Eventually(func() infrav1.VirtualMachineState {
+			result, vm, err := vms.DestroyVM(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			if !result.IsZero() {
+				return infrav1.VirtualMachineStatePending
+			}
+			return vm.State
+		}).Should(BeEquivalentTo(infrav1.VirtualMachineStateNotFound))
+		g.Expect(findVM("deleted-vm-00000000")).To(BeNil())
+		g.Expect(findVM("deleted-vm")).To(BeNil())
+	})
+}
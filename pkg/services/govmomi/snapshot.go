@@ -0,0 +1,214 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+)
+
+// snapshotName returns the name of the snapshot taken before an operation.
+// The key identifies the change made by the operation, so that the snapshot
+// is only taken once for each change.
+func snapshotName(operation infrav1.SnapshotOperation, key string) string {
+	return fmt.Sprintf("capv-pre-%s-%s", strings.ToLower(string(operation)), key)
+}
+
+// pciDevicesKey returns the key of the snapshot taken before adding the PCI
+// devices to a VM.
+func pciDevicesKey(pciDevices []infrav1.PCIDeviceSpec) (string, error) {
+	data, err := json.Marshal(pciDevices)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal PCI devices")
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(data)
+	return fmt.Sprintf("%08x", h.Sum32()), nil
+}
+
+// isSnapshotOperationSuspended returns true if the operation is guarded by the
+// snapshot policy of the VSphereVM and must not be performed because the VM
+// was rolled back to a snapshot.
+func isSnapshotOperationSuspended(vsphereVM *infrav1.VSphereVM, operation infrav1.SnapshotOperation) bool {
+	policy := vsphereVM.Spec.SnapshotPolicy
+	return vsphereVM.Spec.RollbackToSnapshot != "" && policy != nil && slices.Contains(policy.Operations, operation)
+}
+
+// reconcileSnapshotBeforeOperation takes a snapshot of the VM before the
+// operation if it is required by the snapshot policy of the VSphereVM. It
+// returns true once the snapshot exists and the operation may proceed.
+func (vms *VMService) reconcileSnapshotBeforeOperation(ctx context.Context, virtualMachineCtx *virtualMachineContext, operation infrav1.SnapshotOperation, key string) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereVM := virtualMachineCtx.VSphereVM
+	policy := vsphereVM.Spec.SnapshotPolicy
+	if policy == nil || !slices.Contains(policy.Operations, operation) {
+		return true, nil
+	}
+
+	name := snapshotName(operation, key)
+	i := slices.IndexFunc(vsphereVM.Status.Snapshots, func(s infrav1.VSphereVMSnapshot) bool { return s.Name == name })
+	if i >= 0 && vsphereVM.Status.Snapshots[i].SnapshotRef != "" {
+		return true, nil
+	}
+	if i < 0 {
+		vsphereVM.Status.Snapshots = append(vsphereVM.Status.Snapshots, infrav1.VSphereVMSnapshot{
+			Name:         name,
+			Operation:    operation,
+			CreationTime: metav1.Now(),
+		})
+		i = len(vsphereVM.Status.Snapshots) - 1
+	}
+	snapshot := &vsphereVM.Status.Snapshots[i]
+
+	// The snapshot may have been taken by a previous reconcile.
+	snapshotRefs, err := vms.getSnapshotRefs(ctx, virtualMachineCtx)
+	if err != nil {
+		return false, err
+	}
+	if ref, ok := snapshotRefs[name]; ok {
+		log.Info("Snapshot of VM taken", "snapshot", name, "snapshotRef", ref.Value)
+		snapshot.SnapshotRef = ref.Value
+		return true, nil
+	}
+
+	powerState, err := virtualMachineCtx.Obj.PowerState(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Only the file system of a running guest can be quiesced.
+	quiesce := ptr.Deref(policy.Quiesce, true) && powerState == types.VirtualMachinePowerStatePoweredOn
+
+	log.Info("Taking snapshot of VM", "snapshot", name, "operation", operation, "quiesce", quiesce)
+	task, err := virtualMachineCtx.Obj.CreateSnapshot(ctx, name, fmt.Sprintf("Taken before %s", operation), false, quiesce)
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationSnapshot, err)
+		return false, errors.Wrapf(err, "error trigging snapshot op for vm %s", ctx)
+	}
+	snapshot.CreationTime = metav1.Now()
+	vsphereVM.Status.TaskRef = task.Reference().Value
+	return false, nil
+}
+
+// reconcileSnapshots reverts the VM to the snapshot requested by the
+// VSphereVM, and deletes the snapshots which are older than the retention
+// period of the snapshot policy.
+func (vms *VMService) reconcileSnapshots(ctx context.Context, virtualMachineCtx *virtualMachineContext) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	vsphereVM := virtualMachineCtx.VSphereVM
+	rollbackTo := vsphereVM.Spec.RollbackToSnapshot
+	if rollbackTo == "" {
+		vsphereVM.Status.RolledBackSnapshot = ""
+	} else if rollbackTo != vsphereVM.Status.RolledBackSnapshot {
+		i := slices.IndexFunc(vsphereVM.Status.Snapshots, func(s infrav1.VSphereVMSnapshot) bool { return s.Name == rollbackTo })
+		if i < 0 || vsphereVM.Status.Snapshots[i].SnapshotRef == "" {
+			return false, errors.Errorf("unable to roll back vm %s to unknown snapshot %q", ctx, rollbackTo)
+		}
+
+		log.Info("Rolling back VM to snapshot", "snapshot", rollbackTo)
+		task, err := virtualMachineCtx.Obj.RevertToSnapshot(ctx, vsphereVM.Status.Snapshots[i].SnapshotRef, false)
+		if err != nil {
+			metrics.RecordFailure(metrics.OperationSnapshot, err)
+			return false, errors.Wrapf(err, "error trigging revert to snapshot op for vm %s", ctx)
+		}
+		vsphereVM.Status.RolledBackSnapshot = rollbackTo
+		vsphereVM.Status.TaskRef = task.Reference().Value
+		return false, nil
+	}
+
+	retentionPeriod := infrav1.SnapshotDefaultRetentionPeriod
+	if policy := vsphereVM.Spec.SnapshotPolicy; policy != nil && policy.RetentionPeriod != nil {
+		retentionPeriod = policy.RetentionPeriod.Duration
+	}
+	expired := func(s infrav1.VSphereVMSnapshot) bool {
+		// The snapshot the VM is rolled back to is kept until the rollback is cleared.
+		return s.Name != rollbackTo && time.Since(s.CreationTime.Time) > retentionPeriod
+	}
+	if !slices.ContainsFunc(vsphereVM.Status.Snapshots, expired) {
+		return true, nil
+	}
+
+	snapshotRefs, err := vms.getSnapshotRefs(ctx, virtualMachineCtx)
+	if err != nil {
+		return false, err
+	}
+	snapshots := vsphereVM.Status.Snapshots[:0]
+	for _, snapshot := range vsphereVM.Status.Snapshots {
+		if expired(snapshot) {
+			if _, ok := snapshotRefs[snapshot.Name]; !ok {
+				log.Info("Snapshot of VM deleted", "snapshot", snapshot.Name)
+				continue
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	vsphereVM.Status.Snapshots = snapshots
+
+	for _, snapshot := range vsphereVM.Status.Snapshots {
+		if !expired(snapshot) {
+			continue
+		}
+		log.Info("Deleting snapshot of VM after retention period", "snapshot", snapshot.Name, "retentionPeriod", retentionPeriod)
+		task, err := virtualMachineCtx.Obj.RemoveSnapshot(ctx, snapshotRefs[snapshot.Name].Value, false, ptr.To(true))
+		if err != nil {
+			metrics.RecordFailure(metrics.OperationSnapshot, err)
+			return false, errors.Wrapf(err, "error trigging remove snapshot op for vm %s", ctx)
+		}
+		vsphereVM.Status.TaskRef = task.Reference().Value
+		return false, nil
+	}
+	return true, nil
+}
+
+// getSnapshotRefs returns the managed object references of the snapshots of
+// the VM by name.
+func (vms *VMService) getSnapshotRefs(ctx context.Context, virtualMachineCtx *virtualMachineContext) (map[string]types.ManagedObjectReference, error) {
+	var o mo.VirtualMachine
+	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"snapshot"}, &o); err != nil {
+		return nil, errors.Wrapf(err, "error getting snapshots of vm %s", ctx)
+	}
+
+	snapshotRefs := map[string]types.ManagedObjectReference{}
+	if o.Snapshot == nil {
+		return snapshotRefs, nil
+	}
+	var add func(tree []types.VirtualMachineSnapshotTree)
+	add = func(tree []types.VirtualMachineSnapshotTree) {
+		for _, s := range tree {
+			snapshotRefs[s.Name] = s.Snapshot
+			add(s.ChildSnapshotList)
+		}
+	}
+	add(o.Snapshot.RootSnapshotList)
+	return snapshotRefs, nil
+}
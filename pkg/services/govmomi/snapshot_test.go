@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package govmomi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+func Test_reconcileSnapshots(t *testing.T) {
+	newVirtualMachineContext := func(ctx context.Context, g *WithT, c *vim25.Client) *virtualMachineContext {
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmCtx := emptyVirtualMachineContext()
+		vmCtx.Obj = vm
+		vmCtx.VSphereVM = &infrav1.VSphereVM{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "vsphereVM1",
+				Namespace: "my-namespace",
+			},
+			Spec: infrav1.VSphereVMSpec{
+				SnapshotPolicy: &infrav1.VSphereVMSnapshotPolicy{
+					Operations: []infrav1.SnapshotOperation{infrav1.SnapshotOperationHardwareUpgrade},
+				},
+			},
+		}
+		return vmCtx
+	}
+	waitForTask := func(ctx context.Context, g *WithT, c *vim25.Client, vmCtx *virtualMachineContext) {
+		g.Expect(vmCtx.VSphereVM.Status.TaskRef).ToNot(BeEmpty())
+		task := object.NewTask(c, types.ManagedObjectReference{Type: "Task", Value: vmCtx.VSphereVM.Status.TaskRef})
+		g.Expect(task.Wait(ctx)).To(Succeed())
+		vmCtx.VSphereVM.Status.TaskRef = ""
+	}
+
+	t.Run("takes a snapshot once before an operation of the policy", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vmCtx := newVirtualMachineContext(ctx, g, c)
+			vms := &VMService{}
+
+			ok, err := vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationPCIDeviceChange, "key")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.Snapshots).To(BeEmpty())
+
+			ok, err = vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationHardwareUpgrade, "vmx-19")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			waitForTask(ctx, g, c, vmCtx)
+
+			ok, err = vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationHardwareUpgrade, "vmx-19")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.TaskRef).To(BeEmpty())
+			g.Expect(vmCtx.VSphereVM.Status.Snapshots).To(HaveLen(1))
+			g.Expect(vmCtx.VSphereVM.Status.Snapshots[0].Name).To(Equal("capv-pre-hardwareupgrade-vmx-19"))
+			g.Expect(vmCtx.VSphereVM.Status.Snapshots[0].SnapshotRef).ToNot(BeEmpty())
+			return nil
+		})
+	})
+
+	t.Run("rolls back the VM to a snapshot", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vmCtx := newVirtualMachineContext(ctx, g, c)
+			vms := &VMService{}
+
+			_, err := vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationHardwareUpgrade, "vmx-19")
+			g.Expect(err).ToNot(HaveOccurred())
+			waitForTask(ctx, g, c, vmCtx)
+			_, err = vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationHardwareUpgrade, "vmx-19")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			vmCtx.VSphereVM.Spec.RollbackToSnapshot = "does-not-exist"
+			_, err = vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).To(HaveOccurred())
+
+			vmCtx.VSphereVM.Spec.RollbackToSnapshot = "capv-pre-hardwareupgrade-vmx-19"
+			ok, err := vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			g.Expect(vmCtx.VSphereVM.Status.RolledBackSnapshot).To(Equal("capv-pre-hardwareupgrade-vmx-19"))
+			g.Expect(isSnapshotOperationSuspended(vmCtx.VSphereVM, infrav1.SnapshotOperationHardwareUpgrade)).To(BeTrue())
+			waitForTask(ctx, g, c, vmCtx)
+
+			// The VM is only rolled back once.
+			ok, err = vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+
+			vmCtx.VSphereVM.Spec.RollbackToSnapshot = ""
+			ok, err = vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.RolledBackSnapshot).To(BeEmpty())
+			return nil
+		})
+	})
+
+	t.Run("deletes snapshots after the retention period", func(t *testing.T) {
+		g := NewWithT(t)
+
+		simulator.Run(func(ctx context.Context, c *vim25.Client) error {
+			vmCtx := newVirtualMachineContext(ctx, g, c)
+			vmCtx.VSphereVM.Spec.SnapshotPolicy.RetentionPeriod = &metav1.Duration{Duration: time.Hour}
+			vms := &VMService{}
+
+			_, err := vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationHardwareUpgrade, "vmx-19")
+			g.Expect(err).ToNot(HaveOccurred())
+			waitForTask(ctx, g, c, vmCtx)
+			_, err = vms.reconcileSnapshotBeforeOperation(ctx, vmCtx, infrav1.SnapshotOperationHardwareUpgrade, "vmx-19")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			ok, err := vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.Snapshots).To(HaveLen(1))
+
+			vmCtx.VSphereVM.Status.Snapshots[0].CreationTime = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+			ok, err = vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeFalse())
+			waitForTask(ctx, g, c, vmCtx)
+
+			ok, err = vms.reconcileSnapshots(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(vmCtx.VSphereVM.Status.Snapshots).To(BeEmpty())
+			return nil
+		})
+	})
+}
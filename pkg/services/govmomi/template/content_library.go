@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package template
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vapi/library"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+// Content Library item types which can be deployed.
+const (
+	ContentLibraryItemTypeOVF        = "ovf"
+	ContentLibraryItemTypeVMTemplate = "vm-template"
+)
+
+// FindContentLibraryItem finds a Content Library item based either on its ID
+// or on the name of its library and its own name.
+func FindContentLibraryItem(ctx context.Context, session *session.Session, itemSpec infrav1.ContentLibraryItemSpec) (*library.Item, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	// The tags manager wraps the authenticated REST client of the session.
+	manager := library.NewManager(session.TagManager.Client)
+
+	if itemSpec.ID != "" {
+		log.V(5).Info("Find Content Library item by ID", "itemID", itemSpec.ID)
+		item, err := manager.GetLibraryItem(ctx, itemSpec.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find Content Library item by ID %q", itemSpec.ID)
+		}
+		return item, nil
+	}
+
+	log.V(5).Info("Find Content Library item by name", "library", itemSpec.Library, "itemName", itemSpec.Name)
+	lib, err := manager.GetLibraryByName(ctx, itemSpec.Library)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find Content Library %q", itemSpec.Library)
+	}
+	itemIDs, err := manager.FindLibraryItems(ctx, library.FindItem{LibraryID: lib.ID, Name: itemSpec.Name})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying Content Library %q for item %q", itemSpec.Library, itemSpec.Name)
+	}
+	switch len(itemIDs) {
+	case 0:
+		return nil, errors.Errorf("unable to find item %q in Content Library %q", itemSpec.Name, itemSpec.Library)
+	case 1:
+	default:
+		return nil, errors.Errorf("found %d items named %q in Content Library %q", len(itemIDs), itemSpec.Name, itemSpec.Library)
+	}
+	item, err := manager.GetLibraryItem(ctx, itemIDs[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get Content Library item %q", itemIDs[0])
+	}
+	return item, nil
+}
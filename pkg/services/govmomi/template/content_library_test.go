@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package template
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/library"
+	_ "github.com/vmware/govmomi/vapi/simulator" // run init func to register the content library API endpoints.
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
+)
+
+func TestFindContentLibraryItem(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	model := simulator.VPX()
+	g.Expect(model.Create()).To(Succeed())
+	t.Cleanup(model.Remove)
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+
+	server := model.Service.NewServer()
+	t.Cleanup(server.Close)
+	pass, _ := server.URL.User.Password()
+
+	s, err := session.GetOrCreate(ctx,
+		session.NewParams().
+			WithServer(server.URL.Host).
+			WithUserInfo(server.URL.User.Username(), pass).
+			WithDatacenter("*"))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	datastore, err := s.Finder.DefaultDatastore(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	manager := library.NewManager(s.TagManager.Client)
+	libraryID, err := manager.CreateLibrary(ctx, library.Library{
+		Name: "golden-images",
+		Type: "LOCAL",
+		Storage: []library.StorageBackings{{
+			DatastoreID: datastore.Reference().Value,
+			Type:        "DATASTORE",
+		}},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	itemID, err := manager.CreateLibraryItem(ctx, library.Item{
+		Name:      "ubuntu-2204-kube-v1.29.3",
+		Type:      ContentLibraryItemTypeOVF,
+		LibraryID: libraryID,
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	testCases := []struct {
+		name     string
+		itemSpec infrav1.ContentLibraryItemSpec
+		err      string
+	}{
+		{
+			name:     "find item by ID",
+			itemSpec: infrav1.ContentLibraryItemSpec{ID: itemID},
+		},
+		{
+			name:     "find item by library and name",
+			itemSpec: infrav1.ContentLibraryItemSpec{Library: "golden-images", Name: "ubuntu-2204-kube-v1.29.3"},
+		},
+		{
+			name:     "unknown library",
+			itemSpec: infrav1.ContentLibraryItemSpec{Library: "does-not-exist", Name: "ubuntu-2204-kube-v1.29.3"},
+			err:      `unable to find Content Library "does-not-exist"`,
+		},
+		{
+			name:     "unknown item",
+			itemSpec: infrav1.ContentLibraryItemSpec{Library: "golden-images", Name: "does-not-exist"},
+			err:      `unable to find item "does-not-exist" in Content Library "golden-images"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			item, err := FindContentLibraryItem(ctx, s, tc.itemSpec)
+			if tc.err != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.err)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(item.ID).To(Equal(itemID))
+			g.Expect(item.Type).To(Equal(ContentLibraryItemTypeOVF))
+		})
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/session"
@@ -40,6 +42,29 @@ func FindTemplate(ctx context.Context, session *session.Session, templateID stri
 	return findTemplateByName(ctx, session, templateID)
 }
 
+// GetDiskGiB returns the size in GiB of the first disk of a template found
+// based either on a UUID or name, which is the disk resized when cloning the
+// template.
+func GetDiskGiB(ctx context.Context, session *session.Session, templateID string) (int32, error) {
+	tpl, err := FindTemplate(ctx, session, templateID)
+	if err != nil {
+		return 0, err
+	}
+	var o mo.VirtualMachine
+	if err := tpl.Properties(ctx, tpl.Reference(), []string{"config.hardware.device"}, &o); err != nil {
+		return 0, errors.Wrapf(err, "failed to get devices of template %q", templateID)
+	}
+	if o.Config == nil {
+		return 0, errors.Errorf("config of template %q is nil", templateID)
+	}
+	for _, device := range o.Config.Hardware.Device {
+		if disk, ok := device.(*types.VirtualDisk); ok {
+			return int32(disk.CapacityInKB / 1024 / 1024), nil
+		}
+	}
+	return 0, nil
+}
+
 func findTemplateByInstanceUUID(ctx context.Context, session *session.Session, templateID string) (*object.VirtualMachine, error) {
 	log := ctrl.LoggerFrom(ctx)
 
@@ -18,24 +18,26 @@ package govmomi
 
 import (
 	"context"
-	gonet "net"
 	"path"
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/vmware/govmomi/object"
-	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/net"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/vcenter"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/watcher"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 )
 
 func sanitizeIPAddrs(ctx context.Context, ipAddrs []string) []string {
@@ -125,7 +127,49 @@ func getTask(ctx context.Context, vmCtx *capvcontext.VMContext) *mo.Task {
 func reconcileInFlightTask(ctx context.Context, vmCtx *capvcontext.VMContext) (bool, error) {
 	// Check to see if there is an in-flight task.
 	task := getTask(ctx, vmCtx)
-	return checkAndRetryTask(ctx, vmCtx, task)
+	inFlight, err := checkAndRetryTask(ctx, vmCtx, task)
+
+	// A completed clone or destroy task no longer counts against the capacity
+	// of the vCenter server, unlike a Content Library item being deployed in
+	// the background, which has no task until it is reconfigured.
+	if !inFlight && !vcenter.IsDeployingInBackground(vmCtx) {
+		releaseTask(vmCtx)
+	}
+	return inFlight, err
+}
+
+// acquireTask returns whether the clone or destroy task of the VSphereVM can
+// be started on its vCenter server. The tasks of the control plane machines
+// are started before the ones of the worker machines.
+func acquireTask(vmCtx *capvcontext.VMContext) bool {
+	if vmCtx.ControllerManagerContext == nil {
+		return true
+	}
+	priority := throttle.PriorityWorker
+	if _, ok := vmCtx.VSphereVM.Labels[clusterv1.MachineControlPlaneLabel]; ok {
+		priority = throttle.PriorityControlPlane
+	}
+	return vmCtx.TaskLimiter.Acquire(vmCtx.VSphereVM.Spec.Server, client.ObjectKeyFromObject(vmCtx.VSphereVM).String(), priority)
+}
+
+// releaseTask releases the clone or destroy task of the VSphereVM.
+func releaseTask(vmCtx *capvcontext.VMContext) {
+	if vmCtx.ControllerManagerContext == nil {
+		return
+	}
+	vmCtx.TaskLimiter.Release(vmCtx.VSphereVM.Spec.Server, client.ObjectKeyFromObject(vmCtx.VSphereVM).String())
+}
+
+// markCloningFailed marks the VSphereVM as not provisioned because its clone
+// failed, with an error severity if it was denied by the allowed resources of
+// the identity of its cluster.
+func markCloningFailed(vmCtx *capvcontext.VMContext, err error) {
+	var notAllowedErr *identity.ResourceNotAllowedError
+	if errors.As(err, &notAllowedErr) {
+		conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.ResourceNotAllowedReason, clusterv1.ConditionSeverityError, err.Error())
+		return
+	}
+	conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 }
 
 // checkAndRetryTask verifies whether the task exists and if the
@@ -158,6 +202,7 @@ func checkAndRetryTask(ctx context.Context, vmCtx *capvcontext.VMContext, task *
 		return true, nil
 	case types.TaskInfoStateSuccess:
 		log.Info("Task found: Task is a success")
+		metrics.ObserveTask(task.Info)
 		vmCtx.VSphereVM.Status.TaskRef = ""
 		return false, nil
 	case types.TaskInfoStateError:
@@ -170,11 +215,20 @@ func checkAndRetryTask(ctx context.Context, vmCtx *capvcontext.VMContext, task *
 		if task.Info.Error != nil {
 			errorMessage = task.Info.Error.LocalizedMessage
 		}
-		conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.TaskFailure, clusterv1.ConditionSeverityInfo, errorMessage)
+		if task.Info.DescriptionId == instantCloneTaskDescriptionID {
+			// The VM is fully cloned from its template the next time it is
+			// created, see vcenter.Clone.
+			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.InstantCloneFailedReason, clusterv1.ConditionSeverityWarning,
+				"instant clone of parent %s failed, falling back to full clone: %s", vmCtx.VSphereVM.Status.InstantCloneParent, errorMessage)
+		} else {
+			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.TaskFailure, clusterv1.ConditionSeverityInfo, errorMessage)
+		}
 
 		// Instead of directly requeuing the failed task, wait for the RetryAfter duration to pass
 		// before resetting the taskRef from the VSphereVM status.
 		if vmCtx.VSphereVM.Status.RetryAfter.IsZero() {
+			// Only observe the failed task the first time it is seen.
+			metrics.ObserveTask(task.Info)
 			vmCtx.VSphereVM.Status.RetryAfter = metav1.Time{Time: time.Now().Add(1 * time.Minute)}
 		} else {
 			vmCtx.VSphereVM.Status.TaskRef = ""
@@ -186,410 +240,41 @@ func checkAndRetryTask(ctx context.Context, vmCtx *capvcontext.VMContext, task *
 	}
 }
 
-func reconcileVSphereVMWhenNetworkIsReady(ctx context.Context, virtualMachineCtx *virtualMachineContext, powerOnTask *object.Task) {
-	reconcileVSphereVMOnChannel(
-		ctx,
-		&virtualMachineCtx.VMContext,
-		func() (<-chan []interface{}, <-chan error, error) {
-			// Wait for the VM to be powered on.
-			powerOnTaskInfo, err := powerOnTask.WaitForResult(ctx)
-			if err != nil && powerOnTaskInfo == nil {
-				return nil, nil, errors.Wrapf(err, "failed to wait for power on op for vm %s", ctx)
-			}
-			powerState, err := virtualMachineCtx.Obj.PowerState(ctx)
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to get power state for vm %s", ctx)
-			}
-			if powerState != types.VirtualMachinePowerStatePoweredOn {
-				return nil, nil, errors.Errorf(
-					"unexpected power state %v for vm %s",
-					powerState, ctx)
-			}
-
-			// Wait for all NICs to have valid MAC addresses.
-			if err := waitForMacAddresses(ctx, virtualMachineCtx); err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to wait for mac addresses for vm %s", ctx)
-			}
-
-			// Get all the MAC addresses. This is done separately from waiting
-			// for all NICs to have MAC addresses in order to ensure the order
-			// of the retrieved MAC addresses matches the order of the device
-			// specs, and not the propery change order.
-			_, macToDeviceIndex, deviceToMacIndex, err := getMacAddresses(ctx, virtualMachineCtx)
-			if err != nil {
-				return nil, nil, errors.Wrapf(err, "failed to get mac addresses for vm %s", ctx)
-			}
-
-			// Wait for the IP addresses to show up for the VM.
-			chanIPAddresses, chanErrs := waitForIPAddresses(ctx, virtualMachineCtx, macToDeviceIndex, deviceToMacIndex)
-
-			// Trigger a reconcile every time a new IP is discovered.
-			chanOfLoggerKeysAndValues := make(chan []interface{})
-			go func() {
-				for ip := range chanIPAddresses {
-					chanOfLoggerKeysAndValues <- []interface{}{
-						"reason", "network",
-						"ipAddress", ip,
-					}
-				}
-			}()
-			return chanOfLoggerKeysAndValues, chanErrs, nil
-		})
-}
-
-func reconcileVSphereVMOnTaskCompletion(ctx context.Context, vmCtx *capvcontext.VMContext) {
+// watchVSphereVM watches the VM and the in-flight task of the VSphereVM with
+// the watcher of the vCenter session, so that the VSphereVM is reconciled when
+// the state of the VM changes or the task completes. The VM is not watched if
+// its reference is empty, e.g. because it is not created yet.
+func watchVSphereVM(ctx context.Context, vmCtx *capvcontext.VMContext, vmRef types.ManagedObjectReference) {
 	log := ctrl.LoggerFrom(ctx)
 
-	task := getTask(ctx, vmCtx)
-	if task == nil {
-		log.V(4).Info("Skipping reconcile VSphereVM on task completion, because there is no task")
+	w, err := watcher.Get(ctx, vmCtx.ControllerManagerContext, vmCtx.Session.Client.Client)
+	if err != nil {
+		log.Error(err, "Failed to get the watcher of the vCenter session")
 		return
 	}
-	taskRef := task.Reference()
-	taskHelper := object.NewTask(vmCtx.Session.Client.Client, taskRef)
-
-	log.Info("Enqueuing reconcile request on task completion",
-		"taskRef", taskRef,
-		"taskName", task.Info.Name,
-		"taskEntityName", task.Info.EntityName,
-		"taskDescriptionID", task.Info.DescriptionId)
-
-	reconcileVSphereVMOnFuncCompletion(ctx, vmCtx, func() ([]interface{}, error) {
-		taskInfo, err := taskHelper.WaitForResult(ctx)
-
-		// An error is only returned if the process of waiting for the result
-		// failed, *not* if the task itself failed.
-		if err != nil && taskInfo == nil {
-			return nil, err
-		}
-		// do not queue in the event channel when task fails as we don't
-		// want to retry right away
-		if taskInfo.State == types.TaskInfoStateError {
-			return nil, errors.Errorf("task failed: task is in state error")
+	if vmRef.Value != "" {
+		if err := w.WatchVM(ctx, vmRef, vmCtx.VSphereVM); err != nil {
+			log.Error(err, "Failed to watch VM")
 		}
-
-		return []interface{}{
-			"reason", "task",
-			"taskRef", taskRef,
-			"taskName", taskInfo.Name,
-			"taskEntityName", taskInfo.EntityName,
-			"taskState", taskInfo.State,
-			"taskDescriptionID", taskInfo.DescriptionId,
-		}, nil
-	})
-}
-
-func reconcileVSphereVMOnFuncCompletion(ctx context.Context, vmCtx *capvcontext.VMContext, waitFn func() (loggerKeysAndValues []interface{}, _ error)) {
-	log := ctrl.LoggerFrom(ctx)
-
-	obj := vmCtx.VSphereVM.DeepCopy()
-	gvk := infrav1.GroupVersion.WithKind("VSphereVM")
-
-	// Wait on the function to complete in a background goroutine.
-	go func() {
-		loggerKeysAndValues, err := waitFn()
-		if err != nil {
-			log.Error(err, "failed to wait on func")
-			return
-		}
-
-		// Once the task has completed (successfully or otherwise), trigger
-		// a reconcile event for the associated resource by sending a
-		// GenericEvent into the event channel for the resource type.
-		log.Info("Triggering GenericEvent", loggerKeysAndValues...)
-		eventChannel := vmCtx.GetGenericEventChannelFor(gvk)
-		eventChannel <- event.GenericEvent{
-			Object: obj,
-		}
-	}()
-}
-
-func reconcileVSphereVMOnChannel(ctx context.Context, vmCtx *capvcontext.VMContext, waitFn func() (<-chan []interface{}, <-chan error, error)) {
-	log := ctrl.LoggerFrom(ctx)
-
-	obj := vmCtx.VSphereVM.DeepCopy()
-	gvk := obj.GetObjectKind().GroupVersionKind()
-
-	// Send a generic event for every set of logger keys/values received
-	// on the channel.
-	go func() {
-		chanOfLoggerKeysAndValues, chanErrs, err := waitFn()
-		if err != nil {
-			log.Error(err, "failed to wait on func")
-			return
-		}
-		for {
-			select {
-			case loggerKeysAndValues := <-chanOfLoggerKeysAndValues:
-				if loggerKeysAndValues == nil {
-					return
-				}
-				go func() {
-					// Trigger a reconcile event for the associated resource by
-					// sending a GenericEvent into the event channel for the resource
-					// type.
-					log.Info("Triggering GenericEvent", loggerKeysAndValues...)
-					eventChannel := vmCtx.GetGenericEventChannelFor(gvk)
-					eventChannel <- event.GenericEvent{
-						Object: obj,
-					}
-				}()
-			case err := <-chanErrs:
-				if err != nil {
-					log.Error(err, "error occurred while waiting to trigger a generic event")
-				}
-				return
-			}
-		}
-	}()
-}
-
-// waitForMacAddresses waits for all configured network devices to have
-// valid MAC addresses.
-func waitForMacAddresses(ctx context.Context, virtualMachineCtx *virtualMachineContext) error {
-	return property.Wait(
-		ctx, property.DefaultCollector(virtualMachineCtx.Session.Client.Client),
-		virtualMachineCtx.Obj.Reference(), []string{"config.hardware.device"},
-		func(propertyChanges []types.PropertyChange) bool {
-			for _, propChange := range propertyChanges {
-				if propChange.Op != types.PropertyChangeOpAssign {
-					continue
-				}
-				deviceList := object.VirtualDeviceList(propChange.Val.(types.ArrayOfVirtualDevice).VirtualDevice)
-				for _, dev := range deviceList {
-					if nic, ok := dev.(types.BaseVirtualEthernetCard); ok {
-						mac := nic.GetVirtualEthernetCard().MacAddress
-						if mac == "" {
-							return false
-						}
-					}
-				}
-			}
-			return true
-		})
-}
-
-// getMacAddresses gets the MAC addresses for all network devices.
-// This happens separately from waitForMacAddresses to ensure returned order of
-// devices matches the spec and not order in which the property changes were
-// noticed.
-func getMacAddresses(ctx context.Context, virtualMachineCtx *virtualMachineContext) ([]string, map[string]int, map[int]string, error) {
-	var (
-		vm                   mo.VirtualMachine
-		macAddresses         = make([]string, 0)
-		macToDeviceSpecIndex = map[string]int{}
-		deviceSpecIndexToMac = map[int]string{}
-	)
-	if err := virtualMachineCtx.Obj.Properties(ctx, virtualMachineCtx.Obj.Reference(), []string{"config.hardware.device"}, &vm); err != nil {
-		return nil, nil, nil, err
 	}
-	i := 0
-	for _, device := range vm.Config.Hardware.Device {
-		nic, ok := device.(types.BaseVirtualEthernetCard)
-		if !ok {
-			continue
+	if vmCtx.VSphereVM.Status.TaskRef != "" {
+		taskRef := types.ManagedObjectReference{
+			Type:  morefTypeTask,
+			Value: vmCtx.VSphereVM.Status.TaskRef,
+		}
+		if err := w.WatchTask(ctx, taskRef, vmCtx.VSphereVM); err != nil {
+			log.Error(err, "Failed to watch task", "taskRef", taskRef.Value)
 		}
-		mac := nic.GetVirtualEthernetCard().MacAddress
-		macAddresses = append(macAddresses, mac)
-		macToDeviceSpecIndex[mac] = i
-		deviceSpecIndexToMac[i] = mac
-		i++
 	}
-	return macAddresses, macToDeviceSpecIndex, deviceSpecIndexToMac, nil
 }
 
-// waitForIPAddresses waits for all network devices that should be getting an
-// IP address to have an IP address. This is any network device that specifies a
-// network name and DHCP for v4 or v6 or one or more static IP addresses.
-func waitForIPAddresses(
-	ctx context.Context,
-	virtualMachineCtx *virtualMachineContext,
-	macToDeviceIndex map[string]int,
-	deviceToMacIndex map[int]string) (<-chan string, <-chan error) {
-	log := ctrl.LoggerFrom(ctx)
-
-	var (
-		chanErrs          = make(chan error)
-		chanIPAddresses   = make(chan string)
-		macToHasIPv4Lease = map[string]struct{}{}
-		macToHasIPv6Lease = map[string]struct{}{}
-		macToSkipped      = map[string]map[string]struct{}{}
-		macToHasStaticIP  = map[string]map[string]struct{}{}
-		propCollector     = property.DefaultCollector(virtualMachineCtx.Session.Client.Client)
-	)
-
-	// Initialize the nested maps early.
-	for mac := range macToDeviceIndex {
-		macToSkipped[mac] = map[string]struct{}{}
-		macToHasStaticIP[mac] = map[string]struct{}{}
+// unwatchVSphereVM stops watching the VM and the task of the VSphereVM.
+func unwatchVSphereVM(ctx context.Context, vmCtx *capvcontext.VMContext) {
+	w, err := watcher.Get(ctx, vmCtx.ControllerManagerContext, vmCtx.Session.Client.Client)
+	if err == nil {
+		err = w.Unwatch(ctx, vmCtx.VSphereVM)
 	}
-
-	onPropertyChange := func(propertyChanges []types.PropertyChange) bool {
-		for _, propChange := range propertyChanges {
-			if propChange.Op != types.PropertyChangeOpAssign {
-				continue
-			}
-			nics := propChange.Val.(types.ArrayOfGuestNicInfo).GuestNicInfo
-			for _, nic := range nics {
-				mac := nic.MacAddress
-				if mac == "" || nic.IpConfig == nil {
-					continue
-				}
-				// Ignore any that don't correspond to a network
-				// device spec.
-				deviceSpecIndex, ok := macToDeviceIndex[mac]
-				if !ok {
-					chanErrs <- errors.Errorf("unknown device spec index for mac %s while waiting for ip addresses for vm %s", mac, virtualMachineCtx)
-					// Return true to stop the property collector from waiting
-					// on any more changes.
-					return true
-				}
-				if deviceSpecIndex < 0 || deviceSpecIndex >= len(virtualMachineCtx.VSphereVM.Spec.Network.Devices) {
-					chanErrs <- errors.Errorf("invalid device spec index %d for mac %s while waiting for ip addresses for vm %s", deviceSpecIndex, mac, virtualMachineCtx)
-					// Return true to stop the property collector from waiting
-					// on any more changes.
-					return true
-				}
-
-				// Get the network device spec that corresponds to the MAC.
-				deviceSpec := virtualMachineCtx.VSphereVM.Spec.Network.Devices[deviceSpecIndex]
-
-				// Look at each IP and determine whether a reconcile has
-				// been triggered for the IP.
-				for _, discoveredIPInfo := range nic.IpConfig.IpAddress {
-					discoveredIP := discoveredIPInfo.IpAddress
-
-					// Ignore link-local addresses.
-					if err := net.ErrOnLocalOnlyIPAddr(discoveredIP); err != nil {
-						if _, ok := macToSkipped[mac][discoveredIP]; !ok {
-							log.Info("Ignoring IP address", "reason", err.Error())
-							macToSkipped[mac][discoveredIP] = struct{}{}
-						}
-						continue
-					}
-
-					// Check to see if the IP is in the list of the device
-					// spec's static IP addresses.
-					isStatic := false
-					for _, specIP := range deviceSpec.IPAddrs {
-						// The static IP assigned to the VM is required in the CIDR format
-						ip, _, _ := gonet.ParseCIDR(specIP)
-						if discoveredIP == ip.String() {
-							isStatic = true
-							break
-						}
-					}
-
-					// If it's a static IP then check to see if the IP has
-					// triggered a reconcile yet.
-					switch {
-					case isStatic:
-						if _, ok := macToHasStaticIP[mac][discoveredIP]; !ok {
-							// No reconcile yet. Record the IP send it to the
-							// channel.
-							log.Info("Discovered IP address",
-								"addressType", "static",
-								"addressValue", discoveredIP)
-							macToHasStaticIP[mac][discoveredIP] = struct{}{}
-							chanIPAddresses <- discoveredIP
-						}
-					case gonet.ParseIP(discoveredIP).To4() != nil:
-						// An IPv4 address...
-						if deviceSpec.DHCP4 {
-							// Has an IPv4 lease been discovered yet?
-							if _, ok := macToHasIPv4Lease[mac]; !ok {
-								log.Info("Discovered IP address",
-									"addressType", "dhcp4",
-									"addressValue", discoveredIP)
-								macToHasIPv4Lease[mac] = struct{}{}
-								chanIPAddresses <- discoveredIP
-							}
-						}
-					default:
-						// An IPv6 address..
-						if deviceSpec.DHCP6 {
-							// Has an IPv6 lease been discovered yet?
-							if _, ok := macToHasIPv6Lease[mac]; !ok {
-								log.Info("Discovered IP address",
-									"addressType", "dhcp6",
-									"addressValue", discoveredIP)
-								macToHasIPv6Lease[mac] = struct{}{}
-								chanIPAddresses <- discoveredIP
-							}
-						}
-					}
-				}
-			}
-		}
-
-		// Determine whether or not the wait operation is over by whether
-		// or not the VM has all of the requested IP addresses.
-		for i, deviceSpec := range virtualMachineCtx.VSphereVM.Spec.Network.Devices {
-			// If the device spec has SkipIPAllocation set true then
-			// the wait is not required
-			if deviceSpec.SkipIPAllocation {
-				continue
-			}
-
-			mac, ok := deviceToMacIndex[i]
-			if !ok {
-				chanErrs <- errors.Errorf("invalid mac index %d waiting for ip addresses for vm %s", i, virtualMachineCtx)
-
-				// Return true to stop the property collector from waiting
-				// on any more changes.
-				return true
-			}
-			// If the device spec requires DHCP4 then the Wait is not
-			// over if there is no IPv4 lease.
-			if deviceSpec.DHCP4 {
-				if _, ok := macToHasIPv4Lease[mac]; !ok {
-					log.Info("The VM is missing the requested IP address",
-						"addressType", "dhcp4")
-					return false
-				}
-			}
-			// If the device spec requires DHCP6 then the Wait is not
-			// over if there is no IPv6 lease.
-			if deviceSpec.DHCP6 {
-				if _, ok := macToHasIPv6Lease[mac]; !ok {
-					log.Info("The VM is missing the requested IP address",
-						"addressType", "dhcp6")
-					return false
-				}
-			}
-			// If the device spec requires static IP addresses, the wait
-			// is not over if the device lacks one of those addresses.
-			for _, specIP := range deviceSpec.IPAddrs {
-				ip, _, _ := gonet.ParseCIDR(specIP)
-				if _, ok := macToHasStaticIP[mac][ip.String()]; !ok {
-					log.Info("The VM is missing the requested IP address",
-						"addressType", "static",
-						"addressValue", specIP)
-					return false
-				}
-			}
-		}
-
-		log.Info("The VM has all of the requested IP addresses")
-		return true
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to stop watching VM")
 	}
-
-	// The wait function will not return true until all the VM's
-	// network devices have IP assignments that match the requested
-	// network device specs. However, every time a new IP is discovered,
-	// a reconcile request will be triggered for the VSphereVM.
-	go func() {
-		// Note: We intentionally don't use the context from the Reconcile
-		// so this go routine continues independent of the current Reconcile.
-		ctx := context.Background()
-		if err := property.Wait(
-			ctx, propCollector, virtualMachineCtx.Obj.Reference(),
-			[]string{"guest.net"}, onPropertyChange); err != nil {
-			chanErrs <- errors.Wrapf(err, "failed to wait for ip addresses for vm %s", virtualMachineCtx)
-		}
-		close(chanIPAddresses)
-		close(chanErrs)
-	}()
-
-	return chanIPAddresses, chanErrs
 }
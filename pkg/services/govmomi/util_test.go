@@ -26,10 +26,12 @@ import (
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/throttle"
 )
 
 func Test_ShouldRetryTask(t *testing.T) {
@@ -128,6 +130,41 @@ func Test_ShouldRetryTask(t *testing.T) {
 	})
 }
 
+func Test_acquireTask(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	controllerManagerCtx := &capvcontext.ControllerManagerContext{
+		TaskLimiter: throttle.NewTaskLimiter(throttle.Options{MaxInFlight: 1}),
+	}
+	newVMContext := func(name string, labels map[string]string) *capvcontext.VMContext {
+		return &capvcontext.VMContext{
+			ControllerManagerContext: controllerManagerCtx,
+			VSphereVM: &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "my-namespace", Labels: labels},
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Server: "vcenter"},
+				},
+			},
+		}
+	}
+	worker0 := newVMContext("worker-0", nil)
+	worker1 := newVMContext("worker-1", nil)
+	controlPlane := newVMContext("control-plane", map[string]string{clusterv1.MachineControlPlaneLabel: ""})
+
+	g.Expect(acquireTask(worker0)).To(BeTrue())
+	g.Expect(acquireTask(worker1)).To(BeFalse())
+	g.Expect(acquireTask(controlPlane)).To(BeFalse())
+
+	// The task of the first worker is released once it is no longer in
+	// flight, and the control plane machine is dequeued first.
+	inFlight, err := reconcileInFlightTask(ctx, worker0)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inFlight).To(BeFalse())
+	g.Expect(acquireTask(worker1)).To(BeFalse())
+	g.Expect(acquireTask(controlPlane)).To(BeTrue())
+}
+
 func baseTask(state types.TaskInfoState, errorDescription string) mo.Task {
 	t := mo.Task{
 		ExtensibleManagedObject: mo.ExtensibleManagedObject{
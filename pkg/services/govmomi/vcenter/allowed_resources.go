@@ -0,0 +1,183 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
+)
+
+// CheckAllowedResources returns an identity.ResourceNotAllowedError if one of
+// the inventory objects the VSphereVM is cloned with is not allowed by the
+// VSphereClusterIdentity of its cluster. The objects are resolved like when
+// the VM is cloned, and checked by their inventory paths.
+func CheckAllowedResources(ctx context.Context, vmCtx *capvcontext.VMContext) error {
+	if vmCtx.VSphereClusterIdentity == nil || vmCtx.VSphereClusterIdentity.Spec.AllowedResources == nil {
+		return nil
+	}
+	spec := vmCtx.VSphereVM.Spec
+	finder := vmCtx.Session.Finder
+
+	datacenter, err := finder.DatacenterOrDefault(ctx, spec.Datacenter)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get datacenter for %q", ctx)
+	}
+	if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.DatacenterResource, datacenter.InventoryPath); err != nil {
+		return err
+	}
+
+	folder, err := finder.FolderOrDefault(ctx, spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+	if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.FolderResource, folder.InventoryPath); err != nil {
+		return err
+	}
+
+	pool, err := finder.ResourcePoolOrDefault(ctx, spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+	if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.ResourcePoolResource, pool.InventoryPath); err != nil {
+		return err
+	}
+
+	if spec.Datastore != "" {
+		datastore, err := finder.Datastore(ctx, spec.Datastore)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get datastore %s for %q", spec.Datastore, ctx)
+		}
+		if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.DatastoreResource, datastore.InventoryPath); err != nil {
+			return err
+		}
+	}
+	if spec.DatastoreCluster != "" {
+		datastoreCluster, err := finder.DatastoreCluster(ctx, spec.DatastoreCluster)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get datastore cluster %s for %q", spec.DatastoreCluster, ctx)
+		}
+		if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.DatastoreResource, datastoreCluster.InventoryPath); err != nil {
+			return err
+		}
+	}
+
+	for _, device := range spec.Network.Devices {
+		if device.NetworkName == "" {
+			continue
+		}
+		network, err := finder.Network(ctx, device.NetworkName)
+		if err != nil {
+			return errors.Wrapf(err, "unable to find network %q for %q", device.NetworkName, ctx)
+		}
+		if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.NetworkResource, network.GetInventoryPath()); err != nil {
+			return err
+		}
+	}
+
+	// The instant clone parents which are not found are skipped when the VM
+	// is cloned.
+	for _, name := range spec.InstantCloneParents {
+		parent, err := finder.VirtualMachine(ctx, name)
+		if err != nil {
+			if errors.As(err, new(*find.NotFoundError)) {
+				continue
+			}
+			return errors.Wrapf(err, "unable to find instant clone parent %q for %q", name, ctx)
+		}
+		if err := identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.TemplateResource, parent.InventoryPath); err != nil {
+			return err
+		}
+	}
+	return checkAllowedTemplate(ctx, vmCtx)
+}
+
+// checkAllowedTemplate returns an identity.ResourceNotAllowedError if the
+// template or the Content Library item the VSphereVM is cloned from is not
+// allowed by the VSphereClusterIdentity of its cluster. The items are checked
+// by the path /<library>/<item>.
+func checkAllowedTemplate(ctx context.Context, vmCtx *capvcontext.VMContext) error {
+	spec := vmCtx.VSphereVM.Spec
+	if itemSpec := spec.ContentLibraryItem; itemSpec != nil {
+		item, err := template.FindContentLibraryItem(ctx, vmCtx.GetSession(), *itemSpec)
+		if err != nil {
+			return err
+		}
+		lib, err := library.NewManager(vmCtx.Session.TagManager.Client).GetLibraryByID(ctx, item.LibraryID)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get Content Library of item %q for %q", item.Name, ctx)
+		}
+		return identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.TemplateResource, path.Join("/", lib.Name, item.Name))
+	}
+
+	if spec.Template == "" {
+		return nil
+	}
+	tpl, err := template.FindTemplate(ctx, vmCtx.GetSession(), spec.Template)
+	if err != nil {
+		return err
+	}
+	inventoryPath, err := find.InventoryPath(ctx, vmCtx.Session.Client.Client, tpl.Reference())
+	if err != nil {
+		return errors.Wrapf(err, "unable to get inventory path of template %s for %q", spec.Template, ctx)
+	}
+	return identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.TemplateResource, inventoryPath)
+}
+
+// checkAllowedDatastore returns an identity.ResourceNotAllowedError if the
+// datastore selected for the VSphereVM is not allowed by the
+// VSphereClusterIdentity of its cluster.
+func checkAllowedDatastore(ctx context.Context, vmCtx *capvcontext.VMContext, datastoreRef types.ManagedObjectReference) error {
+	if vmCtx.VSphereClusterIdentity == nil || vmCtx.VSphereClusterIdentity.Spec.AllowedResources == nil {
+		return nil
+	}
+	inventoryPath, err := find.InventoryPath(ctx, vmCtx.Session.Client.Client, datastoreRef)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get inventory path of datastore %s for %q", datastoreRef.Value, ctx)
+	}
+	return identity.CheckAllowedResource(vmCtx.VSphereClusterIdentity, identity.DatastoreResource, inventoryPath)
+}
+
+// checkAllowedInstantCloneDatastores returns an
+// identity.ResourceNotAllowedError if a datastore of the instant clone parent,
+// on which the instant clone is placed when the VSphereVM sets no datastore, is
+// not allowed by the VSphereClusterIdentity of its cluster.
+func checkAllowedInstantCloneDatastores(ctx context.Context, vmCtx *capvcontext.VMContext, parent *object.VirtualMachine) error {
+	if vmCtx.VSphereClusterIdentity == nil || vmCtx.VSphereClusterIdentity.Spec.AllowedResources == nil {
+		return nil
+	}
+	var o mo.VirtualMachine
+	if err := parent.Properties(ctx, parent.Reference(), []string{"datastore"}, &o); err != nil {
+		return errors.Wrapf(err, "unable to get datastores of instant clone parent for %q", ctx)
+	}
+	for _, datastoreRef := range o.Datastore {
+		if err := checkAllowedDatastore(ctx, vmCtx, datastoreRef); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/identity"
+)
+
+func TestCheckAllowedResources(t *testing.T) {
+	model, session, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+
+	newVMContext := func(allowedResources *infrav1.AllowedResources) *capvcontext.VMContext {
+		return &capvcontext.VMContext{
+			Session: session,
+			VSphereVM: &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "vsphereVM1",
+					Namespace: "my-namespace",
+				},
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						Datastore: "LocalDS_0",
+						Network: infrav1.NetworkSpec{
+							Devices: []infrav1.NetworkDeviceSpec{{NetworkName: "VM Network"}},
+						},
+					},
+				},
+			},
+			VSphereClusterIdentity: &infrav1.VSphereClusterIdentity{
+				ObjectMeta: metav1.ObjectMeta{Name: "identity"},
+				Spec:       infrav1.VSphereClusterIdentitySpec{AllowedResources: allowedResources},
+			},
+		}
+	}
+
+	t.Run("allows all the resources without restriction", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(CheckAllowedResources(ctx, newVMContext(nil))).To(Succeed())
+	})
+
+	t.Run("checks the inventory paths of the default resources", func(t *testing.T) {
+		g := NewWithT(t)
+		vmCtx := newVMContext(&infrav1.AllowedResources{
+			Datacenters:   []string{"/DC0"},
+			Folders:       []string{"/DC0/vm"},
+			ResourcePools: []string{"/DC0/host/DC0_C0/Resources"},
+			Networks:      []string{"/DC0/network/*"},
+			Datastores:    []string{"LocalDS_*"},
+		})
+		g.Expect(CheckAllowedResources(ctx, vmCtx)).To(Succeed())
+	})
+
+	t.Run("returns the first resource which is not allowed", func(t *testing.T) {
+		g := NewWithT(t)
+		vmCtx := newVMContext(&infrav1.AllowedResources{
+			Folders:    []string{"/DC0/vm/team-a"},
+			Datastores: []string{"team-a-*"},
+		})
+		err := CheckAllowedResources(ctx, vmCtx)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err).To(Equal(&identity.ResourceNotAllowedError{Identity: "identity", Kind: identity.FolderResource, Resource: "/DC0/vm"}))
+
+		vmCtx.VSphereClusterIdentity.Spec.AllowedResources.Folders = nil
+		err = CheckAllowedResources(ctx, vmCtx)
+		g.Expect(err).To(Equal(&identity.ResourceNotAllowedError{Identity: "identity", Kind: identity.DatastoreResource, Resource: "/DC0/datastore/LocalDS_0"}))
+	})
+
+	t.Run("checks the selected datastore", func(t *testing.T) {
+		g := NewWithT(t)
+		datastore, err := session.Finder.Datastore(ctx, "LocalDS_0")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmCtx := newVMContext(&infrav1.AllowedResources{Datastores: []string{"/DC0/datastore/LocalDS_0"}})
+		g.Expect(checkAllowedDatastore(ctx, vmCtx, datastore.Reference())).To(Succeed())
+
+		vmCtx.VSphereClusterIdentity.Spec.AllowedResources.Datastores = []string{"team-a-*"}
+		g.Expect(checkAllowedDatastore(ctx, vmCtx, datastore.Reference())).To(HaveOccurred())
+	})
+
+	t.Run("checks the template", func(t *testing.T) {
+		g := NewWithT(t)
+		vmCtx := newVMContext(&infrav1.AllowedResources{Templates: []string{"/DC0/vm/DC0_C0_RP0_VM0"}})
+		vmCtx.VSphereVM.Spec.Template = "DC0_C0_RP0_VM0"
+		g.Expect(CheckAllowedResources(ctx, vmCtx)).To(Succeed())
+
+		vmCtx.VSphereClusterIdentity.Spec.AllowedResources.Templates = []string{"team-a-*"}
+		err := CheckAllowedResources(ctx, vmCtx)
+		g.Expect(err).To(Equal(&identity.ResourceNotAllowedError{Identity: "identity", Kind: identity.TemplateResource, Resource: "/DC0/vm/DC0_C0_RP0_VM0"}))
+	})
+
+	t.Run("checks the instant clone parents", func(t *testing.T) {
+		g := NewWithT(t)
+		vmCtx := newVMContext(&infrav1.AllowedResources{Templates: []string{"/DC0/vm/DC0_C0_RP0_VM0"}})
+		vmCtx.VSphereVM.Spec.CloneMode = infrav1.InstantClone
+		vmCtx.VSphereVM.Spec.InstantCloneParents = []string{"DC0_C0_RP0_VM0", "missing-parent"}
+		g.Expect(CheckAllowedResources(ctx, vmCtx)).To(Succeed())
+
+		vmCtx.VSphereVM.Spec.InstantCloneParents = append(vmCtx.VSphereVM.Spec.InstantCloneParents, "DC0_C0_RP0_VM1")
+		err := CheckAllowedResources(ctx, vmCtx)
+		g.Expect(err).To(Equal(&identity.ResourceNotAllowedError{Identity: "identity", Kind: identity.TemplateResource, Resource: "/DC0/vm/DC0_C0_RP0_VM1"}))
+	})
+
+	t.Run("checks the datastores of the instant clone parent", func(t *testing.T) {
+		g := NewWithT(t)
+		parent, err := session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmCtx := newVMContext(&infrav1.AllowedResources{Datastores: []string{"/DC0/datastore/LocalDS_0"}})
+		g.Expect(checkAllowedInstantCloneDatastores(ctx, vmCtx, parent)).To(Succeed())
+
+		vmCtx.VSphereClusterIdentity.Spec.AllowedResources.Datastores = []string{"team-a-*"}
+		err = checkAllowedInstantCloneDatastores(ctx, vmCtx, parent)
+		g.Expect(err).To(Equal(&identity.ResourceNotAllowedError{Identity: "identity", Kind: identity.DatastoreResource, Resource: "/DC0/datastore/LocalDS_0"}))
+	})
+}
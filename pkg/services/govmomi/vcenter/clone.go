@@ -20,8 +20,6 @@ package vcenter
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"time"
 
 	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/object"
@@ -35,6 +33,7 @@ import (
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
 )
@@ -53,6 +52,7 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 	vmCtx = &capvcontext.VMContext{
 		ControllerManagerContext: vmCtx.ControllerManagerContext,
 		VSphereVM:                vmCtx.VSphereVM,
+		VSphereClusterIdentity:   vmCtx.VSphereClusterIdentity,
 		Session:                  vmCtx.Session,
 		PatchHelper:              vmCtx.PatchHelper,
 	}
@@ -68,16 +68,92 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 			extraConfig.SetIgnitionUserData(bootstrapData)
 		}
 	}
+	if vmCtx.ControllerManagerContext != nil && vmCtx.ManagerID != "" {
+		extraConfig.SetManagedBy(vmCtx.ManagerID)
+	}
 	if vmCtx.VSphereVM.Spec.CustomVMXKeys != nil {
 		log.Info("Applied custom vmx keys o VM clone spec")
 		if err := extraConfig.SetCustomVMXKeys(vmCtx.VSphereVM.Spec.CustomVMXKeys); err != nil {
 			return err
 		}
 	}
-	tpl, err := template.FindTemplate(ctx, vmCtx.GetSession(), vmCtx.VSphereVM.Spec.Template)
+
+	// If an instant clone is requested then fork one of the running parent
+	// VMs, or fall back to a full clone if none of them is available. The
+	// clone mode of the status is only set to InstantClone before the VM
+	// exists if a previous instant clone failed, in which case the VM is
+	// fully cloned as well.
+	switch {
+	case vmCtx.VSphereVM.Spec.CloneMode != infrav1.InstantClone:
+	case vmCtx.VSphereVM.Status.CloneMode == infrav1.InstantClone:
+		log.Info("Instant clone failed, falling back to full clone", "parent", vmCtx.VSphereVM.Status.InstantCloneParent)
+		vmCtx.VSphereVM.Status.InstantCloneParent = ""
+	default:
+		log.Info("Instant clone requested")
+		parent, parentName, err := findInstantCloneParent(ctx, vmCtx)
+		if err != nil {
+			return err
+		}
+		if parent != nil {
+			return instantClone(ctx, vmCtx, parent, parentName, extraConfig)
+		}
+		log.Info("No instant clone parent is available, falling back to full clone")
+	}
+
+	folder, err := vmCtx.Session.Finder.FolderOrDefault(ctx, vmCtx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+
+	pool, err := vmCtx.Session.Finder.ResourcePoolOrDefault(ctx, vmCtx.VSphereVM.Spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+
+	datastoreRef, err := selectDatastore(ctx, vmCtx, pool)
 	if err != nil {
 		return err
 	}
+	// The datastore and the datastore cluster of the spec are checked before
+	// cloning, but not the datastore selected by the storage policy, by
+	// default or in the datastore cluster, which is checked once known.
+	if vmCtx.VSphereVM.Spec.Datastore == "" && !usesDatastoreCluster(vmCtx.VSphereVM) {
+		if err := checkAllowedDatastore(ctx, vmCtx, datastoreRef); err != nil {
+			return err
+		}
+	}
+
+	var tpl *object.VirtualMachine
+	if itemSpec := vmCtx.VSphereVM.Spec.ContentLibraryItem; itemSpec != nil {
+		item, err := template.FindContentLibraryItem(ctx, vmCtx.GetSession(), *itemSpec)
+		if err != nil {
+			return err
+		}
+
+		// The items are deployed to the datastore of the datastore cluster
+		// with the most free space.
+		if usesDatastoreCluster(vmCtx.VSphereVM) {
+			if err := checkAllowedDatastore(ctx, vmCtx, datastoreRef); err != nil {
+				return err
+			}
+		}
+
+		if !itemSpec.CacheTemplate {
+			return deployContentLibraryItem(ctx, vmCtx, item, folder, pool, datastoreRef, extraConfig)
+		}
+		var contentVersion string
+		tpl, contentVersion, err = getOrCreateContentLibraryTemplate(ctx, vmCtx, item, folder, pool, datastoreRef)
+		if err != nil || tpl == nil {
+			return err
+		}
+		// The version is only recorded once the template of the item exists.
+		vmCtx.VSphereVM.Status.ContentLibraryItemVersion = contentVersion
+	} else {
+		tpl, err = template.FindTemplate(ctx, vmCtx.GetSession(), vmCtx.VSphereVM.Spec.Template)
+		if err != nil {
+			return err
+		}
+	}
 
 	// If a linked clone is requested then a MoRef for a snapshot must be
 	// found with which to perform the linked clone.
@@ -91,7 +167,7 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 			log.Info("Searching for current snapshot")
 			var vm mo.VirtualMachine
 			if err := tpl.Properties(ctx, tpl.Reference(), []string{"snapshot"}, &vm); err != nil {
-				return errors.Wrapf(err, "error getting snapshot information for template %s", vmCtx.VSphereVM.Spec.Template)
+				return errors.Wrapf(err, "error getting snapshot information for template %s", tpl.Reference())
 			}
 			if vm.Snapshot != nil {
 				snapshotRef = vm.Snapshot.CurrentSnapshot
@@ -118,115 +194,172 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 		diskMoveType = linkCloneDiskMoveType
 	}
 
-	folder, err := vmCtx.Session.Finder.FolderOrDefault(ctx, vmCtx.VSphereVM.Spec.Folder)
+	devices, err := tpl.Device(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+		return errors.Wrapf(err, "error getting devices for %q", ctx)
 	}
 
-	pool, err := vmCtx.Session.Finder.ResourcePoolOrDefault(ctx, vmCtx.VSphereVM.Spec.ResourcePool)
+	// Only non-linked clones may expand the size of the template's disk.
+	deviceSpecs, err := getDeviceSpecs(ctx, vmCtx, devices, snapshotRef == nil)
 	if err != nil {
-		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+		return err
 	}
 
-	devices, err := tpl.Device(ctx)
+	spec := types.VirtualMachineCloneSpec{
+		Config: newVMConfigSpec(vmCtx, deviceSpecs, extraConfig),
+		Location: types.VirtualMachineRelocateSpec{
+			DiskMoveType: string(diskMoveType),
+			Folder:       types.NewReference(folder.Reference()),
+			Pool:         types.NewReference(pool.Reference()),
+			Datastore:    types.NewReference(datastoreRef),
+		},
+		// This is implicit, but making it explicit as it is important to not
+		// power the VM on before its virtual hardware is created and the MAC
+		// address(es) used to build and inject the VM with cloud-init metadata
+		// are generated.
+		PowerOn:  false,
+		Snapshot: snapshotRef,
+	}
+
+	// The datastore of a VM in a datastore cluster is recommended by Storage
+	// DRS. It replaces the datastore of the cluster with the most free space,
+	// which is only used for the deployments of Content Library items.
+	if usesDatastoreCluster(vmCtx.VSphereVM) {
+		recommended, err := recommendDatastore(ctx, vmCtx, tpl, folder, spec)
+		if err != nil {
+			return err
+		}
+		if err := checkAllowedDatastore(ctx, vmCtx, recommended); err != nil {
+			return err
+		}
+		datastoreRef = recommended
+		spec.Location.Datastore = types.NewReference(datastoreRef)
+	}
+
+	disks := devices.SelectByType((*types.VirtualDisk)(nil))
+	isLinkedClone := snapshotRef != nil
+	spec.Location.Disk = getDiskLocators(disks, datastoreRef, isLinkedClone)
+
+	log.Info(fmt.Sprintf("Cloning Machine with clone mode %s", vmCtx.VSphereVM.Status.CloneMode))
+	task, err := tpl.Clone(ctx, folder, vmCtx.VSphereVM.Name, spec)
 	if err != nil {
-		return errors.Wrapf(err, "error getting devices for %q", ctx)
+		metrics.RecordFailure(metrics.OperationClone, err)
+		return errors.Wrapf(err, "error trigging clone op for machine %s", ctx)
 	}
 
-	// Create a new list of device specs for cloning the VM.
+	setCloneTaskRef(ctx, vmCtx, task)
+	return nil
+}
+
+// getDeviceSpecs returns the device specs which configure the disks and the
+// network devices of a VM created from a source VM with the given devices.
+func getDeviceSpecs(ctx context.Context, vmCtx *capvcontext.VMContext, devices object.VirtualDeviceList, resizeDisks bool) ([]types.BaseVirtualDeviceConfigSpec, error) {
 	var deviceSpecs []types.BaseVirtualDeviceConfigSpec
 
-	// Only non-linked clones may expand the size of the template's disk.
-	if snapshotRef == nil {
+	if resizeDisks {
 		diskSpecs, err := getDiskSpec(vmCtx, devices)
 		if err != nil {
-			return errors.Wrapf(err, "error getting disk spec for %q", ctx)
+			return nil, errors.Wrapf(err, "error getting disk spec for %q", ctx)
 		}
 		deviceSpecs = append(deviceSpecs, diskSpecs...)
 	}
 
 	networkSpecs, err := getNetworkSpecs(ctx, vmCtx, devices)
 	if err != nil {
-		return errors.Wrapf(err, "error getting network specs for %q", ctx)
+		return nil, errors.Wrapf(err, "error getting network specs for %q", ctx)
 	}
-
 	deviceSpecs = append(deviceSpecs, networkSpecs...)
 
+	dataDiskSpecs, err := getDataDiskSpecs(ctx, vmCtx, devices)
 	if err != nil {
-		return errors.Wrapf(err, "error getting network specs for %q", ctx)
+		return nil, errors.Wrapf(err, "error getting data disk specs for %q", ctx)
 	}
 
-	numCPUs := vmCtx.VSphereVM.Spec.NumCPUs
+	return append(deviceSpecs, dataDiskSpecs...), nil
+}
+
+// VMResources returns the number of CPUs, the number of cores per socket and
+// the memory in MiB of the VM of a VSphereVM, with the defaults applied when
+// the VM is created.
+func VMResources(vsphereVM *infrav1.VSphereVM) (numCPUs, numCoresPerSocket int32, memMiB int64) {
+	numCPUs = vsphereVM.Spec.NumCPUs
 	if numCPUs < 2 {
 		numCPUs = 2
 	}
-	numCoresPerSocket := vmCtx.VSphereVM.Spec.NumCoresPerSocket
+	numCoresPerSocket = vsphereVM.Spec.NumCoresPerSocket
 	if numCoresPerSocket == 0 {
 		numCoresPerSocket = numCPUs
 	}
-	memMiB := vmCtx.VSphereVM.Spec.MemoryMiB
+	memMiB = vsphereVM.Spec.MemoryMiB
 	if memMiB == 0 {
 		memMiB = 2048
 	}
+	return numCPUs, numCoresPerSocket, memMiB
+}
+
+// newVMConfigSpec returns the config spec applied to a VM when it is created.
+func newVMConfigSpec(vmCtx *capvcontext.VMContext, deviceSpecs []types.BaseVirtualDeviceConfigSpec, extraConfig extra.Config) *types.VirtualMachineConfigSpec {
+	numCPUs, numCoresPerSocket, memMiB := VMResources(vmCtx.VSphereVM)
 
 	// Disable the vAppConfig during VM creation to ensure Cloud-Init inside of the guest does not
 	// activate and prefer the OVF datasource over the VMware datasource.
 	vappConfigRemoved := true
 
-	spec := types.VirtualMachineCloneSpec{
-		Config: &types.VirtualMachineConfigSpec{
-			// Assign the clone's InstanceUUID the value of the Kubernetes Machine
-			// object's UID. This allows lookup of the cloned VM prior to knowing
-			// the VM's UUID.
-			InstanceUuid:      string(vmCtx.VSphereVM.UID),
-			Flags:             newVMFlagInfo(),
-			DeviceChange:      deviceSpecs,
-			ExtraConfig:       extraConfig,
-			NumCPUs:           numCPUs,
-			NumCoresPerSocket: numCoresPerSocket,
-			MemoryMB:          memMiB,
-			VAppConfigRemoved: &vappConfigRemoved,
-		},
-		Location: types.VirtualMachineRelocateSpec{
-			DiskMoveType: string(diskMoveType),
-			Folder:       types.NewReference(folder.Reference()),
-			Pool:         types.NewReference(pool.Reference()),
-		},
-		// This is implicit, but making it explicit as it is important to not
-		// power the VM on before its virtual hardware is created and the MAC
-		// address(es) used to build and inject the VM with cloud-init metadata
-		// are generated.
-		PowerOn:  false,
-		Snapshot: snapshotRef,
+	configSpec := &types.VirtualMachineConfigSpec{
+		// Assign the clone's InstanceUUID the value of the Kubernetes Machine
+		// object's UID. This allows lookup of the cloned VM prior to knowing
+		// the VM's UUID.
+		InstanceUuid:      string(vmCtx.VSphereVM.UID),
+		Flags:             newVMFlagInfo(),
+		DeviceChange:      deviceSpecs,
+		ExtraConfig:       extraConfig,
+		NumCPUs:           numCPUs,
+		NumCoresPerSocket: numCoresPerSocket,
+		MemoryMB:          memMiB,
+		VAppConfigRemoved: &vappConfigRemoved,
+		CpuAllocation:     ResourceAllocationInfo(vmCtx.VSphereVM.Spec.CPUAllocation),
+		MemoryAllocation:  ResourceAllocationInfo(vmCtx.VSphereVM.Spec.MemoryAllocation),
 	}
 
 	// For PCI devices, the memory for the VM needs to be reserved
 	// We can replace this once we have another way of reserving memory option
 	// exposed via the API types.
 	if len(vmCtx.VSphereVM.Spec.PciDevices) > 0 {
-		spec.Config.MemoryReservationLockedToMax = ptr.To(true)
+		configSpec.MemoryReservationLockedToMax = ptr.To(true)
 	}
 
+	return configSpec
+}
+
+// selectDatastore returns the datastore on which a VM is created. It is either
+// the datastore of the VSphereVM, a datastore of its datastore cluster, a
+// datastore compatible with its storage policy, or the default datastore.
+func selectDatastore(ctx context.Context, vmCtx *capvcontext.VMContext, pool *object.ResourcePool) (types.ManagedObjectReference, error) {
 	var datastoreRef *types.ManagedObjectReference
 	if vmCtx.VSphereVM.Spec.Datastore != "" {
 		datastore, err := vmCtx.Session.Finder.Datastore(ctx, vmCtx.VSphereVM.Spec.Datastore)
 		if err != nil {
-			return errors.Wrapf(err, "unable to get datastore %s for %q", vmCtx.VSphereVM.Spec.Datastore, ctx)
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get datastore %s for %q", vmCtx.VSphereVM.Spec.Datastore, ctx)
 		}
 		datastoreRef = types.NewReference(datastore.Reference())
-		spec.Location.Datastore = datastoreRef
+	} else if usesDatastoreCluster(vmCtx.VSphereVM) {
+		ref, err := selectDatastoreClusterDatastore(ctx, vmCtx)
+		if err != nil {
+			return types.ManagedObjectReference{}, err
+		}
+		datastoreRef = &ref
 	}
 
 	var storageProfileID string
 	if vmCtx.VSphereVM.Spec.StoragePolicyName != "" {
 		pbmClient, err := pbm.NewClient(ctx, vmCtx.Session.Client.Client)
 		if err != nil {
-			return errors.Wrapf(err, "unable to create pbm client for %q", ctx)
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to create pbm client for %q", ctx)
 		}
 
 		storageProfileID, err = pbmClient.ProfileIDByName(ctx, vmCtx.VSphereVM.Spec.StoragePolicyName)
 		if err != nil {
-			return errors.Wrapf(err, "unable to get storageProfileID from name %s for %q", vmCtx.VSphereVM.Spec.StoragePolicyName, ctx)
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get storageProfileID from name %s for %q", vmCtx.VSphereVM.Spec.StoragePolicyName, ctx)
 		}
 
 		var hubs []pbmTypes.PbmPlacementHub
@@ -241,12 +374,12 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 			// Otherwise we should get just the Datastores connected to our pool
 			cluster, err := pool.Owner(ctx)
 			if err != nil {
-				return errors.Wrapf(err, "failed to get owning cluster of resourcepool %q to calculate datastore based on storage policy", pool)
+				return types.ManagedObjectReference{}, errors.Wrapf(err, "failed to get owning cluster of resourcepool %q to calculate datastore based on storage policy", pool)
 			}
 			dsGetter := object.NewComputeResource(vmCtx.Session.Client.Client, cluster.Reference())
 			datastores, err := dsGetter.Datastores(ctx)
 			if err != nil {
-				return errors.Wrapf(err, "unable to list datastores from owning cluster of requested resourcepool")
+				return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to list datastores from owning cluster of requested resourcepool")
 			}
 			for _, ds := range datastores {
 				hubs = append(hubs, pbmTypes.PbmPlacementHub{
@@ -260,20 +393,22 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 		constraints = append(constraints, &pbmTypes.PbmPlacementCapabilityProfileRequirement{ProfileId: pbmTypes.PbmProfileId{UniqueId: storageProfileID}})
 		result, err := pbmClient.CheckRequirements(ctx, hubs, nil, constraints)
 		if err != nil {
-			return errors.Wrapf(err, "unable to check requirements for storage policy")
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to check requirements for storage policy")
 		}
 
 		if len(result.CompatibleDatastores()) == 0 {
-			return fmt.Errorf("no compatible datastores found for storage policy: %s", vmCtx.VSphereVM.Spec.StoragePolicyName)
+			return types.ManagedObjectReference{}, fmt.Errorf("no compatible datastores found for storage policy: %s", vmCtx.VSphereVM.Spec.StoragePolicyName)
 		}
 
 		// If datastoreRef is nil here it means that the user didn't specify a Datastore. So we should
 		// select one of the datastores of the owning cluster of the resource pool that matched the
-		// requirements of the storage policy.
+		// requirements of the storage policy, according to the datastore selection policy.
 		if datastoreRef == nil {
-			r := rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec // We won't need cryptographically secure randomness here.
-			ds := result.CompatibleDatastores()[r.Intn(len(result.CompatibleDatastores()))]
-			datastoreRef = &types.ManagedObjectReference{Type: ds.HubType, Value: ds.HubId}
+			ref, err := selectCompatibleDatastore(ctx, vmCtx, result.CompatibleDatastores())
+			if err != nil {
+				return types.ManagedObjectReference{}, err
+			}
+			datastoreRef = &ref
 		}
 	}
 
@@ -283,21 +418,17 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 		// if no datastore defined through VM spec or storage policy, use default
 		datastore, err := vmCtx.Session.Finder.DefaultDatastore(ctx)
 		if err != nil {
-			return errors.Wrapf(err, "unable to get default datastore for %q", ctx)
+			return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get default datastore for %q", ctx)
 		}
 		datastoreRef = types.NewReference(datastore.Reference())
 	}
 
-	disks := devices.SelectByType((*types.VirtualDisk)(nil))
-	isLinkedClone := snapshotRef != nil
-	spec.Location.Disk = getDiskLocators(disks, *datastoreRef, isLinkedClone)
-	spec.Location.Datastore = datastoreRef
+	return *datastoreRef, nil
+}
 
-	log.Info(fmt.Sprintf("Cloning Machine with clone mode %s", vmCtx.VSphereVM.Status.CloneMode))
-	task, err := tpl.Clone(ctx, folder, vmCtx.VSphereVM.Name, spec)
-	if err != nil {
-		return errors.Wrapf(err, "error trigging clone op for machine %s", ctx)
-	}
+// setCloneTaskRef records the clone task in the status of the VSphereVM.
+func setCloneTaskRef(ctx context.Context, vmCtx *capvcontext.VMContext, task *object.Task) {
+	log := ctrl.LoggerFrom(ctx)
 
 	vmCtx.VSphereVM.Status.TaskRef = task.Reference().Value
 
@@ -307,7 +438,6 @@ func Clone(ctx context.Context, vmCtx *capvcontext.VMContext, bootstrapData []by
 	if err := vmCtx.Patch(ctx); err != nil {
 		log.Error(err, "Failed to patch VSphereVM (best-effort)")
 	}
-	return nil
 }
 
 func newVMFlagInfo() *types.VirtualMachineFlagInfo {
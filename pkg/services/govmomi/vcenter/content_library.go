@@ -0,0 +1,356 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	vapivcenter "github.com/vmware/govmomi/vapi/vcenter"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/template"
+)
+
+// contentLibraryTemplateSnapshot is the name of the snapshot taken on cached
+// Content Library templates, from which linked clones are created.
+const contentLibraryTemplateSnapshot = "capv-content-library"
+
+// contentLibraryDeployments are the deployments of Content Library items
+// running in the background, by the UID of the VSphereVM they are deployed
+// for. The deploy operation of the vAPI is synchronous and has no task which
+// could be recorded in the status of the VSphereVM, so it is not run by the
+// reconcile itself.
+var contentLibraryDeployments sync.Map
+
+// contentLibraryDeployment is the deployment of a Content Library item
+// running in the background.
+type contentLibraryDeployment struct {
+	done           chan struct{}
+	contentVersion string
+	vm             *object.VirtualMachine
+	err            error
+}
+
+// deployInBackground runs the deploy function in the background for the
+// VSphereVM, unless it is already running. It returns a nil VM and no error
+// while the deployment is running, and the deployed VM with the version of the
+// item once it completed, after which the deployment is forgotten.
+func deployInBackground(ctx context.Context, vmCtx *capvcontext.VMContext, item *library.Item, deploy func(context.Context) (*object.VirtualMachine, error)) (*object.VirtualMachine, string, error) {
+	actual, running := contentLibraryDeployments.LoadOrStore(vmCtx.VSphereVM.UID, &contentLibraryDeployment{done: make(chan struct{}), contentVersion: item.ContentVersion})
+	d := actual.(*contentLibraryDeployment)
+	if !running {
+		// The deployment outlives the reconcile which started it.
+		go func(ctx context.Context) {
+			defer close(d.done)
+			d.vm, d.err = deploy(ctx)
+		}(context.WithoutCancel(ctx))
+	}
+
+	select {
+	case <-d.done:
+		contentLibraryDeployments.Delete(vmCtx.VSphereVM.UID)
+		if conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition) == infrav1.DeployingContentLibraryItemReason {
+			conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.CloningReason, clusterv1.ConditionSeverityInfo, "")
+		}
+		return d.vm, d.contentVersion, d.err
+	default:
+		conditions.MarkFalse(vmCtx.VSphereVM, infrav1.VMProvisionedCondition, infrav1.DeployingContentLibraryItemReason, clusterv1.ConditionSeverityInfo,
+			"deploying Content Library item %q version %s", item.Name, d.contentVersion)
+		return nil, "", nil
+	}
+}
+
+// IsDeployingInBackground returns whether a Content Library item is being
+// deployed in the background for the VSphereVM, or was deployed since its
+// last reconcile.
+func IsDeployingInBackground(vmCtx *capvcontext.VMContext) bool {
+	_, ok := contentLibraryDeployments.Load(vmCtx.VSphereVM.UID)
+	return ok
+}
+
+// DestroyContentLibraryDeployment destroys the VM deployed from a Content
+// Library item for a VSphereVM which is deleted before the VM is configured,
+// and which is therefore not found by its instance UUID or its name. It
+// returns false while the item is still being deployed in the background.
+func DestroyContentLibraryDeployment(ctx context.Context, vmCtx *capvcontext.VMContext) (bool, error) {
+	if vmCtx.VSphereVM.Spec.ContentLibraryItem == nil {
+		return true, nil
+	}
+
+	if actual, ok := contentLibraryDeployments.Load(vmCtx.VSphereVM.UID); ok {
+		select {
+		case <-actual.(*contentLibraryDeployment).done:
+			contentLibraryDeployments.Delete(vmCtx.VSphereVM.UID)
+		default:
+			ctrl.LoggerFrom(ctx).Info("Waiting for the deployment of the Content Library item to complete before deleting the VM")
+			return false, nil
+		}
+	}
+
+	folder, err := vmCtx.Session.Finder.FolderOrDefault(ctx, vmCtx.VSphereVM.Spec.Folder)
+	if err != nil {
+		if errors.As(err, new(*find.NotFoundError)) {
+			return true, nil
+		}
+		return false, errors.Wrapf(err, "unable to find folder %q", vmCtx.VSphereVM.Spec.Folder)
+	}
+	return true, destroyTemporaryVM(ctx, vmCtx, folder, temporaryVMName(vmCtx))
+}
+
+// temporaryVMName returns the name the Content Library item is deployed with
+// for the VSphereVM, so that the deployed VM is not found by its inventory
+// path until it is configured and given the name of the VSphereVM.
+func temporaryVMName(vmCtx *capvcontext.VMContext) string {
+	return fmt.Sprintf("%s-%s", vmCtx.VSphereVM.Name, strings.SplitN(string(vmCtx.VSphereVM.UID), "-", 2)[0])
+}
+
+// destroyTemporaryVM destroys the VM with the temporary name in the folder,
+// if it exists. It is left by a deployment which completed after its
+// VSphereVM was deleted, or which was interrupted by a restart of the
+// manager.
+func destroyTemporaryVM(ctx context.Context, vmCtx *capvcontext.VMContext, folder *object.Folder, name string) error {
+	vm, err := vmCtx.Session.Finder.VirtualMachine(ctx, path.Join(folder.InventoryPath, name))
+	if err != nil {
+		if errors.As(err, new(*find.NotFoundError)) {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to find deployed VM %q", name)
+	}
+
+	ctrl.LoggerFrom(ctx).Info("Destroying VM deployed from Content Library item which was not configured", "vmRef", vm.Reference())
+	task, err := vm.Destroy(ctx)
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationDestroy, err)
+		return errors.Wrapf(err, "error destroying deployed VM %q", name)
+	}
+	return nil
+}
+
+// deployContentLibraryItem deploys the Content Library item as the VM of the
+// VSphereVM in the background and, once it is deployed, kicks off a
+// reconfigure operation which applies the same configuration as a clone
+// operation. The VM is deployed with a temporary name, and is given the name
+// of the VSphereVM by the reconfigure operation, along with its instance
+// UUID. This function does not wait for the reconfigure operation to
+// complete.
+func deployContentLibraryItem(ctx context.Context, vmCtx *capvcontext.VMContext, item *library.Item, folder *object.Folder, pool *object.ResourcePool, datastoreRef types.ManagedObjectReference, extraConfig extra.Config) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	vm, contentVersion, err := deployInBackground(ctx, vmCtx, item, func(ctx context.Context) (*object.VirtualMachine, error) {
+		name := temporaryVMName(vmCtx)
+		if err := destroyTemporaryVM(ctx, vmCtx, folder, name); err != nil {
+			return nil, err
+		}
+		log.Info("Deploying Machine from Content Library item", "item", item.Name, "contentVersion", item.ContentVersion, "name", name)
+		return deployLibraryItem(ctx, vmCtx, item, name, folder, pool, datastoreRef)
+	})
+	if err != nil || vm == nil {
+		return err
+	}
+
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		destroyDeployedVM(ctx, vm)
+		return errors.Wrapf(err, "error getting devices for %q", ctx)
+	}
+
+	deviceSpecs, err := getDeviceSpecs(ctx, vmCtx, devices, true)
+	if err != nil {
+		destroyDeployedVM(ctx, vm)
+		return err
+	}
+
+	configSpec := newVMConfigSpec(vmCtx, deviceSpecs, extraConfig)
+	configSpec.Name = vmCtx.VSphereVM.Name
+	task, err := vm.Reconfigure(ctx, *configSpec)
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationReconfigure, err)
+		destroyDeployedVM(ctx, vm)
+		return errors.Wrapf(err, "error trigging reconfigure op for deployed machine %s", ctx)
+	}
+
+	// A deployed VM has no relationship to the Content Library item.
+	vmCtx.VSphereVM.Status.CloneMode = infrav1.FullClone
+	vmCtx.VSphereVM.Status.ContentLibraryItemVersion = contentVersion
+	setCloneTaskRef(ctx, vmCtx, task)
+	return nil
+}
+
+// getOrCreateContentLibraryTemplate returns the local VM template caching the
+// version of the Content Library item on the given datastore, and the version
+// of the item. If it does not exist yet, it is created in the background, and
+// a nil template is returned until it is created.
+func getOrCreateContentLibraryTemplate(ctx context.Context, vmCtx *capvcontext.VMContext, item *library.Item, folder *object.Folder, pool *object.ResourcePool, datastoreRef types.ManagedObjectReference) (*object.VirtualMachine, string, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	datastoreName, err := object.NewDatastore(vmCtx.Session.Client.Client, datastoreRef).ObjectName(ctx)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "unable to get name of datastore %s", datastoreRef.Value)
+	}
+
+	name := contentLibraryTemplateName(item, datastoreName)
+	if !IsDeployingInBackground(vmCtx) {
+		tpl, err := findContentLibraryTemplate(ctx, vmCtx, folder, name)
+		if err != nil || tpl != nil {
+			return tpl, item.ContentVersion, err
+		}
+	}
+
+	return deployInBackground(ctx, vmCtx, item, func(ctx context.Context) (*object.VirtualMachine, error) {
+		log.Info("Caching Content Library item as a local template", "item", item.Name, "contentVersion", item.ContentVersion, "template", name)
+		return createContentLibraryTemplate(ctx, vmCtx, item, name, folder, pool, datastoreRef)
+	})
+}
+
+// findContentLibraryTemplate returns the cached Content Library template with
+// the given name, or nil if it does not exist.
+func findContentLibraryTemplate(ctx context.Context, vmCtx *capvcontext.VMContext, folder *object.Folder, name string) (*object.VirtualMachine, error) {
+	tpl, err := vmCtx.Session.Finder.VirtualMachine(ctx, path.Join(folder.InventoryPath, name))
+	if err != nil {
+		if errors.As(err, new(*find.NotFoundError)) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to find cached Content Library template %q", name)
+	}
+	ctrl.LoggerFrom(ctx).V(4).Info("Found cached Content Library template", "template", name)
+	return tpl, nil
+}
+
+// createContentLibraryTemplate deploys the Content Library item, snapshots the
+// resulting VM and marks it as a template, so that it may be used for linked
+// clones. The item is deployed with a name of its own to the VSphereVM, and
+// the template is only given its shared name once it is complete, so that
+// the machines caching the same item concurrently do not use each other's
+// partial templates. The first template to be renamed is kept.
+func createContentLibraryTemplate(ctx context.Context, vmCtx *capvcontext.VMContext, item *library.Item, name string, folder *object.Folder, pool *object.ResourcePool, datastoreRef types.ManagedObjectReference) (*object.VirtualMachine, error) {
+	deployName := fmt.Sprintf("%s-%s", name, strings.SplitN(string(vmCtx.VSphereVM.UID), "-", 2)[0])
+	tpl, err := deployLibraryItem(ctx, vmCtx, item, deployName, folder, pool, datastoreRef)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := tpl.CreateSnapshot(ctx, contentLibraryTemplateSnapshot, "Snapshot used for linked clones", false, false)
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		destroyDeployedVM(ctx, tpl)
+		return nil, errors.Wrapf(err, "error creating snapshot of cached Content Library template %q", deployName)
+	}
+
+	if err := tpl.MarkAsTemplate(ctx); err != nil {
+		destroyDeployedVM(ctx, tpl)
+		return nil, errors.Wrapf(err, "error marking %q as template", deployName)
+	}
+
+	task, err = tpl.Rename(ctx, name)
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		destroyDeployedVM(ctx, tpl)
+		// The template may have been created by another machine meanwhile.
+		if existing, findErr := findContentLibraryTemplate(ctx, vmCtx, folder, name); findErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, errors.Wrapf(err, "error renaming cached Content Library template %q to %q", deployName, name)
+	}
+
+	return tpl, nil
+}
+
+// contentLibraryTemplateName returns the name of the local VM template which
+// caches the version of the Content Library item on the given datastore.
+func contentLibraryTemplateName(item *library.Item, datastoreName string) string {
+	name := fmt.Sprintf("%s-%s-%s", item.Name, item.ContentVersion, datastoreName)
+	return strings.ReplaceAll(name, "/", "-")
+}
+
+// deployLibraryItem deploys the Content Library item as a powered off VM with
+// the given name. The deploy operation is synchronous, so it is run in the
+// background by deployInBackground.
+func deployLibraryItem(ctx context.Context, vmCtx *capvcontext.VMContext, item *library.Item, name string, folder *object.Folder, pool *object.ResourcePool, datastoreRef types.ManagedObjectReference) (*object.VirtualMachine, error) {
+	// The tags manager wraps the authenticated REST client of the session.
+	manager := vapivcenter.NewManager(vmCtx.Session.TagManager.Client)
+
+	var ref *types.ManagedObjectReference
+	var err error
+	switch item.Type {
+	case template.ContentLibraryItemTypeOVF:
+		ref, err = manager.DeployLibraryItem(ctx, item.ID, vapivcenter.Deploy{
+			DeploymentSpec: vapivcenter.DeploymentSpec{
+				Name:               name,
+				AcceptAllEULA:      true,
+				DefaultDatastoreID: datastoreRef.Value,
+			},
+			Target: vapivcenter.Target{
+				ResourcePoolID: pool.Reference().Value,
+				FolderID:       folder.Reference().Value,
+			},
+		})
+	case template.ContentLibraryItemTypeVMTemplate:
+		ref, err = manager.DeployTemplateLibraryItem(ctx, item.ID, vapivcenter.DeployTemplate{
+			Name: name,
+			Placement: &vapivcenter.Placement{
+				ResourcePool: pool.Reference().Value,
+				Folder:       folder.Reference().Value,
+			},
+			DiskStorage:   &vapivcenter.DiskStorage{Datastore: datastoreRef.Value},
+			VMHomeStorage: &vapivcenter.DiskStorage{Datastore: datastoreRef.Value},
+		})
+	default:
+		return nil, errors.Errorf("unsupported type %q of Content Library item %q", item.Type, item.Name)
+	}
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationClone, err)
+		return nil, errors.Wrapf(err, "error deploying Content Library item %q", item.Name)
+	}
+
+	return object.NewVirtualMachine(vmCtx.Session.Client.Client, *ref), nil
+}
+
+// destroyDeployedVM destroys a VM which was deployed from a Content Library
+// item but could not be configured, so that the deployment is retried.
+func destroyDeployedVM(ctx context.Context, vm *object.VirtualMachine) {
+	log := ctrl.LoggerFrom(ctx)
+
+	task, err := vm.Destroy(ctx)
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		log.Error(err, "Failed to destroy deployed VM (best-effort)", "vmRef", vm.Reference())
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+func TestContentLibraryTemplateName(t *testing.T) {
+	g := NewWithT(t)
+
+	item := &library.Item{Name: "ubuntu-2204/kube-v1.29.3", ContentVersion: "3"}
+	g.Expect(contentLibraryTemplateName(item, "LocalDS_0")).To(Equal("ubuntu-2204-kube-v1.29.3-3-LocalDS_0"))
+}
+
+func TestDeployInBackground(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	vmCtx := &capvcontext.VMContext{VSphereVM: &infrav1.VSphereVM{ObjectMeta: metav1.ObjectMeta{UID: "vm-uid"}}}
+	item := &library.Item{Name: "ubuntu", ContentVersion: "3"}
+	deployed := object.NewVirtualMachine(nil, types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"})
+
+	release := make(chan struct{})
+	calls := 0
+	deploy := func(context.Context) (*object.VirtualMachine, error) {
+		calls++
+		<-release
+		return deployed, nil
+	}
+
+	// The reconcile is not blocked while the item is deployed.
+	vm, contentVersion, err := deployInBackground(ctx, vmCtx, item, deploy)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(vm).To(BeNil())
+	g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition)).To(Equal(infrav1.DeployingContentLibraryItemReason))
+	g.Expect(IsDeployingInBackground(vmCtx)).To(BeTrue())
+
+	// The version of the item is the one being deployed.
+	vm, _, err = deployInBackground(ctx, vmCtx, &library.Item{Name: "ubuntu", ContentVersion: "4"}, deploy)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(vm).To(BeNil())
+
+	close(release)
+	g.Eventually(func() *object.VirtualMachine {
+		vm, contentVersion, err = deployInBackground(ctx, vmCtx, item, deploy)
+		return vm
+	}).Should(Equal(deployed))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(contentVersion).To(Equal("3"))
+	g.Expect(calls).To(Equal(1))
+	g.Expect(conditions.GetReason(vmCtx.VSphereVM, infrav1.VMProvisionedCondition)).To(Equal(infrav1.CloningReason))
+	g.Expect(IsDeployingInBackground(vmCtx)).To(BeFalse())
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/pbm"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+// maxControllerBusNumber is the highest bus number of a disk controller.
+const maxControllerBusNumber = 3
+
+// getDataDiskSpecs returns the device specs which add the data disks of the
+// VSphereVM, along with the disk controllers they require, to a VM created
+// from a source VM with the given devices. The placement of each data disk is
+// recorded in the status of the VSphereVM, so that the UUID of the disk can
+// be reported once the VM is created.
+func getDataDiskSpecs(ctx context.Context, vmCtx *capvcontext.VMContext, devices object.VirtualDeviceList) ([]types.BaseVirtualDeviceConfigSpec, error) {
+	dataDisks := vmCtx.VSphereVM.Spec.DataDisks
+	if len(dataDisks) == 0 {
+		vmCtx.VSphereVM.Status.DataDisks = nil
+		return nil, nil
+	}
+
+	// Work on a copy of the device list which also includes the devices added
+	// below, so that bus numbers, unit numbers and keys are not reused.
+	devs := append(object.VirtualDeviceList{}, devices...)
+
+	var pbmClient *pbm.Client
+	var deviceSpecs []types.BaseVirtualDeviceConfigSpec
+	dataDiskStatuses := make([]infrav1.DataDiskStatus, 0, len(dataDisks))
+	for i := range dataDisks {
+		dataDisk := &dataDisks[i]
+		controllerType := dataDisk.ControllerType
+		if controllerType == "" {
+			controllerType = infrav1.DiskControllerTypePVSCSI
+		}
+
+		controller := findDiskController(devs, controllerType, dataDisk.ControllerBusNumber)
+		if controller == nil {
+			var err error
+			controller, err = createDiskController(devs, controllerType, dataDisk.ControllerBusNumber)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to add controller for data disk %q", dataDisk.Name)
+			}
+			devs = append(devs, controller.(types.BaseVirtualDevice))
+			deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+				Operation: types.VirtualDeviceConfigSpecOperationAdd,
+				Device:    controller.(types.BaseVirtualDevice),
+			})
+		}
+
+		unitNumber := freeUnitNumber(devs, controller)
+		if unitNumber < 0 {
+			return nil, errors.Errorf("no free unit for data disk %q on %s controller %d", dataDisk.Name, controllerType, controller.GetVirtualController().BusNumber)
+		}
+
+		disk, err := newDataDisk(ctx, vmCtx, dataDisk)
+		if err != nil {
+			return nil, err
+		}
+		disk.Key = devs.NewKey()
+		disk.ControllerKey = controller.GetVirtualController().Key
+		disk.UnitNumber = &unitNumber
+		devs = append(devs, disk)
+
+		diskSpec := &types.VirtualDeviceConfigSpec{
+			Operation:     types.VirtualDeviceConfigSpecOperationAdd,
+			FileOperation: types.VirtualDeviceConfigSpecFileOperationCreate,
+			Device:        disk,
+		}
+		if dataDisk.StoragePolicyName != "" {
+			if pbmClient == nil {
+				pbmClient, err = pbm.NewClient(ctx, vmCtx.Session.Client.Client)
+				if err != nil {
+					return nil, errors.Wrapf(err, "unable to create pbm client for %q", ctx)
+				}
+			}
+			profileID, err := pbmClient.ProfileIDByName(ctx, dataDisk.StoragePolicyName)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to get storageProfileID from name %s for data disk %q", dataDisk.StoragePolicyName, dataDisk.Name)
+			}
+			diskSpec.Profile = []types.BaseVirtualMachineProfileSpec{
+				&types.VirtualMachineDefinedProfileSpec{ProfileId: profileID},
+			}
+		}
+		deviceSpecs = append(deviceSpecs, diskSpec)
+
+		dataDiskStatuses = append(dataDiskStatuses, infrav1.DataDiskStatus{
+			Name:                dataDisk.Name,
+			ControllerType:      controllerType,
+			ControllerBusNumber: controller.GetVirtualController().BusNumber,
+			UnitNumber:          unitNumber,
+		})
+	}
+
+	vmCtx.VSphereVM.Status.DataDisks = dataDiskStatuses
+	return deviceSpecs, nil
+}
+
+// SetDataDiskUUIDs sets the UUID of the data disks which are found among the
+// given devices of a VM.
+func SetDataDiskUUIDs(dataDiskStatuses []infrav1.DataDiskStatus, devices object.VirtualDeviceList) {
+	for i := range dataDiskStatuses {
+		dataDiskStatus := &dataDiskStatuses[i]
+		if dataDiskStatus.UUID != "" {
+			continue
+		}
+		controller := findDiskController(devices, dataDiskStatus.ControllerType, &dataDiskStatus.ControllerBusNumber)
+		if controller == nil {
+			continue
+		}
+		for _, dev := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+			disk := dev.(*types.VirtualDisk)
+			if disk.ControllerKey != controller.GetVirtualController().Key || disk.UnitNumber == nil || *disk.UnitNumber != dataDiskStatus.UnitNumber {
+				continue
+			}
+			if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok {
+				dataDiskStatus.UUID = backing.Uuid
+			}
+			break
+		}
+	}
+}
+
+// diskControllerType returns the type of a disk controller, or false if the
+// device is not a disk controller supported for data disks.
+func diskControllerType(device types.BaseVirtualDevice) (infrav1.DiskControllerType, bool) {
+	switch device.(type) {
+	case *types.ParaVirtualSCSIController:
+		return infrav1.DiskControllerTypePVSCSI, true
+	case *types.VirtualLsiLogicController:
+		return infrav1.DiskControllerTypeLSILogic, true
+	case *types.VirtualLsiLogicSASController:
+		return infrav1.DiskControllerTypeLSILogicSAS, true
+	case *types.VirtualBusLogicController:
+		return infrav1.DiskControllerTypeBusLogic, true
+	case *types.VirtualNVMEController:
+		return infrav1.DiskControllerTypeNVMe, true
+	case *types.VirtualAHCIController:
+		return infrav1.DiskControllerTypeSATA, true
+	}
+	return "", false
+}
+
+// isSCSIControllerType returns true for the SCSI controller types, which share
+// the same bus numbers.
+func isSCSIControllerType(controllerType infrav1.DiskControllerType) bool {
+	switch controllerType {
+	case infrav1.DiskControllerTypePVSCSI, infrav1.DiskControllerTypeLSILogic, infrav1.DiskControllerTypeLSILogicSAS, infrav1.DiskControllerTypeBusLogic:
+		return true
+	}
+	return false
+}
+
+// findDiskController returns the controller of the given type with the given
+// bus number. If no bus number is given, the first controller of the type
+// which has a free unit is returned.
+func findDiskController(devices object.VirtualDeviceList, controllerType infrav1.DiskControllerType, busNumber *int32) types.BaseVirtualController {
+	for _, dev := range devices {
+		if t, ok := diskControllerType(dev); !ok || t != controllerType {
+			continue
+		}
+		controller := dev.(types.BaseVirtualController)
+		if busNumber != nil {
+			if controller.GetVirtualController().BusNumber == *busNumber {
+				return controller
+			}
+			continue
+		}
+		if freeUnitNumber(devices, controller) >= 0 {
+			return controller
+		}
+	}
+	return nil
+}
+
+// createDiskController returns a new controller of the given type. If no bus
+// number is given, the first free bus number is used.
+func createDiskController(devices object.VirtualDeviceList, controllerType infrav1.DiskControllerType, busNumber *int32) (types.BaseVirtualController, error) {
+	// Bus numbers are shared between the different types of SCSI controllers.
+	usedBusNumbers := map[int32]bool{}
+	for _, dev := range devices {
+		t, ok := diskControllerType(dev)
+		if !ok || (t != controllerType && !(isSCSIControllerType(t) && isSCSIControllerType(controllerType))) {
+			continue
+		}
+		usedBusNumbers[dev.(types.BaseVirtualController).GetVirtualController().BusNumber] = true
+	}
+
+	bus := int32(-1)
+	if busNumber != nil {
+		if usedBusNumbers[*busNumber] {
+			return nil, errors.Errorf("bus number %d is already used by another controller", *busNumber)
+		}
+		bus = *busNumber
+	} else {
+		for n := int32(0); n <= maxControllerBusNumber; n++ {
+			if !usedBusNumbers[n] {
+				bus = n
+				break
+			}
+		}
+		if bus < 0 {
+			return nil, errors.Errorf("no free bus number for a new %s controller", controllerType)
+		}
+	}
+
+	var controller types.BaseVirtualController
+	switch controllerType {
+	case infrav1.DiskControllerTypeNVMe:
+		controller = &types.VirtualNVMEController{}
+	case infrav1.DiskControllerTypeSATA:
+		controller = &types.VirtualAHCIController{}
+	default:
+		dev, err := devices.CreateSCSIController(string(controllerType))
+		if err != nil {
+			return nil, err
+		}
+		controller = dev.(types.BaseVirtualController)
+	}
+	controller.GetVirtualController().BusNumber = bus
+	controller.GetVirtualController().Key = devices.NewKey()
+	return controller, nil
+}
+
+// freeUnitNumber returns the first unit number of the controller which is not
+// used by a device, or -1 if all the units are used.
+func freeUnitNumber(devices object.VirtualDeviceList, controller types.BaseVirtualController) int32 {
+	// The maximum number of units depends on the type of the controller.
+	maxUnits := int32(16)
+	usedUnits := map[int32]bool{}
+	switch c := controller.(type) {
+	case types.BaseVirtualSCSIController:
+		// The SCSI controller sits on its own bus.
+		usedUnits[c.GetVirtualSCSIController().ScsiCtlrUnitNumber] = true
+	case *types.VirtualNVMEController:
+		maxUnits = 15
+	case *types.VirtualAHCIController:
+		maxUnits = 30
+	}
+
+	key := controller.GetVirtualController().Key
+	for _, dev := range devices {
+		d := dev.GetVirtualDevice()
+		if d.ControllerKey == key && d.UnitNumber != nil {
+			usedUnits[*d.UnitNumber] = true
+		}
+	}
+
+	for unit := int32(0); unit < maxUnits; unit++ {
+		if !usedUnits[unit] {
+			return unit
+		}
+	}
+	return -1
+}
+
+// newDataDisk returns a new virtual disk for the data disk, which is not yet
+// assigned to a controller.
+func newDataDisk(ctx context.Context, vmCtx *capvcontext.VMContext, dataDisk *infrav1.DataDisk) (*types.VirtualDisk, error) {
+	backing := &types.VirtualDiskFlatVer2BackingInfo{
+		DiskMode: diskMode(dataDisk.DiskMode),
+	}
+
+	switch dataDisk.ProvisioningMode {
+	case infrav1.DiskProvisioningModeThick:
+		backing.ThinProvisioned = types.NewBool(false)
+	case infrav1.DiskProvisioningModeEagerZeroedThick:
+		backing.ThinProvisioned = types.NewBool(false)
+		backing.EagerlyScrub = types.NewBool(true)
+	default:
+		backing.ThinProvisioned = types.NewBool(true)
+	}
+
+	// The disk is created in the folder of the VM on the datastore of the VM,
+	// unless another datastore is requested.
+	if dataDisk.Datastore != "" {
+		datastore, err := vmCtx.Session.Finder.Datastore(ctx, dataDisk.Datastore)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get datastore %s for data disk %q", dataDisk.Datastore, dataDisk.Name)
+		}
+		backing.FileName = fmt.Sprintf("[%s]", datastore.Name())
+		backing.Datastore = types.NewReference(datastore.Reference())
+	}
+
+	return &types.VirtualDisk{
+		VirtualDevice: types.VirtualDevice{
+			Backing: backing,
+		},
+		CapacityInKB: int64(dataDisk.SizeGiB) * 1024 * 1024,
+	}, nil
+}
+
+// diskMode returns the vSphere disk mode of a DiskMode.
+func diskMode(mode infrav1.DiskMode) string {
+	switch mode {
+	case infrav1.DiskModeIndependentPersistent:
+		return string(types.VirtualDiskModeIndependent_persistent)
+	case infrav1.DiskModeIndependentNonpersistent:
+		return string(types.VirtualDiskModeIndependent_nonpersistent)
+	default:
+		return string(types.VirtualDiskModePersistent)
+	}
+}
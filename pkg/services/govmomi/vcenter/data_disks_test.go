@@ -0,0 +1,177 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/ptr"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+func TestGetDataDiskSpecs(t *testing.T) {
+	model, session, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	g := NewWithT(t)
+
+	// The VMs of the simulator have a PVSCSI controller on bus 0 with a disk.
+	vm, err := session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).ToNot(HaveOccurred())
+	devices, err := vm.Device(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	pvscsi := devices.SelectByType((*types.ParaVirtualSCSIController)(nil))
+	g.Expect(pvscsi).To(HaveLen(1))
+
+	newVMContext := func(dataDisks ...infrav1.DataDisk) *capvcontext.VMContext {
+		return &capvcontext.VMContext{
+			Session: session,
+			VSphereVM: &infrav1.VSphereVM{
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						DataDisks: dataDisks,
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("no data disks", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext()
+		specs, err := getDataDiskSpecs(ctx, vmCtx, devices)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(specs).To(BeEmpty())
+		g.Expect(vmCtx.VSphereVM.Status.DataDisks).To(BeEmpty())
+	})
+
+	t.Run("adds a thin disk to the existing PVSCSI controller", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(infrav1.DataDisk{Name: "data", SizeGiB: 10})
+		specs, err := getDataDiskSpecs(ctx, vmCtx, devices)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(specs).To(HaveLen(1))
+
+		spec := specs[0].GetVirtualDeviceConfigSpec()
+		g.Expect(spec.Operation).To(Equal(types.VirtualDeviceConfigSpecOperationAdd))
+		g.Expect(spec.FileOperation).To(Equal(types.VirtualDeviceConfigSpecFileOperationCreate))
+		disk := spec.Device.(*types.VirtualDisk)
+		g.Expect(disk.CapacityInKB).To(Equal(int64(10 * 1024 * 1024)))
+		g.Expect(disk.ControllerKey).To(Equal(pvscsi[0].GetVirtualDevice().Key))
+		g.Expect(*disk.UnitNumber).To(Equal(int32(1)))
+		backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		g.Expect(backing.ThinProvisioned).To(Equal(ptr.To(true)))
+		g.Expect(backing.DiskMode).To(Equal(string(types.VirtualDiskModePersistent)))
+
+		g.Expect(vmCtx.VSphereVM.Status.DataDisks).To(Equal([]infrav1.DataDiskStatus{
+			{Name: "data", ControllerType: infrav1.DiskControllerTypePVSCSI, ControllerBusNumber: 0, UnitNumber: 1},
+		}))
+	})
+
+	t.Run("adds a controller shared by the disks which require it", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(
+			infrav1.DataDisk{Name: "data", SizeGiB: 10, ControllerType: infrav1.DiskControllerTypeNVMe, ControllerBusNumber: ptr.To[int32](1)},
+			infrav1.DataDisk{Name: "logs", SizeGiB: 5, ControllerType: infrav1.DiskControllerTypeNVMe, ControllerBusNumber: ptr.To[int32](1)},
+		)
+		specs, err := getDataDiskSpecs(ctx, vmCtx, devices)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(specs).To(HaveLen(3))
+
+		controller := specs[0].GetVirtualDeviceConfigSpec().Device.(*types.VirtualNVMEController)
+		g.Expect(controller.BusNumber).To(Equal(int32(1)))
+		for i, spec := range specs[1:] {
+			disk := spec.GetVirtualDeviceConfigSpec().Device.(*types.VirtualDisk)
+			g.Expect(disk.ControllerKey).To(Equal(controller.Key))
+			g.Expect(*disk.UnitNumber).To(Equal(int32(i)))
+		}
+
+		g.Expect(vmCtx.VSphereVM.Status.DataDisks).To(Equal([]infrav1.DataDiskStatus{
+			{Name: "data", ControllerType: infrav1.DiskControllerTypeNVMe, ControllerBusNumber: 1, UnitNumber: 0},
+			{Name: "logs", ControllerType: infrav1.DiskControllerTypeNVMe, ControllerBusNumber: 1, UnitNumber: 1},
+		}))
+	})
+
+	t.Run("places an eager zeroed thick disk on another datastore", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(infrav1.DataDisk{
+			Name:             "data",
+			SizeGiB:          10,
+			ProvisioningMode: infrav1.DiskProvisioningModeEagerZeroedThick,
+			DiskMode:         infrav1.DiskModeIndependentPersistent,
+			Datastore:        "LocalDS_0",
+		})
+		specs, err := getDataDiskSpecs(ctx, vmCtx, devices)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(specs).To(HaveLen(1))
+
+		backing := specs[0].GetVirtualDeviceConfigSpec().Device.(*types.VirtualDisk).Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		g.Expect(backing.ThinProvisioned).To(Equal(ptr.To(false)))
+		g.Expect(backing.EagerlyScrub).To(Equal(ptr.To(true)))
+		g.Expect(backing.DiskMode).To(Equal(string(types.VirtualDiskModeIndependent_persistent)))
+		g.Expect(backing.FileName).To(Equal("[LocalDS_0]"))
+		g.Expect(backing.Datastore).ToNot(BeNil())
+	})
+
+	t.Run("SCSI bus number used by another controller type", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(infrav1.DataDisk{Name: "data", SizeGiB: 10, ControllerType: infrav1.DiskControllerTypeLSILogic, ControllerBusNumber: ptr.To[int32](0)})
+		_, err := getDataDiskSpecs(ctx, vmCtx, devices)
+		g.Expect(err).To(MatchError(`unable to add controller for data disk "data": bus number 0 is already used by another controller`))
+	})
+}
+
+func TestSetDataDiskUUIDs(t *testing.T) {
+	g := NewWithT(t)
+
+	controller := &types.ParaVirtualSCSIController{}
+	controller.Key = 1000
+	controller.BusNumber = 1
+	disk := &types.VirtualDisk{
+		VirtualDevice: types.VirtualDevice{
+			Key:           2000,
+			ControllerKey: 1000,
+			UnitNumber:    ptr.To[int32](2),
+			Backing:       &types.VirtualDiskFlatVer2BackingInfo{Uuid: "6000C29a-ad1e-4d5c-a4a1-d1d3ad1e1f00"},
+		},
+	}
+	devices := object.VirtualDeviceList{controller, disk}
+
+	dataDiskStatuses := []infrav1.DataDiskStatus{
+		{Name: "data", ControllerType: infrav1.DiskControllerTypePVSCSI, ControllerBusNumber: 1, UnitNumber: 2},
+		{Name: "missing", ControllerType: infrav1.DiskControllerTypePVSCSI, ControllerBusNumber: 1, UnitNumber: 3},
+		{Name: "other-controller", ControllerType: infrav1.DiskControllerTypeNVMe, ControllerBusNumber: 1, UnitNumber: 2},
+	}
+	SetDataDiskUUIDs(dataDiskStatuses, devices)
+
+	g.Expect(dataDiskStatuses[0].UUID).To(Equal("6000C29a-ad1e-4d5c-a4a1-d1d3ad1e1f00"))
+	g.Expect(dataDiskStatuses[1].UUID).To(BeEmpty())
+	g.Expect(dataDiskStatuses[2].UUID).To(BeEmpty())
+}
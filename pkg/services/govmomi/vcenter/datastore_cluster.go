@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+)
+
+// usesDatastoreCluster returns true if the datastore of the VM is selected in
+// its datastore cluster.
+func usesDatastoreCluster(vsphereVM *infrav1.VSphereVM) bool {
+	return vsphereVM.Spec.Datastore == "" && vsphereVM.Spec.DatastoreCluster != ""
+}
+
+// selectDatastoreClusterDatastore returns the datastore of the datastore
+// cluster of the VM with the most free space. It is used for the deployments
+// which Storage DRS cannot make recommendations for, like the deployment of
+// Content Library items.
+func selectDatastoreClusterDatastore(ctx context.Context, vmCtx *capvcontext.VMContext) (types.ManagedObjectReference, error) {
+	pod, err := vmCtx.Session.Finder.DatastoreCluster(ctx, vmCtx.VSphereVM.Spec.DatastoreCluster)
+	if err != nil {
+		return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get datastore cluster %s for %q", vmCtx.VSphereVM.Spec.DatastoreCluster, ctx)
+	}
+	children, err := pod.Children(ctx)
+	if err != nil {
+		return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to list datastores of datastore cluster %s", vmCtx.VSphereVM.Spec.DatastoreCluster)
+	}
+	var refs []types.ManagedObjectReference
+	for _, child := range children {
+		if ds, ok := child.(*object.Datastore); ok {
+			refs = append(refs, ds.Reference())
+		}
+	}
+	if len(refs) == 0 {
+		return types.ManagedObjectReference{}, errors.Errorf("no datastores found in datastore cluster %s", vmCtx.VSphereVM.Spec.DatastoreCluster)
+	}
+
+	candidates, err := getDatastoreCandidates(ctx, vmCtx, refs, false)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	selected := selectMostFreeSpaceDatastore(candidates)
+	vmCtx.VSphereVM.Status.DatastoreSelection = &infrav1.DatastoreSelection{
+		Policy:           infrav1.DatastoreSelectionPolicyMostFreeSpace,
+		DatastoreCluster: pod.Name(),
+		Datastore:        selected.Name,
+		Candidates:       int32(len(candidates)),
+	}
+	return selected.Ref, nil
+}
+
+// recommendDatastore returns the datastore of the datastore cluster of the VM
+// recommended by Storage DRS for cloning the VM from the template with the
+// given clone spec. The recommendation is applied by cloning the VM on the
+// recommended datastore rather than with ApplyStorageDrsRecommendation, so
+// that the clone task is tracked like any other clone task.
+func recommendDatastore(ctx context.Context, vmCtx *capvcontext.VMContext, tpl *object.VirtualMachine, folder *object.Folder, spec types.VirtualMachineCloneSpec) (types.ManagedObjectReference, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	pod, err := vmCtx.Session.Finder.DatastoreCluster(ctx, vmCtx.VSphereVM.Spec.DatastoreCluster)
+	if err != nil {
+		return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get datastore cluster %s for %q", vmCtx.VSphereVM.Spec.DatastoreCluster, ctx)
+	}
+
+	// Storage DRS places the VM in the datastore cluster.
+	spec.Location.Datastore = nil
+	spec.Location.Disk = nil
+
+	placementSpec := types.StoragePlacementSpec{
+		Type: string(types.StoragePlacementSpecPlacementTypeClone),
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{
+			StoragePod: types.NewReference(pod.Reference()),
+			InitialVmConfig: []types.VmPodConfigForPlacement{
+				{StoragePod: pod.Reference()},
+			},
+		},
+		Vm:           types.NewReference(tpl.Reference()),
+		CloneName:    vmCtx.VSphereVM.Name,
+		CloneSpec:    &spec,
+		Folder:       types.NewReference(folder.Reference()),
+		ResourcePool: spec.Location.Pool,
+	}
+	result, err := object.NewStorageResourceManager(vmCtx.Session.Client.Client).RecommendDatastores(ctx, placementSpec)
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationClone, err)
+		return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get Storage DRS recommendations for datastore cluster %s", vmCtx.VSphereVM.Spec.DatastoreCluster)
+	}
+
+	var destination *types.ManagedObjectReference
+	for _, recommendation := range result.Recommendations {
+		for _, action := range recommendation.Action {
+			if placement, ok := action.(*types.StoragePlacementAction); ok {
+				destination = &placement.Destination
+				break
+			}
+		}
+		if destination != nil {
+			break
+		}
+	}
+	if destination == nil {
+		return types.ManagedObjectReference{}, errors.Errorf("no datastore recommended by Storage DRS in datastore cluster %s", vmCtx.VSphereVM.Spec.DatastoreCluster)
+	}
+
+	datastoreName, err := object.NewDatastore(vmCtx.Session.Client.Client, *destination).ObjectName(ctx)
+	if err != nil {
+		return types.ManagedObjectReference{}, errors.Wrapf(err, "unable to get name of datastore %s", destination.Value)
+	}
+	log.Info("Storage DRS recommended datastore", "datastore", datastoreName, "datastoreCluster", pod.Name())
+	vmCtx.VSphereVM.Status.DatastoreSelection = &infrav1.DatastoreSelection{
+		DatastoreCluster: pod.Name(),
+		Datastore:        datastoreName,
+		Candidates:       int32(len(result.Recommendations)),
+	}
+	return *destination, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+func TestDatastoreCluster(t *testing.T) {
+	model, session, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	g := NewWithT(t)
+
+	// Move the datastore of the simulator into a datastore cluster.
+	dc, err := session.Finder.DefaultDatacenter(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	folders, err := dc.Folders(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	pod, err := folders.DatastoreFolder.CreateStoragePod(ctx, "DC0_POD0")
+	g.Expect(err).ToNot(HaveOccurred())
+	datastore, err := session.Finder.Datastore(ctx, "LocalDS_0")
+	g.Expect(err).ToNot(HaveOccurred())
+	task, err := pod.MoveInto(ctx, []types.ManagedObjectReference{datastore.Reference()})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(task.Wait(ctx)).To(Succeed())
+
+	newVMContext := func() *capvcontext.VMContext {
+		return &capvcontext.VMContext{
+			Session: session,
+			VSphereVM: &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "vsphereVM1",
+					Namespace: "my-namespace",
+				},
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						DatastoreCluster: "DC0_POD0",
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("selects the datastore with the most free space", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext()
+		g.Expect(usesDatastoreCluster(vmCtx.VSphereVM)).To(BeTrue())
+		ref, err := selectDatastoreClusterDatastore(ctx, vmCtx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ref).To(Equal(datastore.Reference()))
+		g.Expect(vmCtx.VSphereVM.Status.DatastoreSelection).To(Equal(&infrav1.DatastoreSelection{
+			Policy:           infrav1.DatastoreSelectionPolicyMostFreeSpace,
+			DatastoreCluster: "DC0_POD0",
+			Datastore:        "LocalDS_0",
+			Candidates:       1,
+		}))
+	})
+
+	t.Run("uses the datastore recommended by Storage DRS for clones", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tpl, err := session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		pool, err := session.Finder.DefaultResourcePool(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmCtx := newVMContext()
+		spec := types.VirtualMachineCloneSpec{
+			Location: types.VirtualMachineRelocateSpec{
+				Pool: types.NewReference(pool.Reference()),
+			},
+		}
+		ref, err := recommendDatastore(ctx, vmCtx, tpl, folders.VmFolder, spec)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ref).To(Equal(datastore.Reference()))
+		g.Expect(vmCtx.VSphereVM.Status.DatastoreSelection).To(Equal(&infrav1.DatastoreSelection{
+			DatastoreCluster: "DC0_POD0",
+			Datastore:        "LocalDS_0",
+			Candidates:       1,
+		}))
+	})
+
+	t.Run("the datastore takes precedence over the datastore cluster", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext()
+		vmCtx.VSphereVM.Spec.Datastore = "LocalDS_0"
+		g.Expect(usesDatastoreCluster(vmCtx.VSphereVM)).To(BeFalse())
+	})
+}
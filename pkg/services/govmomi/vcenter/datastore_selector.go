@@ -0,0 +1,212 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	pbmTypes "github.com/vmware/govmomi/pbm/types"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+// datastoreCandidate is a datastore which is compatible with the storage
+// policy of a VM.
+type datastoreCandidate struct {
+	Ref       types.ManagedObjectReference
+	Name      string
+	FreeSpace int64
+	// VMs is the number of VMs located on the datastore.
+	VMs int
+	// ClusterVMs is the number of VMs of the cluster of the VSphereVM which
+	// were placed on the datastore. It is only computed for the RoundRobin
+	// policy.
+	ClusterVMs int
+}
+
+// datastoreSelector selects the datastore of a VM among the candidates, which
+// are never empty.
+type datastoreSelector func(candidates []datastoreCandidate) datastoreCandidate
+
+// datastoreSelectors are the datastore selectors by selection policy.
+var datastoreSelectors = map[infrav1.DatastoreSelectionPolicy]datastoreSelector{
+	infrav1.DatastoreSelectionPolicyRandom:        selectRandomDatastore,
+	infrav1.DatastoreSelectionPolicyMostFreeSpace: selectMostFreeSpaceDatastore,
+	infrav1.DatastoreSelectionPolicyLeastVMs:      selectLeastVMsDatastore,
+	infrav1.DatastoreSelectionPolicyRoundRobin:    selectRoundRobinDatastore,
+}
+
+func selectRandomDatastore(candidates []datastoreCandidate) datastoreCandidate {
+	r := rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec // We won't need cryptographically secure randomness here.
+	return candidates[r.Intn(len(candidates))]
+}
+
+func selectMostFreeSpaceDatastore(candidates []datastoreCandidate) datastoreCandidate {
+	return slices.MinFunc(candidates, compareFreeSpace)
+}
+
+func selectLeastVMsDatastore(candidates []datastoreCandidate) datastoreCandidate {
+	return slices.MinFunc(candidates, func(a, b datastoreCandidate) int {
+		if a.VMs != b.VMs {
+			return a.VMs - b.VMs
+		}
+		return compareFreeSpace(a, b)
+	})
+}
+
+// selectRoundRobinDatastore spreads the VMs of a cluster across the
+// datastores, weighting each datastore by its free space: the next VM is
+// placed on the datastore with the fewest VMs of the cluster per byte of free
+// space once the VM is added to it. The datastores without free space are
+// only selected if all of them are full.
+func selectRoundRobinDatastore(candidates []datastoreCandidate) datastoreCandidate {
+	load := func(c datastoreCandidate) float64 {
+		if c.FreeSpace <= 0 {
+			return math.Inf(1)
+		}
+		return float64(c.ClusterVMs+1) / float64(c.FreeSpace)
+	}
+	return slices.MinFunc(candidates, func(a, b datastoreCandidate) int {
+		switch la, lb := load(a), load(b); {
+		case la < lb:
+			return -1
+		case la > lb:
+			return 1
+		}
+		return compareFreeSpace(a, b)
+	})
+}
+
+// compareFreeSpace orders datastores by decreasing free space, then by name
+// so that the selection is stable.
+func compareFreeSpace(a, b datastoreCandidate) int {
+	switch {
+	case a.FreeSpace > b.FreeSpace:
+		return -1
+	case a.FreeSpace < b.FreeSpace:
+		return 1
+	case a.Name < b.Name:
+		return -1
+	case a.Name > b.Name:
+		return 1
+	}
+	return 0
+}
+
+// selectCompatibleDatastore selects the datastore of the VM among the hubs
+// compatible with its storage policy according to its datastore selection
+// policy, and records the decision in the status of the VSphereVM.
+func selectCompatibleDatastore(ctx context.Context, vmCtx *capvcontext.VMContext, hubs []pbmTypes.PbmPlacementHub) (types.ManagedObjectReference, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	policy := vmCtx.VSphereVM.Spec.DatastoreSelectionPolicy
+	if policy == "" {
+		policy = infrav1.DatastoreSelectionPolicyRandom
+	}
+	selector, ok := datastoreSelectors[policy]
+	if !ok {
+		return types.ManagedObjectReference{}, errors.Errorf("unknown datastore selection policy %q", policy)
+	}
+
+	refs := make([]types.ManagedObjectReference, 0, len(hubs))
+	for _, hub := range hubs {
+		refs = append(refs, types.ManagedObjectReference{Type: hub.HubType, Value: hub.HubId})
+	}
+	candidates, err := getDatastoreCandidates(ctx, vmCtx, refs, policy == infrav1.DatastoreSelectionPolicyRoundRobin)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+
+	selected := selector(candidates)
+	log.Info("Selected datastore compatible with storage policy", "datastore", selected.Name, "policy", policy, "candidates", len(candidates))
+	vmCtx.VSphereVM.Status.DatastoreSelection = &infrav1.DatastoreSelection{
+		Policy:     policy,
+		Datastore:  selected.Name,
+		Candidates: int32(len(candidates)),
+	}
+	return selected.Ref, nil
+}
+
+// getDatastoreCandidates returns the candidates for the datastores. The VMs of
+// the cluster of the VSphereVM are only counted if countClusterVMs is true,
+// since it requires listing the VSphereVMs of the cluster.
+func getDatastoreCandidates(ctx context.Context, vmCtx *capvcontext.VMContext, refs []types.ManagedObjectReference, countClusterVMs bool) ([]datastoreCandidate, error) {
+	var datastores []mo.Datastore
+	pc := property.DefaultCollector(vmCtx.Session.Client.Client)
+	if err := pc.Retrieve(ctx, refs, []string{"summary", "vm"}, &datastores); err != nil {
+		return nil, errors.Wrapf(err, "unable to get properties of compatible datastores for %q", ctx)
+	}
+	if len(datastores) == 0 {
+		return nil, errors.Errorf("no compatible datastores found for %q", ctx)
+	}
+
+	clusterVMs := map[string]int{}
+	if countClusterVMs {
+		var err error
+		if clusterVMs, err = countClusterVMsByDatastore(ctx, vmCtx); err != nil {
+			return nil, err
+		}
+	}
+
+	candidates := make([]datastoreCandidate, 0, len(datastores))
+	for _, ds := range datastores {
+		candidates = append(candidates, datastoreCandidate{
+			Ref:        ds.Reference(),
+			Name:       ds.Summary.Name,
+			FreeSpace:  ds.Summary.FreeSpace,
+			VMs:        len(ds.Vm),
+			ClusterVMs: clusterVMs[ds.Summary.Name],
+		})
+	}
+	return candidates, nil
+}
+
+// countClusterVMsByDatastore returns the number of VSphereVMs of the cluster
+// of the VSphereVM by the name of the datastore selected for them.
+func countClusterVMsByDatastore(ctx context.Context, vmCtx *capvcontext.VMContext) (map[string]int, error) {
+	counts := map[string]int{}
+	clusterName, ok := vmCtx.VSphereVM.Labels[clusterv1.ClusterNameLabel]
+	if !ok {
+		return counts, nil
+	}
+
+	vsphereVMs := &infrav1.VSphereVMList{}
+	if err := vmCtx.Client.List(ctx, vsphereVMs,
+		client.InNamespace(vmCtx.VSphereVM.Namespace),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: clusterName}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list VSphereVMs of cluster %s/%s", vmCtx.VSphereVM.Namespace, clusterName)
+	}
+	for _, vsphereVM := range vsphereVMs.Items {
+		if vsphereVM.Name == vmCtx.VSphereVM.Name || vsphereVM.Status.DatastoreSelection == nil {
+			continue
+		}
+		counts[vsphereVM.Status.DatastoreSelection.Datastore]++
+	}
+	return counts, nil
+}
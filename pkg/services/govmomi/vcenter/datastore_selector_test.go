@@ -0,0 +1,171 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pbmTypes "github.com/vmware/govmomi/pbm/types"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestDatastoreSelectors(t *testing.T) {
+	candidates := []datastoreCandidate{
+		{Name: "ds-0", FreeSpace: 100, VMs: 10, ClusterVMs: 2},
+		{Name: "ds-1", FreeSpace: 300, VMs: 20, ClusterVMs: 5},
+		{Name: "ds-2", FreeSpace: 200, VMs: 5, ClusterVMs: 1},
+	}
+
+	testCases := []struct {
+		policy   infrav1.DatastoreSelectionPolicy
+		expected string
+	}{
+		{policy: infrav1.DatastoreSelectionPolicyMostFreeSpace, expected: "ds-1"},
+		{policy: infrav1.DatastoreSelectionPolicyLeastVMs, expected: "ds-2"},
+		// ds-2 has 2 VMs of the cluster per 200 bytes once the VM is added,
+		// which is less than 3 per 100 and 6 per 300.
+		{policy: infrav1.DatastoreSelectionPolicyRoundRobin, expected: "ds-2"},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(datastoreSelectors[tc.policy](candidates).Name).To(Equal(tc.expected))
+		})
+	}
+
+	t.Run("Random", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(candidates).To(ContainElement(datastoreSelectors[infrav1.DatastoreSelectionPolicyRandom](candidates)))
+	})
+
+	t.Run("RoundRobin spreads the VMs of a cluster in proportion to the free space", func(t *testing.T) {
+		g := NewWithT(t)
+
+		candidates := []datastoreCandidate{
+			{Name: "ds-0", FreeSpace: 100},
+			{Name: "ds-1", FreeSpace: 200},
+		}
+		placed := map[string]int{}
+		for i := 0; i < 6; i++ {
+			selected := selectRoundRobinDatastore(candidates)
+			placed[selected.Name]++
+			for j := range candidates {
+				if candidates[j].Name == selected.Name {
+					candidates[j].ClusterVMs++
+				}
+			}
+		}
+		g.Expect(placed).To(Equal(map[string]int{"ds-0": 2, "ds-1": 4}))
+	})
+
+	t.Run("RoundRobin does not select a full datastore", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(selectRoundRobinDatastore([]datastoreCandidate{
+			{Name: "ds-0", FreeSpace: 0},
+			{Name: "ds-1", FreeSpace: 100, ClusterVMs: 10},
+		}).Name).To(Equal("ds-1"))
+		g.Expect(selectRoundRobinDatastore([]datastoreCandidate{
+			{Name: "ds-0", FreeSpace: 0},
+			{Name: "ds-1", FreeSpace: 0},
+		}).Name).To(Equal("ds-0"))
+	})
+}
+
+func TestSelectCompatibleDatastore(t *testing.T) {
+	model, session, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	g := NewWithT(t)
+
+	datastore, err := session.Finder.Datastore(ctx, "LocalDS_0")
+	g.Expect(err).ToNot(HaveOccurred())
+	hubs := []pbmTypes.PbmPlacementHub{{HubType: datastore.Reference().Type, HubId: datastore.Reference().Value}}
+
+	otherVSphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other",
+			Namespace: "my-namespace",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "my-cluster"},
+		},
+		Status: infrav1.VSphereVMStatus{
+			DatastoreSelection: &infrav1.DatastoreSelection{Datastore: "LocalDS_0"},
+		},
+	}
+	newVMContext := func(policy infrav1.DatastoreSelectionPolicy) *capvcontext.VMContext {
+		return &capvcontext.VMContext{
+			ControllerManagerContext: fake.NewControllerManagerContext(otherVSphereVM),
+			Session:                  session,
+			VSphereVM: &infrav1.VSphereVM{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "vsphereVM1",
+					Namespace: "my-namespace",
+					Labels:    map[string]string{clusterv1.ClusterNameLabel: "my-cluster"},
+				},
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						DatastoreSelectionPolicy: policy,
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("defaults to the Random policy and records the selection", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext("")
+		ref, err := selectCompatibleDatastore(ctx, vmCtx, hubs)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ref).To(Equal(datastore.Reference()))
+		g.Expect(vmCtx.VSphereVM.Status.DatastoreSelection).To(Equal(&infrav1.DatastoreSelection{
+			Policy:     infrav1.DatastoreSelectionPolicyRandom,
+			Datastore:  "LocalDS_0",
+			Candidates: 1,
+		}))
+	})
+
+	t.Run("gets the properties of the candidates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(infrav1.DatastoreSelectionPolicyRoundRobin)
+		candidates, err := getDatastoreCandidates(ctx, vmCtx, []types.ManagedObjectReference{datastore.Reference()}, true)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(candidates).To(HaveLen(1))
+		g.Expect(candidates[0].Name).To(Equal("LocalDS_0"))
+		g.Expect(candidates[0].FreeSpace).To(BeNumerically(">", 0))
+		g.Expect(candidates[0].VMs).To(BeNumerically(">", 0))
+		g.Expect(candidates[0].ClusterVMs).To(Equal(1))
+	})
+
+	t.Run("fails with an unknown policy", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := selectCompatibleDatastore(ctx, newVMContext("Unknown"), hubs)
+		g.Expect(err).To(MatchError(ContainSubstring("unknown datastore selection policy")))
+	})
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/govmomi/extra"
+)
+
+// findInstantCloneParent returns a powered on VM from the instant clone parent
+// pool of the VSphereVM, along with its name in the pool. The search starts at
+// an offset derived from the name of the VSphereVM to spread the clones across
+// the pool. A nil VM is returned if none of the parents is available.
+func findInstantCloneParent(ctx context.Context, vmCtx *capvcontext.VMContext) (*object.VirtualMachine, string, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	parents := vmCtx.VSphereVM.Spec.InstantCloneParents
+	if len(parents) == 0 {
+		return nil, "", nil
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(vmCtx.VSphereVM.Name))
+	offset := int(h.Sum32() % uint32(len(parents)))
+
+	for i := range parents {
+		name := parents[(offset+i)%len(parents)]
+		vm, err := vmCtx.Session.Finder.VirtualMachine(ctx, name)
+		if err != nil {
+			if errors.As(err, new(*find.NotFoundError)) {
+				log.Info("Instant clone parent not found", "parent", name)
+				continue
+			}
+			return nil, "", errors.Wrapf(err, "unable to find instant clone parent %q", name)
+		}
+		powerState, err := vm.PowerState(ctx)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "unable to get power state of instant clone parent %q", name)
+		}
+		if powerState != types.VirtualMachinePowerStatePoweredOn {
+			log.Info("Instant clone parent is not powered on", "parent", name, "powerState", powerState)
+			continue
+		}
+		return vm, name, nil
+	}
+	return nil, "", nil
+}
+
+// instantClone kicks off an instant clone operation which forks the given
+// running parent VM. The userdata is passed with the extraConfig of the
+// InstantClone spec, while the guestinfo metadata is injected after the fork
+// once the MAC addresses of the new VM are known.
+func instantClone(ctx context.Context, vmCtx *capvcontext.VMContext, parent *object.VirtualMachine, parentName string, extraConfig extra.Config) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	folder, err := vmCtx.Session.Finder.FolderOrDefault(ctx, vmCtx.VSphereVM.Spec.Folder)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get folder for %q", ctx)
+	}
+
+	pool, err := vmCtx.Session.Finder.ResourcePoolOrDefault(ctx, vmCtx.VSphereVM.Spec.ResourcePool)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get resource pool for %q", ctx)
+	}
+
+	devices, err := parent.Device(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error getting devices of instant clone parent %q", parentName)
+	}
+
+	networkSpecs, err := getInstantCloneNetworkSpecs(ctx, vmCtx, devices)
+	if err != nil {
+		return errors.Wrapf(err, "error getting network specs for %q", ctx)
+	}
+
+	spec := types.VirtualMachineInstantCloneSpec{
+		Name: vmCtx.VSphereVM.Name,
+		Location: types.VirtualMachineRelocateSpec{
+			Folder:       types.NewReference(folder.Reference()),
+			Pool:         types.NewReference(pool.Reference()),
+			DeviceChange: networkSpecs,
+		},
+		Config: extraConfig,
+	}
+
+	if vmCtx.VSphereVM.Spec.Datastore != "" {
+		datastore, err := vmCtx.Session.Finder.Datastore(ctx, vmCtx.VSphereVM.Spec.Datastore)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get datastore %s for %q", vmCtx.VSphereVM.Spec.Datastore, ctx)
+		}
+		spec.Location.Datastore = types.NewReference(datastore.Reference())
+	}
+	// The datastore of the spec is checked before cloning, but not the
+	// datastores of the parent, on which the VM is placed by default.
+	if spec.Location.Datastore == nil {
+		if err := checkAllowedInstantCloneDatastores(ctx, vmCtx, parent); err != nil {
+			return err
+		}
+	}
+
+	vmCtx.VSphereVM.Status.CloneMode = infrav1.InstantClone
+	vmCtx.VSphereVM.Status.InstantCloneParent = parentName
+
+	log.Info("Instant cloning Machine", "parent", parentName)
+	task, err := parent.InstantClone(ctx, spec)
+	if err != nil {
+		metrics.RecordFailure(metrics.OperationClone, err)
+		return errors.Wrapf(err, "error trigging instant clone op for machine %s", ctx)
+	}
+
+	setCloneTaskRef(ctx, vmCtx, task)
+	return nil
+}
+
+// getInstantCloneNetworkSpecs returns the specs which connect the network
+// devices inherited from the parent VM to the networks of the VSphereVM.
+// The InstantClone API only allows editing existing network devices, hence
+// the parent VM must have as many network devices as the VSphereVM.
+func getInstantCloneNetworkSpecs(ctx context.Context, vmCtx *capvcontext.VMContext, devices object.VirtualDeviceList) ([]types.BaseVirtualDeviceConfigSpec, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	if len(nics) != len(vmCtx.VSphereVM.Spec.Network.Devices) {
+		return nil, errors.Errorf("instant clone parent has %d network devices, expected %d", len(nics), len(vmCtx.VSphereVM.Spec.Network.Devices))
+	}
+
+	deviceSpecs := []types.BaseVirtualDeviceConfigSpec{}
+	for i := range vmCtx.VSphereVM.Spec.Network.Devices {
+		netSpec := &vmCtx.VSphereVM.Spec.Network.Devices[i]
+		ref, err := vmCtx.Session.Finder.Network(ctx, netSpec.NetworkName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find network %q", netSpec.NetworkName)
+		}
+		backing, err := ref.EthernetCardBackingInfo(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create new ethernet card backing info for network %q on %q", netSpec.NetworkName, ctx)
+		}
+
+		nic := nics[i].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		nic.Backing = backing
+
+		// The MAC address of the parent must not be reused, so either set the
+		// requested one or have vCenter generate a new one.
+		if netSpec.MACAddr != "" {
+			nic.MacAddress = netSpec.MACAddr
+			nic.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+			log.V(4).Info("Configured manual MAC address", "macAddress", nic.MacAddress)
+		} else {
+			nic.MacAddress = ""
+			nic.AddressType = string(types.VirtualEthernetCardMacTypeGenerated)
+		}
+
+		deviceSpecs = append(deviceSpecs, &types.VirtualDeviceConfigSpec{
+			Device:    nics[i],
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+		})
+	}
+
+	return deviceSpecs, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+func TestFindInstantCloneParent(t *testing.T) {
+	model, session, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	g := NewWithT(t)
+
+	// Power off one of the VMs of the simulator so it can't be used as a parent.
+	poweredOff, err := session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM1")
+	g.Expect(err).ToNot(HaveOccurred())
+	task, err := poweredOff.PowerOff(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(task.Wait(ctx)).To(Succeed())
+
+	testCases := []struct {
+		name           string
+		parents        []string
+		expectedParent string
+	}{
+		{
+			name:           "no parents",
+			expectedParent: "",
+		},
+		{
+			name:           "a powered on parent",
+			parents:        []string{"DC0_C0_RP0_VM0"},
+			expectedParent: "DC0_C0_RP0_VM0",
+		},
+		{
+			name:           "skips missing and powered off parents",
+			parents:        []string{"does-not-exist", "DC0_C0_RP0_VM1", "DC0_C0_RP0_VM0"},
+			expectedParent: "DC0_C0_RP0_VM0",
+		},
+		{
+			name:           "no parent is available",
+			parents:        []string{"does-not-exist", "DC0_C0_RP0_VM1"},
+			expectedParent: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			vmCtx := &capvcontext.VMContext{
+				Session: session,
+				VSphereVM: &infrav1.VSphereVM{
+					Spec: infrav1.VSphereVMSpec{
+						VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+							CloneMode:           infrav1.InstantClone,
+							InstantCloneParents: tc.parents,
+						},
+					},
+				},
+			}
+			vmCtx.VSphereVM.Name = "machine"
+
+			parent, parentName, err := findInstantCloneParent(ctx, vmCtx)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(parentName).To(Equal(tc.expectedParent))
+			if tc.expectedParent == "" {
+				g.Expect(parent).To(BeNil())
+			} else {
+				g.Expect(parent).ToNot(BeNil())
+			}
+		})
+	}
+}
+
+func TestGetInstantCloneNetworkSpecs(t *testing.T) {
+	model, session, server := initSimulator(t)
+	t.Cleanup(model.Remove)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	g := NewWithT(t)
+
+	parent, err := session.Finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+	g.Expect(err).ToNot(HaveOccurred())
+	devices, err := parent.Device(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	nics := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	g.Expect(nics).To(HaveLen(1))
+
+	newVMContext := func(devices ...infrav1.NetworkDeviceSpec) *capvcontext.VMContext {
+		return &capvcontext.VMContext{
+			Session: session,
+			VSphereVM: &infrav1.VSphereVM{
+				Spec: infrav1.VSphereVMSpec{
+					VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{
+						Network: infrav1.NetworkSpec{Devices: devices},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("network device count mismatch", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(
+			infrav1.NetworkDeviceSpec{NetworkName: "VM Network"},
+			infrav1.NetworkDeviceSpec{NetworkName: "VM Network"},
+		)
+		_, err := getInstantCloneNetworkSpecs(ctx, vmCtx, devices)
+		g.Expect(err).To(MatchError("instant clone parent has 1 network devices, expected 2"))
+	})
+
+	t.Run("edits the network devices of the parent", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(infrav1.NetworkDeviceSpec{NetworkName: "DC0_DVPG0"})
+		specs, err := getInstantCloneNetworkSpecs(ctx, vmCtx, object.VirtualDeviceList{nics[0]})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(specs).To(HaveLen(1))
+
+		spec := specs[0].GetVirtualDeviceConfigSpec()
+		g.Expect(spec.Operation).To(Equal(types.VirtualDeviceConfigSpecOperationEdit))
+		nic := spec.Device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		g.Expect(nic.Key).To(Equal(nics[0].GetVirtualDevice().Key))
+		g.Expect(nic.Backing).To(BeAssignableToTypeOf(&types.VirtualEthernetCardDistributedVirtualPortBackingInfo{}))
+		g.Expect(nic.MacAddress).To(BeEmpty())
+		g.Expect(nic.AddressType).To(Equal(string(types.VirtualEthernetCardMacTypeGenerated)))
+	})
+
+	t.Run("keeps a manual MAC address", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vmCtx := newVMContext(infrav1.NetworkDeviceSpec{NetworkName: "VM Network", MACAddr: "00:50:56:00:00:01"})
+		specs, err := getInstantCloneNetworkSpecs(ctx, vmCtx, object.VirtualDeviceList{nics[0]})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		nic := specs[0].GetVirtualDeviceConfigSpec().Device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		g.Expect(nic.MacAddress).To(Equal("00:50:56:00:00:01"))
+		g.Expect(nic.AddressType).To(Equal(string(types.VirtualEthernetCardMacTypeManual)))
+	})
+}
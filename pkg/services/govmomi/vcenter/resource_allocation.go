@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vcenter
+
+import (
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/utils/ptr"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+)
+
+// ResourceAllocationInfo returns the resource allocation of a VM config spec
+// for the resource allocation of a VSphereVM, or nil if it is not set.
+func ResourceAllocationInfo(allocation *infrav1.ResourceAllocation) *types.ResourceAllocationInfo {
+	if allocation == nil {
+		return nil
+	}
+	info := &types.ResourceAllocationInfo{
+		Reservation: allocation.Reservation,
+		Limit:       allocation.Limit,
+	}
+	if allocation.Shares != nil {
+		info.Shares = &types.SharesInfo{
+			Level:  types.SharesLevel(strings.ToLower(string(allocation.Shares.Level))),
+			Shares: allocation.Shares.Shares,
+		}
+	}
+	return info
+}
+
+// ResourceAllocationChanged returns true if the settings of the resource
+// allocation of a VSphereVM differ from the resource allocation of its VM.
+// The settings which are not set in the VSphereVM are ignored.
+func ResourceAllocationChanged(allocation *infrav1.ResourceAllocation, info *types.ResourceAllocationInfo) bool {
+	if allocation == nil {
+		return false
+	}
+	if info == nil {
+		return true
+	}
+	if allocation.Reservation != nil && *allocation.Reservation != ptr.Deref(info.Reservation, 0) {
+		return true
+	}
+	if allocation.Limit != nil && *allocation.Limit != ptr.Deref(info.Limit, -1) {
+		return true
+	}
+	if shares := allocation.Shares; shares != nil {
+		if info.Shares == nil || !strings.EqualFold(string(shares.Level), string(info.Shares.Level)) {
+			return true
+		}
+		// The number of shares of the other levels is computed by vSphere.
+		if shares.Level == infrav1.SharesLevelCustom && shares.Shares != info.Shares.Shares {
+			return true
+		}
+	}
+	return false
+}
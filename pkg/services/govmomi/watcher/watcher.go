@@ -0,0 +1,435 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package watcher contains tools to watch the VMs and the tasks of the
+// VSphereVMs with a single property collector per vCenter session.
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	capvcontext "sigs.k8s.io/cluster-api-provider-vsphere/pkg/context"
+)
+
+const (
+	morefTypeTask           = "Task"
+	morefTypeVirtualMachine = "VirtualMachine"
+)
+
+var (
+	// watchers are the watchers by vCenter client.
+	watchers sync.Map
+
+	// watchersMU avoids starting several watchers for a vCenter client.
+	watchersMU sync.Mutex
+
+	// managerCtx is the context of the manager the watchers are started
+	// with, once set by SetManagerContext.
+	managerCtx context.Context
+)
+
+var (
+	// maxWaitSeconds is the maximum time waiting for updates, after which the
+	// watcher checks that the session of the vCenter client is still active.
+	maxWaitSeconds int32 = 60
+
+	// vmProperties are the properties of the VMs whose changes trigger a
+	// reconcile of their VSphereVM.
+	vmProperties = []string{"runtime.powerState", "runtime.host", "guest.net", "config.changeVersion"}
+
+	// taskProperties are the properties of the tasks used to detect their
+	// completion.
+	taskProperties = []string{"info.state"}
+
+	// destroyTimeout is the maximum time destroying the property collector
+	// and the list view of a stopped watcher.
+	destroyTimeout = 10 * time.Second
+)
+
+// Watcher watches the VMs and the in-flight tasks of the VSphereVMs with a
+// single property collector, and triggers a reconcile of the VSphereVMs when
+// the state of their VM changes or their task completes.
+type Watcher struct {
+	client *vim25.Client
+	events chan<- event.GenericEvent
+	view   *view.ListView
+
+	mu sync.Mutex
+	// objects are the VSphereVMs by the VMs and tasks watched for them.
+	objects map[types.ManagedObjectReference]*infrav1.VSphereVM
+	// pending are the VSphereVMs to reconcile by namespaced name, which are
+	// sent to the events channel by send so that the updates are not blocked
+	// by the controller.
+	pending map[string]*infrav1.VSphereVM
+	// notify is signaled when VSphereVMs are added to pending.
+	notify  chan struct{}
+	stopped bool
+}
+
+// SetManagerContext sets the context the watchers are started with to the
+// context of the manager, so that a watcher shared by the reconciles runs
+// until the manager stops rather than until the reconcile which started it
+// is done.
+func SetManagerContext(ctx context.Context) {
+	watchersMU.Lock()
+	defer watchersMU.Unlock()
+	managerCtx = ctx
+}
+
+// Get returns the watcher of the vCenter client, and starts it if it is not
+// running. The watcher runs until the session of the client is gone or the
+// context of the manager is done. It is started with the given context if
+// the context of the manager was not set, e.g. in tests.
+func Get(ctx context.Context, controllerManagerCtx *capvcontext.ControllerManagerContext, c *vim25.Client) (*Watcher, error) {
+	if w, ok := watchers.Load(c); ok {
+		return w.(*Watcher), nil
+	}
+
+	watchersMU.Lock()
+	defer watchersMU.Unlock()
+
+	if w, ok := watchers.Load(c); ok {
+		return w.(*Watcher), nil
+	}
+	if managerCtx != nil {
+		ctx = managerCtx
+	}
+	log := controllerManagerCtx.Logger.WithName("vm-watcher").WithValues("server", c.URL().Host)
+	w, err := start(ctx, log, c, controllerManagerCtx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM")))
+	if err != nil {
+		return nil, err
+	}
+	watchers.Store(c, w)
+	return w, nil
+}
+
+func start(ctx context.Context, log logr.Logger, c *vim25.Client, events chan<- event.GenericEvent) (*Watcher, error) {
+	// The watched objects are added to a list view, which is traversed by the
+	// filter of the property collector.
+	listView, err := view.NewManager(c).CreateListView(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create list view of watched objects")
+	}
+	pc, err := property.DefaultCollector(c).Create(ctx)
+	if err != nil {
+		_ = listView.Destroy(ctx)
+		return nil, errors.Wrap(err, "failed to create property collector of watched objects")
+	}
+	_, err = pc.CreateFilter(ctx, types.CreateFilter{
+		Spec: types.PropertyFilterSpec{
+			ObjectSet: []types.ObjectSpec{{
+				Obj:  listView.Reference(),
+				Skip: types.NewBool(true),
+				SelectSet: []types.BaseSelectionSpec{
+					&types.TraversalSpec{Type: "ListView", Path: "view"},
+				},
+			}},
+			PropSet: []types.PropertySpec{
+				{Type: morefTypeVirtualMachine, PathSet: vmProperties},
+				{Type: morefTypeTask, PathSet: taskProperties},
+			},
+		},
+		PartialUpdates: true,
+	})
+	if err != nil {
+		_ = pc.Destroy(ctx)
+		_ = listView.Destroy(ctx)
+		return nil, errors.Wrap(err, "failed to create filter of watched objects")
+	}
+
+	w := &Watcher{
+		client:  c,
+		events:  events,
+		view:    listView,
+		objects: map[types.ManagedObjectReference]*infrav1.VSphereVM{},
+		pending: map[string]*infrav1.VSphereVM{},
+		notify:  make(chan struct{}, 1),
+	}
+	ctx = ctrl.LoggerInto(ctx, log)
+	log.Info("Watching VMs")
+	go w.run(ctx, pc)
+	go w.send(ctx)
+	return w, nil
+}
+
+// run waits for the updates of the watched objects until the session of the
+// vCenter client is gone, e.g. because it was logged out.
+func (w *Watcher) run(ctx context.Context, pc *property.Collector) {
+	log := ctrl.LoggerFrom(ctx)
+
+	defer func() {
+		// The property collector and the list view are gone with the session
+		// if it was logged out, so they are destroyed on a best-effort basis.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), destroyTimeout)
+		defer cancel()
+		// The pending wait is canceled, so that vCenter does not hold it
+		// until its maximum wait time once the context is done.
+		if err := pc.CancelWaitForUpdates(ctx); err != nil {
+			log.V(4).Info("Failed to cancel wait for updates of watched objects", "err", err)
+		}
+		if err := pc.Destroy(ctx); err != nil {
+			log.V(4).Info("Failed to destroy property collector of watched objects", "err", err)
+		}
+		if err := w.view.Destroy(ctx); err != nil {
+			log.V(4).Info("Failed to destroy list view of watched objects", "err", err)
+		}
+	}()
+
+	err := w.waitForUpdates(ctx, pc)
+	log.Error(err, "Stopped watching VMs")
+	watchers.CompareAndDelete(w.client, w)
+
+	w.mu.Lock()
+	objects := w.objects
+	w.objects = nil
+	w.stopped = true
+	w.mu.Unlock()
+
+	// Reconcile the VSphereVMs of the watched objects, so that they are
+	// watched again with the watcher of the new session.
+	for _, vsphereVM := range objects {
+		w.enqueue(vsphereVM)
+	}
+	// Wake up send even if there is nothing to send, so that it stops.
+	w.enqueue(nil)
+}
+
+// enqueue triggers a reconcile of the VSphereVM without waiting for the
+// controller to receive it. The reconciles of a VSphereVM are merged until
+// they are sent.
+func (w *Watcher) enqueue(vsphereVM *infrav1.VSphereVM) {
+	if vsphereVM != nil {
+		w.mu.Lock()
+		w.pending[klog.KObj(vsphereVM).String()] = vsphereVM
+		w.mu.Unlock()
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// send sends the reconciles of the pending VSphereVMs to the events channel,
+// until the watcher is stopped and they are all sent or the context is done.
+func (w *Watcher) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.notify:
+		}
+
+		w.mu.Lock()
+		pending, stopped := w.pending, w.stopped
+		w.pending = map[string]*infrav1.VSphereVM{}
+		w.mu.Unlock()
+
+		for _, vsphereVM := range pending {
+			select {
+			case w.events <- event.GenericEvent{Object: vsphereVM}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// waitForUpdates waits for the updates of the watched objects until it fails.
+// Unlike property.Collector.WaitForUpdatesEx, the version of the updates is
+// kept when the maximum wait time is exceeded, so that the current state of
+// the watched objects is not sent again.
+func (w *Watcher) waitForUpdates(ctx context.Context, pc *property.Collector) error {
+	req := types.WaitForUpdatesEx{
+		This:    pc.Reference(),
+		Options: &types.WaitOptions{MaxWaitSeconds: ptr.To(maxWaitSeconds)},
+	}
+	for {
+		res, err := methods.WaitForUpdatesEx(ctx, w.client, &req)
+		if err != nil {
+			return err
+		}
+		// The maximum wait time was exceeded.
+		if res.Returnval == nil {
+			continue
+		}
+
+		req.Version = res.Returnval.Version
+		for _, filterUpdate := range res.Returnval.FilterSet {
+			for _, update := range filterUpdate.ObjectSet {
+				w.onUpdate(ctx, update)
+			}
+		}
+	}
+}
+
+func (w *Watcher) onUpdate(ctx context.Context, update types.ObjectUpdate) {
+	log := ctrl.LoggerFrom(ctx)
+
+	w.mu.Lock()
+	vsphereVM, ok := w.objects[update.Obj]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// The objects removed from the view are forgotten before they leave it,
+	// so the objects leaving it were destroyed, like the purged tasks.
+	if update.Kind == types.ObjectUpdateKindLeave {
+		w.drop(update.Obj)
+	}
+
+	switch update.Obj.Type {
+	case morefTypeTask:
+		if update.Kind == types.ObjectUpdateKindLeave {
+			break
+		}
+		state, completed := taskCompletionState(update.ChangeSet)
+		if !completed {
+			return
+		}
+		w.forget(ctx, update.Obj)
+		// A failed task is retried once its RetryAfter time has passed, so
+		// it does not trigger a reconcile right away.
+		if state == types.TaskInfoStateError {
+			log.V(4).Info("Task failed, not triggering GenericEvent", "VSphereVM", klog.KObj(vsphereVM), "ref", update.Obj)
+			return
+		}
+	default:
+		// The state of the VM was reconciled when it started being watched.
+		if update.Kind == types.ObjectUpdateKindEnter {
+			return
+		}
+	}
+
+	changes := make([]string, 0, len(update.ChangeSet))
+	for _, change := range update.ChangeSet {
+		changes = append(changes, change.Name)
+	}
+	log.V(4).Info("Triggering GenericEvent", "VSphereVM", klog.KObj(vsphereVM), "ref", update.Obj, "kind", update.Kind, "changes", changes)
+	w.enqueue(vsphereVM)
+}
+
+// taskCompletionState returns the state of a task and true if the changes
+// report its completion.
+func taskCompletionState(changes []types.PropertyChange) (types.TaskInfoState, bool) {
+	for _, change := range changes {
+		if change.Name != "info.state" {
+			continue
+		}
+		switch state, _ := change.Val.(types.TaskInfoState); state {
+		case types.TaskInfoStateSuccess, types.TaskInfoStateError:
+			return state, true
+		}
+	}
+	return "", false
+}
+
+// WatchVM watches the power state, the host, the guest networking and the
+// configuration of the VM of the VSphereVM.
+func (w *Watcher) WatchVM(ctx context.Context, ref types.ManagedObjectReference, vsphereVM *infrav1.VSphereVM) error {
+	return w.watch(ctx, ref, vsphereVM)
+}
+
+// WatchTask watches the task of the VSphereVM until it completes.
+func (w *Watcher) WatchTask(ctx context.Context, ref types.ManagedObjectReference, vsphereVM *infrav1.VSphereVM) error {
+	return w.watch(ctx, ref, vsphereVM)
+}
+
+func (w *Watcher) watch(ctx context.Context, ref types.ManagedObjectReference, vsphereVM *infrav1.VSphereVM) error {
+	// Only the metadata of the VSphereVM is required to reconcile it.
+	obj := &infrav1.VSphereVM{}
+	obj.SetName(vsphereVM.Name)
+	obj.SetNamespace(vsphereVM.Namespace)
+	obj.SetLabels(vsphereVM.GetLabels())
+	obj.SetAnnotations(vsphereVM.GetAnnotations())
+
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return errors.Errorf("failed to watch %s: watcher is stopped", ref)
+	}
+	_, watched := w.objects[ref]
+	// The object is known before it is added to the view, so that its first
+	// update is not missed.
+	w.objects[ref] = obj
+	w.mu.Unlock()
+	if watched {
+		return nil
+	}
+
+	if _, err := w.view.Add(ctx, []types.ManagedObjectReference{ref}); err != nil {
+		w.mu.Lock()
+		delete(w.objects, ref)
+		w.mu.Unlock()
+		return errors.Wrapf(err, "failed to watch %s", ref)
+	}
+	return nil
+}
+
+// Unwatch stops watching the VM and the task of the VSphereVM.
+func (w *Watcher) Unwatch(ctx context.Context, vsphereVM *infrav1.VSphereVM) error {
+	var refs []types.ManagedObjectReference
+	w.mu.Lock()
+	for ref, obj := range w.objects {
+		if obj.Namespace == vsphereVM.Namespace && obj.Name == vsphereVM.Name {
+			refs = append(refs, ref)
+			delete(w.objects, ref)
+		}
+	}
+	w.mu.Unlock()
+	if len(refs) == 0 {
+		return nil
+	}
+
+	if _, err := w.view.Remove(ctx, refs); err != nil {
+		return errors.Wrapf(err, "failed to stop watching the VM of %s", klog.KObj(vsphereVM))
+	}
+	return nil
+}
+
+// forget stops watching the object.
+func (w *Watcher) forget(ctx context.Context, ref types.ManagedObjectReference) {
+	w.drop(ref)
+
+	if _, err := w.view.Remove(ctx, []types.ManagedObjectReference{ref}); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to stop watching object", "ref", ref)
+	}
+}
+
+// drop forgets the object, which is not in the view anymore.
+func (w *Watcher) drop(ref types.ManagedObjectReference) {
+	w.mu.Lock()
+	delete(w.objects, ref)
+	w.mu.Unlock()
+}
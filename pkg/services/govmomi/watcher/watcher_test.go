@@ -0,0 +1,163 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/context/fake"
+)
+
+func TestWatcher(t *testing.T) {
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vsphereVM1",
+			Namespace: "my-namespace",
+			Labels:    map[string]string{"foo": "bar"},
+		},
+	}
+
+	maxWaitSeconds = 1
+	defer func() { maxWaitSeconds = 60 }()
+
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		g := NewWithT(t)
+
+		controllerManagerCtx := fake.NewControllerManagerContext()
+		events := controllerManagerCtx.GetGenericEventChannelFor(infrav1.GroupVersion.WithKind("VSphereVM"))
+		expectEvent := func() {
+			var e event.GenericEvent
+			g.Eventually(events, 10*time.Second).Should(Receive(&e))
+			g.Expect(e.Object.GetNamespace()).To(Equal(vsphereVM.Namespace))
+			g.Expect(e.Object.GetName()).To(Equal(vsphereVM.Name))
+			g.Expect(e.Object.GetLabels()).To(Equal(vsphereVM.Labels))
+		}
+		watched := func(w *Watcher) func() int {
+			return func() int {
+				w.mu.Lock()
+				defer w.mu.Unlock()
+				return len(w.objects)
+			}
+		}
+
+		w, err := Get(ctx, controllerManagerCtx, c)
+		g.Expect(err).ToNot(HaveOccurred())
+		other, err := Get(ctx, controllerManagerCtx, c)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(other).To(BeIdenticalTo(w))
+
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(w.WatchVM(ctx, vm.Reference(), vsphereVM)).To(Succeed())
+		g.Expect(w.WatchVM(ctx, vm.Reference(), vsphereVM)).To(Succeed())
+		g.Expect(watched(w)()).To(Equal(1))
+
+		// The completion of the task and the change of the power state of
+		// the VM trigger a reconcile, which may be merged.
+		task, err := vm.PowerOff(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(w.WatchTask(ctx, task.Reference(), vsphereVM)).To(Succeed())
+		expectEvent()
+		g.Eventually(watched(w), 10*time.Second).Should(Equal(1))
+		g.Expect(task.Wait(ctx)).To(Succeed())
+		// Drop the reconcile of the power state if it was not merged.
+		time.Sleep(2 * time.Second)
+		select {
+		case <-events:
+		default:
+		}
+
+		// A failed task is forgotten without triggering a reconcile.
+		task, err = vm.PowerOff(ctx)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(w.WatchTask(ctx, task.Reference(), vsphereVM)).To(Succeed())
+		g.Expect(task.Wait(ctx)).ToNot(Succeed())
+		g.Eventually(watched(w), 10*time.Second).Should(Equal(1))
+		g.Consistently(events, 2*time.Second).ShouldNot(Receive())
+
+		// A change of the configuration of the VM triggers a reconcile.
+		task, err = vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{Annotation: "changed"})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(task.Wait(ctx)).To(Succeed())
+		expectEvent()
+
+		g.Expect(w.Unwatch(ctx, vsphereVM)).To(Succeed())
+		g.Expect(watched(w)()).To(BeZero())
+
+		// The watcher stops once the session is logged out, and triggers a
+		// reconcile of the VSphereVMs of the watched objects.
+		g.Expect(w.WatchVM(ctx, vm.Reference(), vsphereVM)).To(Succeed())
+		g.Expect(session.NewManager(c).Logout(ctx)).To(Succeed())
+		expectEvent()
+		_, ok := watchers.Load(c)
+		g.Expect(ok).To(BeFalse())
+		g.Expect(w.WatchVM(ctx, vm.Reference(), vsphereVM)).To(MatchError(ContainSubstring("watcher is stopped")))
+	})
+}
+
+func TestWatcherManagerContext(t *testing.T) {
+	vsphereVM := &infrav1.VSphereVM{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vsphereVM1",
+			Namespace: "my-namespace",
+		},
+	}
+
+	maxWaitSeconds = 1
+	defer func() { maxWaitSeconds = 60 }()
+
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		g := NewWithT(t)
+
+		managerCtx, cancelManager := context.WithCancel(ctx)
+		defer cancelManager()
+		SetManagerContext(managerCtx)
+		defer SetManagerContext(nil)
+
+		// The watcher outlives the reconcile which started it.
+		reconcileCtx, cancelReconcile := context.WithCancel(ctx)
+		w, err := Get(reconcileCtx, fake.NewControllerManagerContext(), c)
+		g.Expect(err).ToNot(HaveOccurred())
+		cancelReconcile()
+
+		vm, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_H0_VM0")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Consistently(func() error {
+			return w.WatchVM(ctx, vm.Reference(), vsphereVM)
+		}, 2*time.Second).Should(Succeed())
+
+		// The watcher stops with the manager.
+		cancelManager()
+		g.Eventually(func() error {
+			return w.WatchVM(ctx, vm.Reference(), vsphereVM)
+		}, 10*time.Second).Should(MatchError(ContainSubstring("watcher is stopped")))
+		_, ok := watchers.Load(c)
+		g.Expect(ok).To(BeFalse())
+	})
+}
@@ -50,6 +50,10 @@ type VirtualMachineService interface {
 
 	// DestroyVM powers off and removes a VM from the inventory.
 	DestroyVM(ctx context.Context, vmCtx *capvcontext.VMContext) (reconcile.Result, infrav1.VirtualMachine, error)
+
+	// RemediateVM takes a step of the remediation of the Machine of a VM.
+	// It returns false if the step cannot be taken on the VM.
+	RemediateVM(ctx context.Context, vmCtx *capvcontext.VMContext, step infrav1.RemediationStep) (bool, error)
 }
 
 // ControlPlaneEndpointService is a service for reconciling load balanced control plane endpoints.
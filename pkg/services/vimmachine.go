@@ -159,6 +159,11 @@ func (v *VimMachineService) ReconcileNormal(ctx context.Context, machineCtx capv
 		return false, err
 	}
 
+	// Report the progress of an in-place resize of the VM on the VSphereMachine.
+	if resized := conditions.Get(vm, infrav1.ResizedCondition); resized != nil {
+		conditions.Set(vimMachineCtx.VSphereMachine, resized)
+	}
+
 	// Waits the VM's ready state.
 	if !vm.Status.Ready {
 		log.Info("Waiting for VSphereVM to become ready")
@@ -185,6 +190,7 @@ func (v *VimMachineService) ReconcileNormal(ctx context.Context, machineCtx capv
 		return true, nil
 	}
 
+	vimMachineCtx.VSphereMachine.Status.DataDisks = vm.Status.DataDisks
 	vimMachineCtx.VSphereMachine.Status.Ready = true
 	return false, nil
 }
@@ -368,6 +374,7 @@ func (v *VimMachineService) createOrPatchVSphereVM(ctx context.Context, vimMachi
 		}
 		vm.Spec.PowerOffMode = vimMachineCtx.VSphereMachine.Spec.PowerOffMode
 		vm.Spec.GuestSoftPowerOffTimeout = vimMachineCtx.VSphereMachine.Spec.GuestSoftPowerOffTimeout
+		vm.Spec.Adopt = vimMachineCtx.VSphereMachine.Spec.Adopt.DeepCopy()
 		return nil
 	}
 
@@ -424,24 +431,36 @@ func (v *VimMachineService) generateOverrideFunc(ctx context.Context, vimMachine
 	}
 
 	overrideWithFailureDomainFunc := func(vm *infrav1.VSphereVM) {
-		vm.Spec.Server = vsphereDeploymentZone.Spec.Server
-		vm.Spec.Datacenter = vsphereFailureDomain.Spec.Topology.Datacenter
-		if vsphereDeploymentZone.Spec.PlacementConstraint.Folder != "" {
-			vm.Spec.Folder = vsphereDeploymentZone.Spec.PlacementConstraint.Folder
-		}
-		if vsphereDeploymentZone.Spec.PlacementConstraint.ResourcePool != "" {
-			vm.Spec.ResourcePool = vsphereDeploymentZone.Spec.PlacementConstraint.ResourcePool
-		}
-		if vsphereFailureDomain.Spec.Topology.Datastore != "" {
-			vm.Spec.Datastore = vsphereFailureDomain.Spec.Topology.Datastore
-		}
-		if len(vsphereFailureDomain.Spec.Topology.Networks) > 0 {
-			vm.Spec.Network.Devices = overrideNetworkDeviceSpecs(vm.Spec.Network.Devices, vsphereFailureDomain.Spec.Topology.Networks)
-		}
+		OverrideWithFailureDomain(vm, &vsphereDeploymentZone, &vsphereFailureDomain)
 	}
 	return overrideWithFailureDomainFunc, true
 }
 
+// OverrideWithFailureDomain overrides the placement of the VSphereVM with the
+// values of the VSphereDeploymentZone and VSphereFailureDomain of a failure
+// domain.
+func OverrideWithFailureDomain(vm *infrav1.VSphereVM, vsphereDeploymentZone *infrav1.VSphereDeploymentZone, vsphereFailureDomain *infrav1.VSphereFailureDomain) {
+	vm.Spec.Server = vsphereDeploymentZone.Spec.Server
+	vm.Spec.Datacenter = vsphereFailureDomain.Spec.Topology.Datacenter
+	if vsphereDeploymentZone.Spec.PlacementConstraint.Folder != "" {
+		vm.Spec.Folder = vsphereDeploymentZone.Spec.PlacementConstraint.Folder
+	}
+	if vsphereDeploymentZone.Spec.PlacementConstraint.ResourcePool != "" {
+		vm.Spec.ResourcePool = vsphereDeploymentZone.Spec.PlacementConstraint.ResourcePool
+	}
+	if vsphereFailureDomain.Spec.Topology.Datastore != "" {
+		vm.Spec.Datastore = vsphereFailureDomain.Spec.Topology.Datastore
+		vm.Spec.DatastoreCluster = ""
+	}
+	if vsphereFailureDomain.Spec.Topology.DatastoreCluster != "" {
+		vm.Spec.Datastore = ""
+		vm.Spec.DatastoreCluster = vsphereFailureDomain.Spec.Topology.DatastoreCluster
+	}
+	if len(vsphereFailureDomain.Spec.Topology.Networks) > 0 {
+		vm.Spec.Network.Devices = overrideNetworkDeviceSpecs(vm.Spec.Network.Devices, vsphereFailureDomain.Spec.Topology.Networks)
+	}
+}
+
 // overrideNetworkDeviceSpecs updates the network devices with the network definitions from the PlacementConstraint.
 // The substitution is done based on the order in which the network devices have been defined.
 //
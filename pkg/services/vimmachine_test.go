@@ -106,6 +106,26 @@ func Test_VimMachineService_GenerateOverrideFunc(t *testing.T) {
 		g.Expect(vm.Spec.Datacenter).To(Equal("dc-one"))
 	})
 
+	t.Run("uses the failure domains datastore cluster instead of the VM datastore", func(t *testing.T) {
+		g := NewWithT(t)
+		fd := failureDomain("one")
+		fd.Spec.Topology.Datastore = ""
+		fd.Spec.Topology.DatastoreCluster = "pod-one"
+		controllerManagerContext := fake.NewControllerManagerContext(deplZone("one"), fd)
+		machineCtx := fake.NewMachineContext(ctx, fake.NewClusterContext(ctx, controllerManagerContext), controllerManagerContext)
+		machineCtx.Machine.Spec.FailureDomain = ptr.To("zone-one")
+		vimMachineService := &VimMachineService{controllerManagerContext.Client}
+
+		overrideFunc, ok := vimMachineService.generateOverrideFunc(ctx, machineCtx)
+		g.Expect(ok).To(BeTrue())
+
+		vm := &infrav1.VSphereVM{Spec: infrav1.VSphereVMSpec{VirtualMachineCloneSpec: infrav1.VirtualMachineCloneSpec{Datastore: "ds"}}}
+		overrideFunc(vm)
+
+		g.Expect(vm.Spec.Datastore).To(BeEmpty())
+		g.Expect(vm.Spec.DatastoreCluster).To(Equal("pod-one"))
+	})
+
 	t.Run("fails to generate an override function for non-existent failure domain value", func(t *testing.T) {
 		g := NewWithT(t)
 		controllerManagerContext := fake.NewControllerManagerContext(deplZone("one"), deplZone("two"), failureDomain("one"), failureDomain("two"))
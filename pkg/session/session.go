@@ -20,9 +20,15 @@ package session
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
 	"fmt"
+	"net/http"
 	"net/netip"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,6 +39,7 @@ import (
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/session"
 	"github.com/vmware/govmomi/session/keepalive"
+	"github.com/vmware/govmomi/sts"
 	"github.com/vmware/govmomi/vapi/rest"
 	"github.com/vmware/govmomi/vapi/tags"
 	"github.com/vmware/govmomi/vim25"
@@ -42,17 +49,60 @@ import (
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-vsphere/apis/v1beta1"
 	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/constants"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
 )
 
 var (
-	// global Session map against sessionKeys in map[sessionKey]Session.
+	// global Session map against cacheKeys in map[cacheKey]Session.
 	sessionCache sync.Map
 
 	// mutex to control access to the GetOrCreate function to avoid duplicate
 	// session creations on startup.
 	sessionMU sync.Mutex
+
+	// drainPeriod is the time during which a drained session remains logged
+	// in, so that the reconciles which are still using it can complete.
+	drainPeriod = time.Minute
 )
 
+// cacheKey identifies a cached session by the credentials it was created
+// with. The subject is the username, or the subject of the TLS keypair or of
+// the token of the sessions logged in with them, and the password hash is the
+// hash of the password, keypair or token. The connection hash is the hash of the
+// thumbprint, the CA bundle and the proxy the server is connected with.
+type cacheKey struct {
+	server         string
+	datacenter     string
+	subject        string
+	passwordHash   string
+	connectionHash string
+}
+
+func newCacheKey(params *Params) cacheKey {
+	var proxyURL string
+	if params.proxyURL != nil {
+		proxyURL = params.proxyURL.String()
+	}
+	return cacheKey{
+		server:         params.server,
+		datacenter:     params.datacenter,
+		subject:        params.subject(),
+		passwordHash:   fmt.Sprintf("%x", sha256.Sum256([]byte(params.secret()))),
+		connectionHash: hash(params.thumbprint, string(params.caBundle), proxyURL),
+	}
+}
+
+// hash returns the hash of the values, which are separated so that distinct
+// values cannot have the same hash.
+func hash(values ...string) string {
+	h := sha256.New()
+	for _, value := range values {
+		_, _ = h.Write([]byte(value))
+		_, _ = h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 // Session is a vSphere session with a configured Finder.
 type Session struct {
 	*govmomi.Client
@@ -76,11 +126,16 @@ func DefaultFeature() Feature {
 
 // Params are the parameters of a VCenter session.
 type Params struct {
-	server     string
-	datacenter string
-	userinfo   *url.Userinfo
-	thumbprint string
-	feature    Feature
+	server      string
+	datacenter  string
+	userinfo    *url.Userinfo
+	certificate string
+	privateKey  string
+	token       string
+	thumbprint  string
+	caBundle    []byte
+	proxyURL    *url.URL
+	feature     Feature
 }
 
 // NewParams returns an empty set of parameters with default features.
@@ -108,18 +163,107 @@ func (p *Params) WithUserInfo(username, password string) *Params {
 	return p
 }
 
+// WithCertificate adds the PEM encoded TLS keypair of a solution user to
+// parameters. The session is logged in with a holder-of-key token issued by
+// the STS of the server for the certificate, instead of the userinfo.
+func (p *Params) WithCertificate(certificate, privateKey string) *Params {
+	p.certificate = certificate
+	p.privateKey = privateKey
+	return p
+}
+
+// WithToken adds a SAML bearer token issued by the STS of the server to
+// parameters. The session is logged in with the token instead of the
+// userinfo, unless a certificate is added.
+func (p *Params) WithToken(token string) *Params {
+	p.token = token
+	return p
+}
+
+// secret returns what the session is authenticated with: the TLS keypair,
+// else the token, else the password.
+func (p *Params) secret() string {
+	switch {
+	case p.certificate != "":
+		return p.certificate + p.privateKey
+	case p.token != "":
+		return p.token
+	}
+	password, _ := p.userinfo.Password()
+	return password
+}
+
+// subject returns who the session is authenticated as: the subject of the
+// certificate of the TLS keypair, else the subject of the token, else the
+// username. The keypairs and tokens which cannot be parsed are identified by
+// their hash, so that they are never taken for the ones of another subject.
+func (p *Params) subject() string {
+	switch {
+	case p.certificate != "":
+		if block, _ := pem.Decode([]byte(p.certificate)); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				return "certificate:" + cert.Subject.String()
+			}
+		}
+		return "certificate:" + hash(p.certificate)
+	case p.token != "":
+		var assertion struct {
+			NameID string `xml:"Subject>NameID"`
+		}
+		if err := xml.Unmarshal([]byte(p.token), &assertion); err == nil && assertion.NameID != "" {
+			return "token:" + assertion.NameID
+		}
+		return "token:" + hash(p.token)
+	}
+	return p.userinfo.Username()
+}
+
 // WithThumbprint adds a thumbprint to parameters.
 func (p *Params) WithThumbprint(thumbprint string) *Params {
 	p.thumbprint = thumbprint
 	return p
 }
 
+// WithCABundle adds the PEM encoded certificate authorities used to verify
+// the certificate of the server to parameters. The certificate is trusted if
+// it is signed by one of them, even if it does not match the thumbprint.
+func (p *Params) WithCABundle(caBundle []byte) *Params {
+	p.caBundle = caBundle
+	return p
+}
+
+// WithProxy adds the URL of the HTTP proxy used to connect to the server to
+// parameters.
+func (p *Params) WithProxy(proxyURL *url.URL) *Params {
+	p.proxyURL = proxyURL
+	return p
+}
+
 // WithFeatures adds features to parameters.
 func (p *Params) WithFeatures(feature Feature) *Params {
 	p.feature = feature
 	return p
 }
 
+// WithVSphereServer adds the server, the certificate verification and the
+// session tuning of the VSphereServer to parameters. The proxy of the
+// VSphereServer must be added with WithProxy, as its credentials are held by
+// a Secret.
+func (p *Params) WithVSphereServer(vsphereServer *infrav1.VSphereServer) *Params {
+	p.server = vsphereServer.Spec.Server
+	p.thumbprint = vsphereServer.Spec.Thumbprint
+	p.caBundle = vsphereServer.Spec.CABundle
+	if tuning := vsphereServer.Spec.Session; tuning != nil {
+		if tuning.EnableKeepAlive != nil {
+			p.feature.EnableKeepAlive = *tuning.EnableKeepAlive
+		}
+		if tuning.KeepAliveDuration != nil {
+			p.feature.KeepAliveDuration = tuning.KeepAliveDuration.Duration
+		}
+	}
+	return p
+}
+
 // GetOrCreate gets a cached session or creates a new one if one does not
 // already exist.
 func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
@@ -132,12 +276,7 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 	sessionMU.Lock()
 	defer sessionMU.Unlock()
 
-	userPassword, _ := params.userinfo.Password()
-	h := sha256.New()
-	h.Write([]byte(userPassword))
-	hashedUserPassword := h.Sum(nil)
-	sessionKey := fmt.Sprintf("%s#%s#%s#%x", params.server, params.datacenter, params.userinfo.Username(),
-		hashedUserPassword)
+	sessionKey := newCacheKey(params)
 	if cachedSession, ok := sessionCache.Load(sessionKey); ok {
 		s := cachedSession.(*Session)
 
@@ -155,6 +294,7 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 
 		if userSession != nil && tagManagerSession != nil {
 			log.Info("Found active cached vSphere client session")
+			metrics.SessionCacheHits.WithLabelValues(params.server).Inc()
 			return s, nil
 		}
 
@@ -173,16 +313,9 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 		}
 	}
 
-	// soap.ParseURL expects a valid URL. In the case of a bare, unbracketed
-	// IPv6 address (e.g fd00::1) ParseURL will fail. Surround unbracketed IPv6
-	// addresses with brackets.
-	urlSafeServer := params.server
-	ip, err := netip.ParseAddr(urlSafeServer)
-	if err == nil && ip.Is6() {
-		urlSafeServer = fmt.Sprintf("[%s]", urlSafeServer)
-	}
+	metrics.SessionCacheMisses.WithLabelValues(params.server).Inc()
 
-	soapURL, err := soap.ParseURL(urlSafeServer)
+	soapURL, err := parseServerURL(params.server)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create vCenter session: error parsing vSphere URL %q", params.server)
 	}
@@ -191,7 +324,7 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 	}
 
 	soapURL.User = params.userinfo
-	client, err := newClient(ctx, sessionKey, soapURL, params.thumbprint, params.feature)
+	client, signer, err := newClient(ctx, sessionKey, soapURL, params)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create vCenter session")
 	}
@@ -202,7 +335,7 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 	// Assign the finder to the session.
 	session.Finder = find.NewFinder(session.Client.Client, false)
 	// Assign tag manager to the session.
-	manager, err := newManager(ctx, sessionKey, client.Client, soapURL.User, params.feature)
+	manager, err := newManager(ctx, sessionKey, client.Client, soapURL.User, signer, params.feature)
 	if err != nil {
 		log.Error(err, "Failed to create tags manager, will logout")
 		// Logout of previously logged session to not leak
@@ -235,21 +368,76 @@ func GetOrCreate(ctx context.Context, params *Params) (*Session, error) {
 
 	log.Info("Created and cached vSphere client session")
 
+	// The sessions of the user created with another password, keypair or
+	// token predate their rotation and must not be used anymore.
+	drainSessions(ctx, func(key cacheKey) bool {
+		return key.server == sessionKey.server &&
+			key.datacenter == sessionKey.datacenter &&
+			key.subject == sessionKey.subject &&
+			key.passwordHash != sessionKey.passwordHash
+	})
+
 	return &session, nil
 }
 
-func newClient(ctx context.Context, sessionKey string, url *url.URL, thumbprint string, feature Feature) (*govmomi.Client, error) {
+// ServerHost returns the host of the URL of the vCenter server, as reported
+// by the clients of its sessions, e.g. without the scheme and the path of the
+// URL and with the brackets of an IPv6 address. It returns the server as is
+// if it is not a valid URL.
+func ServerHost(server string) string {
+	u, err := parseServerURL(server)
+	if err != nil || u == nil {
+		return server
+	}
+	return u.Host
+}
+
+// parseServerURL returns the URL of the SDK of the vCenter server.
+func parseServerURL(server string) (*url.URL, error) {
+	// soap.ParseURL expects a valid URL. In the case of a bare, unbracketed
+	// IPv6 address (e.g fd00::1) ParseURL will fail. Surround unbracketed IPv6
+	// addresses with brackets.
+	ip, err := netip.ParseAddr(server)
+	if err == nil && ip.Is6() {
+		server = fmt.Sprintf("[%s]", server)
+	}
+	return soap.ParseURL(server)
+}
+
+// newClient creates a client logged in with the userinfo of the URL, or with
+// the signer it returns if the parameters have a TLS keypair or a token.
+func newClient(ctx context.Context, sessionKey cacheKey, url *url.URL, params *Params) (*govmomi.Client, *sts.Signer, error) {
 	log := ctrl.LoggerFrom(ctx)
 
-	insecure := thumbprint == ""
+	thumbprint, caBundle, proxyURL, feature := params.thumbprint, params.caBundle, params.proxyURL, params.feature
+	insecure := thumbprint == "" && len(caBundle) == 0
 	soapClient := soap.NewClient(url, insecure)
-	if !insecure {
+	// The REST client used for the tags shares the transport of the SOAP
+	// client, and so its certificate verification and proxy.
+	transport := soapClient.DefaultTransport()
+	if len(caBundle) > 0 {
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, nil, errors.New("failed to create client: no certificate found in CA bundle")
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+	if thumbprint != "" {
 		soapClient.SetThumbprint(url.Host, thumbprint)
 	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+		// The TLS connections tunneled through the proxy are not dialed by
+		// the SOAP client, which is where the thumbprint is verified.
+		if !insecure && thumbprint != "" {
+			transport.TLSClientConfig.InsecureSkipVerify = true
+			transport.TLSClientConfig.VerifyConnection = verifyConnection(url.Hostname(), thumbprint, transport.TLSClientConfig.RootCAs)
+		}
+	}
 
 	vimClient, err := vim25.NewClient(ctx, soapClient)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create client")
+		return nil, nil, errors.Wrapf(err, "failed to create client")
 	}
 	vimClient.UserAgent = "k8s-capv-useragent"
 
@@ -272,15 +460,95 @@ func newClient(ctx context.Context, sessionKey string, url *url.URL, thumbprint
 		})
 	}
 
+	signer, err := newSigner(ctx, vimClient, params)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to create client")
+	}
+	if signer != nil {
+		// LoginByToken requires the version of the service in the SOAPAction
+		// header rather than the one of the vim25 package.
+		if vimClient.Version == vim25.Version {
+			_ = vimClient.UseServiceVersion()
+		}
+		header := soap.Header{Security: signer}
+		if err := c.SessionManager.LoginByToken(vimClient.WithHeader(ctx, header)); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to create client: failed to login by token")
+		}
+		return c, signer, nil
+	}
+
 	if err := c.Login(ctx, url.User); err != nil {
-		return nil, errors.Wrapf(err, "failed to create client: failed to login")
+		return nil, nil, errors.Wrapf(err, "failed to create client: failed to login")
 	}
 
-	return c, nil
+	return c, nil, nil
+}
+
+// newSigner returns the signer used to login with a token, or nil if the
+// session is logged in with the userinfo. A holder-of-key token is issued by
+// the STS for the certificate of a solution user, while a bearer token is
+// used as is.
+func newSigner(ctx context.Context, c *vim25.Client, params *Params) (*sts.Signer, error) {
+	if params.certificate == "" {
+		if params.token == "" {
+			return nil, nil
+		}
+		return &sts.Signer{Token: params.token}, nil
+	}
+
+	certificate, err := tls.X509KeyPair([]byte(params.certificate), []byte(params.privateKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TLS keypair")
+	}
+	stsClient, err := sts.NewClient(ctx, c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create STS client")
+	}
+	signer, err := stsClient.Issue(ctx, sts.TokenRequest{
+		Certificate: &certificate,
+		Delegatable: true,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to issue token")
+	}
+	return signer, nil
+}
+
+// verifyConnection returns a function verifying the certificate of a TLS
+// connection like the SOAP client does: the certificate must be signed by a
+// trusted certificate authority, or the certificate of the server must match
+// its thumbprint. The transport of a session only connects to its server, so
+// the certificate is verified against the name of the server rather than the
+// server name of the connection, which is empty for IP addresses.
+func verifyConnection(serverName, thumbprint string, rootCAs *x509.CertPool) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no certificate presented")
+		}
+		opts := x509.VerifyOptions{
+			Roots:         rootCAs,
+			DNSName:       serverName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		if err == nil {
+			return nil
+		}
+
+		cert := cs.PeerCertificates[0]
+		if strings.EqualFold(thumbprint, soap.ThumbprintSHA1(cert)) || strings.EqualFold(thumbprint, soap.ThumbprintSHA256(cert)) {
+			return nil
+		}
+		return errors.Wrapf(err, "host %q thumbprint does not match %q", serverName, thumbprint)
+	}
 }
 
 // newManager creates a Manager that encompasses the REST Client for the VSphere tagging API.
-func newManager(ctx context.Context, sessionKey string, client *vim25.Client, user *url.Userinfo, feature Feature) (*tags.Manager, error) {
+// The REST client is logged in with the signer if any, else with the userinfo.
+func newManager(ctx context.Context, sessionKey cacheKey, client *vim25.Client, user *url.Userinfo, signer *sts.Signer, feature Feature) (*tags.Manager, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	rc := rest.NewClient(client)
@@ -303,6 +571,12 @@ func newManager(ctx context.Context, sessionKey string, client *vim25.Client, us
 			return errors.New("REST client session expired")
 		})
 	}
+	if signer != nil {
+		if err := rc.LoginByToken(rc.WithSigner(ctx, signer)); err != nil {
+			return nil, errors.Wrapf(err, "failed to create tags manager: failed to login REST client by token")
+		}
+		return tags.NewManager(rc), nil
+	}
 	if err := rc.Login(ctx, user); err != nil {
 		return nil, errors.Wrapf(err, "failed to create tags manager: failed to login REST client")
 	}
@@ -334,6 +608,53 @@ func Clear() {
 	})
 }
 
+// Drain removes the cached sessions created with the credentials of the
+// parameters, whatever their server and datacenter, e.g. because the
+// credentials were rotated, so that new sessions are created by GetOrCreate.
+// The drained sessions are logged out once the reconciles which may still be
+// using them had the time to complete.
+func Drain(ctx context.Context, params *Params) {
+	drained := newCacheKey(params)
+	drainSessions(ctx, func(key cacheKey) bool {
+		return key.subject == drained.subject && key.passwordHash == drained.passwordHash
+	})
+}
+
+// drainSessions removes the cached sessions whose key matches from the cache,
+// and logs them out after the drain period.
+func drainSessions(ctx context.Context, match func(cacheKey) bool) {
+	log := ctrl.LoggerFrom(ctx)
+
+	sessionCache.Range(func(k, v any) bool {
+		key := k.(cacheKey)
+		if !match(key) {
+			return true
+		}
+		if _, loaded := sessionCache.LoadAndDelete(key); !loaded {
+			return true
+		}
+
+		log := log.WithValues("server", key.server, "datacenter", key.datacenter, "subject", key.subject)
+		log.Info("Draining cached vSphere client session", "drainPeriod", drainPeriod)
+		metrics.SessionsDrained.WithLabelValues(key.server).Inc()
+
+		s := v.(*Session)
+		time.AfterFunc(drainPeriod, func() {
+			// The context of the reconcile draining the session may be done by now.
+			ctx := ctrl.LoggerInto(context.Background(), log)
+			if err := s.TagManager.Logout(ctx); err != nil {
+				log.Error(err, "Failed to logout drained REST session")
+			}
+			if err := s.Client.Logout(ctx); err != nil {
+				log.Error(err, "Failed to logout drained session")
+			} else {
+				log.Info("Logout drained session succeed")
+			}
+		})
+		return true
+	})
+}
+
 // FindByBIOSUUID finds an object by its BIOS UUID.
 //
 // To avoid comments about this function's name, please see the Golang
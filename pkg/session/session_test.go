@@ -19,14 +19,32 @@ package session
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	_ "github.com/vmware/govmomi/lookup/simulator"
 	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/sts"
+	_ "github.com/vmware/govmomi/sts/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 
@@ -172,3 +190,450 @@ func TestGetSessionWithKeepAlive(t *testing.T) {
 	g.Expect(sessionInfo.Key).ToNot(BeEquivalentTo(firstSession))
 	assertSessionCountEqualTo(g, simr, 1)
 }
+
+func TestDrainSessions(t *testing.T) {
+	g := NewWithT(t)
+	ctrl.SetLogger(klog.Background())
+
+	simr, err := vcsim.NewBuilder().Build()
+	if err != nil {
+		t.Fatalf("failed to create VC simulator")
+	}
+	defer simr.Destroy()
+
+	drainPeriod = 0
+	defer func() { drainPeriod = time.Minute }()
+
+	params := NewParams().
+		WithServer(simr.ServerURL().Host).
+		WithUserInfo(simr.Username(), simr.Password())
+	key := newCacheKey(params)
+	isLoggedOut := func(ctx context.Context, s *Session) func() bool {
+		return func() bool {
+			userSession, _ := s.SessionManager.UserSession(ctx)
+			return userSession == nil
+		}
+	}
+
+	t.Run("drains the sessions created with the previous password of the user", func(t *testing.T) {
+		ctx := context.Background()
+		previous, err := GetOrCreate(ctx, params)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// Cache the session as if it was created before the rotation of the password.
+		previousKey := newCacheKey(NewParams().
+			WithServer(simr.ServerURL().Host).
+			WithUserInfo(simr.Username(), "previous"))
+		sessionCache.Delete(key)
+		sessionCache.Store(previousKey, previous)
+
+		s, err := GetOrCreate(ctx, params)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(s).ToNot(BeIdenticalTo(previous))
+		_, ok := sessionCache.Load(previousKey)
+		g.Expect(ok).To(BeFalse())
+		g.Eventually(isLoggedOut(ctx, previous), 10*time.Second).Should(BeTrue())
+		g.Expect(isLoggedOut(ctx, s)()).To(BeFalse())
+	})
+
+	t.Run("drains the sessions created with the given credentials", func(t *testing.T) {
+		ctx := context.Background()
+		s, err := GetOrCreate(ctx, params)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		Drain(ctx, NewParams().WithUserInfo(simr.Username(), "other"))
+		_, ok := sessionCache.Load(key)
+		g.Expect(ok).To(BeTrue())
+
+		Drain(ctx, NewParams().WithUserInfo(simr.Username(), simr.Password()))
+		_, ok = sessionCache.Load(key)
+		g.Expect(ok).To(BeFalse())
+		g.Eventually(isLoggedOut(ctx, s), 10*time.Second).Should(BeTrue())
+	})
+}
+
+func TestNewCacheKey(t *testing.T) {
+	g := NewWithT(t)
+
+	newParams := func() *Params {
+		return NewParams().
+			WithServer("vcenter.local").
+			WithUserInfo("user", "password")
+	}
+	proxyURL, err := url.Parse("http://proxy.local:3128")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// The sessions connected with another thumbprint, CA bundle or proxy are
+	// not shared.
+	key := newCacheKey(newParams())
+	g.Expect(newCacheKey(newParams())).To(Equal(key))
+	keys := []cacheKey{
+		key,
+		newCacheKey(newParams().WithThumbprint("thumbprint")),
+		newCacheKey(newParams().WithCABundle([]byte("bundle"))),
+		newCacheKey(newParams().WithProxy(proxyURL)),
+		newCacheKey(newParams().WithThumbprint("thumbprint").WithCABundle([]byte("bundle"))),
+	}
+	for i := range keys {
+		for j := range keys {
+			if i != j {
+				g.Expect(keys[i]).NotTo(Equal(keys[j]))
+			}
+		}
+	}
+}
+
+func TestServerHost(t *testing.T) {
+	g := NewWithT(t)
+
+	for server, host := range map[string]string{
+		"vcenter.local":                  "vcenter.local",
+		"vcenter.local:8443":             "vcenter.local:8443",
+		"https://vcenter.local/sdk":      "vcenter.local",
+		"https://vcenter.local:8443/sdk": "vcenter.local:8443",
+		"10.0.0.1":                       "10.0.0.1",
+		"fd00::1":                        "[fd00::1]",
+		"[fd00::1]:8443":                 "[fd00::1]:8443",
+		"https://[fd00::1]/sdk":          "[fd00::1]",
+	} {
+		g.Expect(ServerHost(server)).To(Equal(host), server)
+	}
+}
+
+func TestGetSessionWithCABundle(t *testing.T) {
+	ctrl.SetLogger(klog.Background())
+
+	simr, err := vcsim.NewBuilder().Build()
+	if err != nil {
+		t.Fatalf("failed to create VC simulator")
+	}
+	defer simr.Destroy()
+
+	cert := simr.Certificate()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	otherCABundle := createTestCABundle(t)
+
+	tests := []struct {
+		name       string
+		thumbprint string
+		caBundle   []byte
+		wantErr    bool
+	}{
+		{
+			name:     "with the CA bundle of the server",
+			caBundle: caBundle,
+		},
+		{
+			name:       "with the CA bundle of the server and an outdated thumbprint",
+			thumbprint: "AA:BB:CC",
+			caBundle:   caBundle,
+		},
+		{
+			name:       "with another CA bundle and the thumbprint of the server",
+			thumbprint: soap.ThumbprintSHA1(cert),
+			caBundle:   otherCABundle,
+		},
+		{
+			name:     "with another CA bundle",
+			caBundle: otherCABundle,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			defer clearSessionCache()
+
+			params := NewParams().
+				WithServer(simr.ServerURL().Host).
+				WithUserInfo(simr.Username(), simr.Password()).
+				WithThumbprint(tt.thumbprint).
+				WithCABundle(tt.caBundle)
+			s, err := GetOrCreate(context.Background(), params)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(s.TagManager).ToNot(BeNil())
+		})
+	}
+}
+
+func TestGetSessionWithProxy(t *testing.T) {
+	ctrl.SetLogger(klog.Background())
+
+	simr, err := vcsim.NewBuilder().Build()
+	if err != nil {
+		t.Fatalf("failed to create VC simulator")
+	}
+	defer simr.Destroy()
+
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tunnels.Add(1)
+		go func() { _, _ = io.Copy(target, conn) }()
+		_, _ = io.Copy(conn, target)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("verifies the thumbprint of the server", func(t *testing.T) {
+		g := NewWithT(t)
+		defer clearSessionCache()
+
+		params := NewParams().
+			WithServer(simr.ServerURL().Host).
+			WithUserInfo(simr.Username(), simr.Password()).
+			WithThumbprint("AA:BB:CC").
+			WithProxy(proxyURL)
+		_, err := GetOrCreate(context.Background(), params)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("thumbprint does not match"))
+	})
+
+	t.Run("connects through the proxy", func(t *testing.T) {
+		g := NewWithT(t)
+		defer clearSessionCache()
+
+		tunnels.Store(0)
+		params := NewParams().
+			WithServer(simr.ServerURL().Host).
+			WithUserInfo(simr.Username(), simr.Password()).
+			WithThumbprint(soap.ThumbprintSHA1(simr.Certificate())).
+			WithProxy(proxyURL)
+		s, err := GetOrCreate(context.Background(), params)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(s.TagManager).ToNot(BeNil())
+		g.Expect(tunnels.Load()).To(BeNumerically(">", 0))
+	})
+}
+
+func TestGetSessionWithCertificateOrToken(t *testing.T) {
+	ctrl.SetLogger(klog.Background())
+
+	simr, err := vcsim.NewBuilder().Build()
+	if err != nil {
+		t.Fatalf("failed to create VC simulator")
+	}
+	defer simr.Destroy()
+
+	certificate, privateKey := createTestKeyPair(t, "capv-solution-user")
+
+	tests := []struct {
+		name        string
+		certificate string
+		privateKey  string
+		token       string
+		wantErr     bool
+	}{
+		{
+			name:        "with the certificate of a solution user",
+			certificate: certificate,
+			privateKey:  privateKey,
+		},
+		{
+			name:  "with a bearer token",
+			token: simulatorToken(t, simr),
+		},
+		{
+			name:        "with an invalid keypair",
+			certificate: certificate,
+			privateKey:  "not a private key",
+			wantErr:     true,
+		},
+		{
+			name:    "with an invalid token",
+			token:   "not a token",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			defer clearSessionCache()
+
+			params := NewParams().
+				WithServer(simr.ServerURL().Host).
+				WithCertificate(tt.certificate, tt.privateKey).
+				WithToken(tt.token)
+			s, err := GetOrCreate(context.Background(), params)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			userSession, err := s.SessionManager.UserSession(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(userSession).ToNot(BeNil())
+			tagManagerSession, err := s.TagManager.Session(context.Background())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(tagManagerSession).ToNot(BeNil())
+
+			// The session is cached by its credentials.
+			cached, err := GetOrCreate(context.Background(), params)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cached).To(BeIdenticalTo(s))
+		})
+	}
+}
+
+func TestDrainSessionsOfSubject(t *testing.T) {
+	g := NewWithT(t)
+	ctrl.SetLogger(klog.Background())
+
+	simr, err := vcsim.NewBuilder().Build()
+	if err != nil {
+		t.Fatalf("failed to create VC simulator")
+	}
+	defer simr.Destroy()
+	defer clearSessionCache()
+
+	drainPeriod = 0
+	defer func() { drainPeriod = time.Minute }()
+
+	ctx := context.Background()
+	newParams := func() *Params {
+		return NewParams().WithServer(simr.ServerURL().Host)
+	}
+	isCached := func(params *Params) bool {
+		_, ok := sessionCache.Load(newCacheKey(params))
+		return ok
+	}
+
+	// The identities without username are told apart by the subject of their
+	// certificate or token.
+	certificate, privateKey := createTestKeyPair(t, "capv-solution-user")
+	solutionUser := newParams().WithCertificate(certificate, privateKey)
+	_, err = GetOrCreate(ctx, solutionUser)
+	g.Expect(err).ToNot(HaveOccurred())
+	otherCertificate, otherPrivateKey := createTestKeyPair(t, "other-solution-user")
+	otherSolutionUser := newParams().WithCertificate(otherCertificate, otherPrivateKey)
+	_, err = GetOrCreate(ctx, otherSolutionUser)
+	g.Expect(err).ToNot(HaveOccurred())
+	bearer := newParams().WithToken(simulatorToken(t, simr))
+	_, err = GetOrCreate(ctx, bearer)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(isCached(solutionUser)).To(BeTrue())
+	g.Expect(isCached(otherSolutionUser)).To(BeTrue())
+	g.Expect(isCached(bearer)).To(BeTrue())
+
+	// The sessions created with the previous keypair of the solution user are
+	// drained once it is rotated.
+	rotatedCertificate, rotatedPrivateKey := createTestKeyPair(t, "capv-solution-user")
+	rotated := newParams().WithCertificate(rotatedCertificate, rotatedPrivateKey)
+	_, err = GetOrCreate(ctx, rotated)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(isCached(solutionUser)).To(BeFalse())
+	g.Expect(isCached(otherSolutionUser)).To(BeTrue())
+	g.Expect(isCached(bearer)).To(BeTrue())
+}
+
+func TestParamsSubject(t *testing.T) {
+	g := NewWithT(t)
+
+	certificate, privateKey := createTestKeyPair(t, "capv-solution-user")
+	g.Expect(NewParams().WithUserInfo("user", "password").subject()).To(Equal("user"))
+	g.Expect(NewParams().WithCertificate(certificate, privateKey).subject()).To(Equal("certificate:CN=capv-solution-user"))
+	g.Expect(NewParams().WithToken(`<saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion"><saml2:Subject><saml2:NameID>user@vsphere.local</saml2:NameID></saml2:Subject></saml2:Assertion>`).subject()).To(Equal("token:user@vsphere.local"))
+
+	// The keypairs and tokens which cannot be parsed have distinct subjects.
+	g.Expect(NewParams().WithCertificate("invalid", "").subject()).NotTo(Equal(NewParams().WithCertificate("other", "").subject()))
+	g.Expect(NewParams().WithToken("invalid").subject()).NotTo(Equal(NewParams().WithToken("other").subject()))
+}
+
+// simulatorToken returns a bearer token issued by the STS of the simulator.
+func simulatorToken(t *testing.T, simr *vcsim.Simulator) string {
+	t.Helper()
+
+	ctx := context.Background()
+	soapURL := simr.ServerURL()
+	soapURL.User = nil
+	vimClient, err := vim25.NewClient(ctx, soap.NewClient(soapURL, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stsClient, err := sts.NewClient(ctx, vimClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := stsClient.Issue(ctx, sts.TokenRequest{Userinfo: url.UserPassword(simr.Username(), simr.Password())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.Token
+}
+
+// clearSessionCache logs out and removes the cached sessions, so that each
+// test case creates its own session.
+func clearSessionCache() {
+	Clear()
+	sessionCache.Range(func(key, _ any) bool {
+		sessionCache.Delete(key)
+		return true
+	})
+}
+
+func createTestKeyPair(t *testing.T, commonName string) (certificate, privateKey string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	privateKey = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certificate, privateKey
+}
+
+func createTestCABundle(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
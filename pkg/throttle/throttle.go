@@ -0,0 +1,220 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package throttle limits the rate and the number of the vCenter tasks
+// started by CAPV on each vCenter server.
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/metrics"
+)
+
+const (
+	// RequeueAfter is the interval at which the VSphereVMs waiting for the
+	// capacity of their vCenter are reconciled again.
+	RequeueAfter = 10 * time.Second
+
+	// waitingTimeout is the time after which a VSphereVM which did not try
+	// to start its task again is no longer waiting, for example because it
+	// was deleted.
+	waitingTimeout = 6 * RequeueAfter
+
+	// inFlightTimeout is the time after which a task is no longer counted as
+	// in flight if it was not released, for example because its VSphereVM
+	// was force-deleted.
+	inFlightTimeout = time.Hour
+)
+
+// Priority is the priority of a task. The tasks with the lowest priority are
+// started first.
+type Priority int
+
+const (
+	// PriorityControlPlane is the priority of the tasks of the control
+	// plane machines.
+	PriorityControlPlane Priority = iota
+
+	// PriorityWorker is the priority of the tasks of the worker machines.
+	PriorityWorker
+)
+
+// Options are the limits of the tasks started on each vCenter server.
+type Options struct {
+	// QPS is the number of tasks per second which can be started on a
+	// vCenter server. The rate is not limited if zero.
+	QPS float64
+
+	// Burst is the number of tasks which can be started at once on a vCenter
+	// server when the rate is limited.
+	Burst int
+
+	// MaxInFlight is the maximum number of tasks running at the same time on
+	// a vCenter server. The number of tasks is not limited if zero.
+	MaxInFlight int
+}
+
+// TaskLimiter limits the tasks started on each vCenter server. The tasks
+// which cannot be started yet are queued by priority, then by the time they
+// were first tried.
+//
+// The tasks are identified by the key of their VSphereVM. A task is started
+// once Acquire returns true for it, and must be released with Release once
+// it completes. A nil TaskLimiter does not limit anything.
+type TaskLimiter struct {
+	options Options
+
+	mu      sync.Mutex
+	servers map[string]*server
+
+	// now returns the current time, and is replaced in tests.
+	now func() time.Time
+}
+
+// server is the state of the tasks of a vCenter server.
+type server struct {
+	limiter  *rate.Limiter
+	inFlight map[string]time.Time
+	waiting  map[string]*waiter
+}
+
+// waiter is a task waiting to be started.
+type waiter struct {
+	priority Priority
+	since    time.Time
+	lastSeen time.Time
+}
+
+// NewTaskLimiter returns a TaskLimiter with the given limits.
+func NewTaskLimiter(options Options) *TaskLimiter {
+	if options.Burst < 1 {
+		options.Burst = 1
+	}
+	return &TaskLimiter{
+		options: options,
+		servers: map[string]*server{},
+		now:     time.Now,
+	}
+}
+
+// Acquire returns whether the task of the VSphereVM with the given key can be
+// started on the vCenter server. Otherwise the task is queued, and Acquire
+// must be called again later to keep it in the queue.
+func (l *TaskLimiter) Acquire(serverName, key string, priority Priority) bool {
+	if l == nil || (l.options.QPS <= 0 && l.options.MaxInFlight <= 0) {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.getServer(serverName)
+	now := l.now()
+	s.expire(now)
+	if _, ok := s.inFlight[key]; ok {
+		return true
+	}
+
+	w, ok := s.waiting[key]
+	if !ok {
+		w = &waiter{since: now}
+		s.waiting[key] = w
+	}
+	w.priority = priority
+	w.lastSeen = now
+	defer func() { metrics.TasksWaiting.WithLabelValues(serverName).Set(float64(len(s.waiting))) }()
+
+	// Only the tasks at the head of the queue can take the available slots,
+	// so that the tasks with a higher priority are started first.
+	slots := len(s.waiting)
+	if l.options.MaxInFlight > 0 {
+		slots = min(slots, l.options.MaxInFlight-len(s.inFlight))
+	}
+	if s.limiter != nil {
+		slots = min(slots, int(s.limiter.TokensAt(now)))
+	}
+	if s.rank(key, w) >= slots || (s.limiter != nil && !s.limiter.AllowN(now, 1)) {
+		return false
+	}
+
+	delete(s.waiting, key)
+	s.inFlight[key] = now
+	return true
+}
+
+// Release releases the in-flight task of the VSphereVM with the given key
+// once it completed. A queued task is dropped once it is no longer tried.
+func (l *TaskLimiter) Release(serverName, key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.servers[serverName]; ok {
+		delete(s.inFlight, key)
+	}
+}
+
+func (l *TaskLimiter) getServer(serverName string) *server {
+	if s, ok := l.servers[serverName]; ok {
+		return s
+	}
+	s := &server{
+		inFlight: map[string]time.Time{},
+		waiting:  map[string]*waiter{},
+	}
+	if l.options.QPS > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(l.options.QPS), l.options.Burst)
+	}
+	l.servers[serverName] = s
+	return s
+}
+
+// expire drops the tasks which were not released or tried again in time.
+func (s *server) expire(now time.Time) {
+	for key, since := range s.inFlight {
+		if now.Sub(since) > inFlightTimeout {
+			delete(s.inFlight, key)
+		}
+	}
+	for key, w := range s.waiting {
+		if now.Sub(w.lastSeen) > waitingTimeout {
+			delete(s.waiting, key)
+		}
+	}
+}
+
+// rank returns the number of tasks queued before the given task.
+func (s *server) rank(key string, w *waiter) int {
+	rank := 0
+	for otherKey, other := range s.waiting {
+		if otherKey == key {
+			continue
+		}
+		if other.priority < w.priority ||
+			(other.priority == w.priority && other.since.Before(w.since)) ||
+			(other.priority == w.priority && other.since.Equal(w.since) && otherKey < key) {
+			rank++
+		}
+	}
+	return rank
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func newTestTaskLimiter(options Options) (*TaskLimiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewTaskLimiter(options)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestTaskLimiter_Unlimited(t *testing.T) {
+	g := NewWithT(t)
+
+	var nilLimiter *TaskLimiter
+	g.Expect(nilLimiter.Acquire("vcenter", "ns/vm", PriorityWorker)).To(BeTrue())
+	nilLimiter.Release("vcenter", "ns/vm")
+
+	l := NewTaskLimiter(Options{})
+	for _, key := range []string{"ns/vm-0", "ns/vm-1", "ns/vm-2"} {
+		g.Expect(l.Acquire("vcenter", key, PriorityWorker)).To(BeTrue())
+	}
+}
+
+func TestTaskLimiter_MaxInFlight(t *testing.T) {
+	g := NewWithT(t)
+	l, now := newTestTaskLimiter(Options{MaxInFlight: 2})
+
+	g.Expect(l.Acquire("vcenter", "ns/worker-0", PriorityWorker)).To(BeTrue())
+	g.Expect(l.Acquire("vcenter", "ns/worker-1", PriorityWorker)).To(BeTrue())
+	g.Expect(l.Acquire("vcenter", "ns/worker-2", PriorityWorker)).To(BeFalse())
+
+	// An in-flight task can be acquired again.
+	g.Expect(l.Acquire("vcenter", "ns/worker-0", PriorityWorker)).To(BeTrue())
+
+	// The limits apply to each vCenter server.
+	g.Expect(l.Acquire("other-vcenter", "ns/worker-3", PriorityWorker)).To(BeTrue())
+
+	// The control plane machines are dequeued before the workers which were
+	// queued earlier.
+	*now = now.Add(time.Second)
+	g.Expect(l.Acquire("vcenter", "ns/control-plane-0", PriorityControlPlane)).To(BeFalse())
+	l.Release("vcenter", "ns/worker-0")
+	g.Expect(l.Acquire("vcenter", "ns/worker-2", PriorityWorker)).To(BeFalse())
+	g.Expect(l.Acquire("vcenter", "ns/control-plane-0", PriorityControlPlane)).To(BeTrue())
+
+	// The workers are dequeued in order.
+	*now = now.Add(time.Second)
+	g.Expect(l.Acquire("vcenter", "ns/worker-4", PriorityWorker)).To(BeFalse())
+	l.Release("vcenter", "ns/worker-1")
+	g.Expect(l.Acquire("vcenter", "ns/worker-4", PriorityWorker)).To(BeFalse())
+	g.Expect(l.Acquire("vcenter", "ns/worker-2", PriorityWorker)).To(BeTrue())
+
+	// A queued task which is no longer tried is dropped from the queue.
+	l.Release("vcenter", "ns/worker-2")
+	*now = now.Add(waitingTimeout + time.Second)
+	g.Expect(l.Acquire("vcenter", "ns/worker-5", PriorityWorker)).To(BeTrue())
+
+	// An in-flight task which is never released is eventually dropped.
+	g.Expect(l.Acquire("vcenter", "ns/worker-6", PriorityWorker)).To(BeFalse())
+	*now = now.Add(inFlightTimeout + time.Second)
+	g.Expect(l.Acquire("vcenter", "ns/worker-6", PriorityWorker)).To(BeTrue())
+}
+
+func TestTaskLimiter_QPS(t *testing.T) {
+	g := NewWithT(t)
+	l, now := newTestTaskLimiter(Options{QPS: 1, Burst: 2})
+
+	g.Expect(l.Acquire("vcenter", "ns/worker-0", PriorityWorker)).To(BeTrue())
+	g.Expect(l.Acquire("vcenter", "ns/worker-1", PriorityWorker)).To(BeTrue())
+	g.Expect(l.Acquire("vcenter", "ns/worker-2", PriorityWorker)).To(BeFalse())
+	g.Expect(l.Acquire("vcenter", "ns/control-plane-0", PriorityControlPlane)).To(BeFalse())
+
+	// The next token goes to the control plane machine.
+	*now = now.Add(time.Second)
+	g.Expect(l.Acquire("vcenter", "ns/worker-2", PriorityWorker)).To(BeFalse())
+	g.Expect(l.Acquire("vcenter", "ns/control-plane-0", PriorityControlPlane)).To(BeTrue())
+
+	*now = now.Add(time.Second)
+	g.Expect(l.Acquire("vcenter", "ns/worker-2", PriorityWorker)).To(BeTrue())
+}